@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Batch collects sets to apply together, in order; see Handle.Batch.  It's
+// not safe for concurrent use.
+type Batch struct {
+	h     *Handle
+	props []Property
+}
+
+// BatchResult reports what became of each set of a batch.
+type BatchResult struct {
+	// Properties holds the status of each set, in the order they were
+	// added to the batch.
+	Properties []SetStatus
+
+	// Session is the session the sets were made in when they span
+	// components, or zero.
+	Session SessionID
+
+	// Committed reports whether every set was committed.
+	Committed bool
+}
+
+// Batch starts a batch of sets, added with Set and applied with Commit.
+func (h *Handle) Batch() *Batch {
+	return &Batch{h: h}
+}
+
+// Set adds the set of the named property to the value to the batch.
+func (b *Batch) Set(name string, value Value) *Batch {
+	b.props = append(b.props, Property{Name: name, Value: value})
+	return b
+}
+
+// Commit applies the sets of the batch.  The router is asked which component
+// owns each property, and the sets for the same component go in a single
+// request that commits, in the order they were added, like rbus_setMulti does.
+// The components are sent their requests in the order their first set was
+// added.
+//
+// When the sets span components, their requests carry the id of a session,
+// the one of the handle begun with BeginSession or else a new one, so the
+// providers can tell them apart from other sets; a new session is closed
+// once the requests are over.  Like in the C library, a request that commits
+// can't be rolled back: when a component rejects a set, the rest of the batch
+// isn't sent, but the components sent theirs before keep them.
+//
+// When a property has no component, nothing is sent and the error matches
+// ErrDestinationNotFound.  Otherwise the error is that of the first request
+// that failed; the result tells which sets were accepted, the one rejected,
+// and those not attempted.
+func (b *Batch) Commit(ctx context.Context) (BatchResult, error) {
+	h := b.h
+	result := BatchResult{Properties: make([]SetStatus, len(b.props))}
+	for i, p := range b.props {
+		result.Properties[i].Name = p.Name
+	}
+	if len(b.props) == 0 {
+		return result, nil
+	}
+
+	names := make([]string, len(b.props))
+	for i, p := range b.props {
+		names[i] = p.Name
+	}
+
+	components, err := h.DiscoverComponents(ctx, names...)
+	if err != nil {
+		return result, fmt.Errorf("batch: %w", err)
+	}
+
+	var missing []error
+	var order []string
+	groups := make(map[string][]int)
+	for i, name := range names {
+		component := components[name]
+		if component == "" {
+			missing = append(missing, &PropertyError{Name: name, Err: ErrDestinationNotFound})
+			continue
+		}
+		if _, found := groups[component]; !found {
+			order = append(order, component)
+		}
+		groups[component] = append(groups[component], i)
+	}
+	if len(missing) > 0 {
+		return result, fmt.Errorf("batch: %w", errors.Join(missing...))
+	}
+
+	if len(order) == 1 {
+		err := b.send(ctx, &result, order[0], groups[order[0]])
+		result.Committed = err == nil
+		return result, err
+	}
+
+	h.m.Lock()
+	session := h.session
+	h.m.Unlock()
+
+	own := session == 0
+	if own {
+		if session, err = h.CreateSession(ctx); err != nil {
+			return result, fmt.Errorf("batch: %w", err)
+		}
+	}
+	result.Session = session
+
+	for _, component := range order {
+		err := b.send(ctx, &result, component, groups[component], WithSession(session))
+		if err == nil {
+			continue
+		}
+
+		if own {
+			if cerr := h.CloseSession(ctx, session); cerr != nil {
+				h.cfg.logger.WarnContext(ctx, "closing the session failed", "session", session, "error", cerr)
+			}
+		}
+		return result, err
+	}
+	result.Committed = true
+
+	if !own {
+		return result, nil
+	}
+
+	if err := h.CloseSession(ctx, session); err != nil {
+		return result, fmt.Errorf("batch: %w", err)
+	}
+
+	return result, nil
+}
+
+// send sets the properties at the indexes with a single request to the
+// component, recording their status in the result.
+func (b *Batch) send(ctx context.Context, result *BatchResult, component string, indexes []int, opts ...SetOption) error {
+	props := make([]Property, len(indexes))
+	for i, n := range indexes {
+		props[i] = b.props[n]
+	}
+
+	opts = append(opts, ToComponent(component))
+	got, err := b.h.SetProperties(ctx, props, opts...)
+	for i, n := range indexes {
+		if i < len(got.Properties) {
+			result.Properties[n] = got.Properties[i]
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("batch: %w", err)
+	}
+
+	return nil
+}
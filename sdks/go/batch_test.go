@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// batchBus has two providers, wifi and radio, each with its setter.
+type batchBus struct {
+	sm       *sessionManager
+	consumer *rbus.Handle
+	wifi     *setter
+	radio    *setter
+}
+
+func newBatchBus(t *testing.T, reject map[string]rbus.ErrorCode) *batchBus {
+	t.Helper()
+
+	_, url := newRouter(t)
+	b := batchBus{
+		sm:    newSessionManager(t, url, 3),
+		wifi:  &setter{reject: reject},
+		radio: &setter{reject: reject},
+	}
+	b.wifi.register(t, openHandle(t, url, "wifi"), "Device.WiFi.SSID", "Device.WiFi.Enable")
+	b.radio.register(t, openHandle(t, url, "radio"), "Device.Radio.Channel")
+	b.consumer = openHandle(t, url, "consumer")
+
+	return &b
+}
+
+// ended returns the sessions ended with the session manager.
+func (b *batchBus) ended() []int32 {
+	b.sm.m.Lock()
+	defer b.sm.m.Unlock()
+
+	return b.sm.ended
+}
+
+func TestBatchSingleComponent(t *testing.T) {
+	b := newBatchBus(t, nil)
+
+	result, err := b.consumer.Batch().
+		Set("Device.WiFi.SSID", rbus.NewValue("home")).
+		Set("Device.WiFi.Enable", rbus.NewValue(true)).
+		Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single request, committing with the last value, in no session.
+	if got, want := b.wifi.took(), "[Device.WiFi.SSID=home Device.WiFi.Enable=true!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if !result.Committed || result.Session != 0 || len(b.ended()) != 0 {
+		t.Fatalf("got %+v, ended %v", result, b.ended())
+	}
+	for _, opts := range b.wifi.opts {
+		if opts.Session != 0 {
+			t.Fatalf("got %+v, want no session", opts)
+		}
+	}
+}
+
+func TestBatchMultiComponent(t *testing.T) {
+	b := newBatchBus(t, nil)
+
+	result, err := b.consumer.Batch().
+		Set("Device.WiFi.SSID", rbus.NewValue("home")).
+		Set("Device.Radio.Channel", rbus.NewValue(uint32(6))).
+		Set("Device.WiFi.Enable", rbus.NewValue(true)).
+		Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each component gets a request of its own that commits, in the
+	// session made for the batch.
+	if got, want := b.wifi.took(), "[Device.WiFi.SSID=home Device.WiFi.Enable=true!]"; got != want {
+		t.Fatalf("wifi got %s, want %s", got, want)
+	}
+	if got, want := b.radio.took(), "[Device.Radio.Channel=6!]"; got != want {
+		t.Fatalf("radio got %s, want %s", got, want)
+	}
+	for _, opts := range append(b.wifi.opts, b.radio.opts...) {
+		if opts.Session != 3 {
+			t.Fatalf("got %+v, want session 3", opts)
+		}
+	}
+
+	if !result.Committed || result.Session != 3 {
+		t.Fatalf("got %+v, want committed in session 3", result)
+	}
+	if ended := b.ended(); len(ended) != 1 || ended[0] != 3 {
+		t.Fatalf("got %v ended, want session 3", ended)
+	}
+
+	// The statuses are in the order of the sets.
+	names := []string{"Device.WiFi.SSID", "Device.Radio.Channel", "Device.WiFi.Enable"}
+	for i, status := range result.Properties {
+		if status.Name != names[i] || !status.Attempted || status.Code != 0 {
+			t.Fatalf("property %d: got %+v, want %s accepted", i, status, names[i])
+		}
+	}
+}
+
+func TestBatchMultiComponentRejected(t *testing.T) {
+	b := newBatchBus(t, map[string]rbus.ErrorCode{"Device.Radio.Channel": rbus.ErrInvalidParameterValue})
+
+	result, err := b.consumer.Batch().
+		Set("Device.WiFi.SSID", rbus.NewValue("home")).
+		Set("Device.Radio.Channel", rbus.NewValue(uint32(99))).
+		Set("Device.WiFi.Enable", rbus.NewValue(true)).
+		Commit(context.Background())
+
+	var pe *rbus.PropertyError
+	if !errors.As(err, &pe) || pe.Name != "Device.Radio.Channel" || !errors.Is(err, rbus.ErrInvalidParameterValue) {
+		t.Fatalf("got %v, want the channel rejected", err)
+	}
+
+	// The component sent its sets first keeps them.
+	if got, want := b.wifi.took(), "[Device.WiFi.SSID=home Device.WiFi.Enable=true!]"; got != want {
+		t.Fatalf("wifi got %s, want %s", got, want)
+	}
+	if result.Committed {
+		t.Fatal("committed")
+	}
+	if got := result.Properties[1]; !got.Attempted || got.Code != rbus.ErrInvalidParameterValue {
+		t.Fatalf("got %+v, want the channel rejected", got)
+	}
+	if ended := b.ended(); len(ended) != 1 || ended[0] != 3 {
+		t.Fatalf("got %v ended, want session 3", ended)
+	}
+}
+
+func TestBatchHandleSession(t *testing.T) {
+	b := newBatchBus(t, nil)
+
+	ctx := context.Background()
+	id, err := b.consumer.BeginSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := b.consumer.Batch().
+		Set("Device.WiFi.SSID", rbus.NewValue("home")).
+		Set("Device.Radio.Channel", rbus.NewValue(uint32(6))).
+		Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session of the handle is left for the caller to close.
+	if !result.Committed || result.Session != id || len(b.ended()) != 0 {
+		t.Fatalf("got %+v, ended %v", result, b.ended())
+	}
+	if err := b.consumer.CommitSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchNoComponent(t *testing.T) {
+	b := newBatchBus(t, nil)
+
+	result, err := b.consumer.Batch().
+		Set("Device.WiFi.SSID", rbus.NewValue("home")).
+		Set("Device.Nobody.Name", rbus.NewValue("x")).
+		Commit(context.Background())
+
+	var pe *rbus.PropertyError
+	if !errors.As(err, &pe) || pe.Name != "Device.Nobody.Name" || !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v for Device.Nobody.Name", err, rbus.ErrDestinationNotFound)
+	}
+	if got := b.wifi.took(); got != "[]" || result.Committed {
+		t.Fatalf("got %s set, %+v", got, result)
+	}
+}
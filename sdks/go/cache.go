@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// subtreeCache caches the results of subtree gets by name.  Concurrent
+// callers asking for the same name while a fetch is in flight wait for that
+// fetch rather than issuing their own.  The entries that expired are removed
+// whenever a fetch starts, so those of names not asked for again don't
+// accumulate.
+type subtreeCache struct {
+	m       sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	ready   chan struct{}
+	props   []Property
+	err     error
+	expires time.Time
+
+	// abandoned is set when the fetch failed because the context of the
+	// caller that made it was done, which says nothing about the others.
+	abandoned bool
+}
+
+// get returns the cached properties for name, calling fetch when there is no
+// unexpired entry.  Errors are returned to every caller waiting on the fetch
+// but are never cached.  The fetch runs with the context of the caller that
+// started it; when that context is done first, the callers waiting on the
+// fetch try again rather than fail with it.
+func (c *subtreeCache) get(ctx context.Context, name string, ttl time.Duration,
+	fetch func(context.Context) ([]Property, error)) ([]Property, error) {
+	for {
+		c.m.Lock()
+		if c.entries == nil {
+			c.entries = make(map[string]*cacheEntry)
+		}
+
+		e, ok := c.entries[name]
+		if !ok {
+			break
+		}
+
+		select {
+		case <-e.ready:
+			if time.Now().Before(e.expires) {
+				c.m.Unlock()
+				return slices.Clone(e.props), nil
+			}
+		default:
+			c.m.Unlock()
+			select {
+			case <-e.ready:
+				if e.abandoned {
+					continue
+				}
+				return slices.Clone(e.props), e.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		break
+	}
+
+	// A fetch is a round trip to the bus, next to which going through the
+	// entries costs little.
+	c.sweepLocked(time.Now())
+
+	e := &cacheEntry{
+		ready: make(chan struct{}),
+	}
+	c.entries[name] = e
+	c.m.Unlock()
+
+	props, err := fetch(ctx)
+
+	c.m.Lock()
+	e.props = props
+	e.err = err
+	e.expires = time.Now().Add(ttl)
+	e.abandoned = err != nil && ctx.Err() != nil
+	if err != nil && c.entries[name] == e {
+		delete(c.entries, name)
+	}
+	close(e.ready)
+	c.m.Unlock()
+
+	return slices.Clone(props), err
+}
+
+// sweepLocked removes the entries whose fetch is done and that expired by now.
+// The caller must hold c.m.
+func (c *subtreeCache) sweepLocked(now time.Time) {
+	for name, e := range c.entries {
+		select {
+		case <-e.ready:
+			if !now.Before(e.expires) {
+				delete(c.entries, name)
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetch returns a fetch that counts its calls and, after telling
+// entered, blocks until release is closed or the context is done.
+func countingFetch(calls *atomic.Int32, entered chan<- struct{}, release <-chan struct{}) func(context.Context) ([]Property, error) {
+	return func(ctx context.Context) ([]Property, error) {
+		calls.Add(1)
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-release:
+			return []Property{{Name: "Device.Test.X", Value: NewValue(int32(5))}}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestSubtreeCacheShared(t *testing.T) {
+	var c subtreeCache
+	var calls atomic.Int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	fetch := countingFetch(&calls, entered, release)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	get := func() {
+		defer wg.Done()
+		props, err := c.get(context.Background(), "Device.Test.", time.Hour, fetch)
+		if err == nil && (len(props) != 1 || props[0].Value.String() != "5") {
+			err = fmt.Errorf("got %v, want Device.Test.X=5", props)
+		}
+		errs <- err
+	}
+
+	wg.Add(callers)
+	go get()
+	<-entered
+	for range callers - 1 {
+		go get()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("got %d fetches, want 1", got)
+	}
+
+	// Within the TTL the result is served from the cache, and a caller
+	// changing it doesn't change the cache.
+	props, err := c.get(context.Background(), "Device.Test.", time.Hour, fetch)
+	if err != nil || calls.Load() != 1 {
+		t.Fatalf("got %v after %d fetches, want 1", err, calls.Load())
+	}
+	props[0].Name = "changed"
+	if props, _ := c.get(context.Background(), "Device.Test.", time.Hour, fetch); props[0].Name != "Device.Test.X" {
+		t.Fatalf("got %s, want the cached name", props[0].Name)
+	}
+
+	// Once it expired, it's fetched again.
+	if _, err := c.get(context.Background(), "Device.Other.", 0, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.get(context.Background(), "Device.Other.", time.Hour, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("got %d fetches, want 3", got)
+	}
+}
+
+func TestSubtreeCacheErrorsNotCached(t *testing.T) {
+	var c subtreeCache
+	calls := 0
+	fetch := func(context.Context) ([]Property, error) {
+		calls++
+		if calls == 1 {
+			return nil, ErrTimeout
+		}
+		return []Property{{Name: "Device.Test.X"}}, nil
+	}
+
+	if _, err := c.get(context.Background(), "Device.Test.", time.Hour, fetch); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want %v", err, ErrTimeout)
+	}
+	if props, err := c.get(context.Background(), "Device.Test.", time.Hour, fetch); err != nil || len(props) != 1 {
+		t.Fatalf("got %v and %v, want the property", props, err)
+	}
+	if calls != 2 {
+		t.Fatalf("got %d fetches, want 2", calls)
+	}
+}
+
+func TestSubtreeCacheLeaderCanceled(t *testing.T) {
+	var c subtreeCache
+	var calls atomic.Int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	fetch := countingFetch(&calls, entered, release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.get(ctx, "Device.Test.", time.Hour, fetch)
+		leader <- err
+	}()
+	<-entered
+
+	waiter := make(chan error, 1)
+	go func() {
+		props, err := c.get(context.Background(), "Device.Test.", time.Hour, fetch)
+		if err == nil && len(props) != 1 {
+			err = errors.New("no property")
+		}
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The caller that started the fetch gives up, the one waiting on it
+	// fetches again.
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-entered:
+	case err := <-waiter:
+		t.Fatalf("got %v, want the waiter to fetch again", err)
+	}
+	close(release)
+	if err := <-waiter; err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("got %d fetches, want 2", got)
+	}
+}
+
+func TestSubtreeCacheWaiterCanceled(t *testing.T) {
+	var c subtreeCache
+	var calls atomic.Int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	fetch := countingFetch(&calls, entered, release)
+
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.get(context.Background(), "Device.Test.", time.Hour, fetch)
+		leader <- err
+	}()
+	<-entered
+
+	// A waiter giving up leaves the fetch alone.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.get(ctx, "Device.Test.", time.Hour, fetch); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	if err := <-leader; err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("got %d fetches, want 1", got)
+	}
+}
+
+func TestSubtreeCacheSweep(t *testing.T) {
+	var c subtreeCache
+	fetch := func(context.Context) ([]Property, error) {
+		return []Property{{Name: "Device.Test.X"}}, nil
+	}
+
+	if _, err := c.get(context.Background(), "Device.Kept.", time.Hour, fetch); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 10 {
+		if _, err := c.get(context.Background(), fmt.Sprintf("Device.Test.%d.", i), 0, fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The next fetch removes the entries that expired, and only those.
+	if _, err := c.get(context.Background(), "Device.Other.", time.Hour, fetch); err != nil {
+		t.Fatal(err)
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if got := len(c.entries); got != 2 {
+		t.Fatalf("got %d entries, want 2", got)
+	}
+	for _, name := range []string{"Device.Kept.", "Device.Other."} {
+		if _, found := c.entries[name]; !found {
+			t.Fatalf("got no entry for %s", name)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// component is the component providing an element, as printed with -json.
+type component struct {
+	Name      string `json:"name"`
+	Component string `json:"component,omitempty"`
+}
+
+// element is an element of the data model, as printed with -json.
+type element struct {
+	Name      string `json:"name"`
+	Component string `json:"component"`
+	Type      string `json:"type"`
+	Access    string `json:"access"`
+}
+
+func main() {
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "my_go_app", "the application name")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for the router")
+	var names []string
+	flag.Func("element", "an element to find the component of; can be repeated, like the arguments", func(s string) error {
+		names = append(names, s)
+		return nil
+	})
+	componentName := flag.String("component", "", "list the elements the component registered")
+	path := flag.String("path", "", "list the elements under the partial path, such as Device.WiFi.")
+	asJSON := flag.Bool("json", false, "print JSON rather than a table")
+	flag.Parse()
+
+	names = append(names, flag.Args()...)
+
+	modes := 0
+	for _, set := range []bool{len(names) > 0, *componentName != "", *path != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		fmt.Fprintln(os.Stderr, "usage: discover [flags] [-element] name ...")
+		fmt.Fprintln(os.Stderr, "       discover [flags] -component name")
+		fmt.Fprintln(os.Stderr, "       discover [flags] -path partial.path.")
+		os.Exit(2)
+	}
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
+	}
+	defer h.Close(context.Background())
+
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var failed bool
+	if len(names) > 0 {
+		failed = discoverComponents(ctx, h, names, *asJSON)
+	} else if *path != "" {
+		failed = discoverElements(ctx, h, strings.TrimSuffix(*path, ".")+".", *asJSON)
+	} else {
+		failed = discoverElements(ctx, h, *componentName, *asJSON)
+	}
+
+	if failed {
+		cancel()
+		h.Close(context.Background())
+		os.Exit(1)
+	}
+}
+
+// discoverComponents prints the component providing each of the elements,
+// reporting whether any has none.
+func discoverComponents(ctx context.Context, h *rbus.Handle, names []string, asJSON bool) bool {
+	components, err := h.DiscoverComponents(ctx, names...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return true
+	}
+
+	failed := false
+	list := make([]component, 0, len(names))
+	for _, name := range names {
+		if components[name] == "" {
+			fmt.Fprintf(os.Stderr, "%s: no component\n", name)
+			failed = true
+		}
+		list = append(list, component{Name: name, Component: components[name]})
+	}
+
+	if asJSON {
+		printJSON(list)
+		return failed
+	}
+
+	for _, c := range list {
+		if c.Component != "" {
+			fmt.Printf("%s: %s\n", c.Name, c.Component)
+		}
+	}
+	return failed
+}
+
+// discoverElements prints the elements of the component or under the partial
+// path, reporting whether the discovery failed.
+func discoverElements(ctx context.Context, h *rbus.Handle, componentOrPath string, asJSON bool) bool {
+	infos, err := h.DiscoverElements(ctx, componentOrPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+
+	list := make([]element, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, element{
+			Name:      info.Name,
+			Component: info.Component,
+			Type:      info.Type.String(),
+			Access:    info.Access.String(),
+		})
+	}
+
+	if asJSON {
+		printJSON(list)
+		return err != nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tACCESS\tCOMPONENT")
+	for _, e := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Name, e.Type, e.Access, e.Component)
+	}
+	w.Flush()
+
+	return err != nil
+}
+
+// printJSON prints the value as indented JSON.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
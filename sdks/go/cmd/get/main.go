@@ -1,31 +1,107 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
-	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/internal/rtmessage"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/cmd/internal/values"
 )
 
+// result is a value as printed with -json.
+type result struct {
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
 func main() {
-	url := "unix:///tmp/rtrouted"
-	appName := "my_go_app"
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "my_go_app", "the application name")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for the values")
+	asJSON := flag.Bool("json", false, "print a JSON object of the values by name")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: get [flags] name|partial.path. ...")
+		os.Exit(2)
+	}
+
+	// The names are fetched with a single request, and the partial paths
+	// each with their own.
+	var names, paths []string
+	for _, name := range flag.Args() {
+		if strings.HasSuffix(name, ".") || strings.Contains(name, "*") {
+			paths = append(paths, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
 
-	con, err := rtmessage.New(url, appName)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to create connection. %s", err.Error()))
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
 	}
+	defer h.Close(context.Background())
+
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var props []rbus.Property
+	var errs []error
 
-	if err := con.Connect(); err != nil {
-		panic(fmt.Sprintf("Failed to connect. %s", err.Error()))
+	// A name the provider of the first doesn't know is fetched on its own,
+	// so names spanning providers still work, and each failure is a
+	// *rbus.PropertyError naming the property.
+	if len(names) > 0 {
+		got, err := h.GetProperties(ctx, names...)
+		props = append(props, got...)
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	con.Add(rtmessage.MessageListenerFunc(func(msg rtmessage.Message) {
-		fmt.Printf("Received message: %s\n", string(msg.Payload))
-	}), "A.B.C")
+	for _, path := range paths {
+		got, err := h.GetWildcard(ctx, path)
+		props = append(props, got...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if *asJSON {
+		m := make(map[string]result, len(props))
+		for _, p := range props {
+			m[p.Name] = result{Type: p.Value.Type().String(), Value: values.Native(p.Value)}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(m)
+	} else {
+		for _, p := range props {
+			fmt.Printf("%s = %s (%s)\n", p.Name, p.Value, p.Value.Type())
+		}
+	}
 
-	// This is somewhat weird.
-	for {
-		time.Sleep(1 * time.Second)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		cancel()
+		h.Close(context.Background())
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,155 @@
+// Package values parses the type-tagged values the sample tools take on their
+// command lines, and converts values for printing as JSON.
+package values
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// Types lists the types Parse knows, for usage messages.  int, uint and float
+// are short for int32, uint32 and double.
+const Types = "bool|int|uint|float|string|datetime|bytes|int8|int16|int32|int64|uint8|uint16|uint32|uint64|single|double"
+
+// Parse parses the string into a value of the named type.  Integers can be
+// written in any base strconv.ParseInt knows, such as 0x10, datetimes as
+// RFC 3339, or 0000-00-00T00:00:00Z for the unknown time, and bytes as base64.
+func Parse(typ, s string) (rbus.Value, error) {
+	switch typ {
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return rbus.Value{}, err
+		}
+		return rbus.NewValue(b), nil
+	case "int8":
+		return parseInt[int8](s, 8)
+	case "int16":
+		return parseInt[int16](s, 16)
+	case "int", "int32":
+		return parseInt[int32](s, 32)
+	case "int64":
+		return parseInt[int64](s, 64)
+	case "uint8":
+		return parseUint[uint8](s, 8)
+	case "uint16":
+		return parseUint[uint16](s, 16)
+	case "uint", "uint32":
+		return parseUint[uint32](s, 32)
+	case "uint64":
+		return parseUint[uint64](s, 64)
+	case "single":
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return rbus.Value{}, err
+		}
+		return rbus.NewValue(float32(f)), nil
+	case "float", "double":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return rbus.Value{}, err
+		}
+		return rbus.NewValue(f), nil
+	case "string":
+		return rbus.NewValue(s), nil
+	case "datetime":
+		// The unknown time, as rbusValue_SetFromString takes it.
+		if strings.HasPrefix(s, "0000-") {
+			return rbus.NewTimeValue(time.Time{}), nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return rbus.Value{}, err
+		}
+		return rbus.NewTimeValue(t), nil
+	case "bytes":
+		return parseBytes(s)
+	}
+	return rbus.Value{}, fmt.Errorf("unknown type %s", typ)
+}
+
+// ParseTagged parses a value written type:value, such as "int32:7".
+func ParseTagged(s string) (rbus.Value, error) {
+	typ, value, found := strings.Cut(s, ":")
+	if !found {
+		return rbus.Value{}, fmt.Errorf("%q is not type:value", s)
+	}
+	return Parse(typ, value)
+}
+
+func parseInt[T int8 | int16 | int32 | int64](s string, bits int) (rbus.Value, error) {
+	i, err := strconv.ParseInt(s, 0, bits)
+	if err != nil {
+		return rbus.Value{}, err
+	}
+	return rbus.NewValue(T(i)), nil
+}
+
+func parseUint[T uint8 | uint16 | uint32 | uint64](s string, bits int) (rbus.Value, error) {
+	u, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return rbus.Value{}, err
+	}
+	return rbus.NewValue(T(u)), nil
+}
+
+// parseBytes parses base64, which may have the length prefix rbus.Value.String
+// writes, such as 3:AQID.
+func parseBytes(s string) (rbus.Value, error) {
+	n, data, found := strings.Cut(s, ":")
+	if !found {
+		data = s
+	}
+
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return rbus.Value{}, err
+	}
+	if found && n != strconv.Itoa(len(b)) {
+		return rbus.Value{}, fmt.Errorf("%q has %d bytes, not %s", s, len(b), n)
+	}
+	return rbus.NewValue(b), nil
+}
+
+// Native returns the value as the Go value encoding/json prints best.
+func Native(v rbus.Value) any {
+	switch v.Type() {
+	case rbus.ValueTypeBoolean:
+		b, _ := v.AsBool()
+		return b
+	case rbus.ValueTypeInt8, rbus.ValueTypeInt16, rbus.ValueTypeInt32, rbus.ValueTypeInt64:
+		i, _ := v.AsInt64()
+		return i
+	case rbus.ValueTypeByte, rbus.ValueTypeUInt8, rbus.ValueTypeUInt16, rbus.ValueTypeUInt32, rbus.ValueTypeUInt64:
+		u, _ := v.AsUint64()
+		return u
+	case rbus.ValueTypeSingle, rbus.ValueTypeDouble:
+		f, _ := v.AsFloat64()
+		return f
+	case rbus.ValueTypeBytes:
+		b, _ := v.AsBytes()
+		return b
+	case rbus.ValueTypeObject:
+		props, _ := v.AsObject()
+		return Map(props)
+	}
+	return v.String()
+}
+
+// Map returns the values of the properties by name, as Native returns them.
+func Map(props []rbus.Property) map[string]any {
+	if len(props) == 0 {
+		return nil
+	}
+
+	m := make(map[string]any, len(props))
+	for _, p := range props {
+		m[p.Name] = Native(p.Value)
+	}
+	return m
+}
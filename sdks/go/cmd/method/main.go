@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/cmd/internal/values"
+)
+
+func main() {
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "my_go_app", "the application name")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for the method to return")
+	async := flag.Bool("async", false, "call the method with InvokeAsync and wait for its outcome")
+	var in []rbus.Property
+	flag.Func("in", "an input parameter written name=type:value, such as count=int32:7; can be repeated", func(s string) error {
+		name, tagged, found := strings.Cut(s, "=")
+		if !found || name == "" {
+			return fmt.Errorf("%q is not name=type:value", s)
+		}
+		v, err := values.ParseTagged(tagged)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		in = append(in, rbus.Property{Name: name, Value: v})
+		return nil
+	})
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: method [flags] Device.X.Method()")
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
+	}
+	defer h.Close(context.Background())
+
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var out []rbus.Property
+	if *async {
+		type outcome struct {
+			out []rbus.Property
+			err error
+		}
+		done := make(chan outcome, 1)
+		err = h.InvokeAsync(ctx, name, in, func(out []rbus.Property, err error) {
+			done <- outcome{out: out, err: err}
+		})
+		if err == nil {
+			o := <-done
+			out, err = o.out, o.err
+		}
+	} else {
+		out, err = h.Invoke(ctx, name, in)
+	}
+
+	for _, p := range out {
+		fmt.Printf("%s = %s (%s)\n", p.Name, p.Value, p.Value.Type())
+	}
+
+	var code rbus.ErrorCode
+	switch {
+	case err == nil:
+		fmt.Println("return code: success (0)")
+		return
+	case errors.As(err, &code):
+		fmt.Printf("return code: %s (%d)\n", code, int32(code))
+	}
+
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	cancel()
+	h.Close(context.Background())
+	os.Exit(1)
+}
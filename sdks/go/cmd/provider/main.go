@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// prefix is the path of everything the provider registers, like that of the C
+// sampleProvider.
+const prefix = "Device.GoSampleProvider.AllTypes."
+
+const (
+	tableName  = prefix + "Table."
+	ticksName  = prefix + "Ticks"
+	methodName = prefix + "Echo()"
+)
+
+// parameter is a parameter of the provider with its initial value.
+type parameter struct {
+	name     string
+	value    rbus.Value
+	writable bool
+}
+
+// parameters has a parameter of each type, the booleans, strings, bytes,
+// datetimes and the widest numbers writable.
+var parameters = []parameter{
+	{name: "Boolean", value: rbus.NewValue(true), writable: true},
+	{name: "Int8", value: rbus.NewValue(int8(-8))},
+	{name: "UInt8", value: rbus.NewValue(uint8(8))},
+	{name: "Int16", value: rbus.NewValue(int16(-16))},
+	{name: "UInt16", value: rbus.NewValue(uint16(16))},
+	{name: "Int32", value: rbus.NewValue(int32(-32)), writable: true},
+	{name: "UInt32", value: rbus.NewValue(uint32(32)), writable: true},
+	{name: "Int64", value: rbus.NewValue(int64(-64)), writable: true},
+	{name: "UInt64", value: rbus.NewValue(uint64(64)), writable: true},
+	{name: "Single", value: rbus.NewValue(float32(1.5))},
+	{name: "Double", value: rbus.NewValue(2.5), writable: true},
+	{name: "String", value: rbus.NewValue("Go sample provider"), writable: true},
+	{name: "Bytes", value: rbus.NewValue([]byte("Go")), writable: true},
+	{name: "DateTime", value: rbus.NewTimeValue(time.Date(2024, time.January, 2, 3, 4, 5, 0, time.FixedZone("", -5*3600))), writable: true},
+}
+
+// rowElements are the elements of each row of the table with their initial
+// values, all writable.
+var rowElements = []parameter{
+	{name: "Name", value: rbus.NewValue("")},
+	{name: "Value", value: rbus.NewValue(int32(0))},
+}
+
+// store holds the values of the parameters and of the elements of the rows,
+// by full name.
+type store struct {
+	m      sync.Mutex
+	values map[string]rbus.Value
+}
+
+func (s *store) get(name string) (rbus.Value, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	v, found := s.values[name]
+	if !found {
+		return rbus.Value{}, rbus.ErrElementDoesNotExist
+	}
+	return v, nil
+}
+
+// set changes the value of the element, which keeps its type.
+func (s *store) set(name string, v rbus.Value) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	old, found := s.values[name]
+	if !found {
+		return rbus.ErrElementDoesNotExist
+	}
+	if v.Type() != old.Type() {
+		return fmt.Errorf("%w: %s is not %s", rbus.ErrInvalidParameterType, v.Type(), old.Type())
+	}
+	s.values[name] = v
+	return nil
+}
+
+// tick adds one to the number of ticks.
+func (s *store) tick() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	n, _ := s.values[ticksName].AsUint64()
+	s.values[ticksName] = rbus.NewValue(uint32(n + 1))
+}
+
+// addRow gives the elements of the row their initial values.
+func (s *store) addRow(row rbus.RowInfo) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, e := range rowElements {
+		s.values[row.Name+e.name] = e.value
+	}
+	return nil
+}
+
+// removeRow forgets the values of the elements of the row.
+func (s *store) removeRow(row rbus.RowInfo) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, e := range rowElements {
+		delete(s.values, row.Name+e.name)
+	}
+	return nil
+}
+
+// echo is the method returning its inputs.
+func echo(_ context.Context, in []rbus.Property) ([]rbus.Property, error) {
+	return in, nil
+}
+
+func main() {
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "GoSampleProvider", "the application name, the component the elements are registered for")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for the router")
+	interval := flag.Duration("interval", 5*time.Second, "how often "+ticksName+" is incremented, publishing a value change")
+	flag.Parse()
+
+	if *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "the interval must be positive")
+		os.Exit(2)
+	}
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
+	}
+	defer h.Close(context.Background())
+
+	s := &store{values: map[string]rbus.Value{
+		ticksName: rbus.NewValue(uint32(0)),
+	}}
+	get := func(_ context.Context, name string) (rbus.Value, error) {
+		return s.get(name)
+	}
+	set := func(_ context.Context, name string, v rbus.Value, _ rbus.SetHandlerOptions) error {
+		return s.set(name, v)
+	}
+
+	var elements []string
+	register := func(name string, cb rbus.ElementCallbacks) error {
+		if err := h.RegisterElement(name, cb); err != nil {
+			return err
+		}
+		elements = append(elements, name)
+		return nil
+	}
+
+	var errs []error
+	for _, p := range parameters {
+		s.values[prefix+p.name] = p.value
+
+		cb := rbus.ElementCallbacks{GetHandler: get}
+		if p.writable {
+			cb.SetHandler = set
+		}
+		errs = append(errs, register(prefix+p.name, cb))
+	}
+
+	errs = append(errs, h.RegisterTable(tableName, 0, rbus.TableCallbacks{
+		AddRow:    s.addRow,
+		RemoveRow: s.removeRow,
+	}))
+	for _, e := range rowElements {
+		errs = append(errs, register(tableName+"{i}."+e.name, rbus.ElementCallbacks{
+			GetHandler: get,
+			SetHandler: set,
+		}))
+	}
+
+	// The changes of the ticks are published when polled, which is often
+	// enough to see each.
+	errs = append(errs, register(ticksName, rbus.ElementCallbacks{GetHandler: get}))
+	errs = append(errs, h.EnableValueChangeDetection(ticksName, min(*interval, time.Second)))
+
+	errs = append(errs, h.RegisterMethod(methodName, echo))
+
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		h.Close(context.Background())
+		os.Exit(1)
+	}
+
+	fmt.Printf("serving %s* as %s, press Ctrl-C to stop\n", prefix, *appName)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	t := time.NewTicker(*interval)
+	defer t.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-t.C:
+			s.tick()
+		}
+	}
+
+	// There's no unregistering the table and the method, which Close stops
+	// serving as it removes the component from the bus.
+	for _, name := range elements {
+		if err := h.UnregisterElement(name); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+	}
+}
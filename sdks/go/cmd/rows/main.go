@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+func main() {
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "my_go_app", "the application name")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for each table")
+	recursive := flag.Bool("r", false, "also list the rows of the tables within the rows")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rows [flags] table. ...")
+		os.Exit(2)
+	}
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
+	}
+	defer h.Close(context.Background())
+
+	var opts []rbus.RowsOption
+	if *recursive {
+		opts = append(opts, rbus.RowsRecursive())
+	}
+
+	failed := false
+	for _, name := range flag.Args() {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		rows, err := h.GetRowNames(ctx, name, opts...)
+		cancel()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			failed = true
+			continue
+		}
+
+		for _, row := range rows {
+			if row.Alias == "" {
+				fmt.Println(row.Name)
+				continue
+			}
+			fmt.Printf("%s [%s]\n", row.Name, row.Alias)
+		}
+	}
+
+	if failed {
+		h.Close(context.Background())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/cmd/internal/values"
+)
+
+func main() {
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "my_go_app", "the application name")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for the set")
+	commit := flag.Bool("commit", true, "commit the value rather than stage it")
+	session := flag.Uint("session", 0, "the session to stage the value in, from CreateSession")
+	flag.Parse()
+
+	if flag.NArg() != 3 {
+		fmt.Fprintln(os.Stderr, "usage: set [flags] name "+values.Types+" value")
+		os.Exit(2)
+	}
+	name, typ := flag.Arg(0), flag.Arg(1)
+
+	v, err := values.Parse(typ, flag.Arg(2))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		os.Exit(2)
+	}
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
+	}
+	defer h.Close(context.Background())
+
+	opts := []rbus.SetOption{rbus.WithCommit(*commit)}
+	if *session != 0 {
+		opts = append(opts, rbus.WithSession(rbus.SessionID(*session)))
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	err = h.Set(ctx, name, v, opts...)
+	cancel()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		h.Close(context.Background())
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s = %s (%s)\n", name, v, v.Type())
+}
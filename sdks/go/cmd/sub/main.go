@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/cmd/internal/values"
+)
+
+// filterOps maps the operators of the -filter flag to theirs.
+var filterOps = map[string]rbus.FilterOp{
+	"gt": rbus.FilterGreaterThan,
+	"ge": rbus.FilterGreaterThanOrEqual,
+	"lt": rbus.FilterLessThan,
+	"le": rbus.FilterLessThanOrEqual,
+	"eq": rbus.FilterEqual,
+	"ne": rbus.FilterNotEqual,
+}
+
+// parseFilter parses a filter such as "gt:50".  The value is a number when
+// it parses as one, and a string otherwise.
+func parseFilter(s string) (rbus.SubOption, error) {
+	op, value, found := strings.Cut(s, ":")
+	if !found {
+		return nil, fmt.Errorf("filter %q is not op:value", s)
+	}
+
+	fop, found := filterOps[op]
+	if !found {
+		return nil, fmt.Errorf("unknown filter operator %q", op)
+	}
+
+	if i, err := strconv.ParseInt(value, 0, 64); err == nil {
+		return rbus.SubWithFilter(fop, rbus.NewValue(i)), nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return rbus.SubWithFilter(fop, rbus.NewValue(f)), nil
+	}
+	return rbus.SubWithFilter(fop, rbus.NewValue(value)), nil
+}
+
+// line is an event as printed.
+type line struct {
+	Name   string         `json:"name"`
+	Type   string         `json:"type"`
+	Time   time.Time      `json:"time"`
+	Values map[string]any `json:"values,omitempty"`
+}
+
+func main() {
+	url := flag.String("url", "unix:///tmp/rtrouted", "the router to connect to")
+	appName := flag.String("app", "my_go_app", "the application name")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for each subscribe")
+	interval := flag.Duration("interval", 0, "have the provider publish at this interval, in whole seconds")
+	filter := flag.String("filter", "", "publish only the values passing a filter such as gt:50 (gt, ge, lt, le, eq, ne)")
+	count := flag.Int("count", 0, "exit after this many events, or never when 0")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: sub [flags] name ...")
+		os.Exit(2)
+	}
+
+	var opts []rbus.SubOption
+	if *interval != 0 {
+		opts = append(opts, rbus.SubWithInterval(*interval))
+	}
+	if *filter != "" {
+		opt, err := parseFilter(*filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(2)
+		}
+		opts = append(opts, opt)
+	}
+
+	h, err := rbus.New(rbus.WithURL(*url), rbus.WithApplicationName(*appName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create handle: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err = h.Open(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open: %s\n", err)
+		os.Exit(1)
+	}
+	defer h.Close(context.Background())
+
+	// The events are printed by the main goroutine, which stops taking them
+	// once done.
+	events := make(chan line, 64)
+	done := make(chan struct{})
+	handler := func(e rbus.Event) {
+		l := line{
+			Name:   e.Name,
+			Type:   e.Type.String(),
+			Time:   time.Now(),
+			Values: values.Map(e.Data),
+		}
+		select {
+		case events <- l:
+		case <-done:
+		}
+	}
+
+	var subs []*rbus.Subscription
+	for _, name := range flag.Args() {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		sub, err := h.Subscribe(ctx, name, handler, opts...)
+		cancel()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			for _, sub := range subs {
+				_ = sub.Close()
+			}
+			h.Close(context.Background())
+			os.Exit(1)
+		}
+		subs = append(subs, sub)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+loop:
+	for n := 0; *count == 0 || n < *count; n++ {
+		select {
+		case <-ctx.Done():
+			break loop
+		case l := <-events:
+			_ = enc.Encode(l)
+		}
+	}
+	close(done)
+
+	for _, sub := range subs {
+		if err := sub.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+func TestConcurrentRequests(t *testing.T) {
+	const (
+		callers = 100
+		calls   = 100
+	)
+
+	values := make(map[string]rbus.Value, callers)
+	for g := range callers {
+		values[fmt.Sprintf("Device.Test.%d", g)] = rbus.NewValue("")
+	}
+	b := newBroker(t, values)
+
+	// The slow method answers later on, holding up no other call.  Its
+	// answers are counted, as a call given up on before it was sent gets
+	// none.
+	var gaveUp, answered atomic.Uint64
+	err := b.AddMethod("Device.Test.Echo()", echo)
+	if err == nil {
+		err = b.AddMethod("Device.Test.Slow()", func(ctx context.Context, in []rbus.Property) ([]rbus.Property, error) {
+			reply := rbus.MethodReply(ctx)
+			time.AfterFunc(300*time.Millisecond, func() {
+				answered.Add(1)
+				reply(echo(ctx, in))
+			})
+			return nil, rbus.ErrAsyncResponse
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection is the test's, so its statistics can be looked at.
+	con, err := rtmessage.New(b.URL(), "consumer", rtmessage.WithInbox("consumer.INBOX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = con.Close() })
+	h, err := rbus.New(rbus.WithApplicationName("consumer"), rbus.WithTransport(con))
+	if err == nil {
+		err = h.Open(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close(context.Background()) })
+
+	// Each caller sets, gets and echoes values of its own, so a response
+	// handed to another caller shows up as the wrong value.  Midway, every
+	// tenth caller gives up on a slow method, whose response comes late.
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for g := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := context.Background()
+			name := fmt.Sprintf("Device.Test.%d", g)
+			for i := range calls {
+				want := fmt.Sprintf("%d-%d", g, i)
+				var got string
+				var err error
+				switch {
+				case g%10 == 0 && i == calls/2:
+					short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+					_, err = h.Invoke(short, "Device.Test.Slow()", nil)
+					cancel()
+					if errors.Is(err, context.DeadlineExceeded) {
+						gaveUp.Add(1)
+						continue
+					}
+					err = fmt.Errorf("slow call: got %w, want %w", err, context.DeadlineExceeded)
+				case i%3 == 0:
+					if err = h.Set(ctx, name, rbus.NewValue(want)); err == nil {
+						got, err = h.GetString(ctx, name)
+					}
+				default:
+					var out []rbus.Property
+					out, err = h.Invoke(ctx, "Device.Test.Echo()", []rbus.Property{{Name: "in", Value: rbus.NewValue(want)}})
+					got = list(out)
+					want = "[out.in=" + want + "]"
+				}
+				if err == nil && got != want {
+					err = fmt.Errorf("got %s, want %s", got, want)
+				}
+				if err != nil {
+					errs <- fmt.Errorf("caller %d, call %d: %w", g, i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	// The response of each call given up on is counted once it comes, and
+	// goes to nobody.
+	deadline := time.Now().Add(5 * time.Second)
+	for con.Stats().LateResponses < gaveUp.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got, want := con.Stats().LateResponses, answered.Load()
+	if got != want || want == 0 {
+		t.Fatalf("got %d late responses, want %d", got, want)
+	}
+}
+
+func TestHandlesInboxes(t *testing.T) {
+	const calls = 100
+
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.A": rbus.NewValue("a"),
+		"Device.Test.B": rbus.NewValue("b"),
+	})
+
+	// The handles are in the same process and share the router.
+	hs := []*rbus.Handle{
+		openHandle(t, b.URL(), "consumer-a"),
+		openHandle(t, b.URL(), "consumer-b"),
+	}
+	if hs[0].Inbox() == hs[1].Inbox() {
+		t.Fatalf("got the inbox %s for both handles", hs[0].Inbox())
+	}
+
+	// Each handle gets a value of its own, so a response delivered to the
+	// other handle shows up as the wrong value.
+	var wg sync.WaitGroup
+	errs := make(chan error, len(hs))
+	for i, h := range hs {
+		name, want := "Device.Test.A", "a"
+		if i == 1 {
+			name, want = "Device.Test.B", "b"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range calls {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				got, err := h.GetString(ctx, name)
+				cancel()
+				if err == nil && got != want {
+					err = fmt.Errorf("got %s, want %s", got, want)
+				}
+				if err != nil {
+					errs <- fmt.Errorf("handle %d: %w", i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// dateTimeSize is the size of rbusDateTime_t: the nine int32 fields of
+// struct tm32, the hours and minutes of the time zone, and the isWest bool
+// padded to 4 bytes.
+const dateTimeSize = 48
+
+// unknownTime is how rbus writes its unknown time, a rbusDateTime_t of zeros.
+const unknownTime = "0000-00-00T00:00:00Z"
+
+// dateTime is the variant of a datetime value.
+type dateTime struct {
+	t time.Time
+}
+
+func (d dateTime) isVariant() {}
+
+func (d dateTime) get() any {
+	return d.t
+}
+
+// String formats the time as RFC 3339, or the unknown time the way
+// rbusValue_ToString does.
+func (d dateTime) String() string {
+	if d.t.IsZero() {
+		return unknownTime
+	}
+	return d.t.Format(time.RFC3339)
+}
+
+// NewTimeValue returns a datetime value holding the time.  The time keeps its
+// offset from UTC but not its location, and loses its fraction of a second on
+// the wire.  The zero time.Time is the unknown time of rbus, which C providers
+// write as 0000-00-00T00:00:00Z.
+func NewTimeValue(t time.Time) Value {
+	return Value{dateTime{t: t}}
+}
+
+// AsTime returns the time of a datetime.  No other type converts to a time.
+func (val Value) AsTime() (time.Time, error) {
+	if v, ok := val.Value.(dateTime); ok {
+		return v.t, nil
+	}
+	return time.Time{}, val.mismatch("a time")
+}
+
+// marshal returns the rbusDateTime_t of the time, in the little-endian byte
+// order of the devices, the way rbusValue_appendToMessage writes it.  The
+// offset of the time is truncated to whole minutes, as rbusTimeZone_t has no
+// seconds.
+func (d dateTime) marshal() []byte {
+	b := make([]byte, dateTimeSize)
+	if d.t.IsZero() {
+		return b
+	}
+
+	t := d.t
+	_, offset := t.Zone()
+	if offset%60 != 0 {
+		offset = offset / 60 * 60
+		t = t.In(time.FixedZone("", offset))
+	}
+
+	year, month, day := t.Date()
+	hour, minute, sec := t.Clock()
+	isDST := 0
+	if t.IsDST() {
+		isDST = 1
+	}
+
+	west := offset < 0
+	if west {
+		offset = -offset
+	}
+
+	for i, v := range []int{
+		sec, minute, hour, day, int(month) - 1, year - 1900,
+		int(t.Weekday()), t.YearDay() - 1, isDST,
+		offset / 3600, offset / 60 % 60,
+	} {
+		binary.LittleEndian.PutUint32(b[i*4:], uint32(int32(v)))
+	}
+	if west {
+		b[44] = 1
+	}
+
+	return b
+}
+
+// unmarshalDateTime decodes the rbusDateTime_t marshal writes.  The time is
+// in a fixed zone of the offset it was written with, or in UTC when that's
+// none.  Out of range fields are normalized as time.Date does.
+func unmarshalDateTime(b []byte) (time.Time, error) {
+	if len(b) != dateTimeSize {
+		return time.Time{}, fmt.Errorf("datetime of length %d", len(b))
+	}
+
+	zero := true
+	for _, c := range b {
+		if c != 0 {
+			zero = false
+			break
+		}
+	}
+	if zero {
+		return time.Time{}, nil
+	}
+
+	field := func(i int) int {
+		return int(int32(binary.LittleEndian.Uint32(b[i*4:])))
+	}
+
+	offset := field(9)*3600 + field(10)*60
+	if b[44] != 0 {
+		offset = -offset
+	}
+
+	loc := time.UTC
+	if offset != 0 {
+		loc = time.FixedZone("", offset)
+	}
+
+	return time.Date(field(5)+1900, time.Month(field(4)+1), field(3),
+		field(2), field(1), field(0), 0, loc), nil
+}
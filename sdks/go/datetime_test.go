@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDateTimeRoundTrip(t *testing.T) {
+	utc := time.Date(2024, time.March, 10, 12, 34, 56, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{name: "unknown", in: time.Time{}, want: unknownTime},
+		{name: "utc", in: utc, want: "2024-03-10T12:34:56Z"},
+		{name: "east", in: utc.In(time.FixedZone("IST", 5*3600+30*60)), want: "2024-03-10T18:04:56+05:30"},
+		{name: "west", in: utc.In(time.FixedZone("EST", -5*3600)), want: "2024-03-10T07:34:56-05:00"},
+		{name: "west half hour", in: utc.In(time.FixedZone("NST", -(3*3600 + 30*60))), want: "2024-03-10T09:04:56-03:30"},
+		{name: "unnamed zone", in: utc.In(time.FixedZone("", 9*3600)), want: "2024-03-10T21:34:56+09:00"},
+		// The fraction of the second is lost, and the time is moved to the
+		// offset in whole minutes.
+		{name: "truncated", in: time.Date(2024, time.March, 10, 12, 34, 56, 789, time.FixedZone("", 3600+59)), want: "2024-03-10T12:33:57+01:00"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMessage()
+			if err := m.AppendValue(NewTimeValue(tc.in)); err != nil {
+				t.Fatal(err)
+			}
+			v, err := NewMessageFromBytes(m.Bytes()).PopValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := v.AsTime()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.String() != tc.want {
+				t.Fatalf("got %s, want %s", v, tc.want)
+			}
+			if tc.in.IsZero() != got.IsZero() {
+				t.Fatalf("got %v, want the unknown time %t", got, tc.in.IsZero())
+			}
+			if want := tc.in.Truncate(time.Second); !got.Equal(want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDateTimeGolden(t *testing.T) {
+	utc := time.Date(2024, time.March, 10, 12, 34, 56, 0, time.UTC)
+
+	// The payloads of testdata are written by the C library with
+	// testdata/datetime.c.
+	tests := []struct {
+		file string
+		want time.Time
+		s    string
+	}{
+		{file: "unknown", s: unknownTime},
+		{file: "utc", want: utc, s: "2024-03-10T12:34:56Z"},
+		{file: "east", want: utc, s: "2024-03-10T18:04:56+05:30"},
+		{file: "west", want: utc, s: "2024-03-10T07:34:56-05:00"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", "datetime-"+tc.file+".bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := NewMessageFromBytes(b)
+			name, err := m.PopString()
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := m.PopValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := v.AsTime()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tc.want) || v.String() != tc.s {
+				t.Fatalf("got %s, want %s", v, tc.s)
+			}
+
+			// A Go provider sends the same bytes.
+			again := NewMessage()
+			again.AppendString(name)
+			if err := again.AppendValue(v); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again.Bytes(), b) {
+				t.Fatalf("got\n% x\nwant\n% x", again.Bytes(), b)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// The methods asking a provider to open and close a direct connection.
+const (
+	methodOpenDirect  = "METHOD_OPENDIRECT_CONN"
+	methodCloseDirect = "METHOD_CLOSEDIRECT_CONN"
+)
+
+// errDirectDeclined is the cause of a provider answering the request for a
+// direct connection with an error.  The code is that of rbuscore, not an
+// ErrorCode.
+var errDirectDeclined = errors.New("direct connection declined")
+
+// DirectHandle reaches the provider of an element over a private connection
+// to it, bypassing the router, the way a handle opened with rbus_openDirect
+// does.  When the provider doesn't support direct connections, or the one to
+// it is lost, the DirectHandle falls back to sending through the router with
+// the Handle it was opened from; see Direct.
+type DirectHandle struct {
+	parent *Handle
+	name   string
+
+	// m guards whether the DirectHandle is closed and the handle of the
+	// direct connection, nil when falling back to the router.
+	m      sync.Mutex
+	closed bool
+	direct *Handle
+}
+
+// OpenDirect opens a direct connection to the provider of the named element,
+// like rbus_openDirect.  The provider is asked through the router for the
+// address of a private listener, unix or tcp like the connection to the
+// router, which is then dialed.  When the provider declines, or its listener
+// can't be reached, the DirectHandle falls back to the router and the reason
+// is logged.  When no provider of the element is on the bus, the error matches
+// ErrDestinationNotFound.
+//
+// Closing the Handle closes its DirectHandles.
+func (h *Handle) OpenDirect(ctx context.Context, name string) (*DirectHandle, error) {
+	if err := h.checkOpen(); err != nil {
+		return nil, fmt.Errorf("open direct '%s': %w", name, err)
+	}
+
+	d := &DirectHandle{parent: h, name: name}
+
+	address, err := h.requestDirect(ctx, name)
+	switch {
+	case errors.Is(err, rtmessage.ErrNoRoute):
+		return nil, fmt.Errorf("open direct '%s': %w: %w", name, ErrDestinationNotFound, err)
+	case errors.Is(err, errDirectDeclined):
+		d.fallback(ctx, err)
+	case err != nil:
+		return nil, fmt.Errorf("open direct '%s': %w", name, err)
+	default:
+		direct, c, err := h.dialDirect(ctx, address)
+		if err != nil {
+			h.closeDirect(ctx, name)
+			d.fallback(ctx, fmt.Errorf("%s: %w", address, err))
+			break
+		}
+		d.direct = direct
+		go d.watch(c)
+		h.cfg.logger.DebugContext(ctx, "direct connection opened", "name", name, "address", address)
+	}
+
+	h.m.Lock()
+	if err := h.checkOpenLocked(); err != nil {
+		h.m.Unlock()
+		_ = d.Close(ctx)
+		return nil, fmt.Errorf("open direct '%s': %w", name, err)
+	}
+	if h.directs == nil {
+		h.directs = make(map[*DirectHandle]struct{})
+	}
+	h.directs[d] = struct{}{}
+	h.m.Unlock()
+
+	return d, nil
+}
+
+// requestDirect asks the provider of the element for a direct connection the
+// way rbuscore_createPrivateConnection does, returning the address of its
+// private listener.
+func (h *Handle) requestDirect(ctx context.Context, name string) (string, error) {
+	req := h.newMessage()
+	req.AppendString(h.Inbox())
+	req.AppendInt32(int32(os.Getpid()))
+	req.AppendString(name)
+	req.AppendString(h.cfg.url)
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodOpenDirect, parent, state)
+
+	resp, err := h.request(ctx, name, req)
+	if err != nil {
+		return "", err
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return "", err
+	}
+	if rc != 0 {
+		return "", fmt.Errorf("%w: return code %d", errDirectDeclined, rc)
+	}
+
+	// The inbox of the provider, which the direct connection has no use
+	// for, comes first.
+	if _, err := resp.PopString(); err != nil {
+		return "", err
+	}
+
+	return resp.PopString()
+}
+
+// dialDirect connects to the private listener of a provider, returning a
+// handle that sends over it.  The connection isn't reestablished when lost,
+// as the listener goes away with the provider.
+func (h *Handle) dialDirect(ctx context.Context, address string) (*Handle, *rtmessage.Connection, error) {
+	direct := &Handle{
+		cfg:         h.cfg,
+		componentID: lastComponentID.Add(1),
+	}
+
+	c, err := rtmessage.New(address, h.cfg.appName,
+		rtmessage.WithInbox(direct.inbox()),
+		rtmessage.WithLogger(h.cfg.logger))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.Connect(ctx); err != nil {
+		_ = c.Close()
+		return nil, nil, err
+	}
+	direct.attach(c)
+
+	return direct, c, nil
+}
+
+// closeDirect tells the provider of the element that the direct connection to
+// it is no longer used, the way rbuscore_closePrivateConnection does.  It is
+// sent even once the handle is closing, and its failure is only logged, as
+// the provider drops the connection of a consumer that is gone anyway.
+func (h *Handle) closeDirect(ctx context.Context, name string) {
+	req := h.newMessage()
+	req.AppendString(h.Inbox())
+	req.AppendString(name)
+	req.SetMetaInfo(methodCloseDirect, "", "")
+
+	ctx, cancel := context.WithTimeout(ctx, unsubscribeTimeout)
+	defer cancel()
+
+	resp, err := h.roundTrip(ctx, name, req)
+	if err == nil {
+		var rc int32
+		if rc, err = resp.PopInt32(); err == nil && rc != 0 {
+			err = fmt.Errorf("%w: return code %d", errDirectDeclined, rc)
+		}
+	}
+	if err != nil {
+		h.cfg.logger.DebugContext(ctx, "closing the direct connection failed", "name", name, "error", err)
+	}
+}
+
+// closeDirects closes the DirectHandles opened from the handle.
+func (h *Handle) closeDirects(ctx context.Context) {
+	h.m.Lock()
+	directs := h.directs
+	h.directs = nil
+	h.m.Unlock()
+
+	for d := range directs {
+		_ = d.Close(ctx)
+	}
+}
+
+// fallback logs that the DirectHandle sends through the router, and why.
+func (d *DirectHandle) fallback(ctx context.Context, err error) {
+	d.parent.cfg.logger.InfoContext(ctx, "direct connection unavailable, using the router", "name", d.name, "error", err)
+}
+
+// watch falls back to the router once the direct connection is lost, which
+// happens when the provider goes away.  The subscriptions made over it end.
+func (d *DirectHandle) watch(c *rtmessage.Connection) {
+	<-c.Done()
+
+	d.m.Lock()
+	direct := d.direct
+	d.direct = nil
+	d.m.Unlock()
+
+	// Closing the DirectHandle closes the connection on purpose.
+	if direct == nil {
+		return
+	}
+
+	d.fallback(context.Background(), c.Err())
+
+	ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+	defer cancel()
+	_ = direct.Close(ctx)
+}
+
+// Name returns the name of the element the DirectHandle was opened for.
+func (d *DirectHandle) Name() string {
+	return d.name
+}
+
+// Direct reports whether the DirectHandle sends over a direct connection to
+// the provider, rather than through the router.
+func (d *DirectHandle) Direct() bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return d.direct != nil
+}
+
+// handle returns the handle to send with: the one of the direct connection,
+// or the one the DirectHandle was opened from.
+func (d *DirectHandle) handle() (*Handle, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	switch {
+	case d.closed:
+		return nil, ErrHandleClosed
+	case d.direct != nil:
+		return d.direct, nil
+	}
+	return d.parent, nil
+}
+
+// Get fetches the value of the named property like Handle.Get.  A get in
+// flight when the direct connection is lost fails rather than being sent
+// again through the router.
+func (d *DirectHandle) Get(ctx context.Context, name string, opts ...CallOption) (Value, error) {
+	h, err := d.handle()
+	if err != nil {
+		return Value{}, fmt.Errorf("get '%s': %w", name, err)
+	}
+	return h.Get(ctx, name, opts...)
+}
+
+// Set sets the named property to the value like Handle.Set.
+func (d *DirectHandle) Set(ctx context.Context, name string, value Value, opts ...SetOption) error {
+	h, err := d.handle()
+	if err != nil {
+		return fmt.Errorf("set '%s': %w", name, err)
+	}
+	return h.Set(ctx, name, value, opts...)
+}
+
+// Subscribe subscribes to the named event like Handle.Subscribe.  A
+// subscription made over the direct connection ends when the connection is
+// lost, its handler no longer being called; once Direct reports false, the
+// application can subscribe again to get the events through the router.
+func (d *DirectHandle) Subscribe(ctx context.Context, name string, handler EventHandler, opts ...SubOption) (*Subscription, error) {
+	h, err := d.handle()
+	if err != nil {
+		return nil, fmt.Errorf("subscribe '%s': %w", name, err)
+	}
+	return h.Subscribe(ctx, name, handler, opts...)
+}
+
+// Close closes the direct connection, ending the subscriptions made over it,
+// and tells the provider.  Then every operation fails with ErrHandleClosed.
+// Closing it again does nothing.
+func (d *DirectHandle) Close(ctx context.Context) error {
+	d.m.Lock()
+	if d.closed {
+		d.m.Unlock()
+		return nil
+	}
+	d.closed = true
+	direct := d.direct
+	d.direct = nil
+	d.m.Unlock()
+
+	d.parent.m.Lock()
+	delete(d.parent.directs, d)
+	d.parent.m.Unlock()
+
+	if direct == nil {
+		return nil
+	}
+
+	err := direct.Close(ctx)
+	d.parent.closeDirect(ctx, d.name)
+
+	return err
+}
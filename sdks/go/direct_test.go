@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage/rtroutedtest"
+)
+
+// directBus is a router with a provider of Device.Test.X, and a private
+// listener, standing in for that of a provider supporting direct
+// connections, with another provider of it.  The values tell which one
+// answered.  Direct connections are asked for by opening one to
+// Device.Test.Direct, which hands out the address of the listener.
+type directBus struct {
+	url      string
+	listener *rtroutedtest.Server
+	closed   chan string
+}
+
+func newDirectBus(t *testing.T) *directBus {
+	t.Helper()
+
+	s, url := newServer(t)
+	private, privateURL := newServer(t)
+
+	ctx := context.Background()
+	registerValues(t, openHandle(t, url, "provider"), map[string]rbus.Value{"Device.Test.X": rbus.NewValue("routed")})
+	registerValues(t, openHandle(t, privateURL, "provider"), map[string]rbus.Value{"Device.Test.X": rbus.NewValue("direct")})
+	for _, s := range []*rtroutedtest.Server{s, private} {
+		if err := s.ExpectSubscribe(ctx, "Device.Test.X"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bus := directBus{url: url, listener: private, closed: make(chan string, 10)}
+
+	con, err := rtmessage.New(url, "directs", rtmessage.WithInbox("directs.INBOX"))
+	if err == nil {
+		err = con.Connect(ctx)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = con.Close() })
+
+	_, err = con.Serve("Device.Test.Direct", func(_ context.Context, msg rtmessage.Message) ([]byte, error) {
+		req := rbus.NewMessageFromBytes(msg.Payload)
+		method, _, _, err := req.GetMetaInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		resp := rbus.NewMessage()
+		resp.AppendInt32(0)
+		switch method {
+		case "METHOD_OPENDIRECT_CONN":
+			resp.AppendString("directs.INBOX")
+			resp.AppendString(privateURL)
+		case "METHOD_CLOSEDIRECT_CONN":
+			inbox, _ := req.PopString()
+			bus.closed <- inbox
+		}
+		resp.SetMetaInfo("METHOD_RESPONSE", "", "")
+
+		return resp.Bytes(), nil
+	})
+	if err == nil {
+		err = s.ExpectSubscribe(ctx, "Device.Test.Direct")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &bus
+}
+
+// openDirect opens the direct connection with the consumer, and checks it
+// is.
+func (bus *directBus) openDirect(t *testing.T, consumer *rbus.Handle) *rbus.DirectHandle {
+	t.Helper()
+
+	d, err := consumer.OpenDirect(context.Background(), "Device.Test.Direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Direct() {
+		t.Fatal("not direct")
+	}
+	checkFrom(t, d, "direct")
+
+	return d
+}
+
+// checkFrom checks that a get of Device.Test.X made with the DirectHandle is
+// answered by the provider.
+func checkFrom(t *testing.T, d *rbus.DirectHandle, provider string) {
+	t.Helper()
+
+	v, err := d.Get(context.Background(), "Device.Test.X")
+	if err != nil || v.String() != provider {
+		t.Fatalf("got %v and %v, want %s", v, err, provider)
+	}
+}
+
+func TestDirectProviderGone(t *testing.T) {
+	bus := newDirectBus(t)
+	consumer := openHandle(t, bus.url, "consumer")
+	d := bus.openDirect(t, consumer)
+
+	// The provider goes away with its listener, and the gets go through
+	// the router.
+	if err := bus.listener.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Direct() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.Direct() {
+		t.Fatal("still direct with the provider gone")
+	}
+	checkFrom(t, d, "routed")
+
+	// There's no direct connection left to tell the provider about.
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case inbox := <-bus.closed:
+		t.Fatalf("told the provider %s closed a connection it lost", inbox)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestDirectConsumerGone(t *testing.T) {
+	bus := newDirectBus(t)
+
+	for _, closeHandle := range []bool{false, true} {
+		consumer := openHandle(t, bus.url, fmt.Sprintf("consumer-%t", closeHandle))
+		d := bus.openDirect(t, consumer)
+		inbox := consumer.Inbox()
+
+		// Closing either the DirectHandle or the Handle it was opened
+		// from tells the provider.
+		var err error
+		if closeHandle {
+			err = consumer.Close(context.Background())
+		} else {
+			err = d.Close(context.Background())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := <-bus.closed; got != inbox {
+			t.Fatalf("got the direct connection of %s closed, want %s", got, inbox)
+		}
+
+		if _, err := d.Get(context.Background(), "Device.Test.X"); !errors.Is(err, rbus.ErrHandleClosed) {
+			t.Fatalf("got %v, want %v", err, rbus.ErrHandleClosed)
+		}
+		if err := d.Close(context.Background()); err != nil {
+			t.Fatalf("closing again: %v", err)
+		}
+		_ = consumer.Close(context.Background())
+	}
+}
+
+func TestDirectFallback(t *testing.T) {
+	s, url := newServer(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+	registerValues(t, provider, map[string]rbus.Value{"Device.Test.X": rbus.NewValue("routed")})
+	if err := s.ExpectSubscribe(context.Background(), "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Go provider doesn't support direct connections.
+	d, err := consumer.OpenDirect(context.Background(), "Device.Test.X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Direct() {
+		t.Fatal("direct with a provider that doesn't support it")
+	}
+	checkFrom(t, d, "routed")
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// No provider at all is an error.
+	if _, err := consumer.OpenDirect(context.Background(), "Device.Test.Nope"); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+}
@@ -0,0 +1,222 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// maxNameDepth is the depth of the names asked for when walking a partial
+// path, RBUS_MAX_NAME_DEPTH in the C library.
+const maxNameDepth = 16
+
+// ElementType is the kind of an element of the data model.  The numeric values
+// match rbusElementType_t in the C library, which reports objects as zero.
+type ElementType int32
+
+const (
+	ElementTypeObject ElementType = iota
+	ElementTypeProperty
+	ElementTypeTable
+	ElementTypeEvent
+	ElementTypeMethod
+)
+
+var elementTypeNames = map[ElementType]string{
+	ElementTypeObject:   "object",
+	ElementTypeProperty: "property",
+	ElementTypeTable:    "table",
+	ElementTypeEvent:    "event",
+	ElementTypeMethod:   "method",
+}
+
+func (t ElementType) String() string {
+	if name, found := elementTypeNames[t]; found {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int32(t))
+}
+
+// Access holds the operations an element allows.  The flags match
+// rbusAccess_t in the C library.
+type Access uint32
+
+const (
+	AccessGet Access = 1 << iota
+	AccessSet
+	AccessAddRow
+	AccessRemoveRow
+	AccessSubscribe
+	AccessInvoke
+)
+
+var accessNames = []struct {
+	flag Access
+	name string
+}{
+	{AccessGet, "get"},
+	{AccessSet, "set"},
+	{AccessAddRow, "addrow"},
+	{AccessRemoveRow, "removerow"},
+	{AccessSubscribe, "subscribe"},
+	{AccessInvoke, "invoke"},
+}
+
+// String returns the names of the flags joined by "|", such as "get|set".
+func (a Access) String() string {
+	var names []string
+	for _, n := range accessNames {
+		if a&n.flag != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// ElementInfo describes an element of the data model.
+type ElementInfo struct {
+	// Name is the name of the element.  The names of objects and tables
+	// end in ".".
+	Name string
+
+	// Component is the component providing the element.
+	Component string
+
+	// Type is the kind of the element.
+	Type ElementType
+
+	// Access holds the operations the element allows, or none when they
+	// aren't known.
+	Access Access
+}
+
+// DiscoverComponents asks the router which component provides each of the
+// named elements, such as "Device.WiFi.SSID.1.SSID", the way
+// rbus_discoverComponentName does.  The result maps each name to its
+// component, or to "" when no component provides it; that doesn't fail the
+// call.
+func (h *Handle) DiscoverComponents(ctx context.Context, elementNames ...string) (map[string]string, error) {
+	if len(elementNames) == 0 {
+		return map[string]string{}, nil
+	}
+	if err := h.checkOpen(); err != nil {
+		return nil, fmt.Errorf("discover components: %w", err)
+	}
+
+	d, err := h.discoverer()
+	if err != nil {
+		return nil, fmt.Errorf("discover components: %w", err)
+	}
+
+	routes, err := d.DiscoverElementObjects(ctx, elementNames...)
+	if err != nil {
+		return nil, fmt.Errorf("discover components: %w", err)
+	}
+
+	components := make(map[string]string, len(elementNames))
+	for i, name := range elementNames {
+		components[name] = ""
+		if len(routes[i]) > 0 {
+			components[name] = routes[i][0]
+		}
+	}
+
+	return components, nil
+}
+
+// DiscoverElements lists the elements of the data model.  Given a component
+// name it lists every element the component registered, as the router knows
+// them: their types follow from the names and their access isn't known.
+// Given a partial path ending in ".", such as "Device.WiFi.", it asks each
+// provider serving the path for the elements under it, with their types and
+// access.
+//
+// When a provider fails, the elements listed so far are returned along with
+// the error.
+func (h *Handle) DiscoverElements(ctx context.Context, componentOrPath string) ([]ElementInfo, error) {
+	if err := h.checkOpen(); err != nil {
+		return nil, fmt.Errorf("discover '%s': %w", componentOrPath, err)
+	}
+
+	if !strings.HasSuffix(componentOrPath, ".") {
+		return h.discoverComponentElements(ctx, componentOrPath)
+	}
+
+	d, err := h.discoverer()
+	if err != nil {
+		return nil, fmt.Errorf("discover '%s': %w", componentOrPath, err)
+	}
+
+	destinations, err := d.DiscoverWildcardDestinations(ctx, componentOrPath)
+	if err != nil {
+		return nil, fmt.Errorf("discover '%s': %w", componentOrPath, err)
+	}
+
+	// Like GetWildcard, a table row nobody has a route for is asked for
+	// directly.
+	if len(destinations) == 0 {
+		destinations = []string{componentOrPath}
+	}
+
+	var elements []ElementInfo
+	for _, destination := range destinations {
+		got, err := h.getNames(ctx, destination, componentOrPath, maxNameDepth)
+		for i := range got {
+			got[i].Component = destination
+		}
+		elements = append(elements, got...)
+		if err != nil {
+			return elements, fmt.Errorf("discover '%s' from '%s': %w", componentOrPath, destination, err)
+		}
+	}
+
+	return elements, nil
+}
+
+// discoverComponentElements lists the elements the component added to the
+// router, the way rbus_discoverComponentDataElements does.
+func (h *Handle) discoverComponentElements(ctx context.Context, component string) ([]ElementInfo, error) {
+	d, err := h.discoverer()
+	if err != nil {
+		return nil, fmt.Errorf("discover '%s': %w", component, err)
+	}
+
+	topics, err := d.DiscoverObjectElements(ctx, component)
+	if err != nil {
+		return nil, fmt.Errorf("discover '%s': %w", component, err)
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("discover '%s': %w", component, ErrComponentDoesNotExist)
+	}
+
+	elements := make([]ElementInfo, 0, len(topics))
+	for _, topic := range topics {
+		// The component's own name comes first.
+		if topic == component {
+			continue
+		}
+
+		info := ElementInfo{Name: topic, Component: component, Type: ElementTypeProperty}
+		switch {
+		case strings.HasSuffix(topic, "()"):
+			info.Type = ElementTypeMethod
+		case strings.HasSuffix(topic, "!"):
+			info.Type = ElementTypeEvent
+		case strings.HasSuffix(strings.TrimSuffix(topic, "."), "{i}"):
+			// Tables are registered by their row pattern.
+			info.Name = strings.TrimSuffix(strings.TrimSuffix(topic, "."), "{i}")
+			info.Type = ElementTypeTable
+		case strings.HasSuffix(topic, "."):
+			info.Type = ElementTypeObject
+		}
+		elements = append(elements, info)
+	}
+
+	return elements, nil
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// waitRoutes waits for the router to have routes for the names, which it
+// doesn't acknowledge.
+func waitRoutes(t *testing.T, r *rtmessage.MemRouter, names ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, name := range names {
+		for !slices.Contains(r.Subscriptions(), name) {
+			if time.Now().After(deadline) {
+				t.Fatalf("no route for %s", name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestDiscoverComponents(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.X": rbus.NewValue("x"),
+		"Device.Test.Y": rbus.NewValue(int32(1)),
+	})
+	other := openHandle(t, b.URL(), "other")
+	registerValues(t, other, map[string]rbus.Value{"Device.Other.Z": rbus.NewValue(true)})
+	waitRoutes(t, b.Router(), "Device.Test.X", "Device.Test.Y", "Device.Other.Z")
+
+	consumer := openHandle(t, b.URL(), "consumer")
+	ctx := context.Background()
+
+	// A name nobody provides maps to "" without failing the call.
+	got, err := consumer.DiscoverComponents(ctx, "Device.Test.X", "Device.Other.Z", "Device.Test.Y", "Device.Nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := got["Device.Test.X"]
+	want := map[string]string{
+		"Device.Test.X":  broker,
+		"Device.Test.Y":  broker,
+		"Device.Other.Z": "other",
+		"Device.Nobody":  "",
+	}
+	if broker == "" || broker == "other" || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v", got)
+	}
+
+	// The broker's component is the one that answers.
+	if v, err := consumer.Get(ctx, "Device.Test.Y", rbus.ToComponent(broker)); err != nil || v.String() != "1" {
+		t.Fatalf("got %s and %v, want 1", v, err)
+	}
+
+	if got, err := consumer.DiscoverComponents(ctx); err != nil || len(got) != 0 {
+		t.Fatalf("got %v and %v, want nothing", got, err)
+	}
+
+	if err := consumer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.DiscoverComponents(ctx, "Device.Test.X"); !errors.Is(err, rbus.ErrHandleClosed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrHandleClosed)
+	}
+}
+
+func TestDiscoverElements(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.X":     rbus.NewValue("x"),
+		"Device.Test.Sub.Y": rbus.NewValue(int32(1)),
+	})
+	if err := b.AddMethod("Device.Test.Reset()", echo); err != nil {
+		t.Fatal(err)
+	}
+	waitRoutes(t, b.Router(), "Device.Test.X", "Device.Test.Sub.Y", "Device.Test.Reset()")
+
+	consumer := openHandle(t, b.URL(), "consumer")
+	ctx := context.Background()
+	comps, err := consumer.DiscoverComponents(ctx, "Device.Test.X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := comps["Device.Test.X"]
+
+	// elements lists the elements as name/type/access, with the component
+	// when it's not the broker's.
+	elements := func(infos []rbus.ElementInfo) string {
+		s := make([]string, 0, len(infos))
+		for _, e := range infos {
+			info := fmt.Sprintf("%s/%s/%s", e.Name, e.Type, e.Access)
+			if e.Component != broker {
+				info += "@" + e.Component
+			}
+			s = append(s, info)
+		}
+		slices.Sort(s)
+		return fmt.Sprint(s)
+	}
+
+	// The router knows the names the component registered, not their
+	// access.
+	got, err := consumer.DiscoverElements(ctx, broker)
+	want := fmt.Sprint([]string{
+		"Device.Test.Reset()/method/none",
+		"Device.Test.Sub.Y/property/none",
+		"Device.Test.X/property/none",
+	})
+	if err != nil || elements(got) != want {
+		t.Fatalf("got %s and %v, want %s", elements(got), err, want)
+	}
+
+	// The provider knows everything under a partial path, objects included.
+	got, err = consumer.DiscoverElements(ctx, "Device.Test.")
+	want = fmt.Sprint([]string{
+		"Device.Test./object/none",
+		"Device.Test.Reset()/method/invoke",
+		"Device.Test.Sub./object/none",
+		"Device.Test.Sub.Y/property/get|set|subscribe",
+		"Device.Test.X/property/get|set|subscribe",
+	})
+	if err != nil || elements(got) != want {
+		t.Fatalf("got %s and %v, want %s", elements(got), err, want)
+	}
+
+	got, err = consumer.DiscoverElements(ctx, "Device.Test.Sub.")
+	want = fmt.Sprint([]string{
+		"Device.Test.Sub./object/none",
+		"Device.Test.Sub.Y/property/get|set|subscribe",
+	})
+	if err != nil || elements(got) != want {
+		t.Fatalf("got %s and %v, want %s", elements(got), err, want)
+	}
+
+	if _, err := consumer.DiscoverElements(ctx, "nobody"); !errors.Is(err, rbus.ErrComponentDoesNotExist) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrComponentDoesNotExist)
+	}
+	if got, err := consumer.DiscoverElements(ctx, "Device.Nobody."); !errors.Is(err, rtmessage.ErrNoRoute) || len(got) != 0 {
+		t.Fatalf("got %s and %v, want %v", elements(got), err, rtmessage.ErrNoRoute)
+	}
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+var (
+	ErrNotOpen      = errors.New("handle not open")
+	ErrHandleClosed = errors.New("handle closed")
+	ErrNoSession    = errors.New("no session open")
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrConnectionLost means the connection to the router went down while
+	// waiting for the response.
+	ErrConnectionLost = rtmessage.ErrConnectionClosed
+
+	// ErrDefaultTimeout means the response didn't come within the timeout
+	// set with WithDefaultTimeout.  The error matches ErrTimeout too, but
+	// unlike a provider's timeout, it's the Handle that gave up.
+	ErrDefaultTimeout = errors.New("default timeout")
+)
+
+// ErrorCode is a return code reported by an rbus provider.  The numeric values
+// match rbusError_t in the C library.  An ErrorCode is an error itself, so the
+// errors returned by the Handle can be checked with errors.Is, for example
+// errors.Is(err, ErrElementDoesNotExist).
+type ErrorCode int32
+
+const (
+	ErrBus                            ErrorCode = 1
+	ErrInvalidInput                   ErrorCode = 2
+	ErrNotInitialized                 ErrorCode = 3
+	ErrOutOfResources                 ErrorCode = 4
+	ErrDestinationNotFound            ErrorCode = 5
+	ErrDestinationNotReachable        ErrorCode = 6
+	ErrDestinationResponseFailure     ErrorCode = 7
+	ErrInvalidResponseFromDestination ErrorCode = 8
+	ErrInvalidOperation               ErrorCode = 9
+	ErrInvalidEvent                   ErrorCode = 10
+	ErrInvalidHandle                  ErrorCode = 11
+	ErrSessionAlreadyExists           ErrorCode = 12
+	ErrComponentNameDuplicate         ErrorCode = 13
+	ErrElementNameDuplicate           ErrorCode = 14
+	ErrElementNameMissing             ErrorCode = 15
+	ErrComponentDoesNotExist          ErrorCode = 16
+	ErrElementDoesNotExist            ErrorCode = 17
+	ErrAccessNotAllowed               ErrorCode = 18
+	ErrInvalidContext                 ErrorCode = 19
+	ErrTimeout                        ErrorCode = 20
+	ErrAsyncResponse                  ErrorCode = 21
+	ErrInvalidMethod                  ErrorCode = 22
+	ErrNoSubscribers                  ErrorCode = 23
+	ErrSubscriptionAlreadyExists      ErrorCode = 24
+	ErrInvalidNamespace               ErrorCode = 25
+	ErrDirectConnectionDoesNotExist   ErrorCode = 26
+	ErrNotWritable                    ErrorCode = 27
+	ErrNotReadable                    ErrorCode = 28
+	ErrInvalidParameterType           ErrorCode = 29
+	ErrInvalidParameterValue          ErrorCode = 30
+)
+
+// legacySuccess is the success code of CCSP components bridged onto rbus,
+// whose return codes start at 100 instead of 0.
+const legacySuccess = 100
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrBus:                            "bus error",
+	ErrInvalidInput:                   "invalid input",
+	ErrNotInitialized:                 "not initialized",
+	ErrOutOfResources:                 "out of resources",
+	ErrDestinationNotFound:            "destination not found",
+	ErrDestinationNotReachable:        "destination not reachable",
+	ErrDestinationResponseFailure:     "destination response failure",
+	ErrInvalidResponseFromDestination: "invalid response from destination",
+	ErrInvalidOperation:               "invalid operation",
+	ErrInvalidEvent:                   "invalid event",
+	ErrInvalidHandle:                  "invalid handle",
+	ErrSessionAlreadyExists:           "session already exists",
+	ErrComponentNameDuplicate:         "component name duplicate",
+	ErrElementNameDuplicate:           "element name duplicate",
+	ErrElementNameMissing:             "element name missing",
+	ErrComponentDoesNotExist:          "component does not exist",
+	ErrElementDoesNotExist:            "element does not exist",
+	ErrAccessNotAllowed:               "access not allowed",
+	ErrInvalidContext:                 "invalid context",
+	ErrTimeout:                        "timeout",
+	ErrAsyncResponse:                  "async response",
+	ErrInvalidMethod:                  "invalid method",
+	ErrNoSubscribers:                  "no subscribers",
+	ErrSubscriptionAlreadyExists:      "subscription already exists",
+	ErrInvalidNamespace:               "invalid namespace",
+	ErrDirectConnectionDoesNotExist:   "direct connection does not exist",
+	ErrNotWritable:                    "not writable",
+	ErrNotReadable:                    "not readable",
+	ErrInvalidParameterType:           "invalid parameter type",
+	ErrInvalidParameterValue:          "invalid parameter value",
+}
+
+func (e ErrorCode) Error() string {
+	if name, found := errorCodeNames[e]; found {
+		return name
+	}
+	if e > legacySuccess {
+		return fmt.Sprintf("legacy error %d", int32(e))
+	}
+	return fmt.Sprintf("rbus error %d", int32(e))
+}
+
+// checkReturnCode converts the return code of a response into an error.
+func checkReturnCode(rc int32) error {
+	if rc == 0 || rc == legacySuccess {
+		return nil
+	}
+	return ErrorCode(rc)
+}
+
+// missing reports whether the error means the element isn't there, so a
+// default can stand in for its value: either its provider says it doesn't
+// exist, or no provider on the bus serves the name.  Failing to reach a
+// provider that does, by a timeout or a lost connection, doesn't count.
+func missing(err error) bool {
+	return errors.Is(err, ErrElementDoesNotExist) ||
+		errors.Is(err, ErrDestinationNotFound) ||
+		errors.Is(err, rtmessage.ErrNoRoute)
+}
+
+// PropertyError is the failure to get or set a single property of a request
+// covering several.
+type PropertyError struct {
+	Name string
+	Err  error
+}
+
+func (e *PropertyError) Error() string {
+	return fmt.Sprintf("'%s': %v", e.Name, e.Err)
+}
+
+func (e *PropertyError) Unwrap() error {
+	return e.Err
+}
+
+// returnCode converts the error of a provider callback into the return code
+// sent to the consumer: the ErrorCode it wraps, or ErrBus for any other error.
+func returnCode(err error) int32 {
+	if err == nil {
+		return 0
+	}
+
+	var code ErrorCode
+	if errors.As(err, &code) {
+		return int32(code)
+	}
+
+	return int32(ErrBus)
+}
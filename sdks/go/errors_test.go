@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+func TestMissingErrorCodes(t *testing.T) {
+	for code := ErrBus; code <= ErrInvalidParameterValue; code++ {
+		want := code == ErrElementDoesNotExist || code == ErrDestinationNotFound
+
+		t.Run(code.Error(), func(t *testing.T) {
+			if got := missing(code); got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+
+			// As returned by a get, and as one property of several.
+			wrapped := fmt.Errorf("get 'Device.Test.X': %w", code)
+			if got := missing(wrapped); got != want {
+				t.Fatalf("wrapped: got %t, want %t", got, want)
+			}
+			pe := &PropertyError{Name: "Device.Test.X", Err: code}
+			if got := missing(errors.Join(pe)); got != want {
+				t.Fatalf("property error: got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestMissing(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil},
+		{name: "no route", err: rtmessage.ErrNoRoute, want: true},
+		{name: "wrapped no route", err: fmt.Errorf("get 'Device.Test.X': %w", rtmessage.ErrNoRoute), want: true},
+		{name: "legacy success", err: ErrorCode(legacySuccess)},
+		{name: "unknown code", err: ErrorCode(99)},
+		{name: "deadline", err: context.DeadlineExceeded},
+		{name: "canceled", err: context.Canceled},
+		{name: "connection lost", err: ErrConnectionLost},
+		{name: "closed", err: ErrHandleClosed},
+		{name: "type mismatch", err: ErrTypeMismatch},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := missing(tc.err); got != tc.want {
+				t.Fatalf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// EventType is the kind of an event.  The numeric values match rbusEventType_t
+// in the C library.
+type EventType int32
+
+const (
+	EventObjectCreated EventType = iota
+	EventObjectDeleted
+	EventValueChanged
+	EventGeneral
+	EventInitialValue
+	EventInterval
+	EventDurationComplete
+)
+
+var eventTypeNames = map[EventType]string{
+	EventObjectCreated:    "object created",
+	EventObjectDeleted:    "object deleted",
+	EventValueChanged:     "value changed",
+	EventGeneral:          "general",
+	EventInitialValue:     "initial value",
+	EventInterval:         "interval",
+	EventDurationComplete: "duration complete",
+}
+
+func (t EventType) String() string {
+	if name, found := eventTypeNames[t]; found {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int32(t))
+}
+
+// Event is an event published by a provider to a subscription.
+type Event struct {
+	// Name is the name of the event, or of the element it is about.
+	Name string
+
+	// Type is the kind of the event.
+	Type EventType
+
+	// Data holds the properties the provider sent with the event, such as
+	// "value" and "oldValue" for a value change.
+	Data []Property
+
+	// NewValue, OldValue and ByComponent are taken from Data for a value
+	// change, and NewValue for an initial value: the value, the one before
+	// and the component whose set changed it.  Those the provider didn't
+	// send are left zero, a Value holding nothing.
+	NewValue    Value
+	OldValue    Value
+	ByComponent string
+}
+
+// decode fills the fields of the event taken from its data, the way
+// rbusValueChange_publish names them, and _subscribe_callback_handler the
+// initial value.  A value of another type than expected
+// is left out rather than failing the event.
+func (e *Event) decode() {
+	if e.Type != EventValueChanged && e.Type != EventInitialValue {
+		return
+	}
+
+	for _, p := range e.Data {
+		switch p.Name {
+		case "value":
+			if e.Type == EventValueChanged {
+				e.NewValue = p.Value
+			}
+		case "initialValue":
+			if e.Type == EventInitialValue {
+				e.NewValue = p.Value
+			}
+		case "oldValue":
+			if e.Type == EventValueChanged {
+				e.OldValue = p.Value
+			}
+		case "by":
+			if by, err := p.Value.AsString(); err == nil && e.Type == EventValueChanged {
+				e.ByComponent = by
+			}
+		}
+	}
+}
+
+// FilterOp is the relation a filter tests the value of an element against.
+// The numeric values match rbusFilter_RelationOperator_t in the C library.
+type FilterOp int32
+
+const (
+	FilterGreaterThan FilterOp = iota
+	FilterGreaterThanOrEqual
+	FilterLessThan
+	FilterLessThanOrEqual
+	FilterEqual
+	FilterNotEqual
+)
+
+// Filter is the filter a consumer subscribed with, as its provider sees it.
+type Filter struct {
+	f *filter
+}
+
+// Relation returns the operator and the value of a filter relating the value
+// of the element to a value, like those made with SubWithFilter.  ok is false
+// for a filter combining others, which C consumers can send.
+func (f *Filter) Relation() (op FilterOp, value Value, ok bool) {
+	if f.f.kind != filterRelation {
+		return 0, Value{}, false
+	}
+	return FilterOp(f.f.op), f.f.value, true
+}
+
+// Apply reports whether the value passes the filter, the way the values
+// published to the subscription are tested.
+func (f *Filter) Apply(val Value) bool {
+	return f.f.apply(val)
+}
+
+// The kinds of filter expressions and the logic operators, as encoded by
+// rbusFilter_AppendToMessage.
+const (
+	filterRelation = 0
+	filterLogic    = 1
+
+	filterLogicAnd = 0
+	filterLogicOr  = 1
+	filterLogicNot = 2
+)
+
+// filter is a filter expression: either a relation of the element's value to
+// a value, or a logic operator combining other filters.
+type filter struct {
+	kind        int32
+	op          int32
+	value       Value
+	left, right *filter
+}
+
+// append encodes the filter the way rbusFilter_AppendToMessage does.
+func (f *filter) append(m *Message) error {
+	m.AppendInt32(f.kind)
+	m.AppendInt32(f.op)
+
+	if f.kind == filterRelation {
+		m.AppendString("filter")
+		return m.AppendValue(f.value)
+	}
+
+	if err := f.left.append(m); err != nil {
+		return err
+	}
+	if f.op != filterLogicNot {
+		return f.right.append(m)
+	}
+	return nil
+}
+
+// equal reports whether the filters are the same expression.
+func (f *filter) equal(o *filter) bool {
+	if f == nil || o == nil {
+		return f == o
+	}
+	if f.kind != o.kind || f.op != o.op {
+		return false
+	}
+	if f.kind == filterRelation {
+		return f.value.Equal(o.value)
+	}
+	return f.left.equal(o.left) && f.right.equal(o.right)
+}
+
+// apply reports whether the value passes the filter.  Numbers compare by
+// value whatever their types, strings compare as strings, and a boolean only
+// is equal or not to another.
+func (f *filter) apply(val Value) bool {
+	if f.kind != filterRelation {
+		switch f.op {
+		case filterLogicAnd:
+			return f.left.apply(val) && f.right.apply(val)
+		case filterLogicOr:
+			return f.left.apply(val) || f.right.apply(val)
+		default:
+			return !f.left.apply(val)
+		}
+	}
+
+	c, ok := compareValues(val, f.value)
+	if !ok {
+		return FilterOp(f.op) == FilterNotEqual
+	}
+
+	switch FilterOp(f.op) {
+	case FilterGreaterThan:
+		return c > 0
+	case FilterGreaterThanOrEqual:
+		return c >= 0
+	case FilterLessThan:
+		return c < 0
+	case FilterLessThanOrEqual:
+		return c <= 0
+	case FilterEqual:
+		return c == 0
+	case FilterNotEqual:
+		return c != 0
+	}
+	return false
+}
+
+// compareValues compares the values, reporting whether they can be compared
+// at all.  Booleans compare as equal or not, with no order.  Datetimes compare
+// as instants, whatever their offsets, and bytes as memcmp does.
+func compareValues(a, b Value) (int, bool) {
+	if x, err := a.AsString(); err == nil {
+		y, err := b.AsString()
+		return strings.Compare(x, y), err == nil
+	}
+
+	if x, err := a.AsBytes(); err == nil {
+		y, err := b.AsBytes()
+		return bytes.Compare(x, y), err == nil
+	}
+
+	if x, err := a.AsTime(); err == nil {
+		y, err := b.AsTime()
+		return x.Compare(y), err == nil
+	}
+
+	if x, err := a.AsBool(); err == nil {
+		y, err := b.AsBool()
+		if err != nil || x != y {
+			return 1, err == nil
+		}
+		return 0, true
+	}
+
+	x, ok := number(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := number(b)
+	if !ok {
+		return 0, false
+	}
+	return cmp.Compare(x, y), true
+}
+
+// number returns the value of any of the numeric types as a float64.
+func number(val Value) (float64, bool) {
+	if f, err := val.AsFloat64(); err == nil {
+		return f, true
+	}
+	if u, err := val.AsUint64(); err == nil {
+		return float64(u), true
+	}
+	if i, err := val.AsInt64(); err == nil {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// popFilter decodes a filter encoded by rbusFilter_AppendToMessage.
+func popFilter(m *Message) (*filter, error) {
+	leave, err := m.nest()
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	var f filter
+
+	if f.kind, err = m.PopInt32(); err != nil {
+		return nil, err
+	}
+	if f.op, err = m.PopInt32(); err != nil {
+		return nil, err
+	}
+
+	switch f.kind {
+	case filterRelation:
+		if _, err = m.PopString(); err != nil {
+			return nil, err
+		}
+		if f.value, err = m.PopValue(); err != nil {
+			return nil, err
+		}
+	case filterLogic:
+		if f.left, err = popFilter(m); err != nil {
+			return nil, err
+		}
+		if f.op != filterLogicNot {
+			if f.right, err = popFilter(m); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown filter kind %d", ErrMalformedMessage, f.kind)
+	}
+
+	return &f, nil
+}
+
+// eventData is the payload of an event message, as encoded by
+// rbusEventData_appendToMessage.  Besides the event it repeats the options of
+// the subscription it was published for.
+type eventData struct {
+	event       Event
+	filter      *filter
+	interval    int32
+	duration    int32
+	componentID int32
+}
+
+// popEventData decodes the payload of an event message.
+func popEventData(m *Message) (eventData, error) {
+	var d eventData
+	var err error
+
+	if d.event.Name, err = m.PopString(); err != nil {
+		return d, err
+	}
+
+	typ, err := m.PopInt32()
+	if err != nil {
+		return d, err
+	}
+	d.event.Type = EventType(typ)
+
+	hasData, err := m.PopInt32()
+	if err != nil {
+		return d, err
+	}
+	if hasData != 0 {
+		if d.event.Data, err = popObject(m); err != nil {
+			return d, err
+		}
+	}
+
+	hasFilter, err := m.PopInt32()
+	if err != nil {
+		return d, err
+	}
+	if hasFilter != 0 {
+		if d.filter, err = popFilter(m); err != nil {
+			return d, err
+		}
+	}
+
+	if d.interval, err = m.PopInt32(); err != nil {
+		return d, err
+	}
+	if d.duration, err = m.PopInt32(); err != nil {
+		return d, err
+	}
+	if d.componentID, err = m.PopInt32(); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+// appendEventData encodes the payload of an event message the way
+// rbusEventData_appendToMessage does.
+func appendEventData(m *Message, d eventData) error {
+	m.AppendString(d.event.Name)
+	m.AppendInt32(int32(d.event.Type))
+
+	if d.event.Data == nil {
+		m.AppendInt32(0)
+	} else {
+		m.AppendInt32(1)
+		// The publishers of the C library make the data without a name.
+		if err := appendObject(m, "", d.event.Data); err != nil {
+			return err
+		}
+	}
+
+	if d.filter == nil {
+		m.AppendInt32(0)
+	} else {
+		m.AppendInt32(1)
+		if err := d.filter.append(m); err != nil {
+			return err
+		}
+	}
+
+	m.AppendInt32(d.interval)
+	m.AppendInt32(d.duration)
+	m.AppendInt32(d.componentID)
+
+	return nil
+}
+
+// appendObject encodes the properties as an object without children, the way
+// rbusObject_appendToMessage does.  Nested objects are encoded as properties
+// holding object values.
+func appendObject(m *Message, name string, props []Property) error {
+	m.AppendString(name)
+	m.AppendInt32(0) // single instance
+	m.AppendInt32(int32(len(props)))
+	for _, p := range props {
+		m.AppendString(p.Name)
+		if err := m.AppendValue(p.Value); err != nil {
+			return fmt.Errorf("'%s': %w", p.Name, err)
+		}
+	}
+	m.AppendInt32(0) // children
+
+	return nil
+}
+
+// popObject decodes an object encoded by rbusObject_appendToMessage,
+// returning its properties.  The child objects follow them, each as a
+// property holding an object value named after the child.
+func popObject(m *Message) ([]Property, error) {
+	_, props, err := popNamedObject(m)
+	return props, err
+}
+
+// popNamedObject decodes an object like popObject, returning its name too.
+func popNamedObject(m *Message) (string, []Property, error) {
+	leave, err := m.nest()
+	if err != nil {
+		return "", nil, err
+	}
+	defer leave()
+
+	name, err := m.PopString()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := m.PopInt32(); err != nil { // single or multi instance
+		return "", nil, err
+	}
+
+	count, err := m.PopInt32()
+	if err != nil {
+		return "", nil, err
+	}
+	if count < 0 {
+		return "", nil, fmt.Errorf("%w: negative property count %d", ErrMalformedMessage, count)
+	}
+
+	props := make([]Property, 0, min(int(count), m.remaining()/2))
+	for range count {
+		var p Property
+		if p.Name, err = m.PopString(); err != nil {
+			return "", nil, err
+		}
+		if p.Value, err = m.PopValue(); err != nil {
+			return "", nil, err
+		}
+		props = append(props, p)
+	}
+
+	children, err := m.PopInt32()
+	if err != nil {
+		return "", nil, err
+	}
+	if children < 0 {
+		return "", nil, fmt.Errorf("%w: negative child count %d", ErrMalformedMessage, children)
+	}
+	for range children {
+		childName, childProps, err := popNamedObject(m)
+		if err != nil {
+			return "", nil, err
+		}
+		props = append(props, Property{Name: childName, Value: NewObjectValue(childProps...)})
+	}
+
+	return name, props, nil
+}
@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// properties returns the properties as name=value pairs.
+func properties(props []Property) string {
+	s := make([]string, 0, len(props))
+	for _, p := range props {
+		s = append(s, fmt.Sprintf("%s=%s", p.Name, p.Value))
+	}
+	return fmt.Sprint(s)
+}
+
+func TestEventDecodeGolden(t *testing.T) {
+	tests := []struct {
+		// file is the payload of testdata, written by the C library with
+		// testdata/events.c.
+		file     string
+		name     string
+		typ      EventType
+		data     string
+		newValue string
+		oldValue string
+		by       string
+		filter   *filter
+		interval int32
+		duration int32
+	}{
+		{
+			file:     "value-changed",
+			name:     "Device.Test.X",
+			typ:      EventValueChanged,
+			data:     "[value=6 oldValue=5 by=setter]",
+			newValue: "6",
+			oldValue: "5",
+			by:       "setter",
+		}, {
+			file:     "value-changed-filter",
+			name:     "Device.Test.X",
+			typ:      EventValueChanged,
+			data:     "[value=6 oldValue=5 by=setter filter=true]",
+			newValue: "6",
+			oldValue: "5",
+			by:       "setter",
+			filter:   &filter{kind: filterRelation, op: int32(FilterGreaterThan), value: NewValue(int32(5))},
+		}, {
+			file: "object-created",
+			name: "Device.Test.Table.",
+			typ:  EventObjectCreated,
+			data: "[rowName=Device.Test.Table.1. instNum=1 alias=first]",
+		}, {
+			file: "object-deleted",
+			name: "Device.Test.Table.",
+			typ:  EventObjectDeleted,
+			data: "[rowName=Device.Test.Table.1.]",
+		}, {
+			file: "general",
+			name: "Device.Test.Event!",
+			typ:  EventGeneral,
+			data: "[message=hello count=3]",
+		}, {
+			file:     "initial-value",
+			name:     "Device.Test.X",
+			typ:      EventInitialValue,
+			data:     "[initialValue=5]",
+			newValue: "5",
+		}, {
+			file:     "interval",
+			name:     "Device.Test.X",
+			typ:      EventInterval,
+			data:     "[Device.Test.X=5]",
+			interval: 2,
+			duration: 10,
+		}, {
+			file:     "duration-complete",
+			name:     "Device.Test.X",
+			typ:      EventDurationComplete,
+			data:     "[Device.Test.X=5]",
+			interval: 2,
+			duration: 10,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", "event-"+tc.file+".bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := NewMessageFromBytes(b)
+			name, err := eventName(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := popEventData(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.event.decode()
+
+			e := d.event
+			if name != tc.name || e.Name != tc.name || e.Type != tc.typ {
+				t.Fatalf("got %s event %s of %s, want %s event of %s", e.Type, e.Name, name, tc.typ, tc.name)
+			}
+			if got := properties(e.Data); got != tc.data {
+				t.Fatalf("got data %s, want %s", got, tc.data)
+			}
+			if got := e.NewValue.String(); got != tc.newValue {
+				t.Fatalf("got new value %q, want %q", got, tc.newValue)
+			}
+			if got := e.OldValue.String(); got != tc.oldValue {
+				t.Fatalf("got old value %q, want %q", got, tc.oldValue)
+			}
+			if e.ByComponent != tc.by {
+				t.Fatalf("got by %q, want %q", e.ByComponent, tc.by)
+			}
+			if !d.filter.equal(tc.filter) {
+				t.Fatalf("got filter %+v, want %+v", d.filter, tc.filter)
+			}
+			if d.interval != tc.interval || d.duration != tc.duration || d.componentID != 7 {
+				t.Fatalf("got interval %d, duration %d and component %d, want %d, %d and 7",
+					d.interval, d.duration, d.componentID, tc.interval, tc.duration)
+			}
+
+			// A Go provider publishes the same bytes.
+			again := NewMessage()
+			if err := appendEventData(again, d); err != nil {
+				t.Fatal(err)
+			}
+			again.setEventMetaInfo(name, "provider")
+			if !bytes.Equal(again.Bytes(), b) {
+				t.Fatalf("got\n% x\nwant\n% x", again.Bytes(), b)
+			}
+		})
+	}
+}
+
+func TestEventDurationComplete(t *testing.T) {
+	h, err := New(WithURL("mem://rbus-event-test"), WithApplicationName("consumer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The event of testdata was published for the component 7.
+	h.componentID = 7
+
+	var calls []string
+	sub := &Subscription{
+		h:    h,
+		name: "Device.Test.X",
+		handler: func(e Event) {
+			calls = append(calls, "handler "+e.Type.String())
+		},
+	}
+	sub.cfg.interval = 2
+	sub.cfg.duration = 10
+	sub.cfg.onComplete = func() { calls = append(calls, "complete") }
+
+	// Another subscription to the same event, without a duration, goes on.
+	other := &Subscription{
+		h:       h,
+		name:    "Device.Test.X",
+		handler: func(e Event) { calls = append(calls, "other "+e.Type.String()) },
+	}
+	h.subs = []*Subscription{other, sub}
+
+	b, err := os.ReadFile(filepath.Join("testdata", "event-duration-complete.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := rtmessage.Message{Header: &rtmessage.Header{Topic: h.Inbox()}, Payload: b}
+
+	// A copy of the event, sent again, is ignored.
+	h.onEvent(msg)
+	h.onEvent(msg)
+
+	want := fmt.Sprint([]string{"handler duration complete", "complete"})
+	if got := fmt.Sprint(calls); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if h.hasSubscription(sub) || !h.hasSubscription(other) {
+		t.Fatal("got the subscription still there, or the other gone")
+	}
+}
+
+// nestedFilter encodes a relation negated depth-1 times, so its terms nest
+// depth deep.
+func nestedFilter(depth int) []byte {
+	m := NewMessage()
+	for range depth - 1 {
+		m.AppendInt32(filterLogic)
+		m.AppendInt32(filterLogicNot)
+	}
+	f := filter{kind: filterRelation, op: int32(FilterGreaterThan), value: NewValue(int32(5))}
+	if err := f.append(m); err != nil {
+		panic(err)
+	}
+	return m.Bytes()
+}
+
+func TestPopFilterNesting(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   int
+		wantErr bool
+	}{
+		{name: "at the limit", depth: maxNestingDepth},
+		{name: "past the limit", depth: maxNestingDepth + 1, wantErr: true},
+		{name: "far past the limit", depth: 1_000_000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(err error) {
+				t.Helper()
+				if tt.wantErr {
+					if !errors.Is(err, ErrMalformedMessage) {
+						t.Fatalf("got %v, want %v", err, ErrMalformedMessage)
+					}
+				} else if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+			}
+
+			in := nestedFilter(tt.depth)
+			_, err := popFilter(NewMessageFromBytes(in))
+			check(err)
+
+			// The filter of a subscription request is decoded the same way.
+			options := NewMessage()
+			options.AppendInt32(7) // component
+			options.AppendInt32(0) // interval
+			options.AppendInt32(0) // duration
+			options.AppendInt32(1) // has filter
+			b := append(options.Bytes(), in...)
+
+			var s subscriber
+			check((&Handle{}).popSubscriberOptions(b, &s))
+		})
+	}
+}
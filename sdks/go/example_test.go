@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+func ExampleGetAs() {
+	// An in-process router, with a provider of the channel.
+	router, err := rtmessage.NewMemRouter("example-getas")
+	if err != nil {
+		panic(err)
+	}
+	defer router.Close()
+
+	ctx := context.Background()
+	open := func(component string) *rbus.Handle {
+		h, err := rbus.New(rbus.WithURL("mem://example-getas"), rbus.WithApplicationName(component))
+		if err != nil {
+			panic(err)
+		}
+		if err := h.Open(ctx); err != nil {
+			panic(err)
+		}
+		return h
+	}
+
+	provider := open("provider")
+	defer provider.Close(ctx)
+	err = provider.RegisterElement("Device.WiFi.Radio.1.Channel", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(uint32(6)), nil },
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	h := open("consumer")
+	defer h.Close(ctx)
+
+	channel, err := rbus.GetAs[uint8](ctx, h, "Device.WiFi.Radio.1.Channel")
+	fmt.Println(channel, err)
+
+	_, err = rbus.GetAs[string](ctx, h, "Device.WiFi.Radio.1.Channel")
+	fmt.Println(errors.Is(err, rbus.ErrTypeMismatch))
+	// Output:
+	// 6 <nil>
+	// true
+}
+
+func ExampleValueAs() {
+	v := rbus.NewValue(uint32(70000))
+
+	n, err := rbus.ValueAs[int64](v)
+	fmt.Println(n, err)
+
+	f, err := rbus.ValueAs[float32](v)
+	fmt.Println(f, err)
+
+	_, err = rbus.ValueAs[uint16](v)
+	fmt.Println(err)
+	// Output:
+	// 70000 <nil>
+	// 70000 <nil>
+	// type mismatch: uint32 value 70000 overflows uint16
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Scalar is the set of Go types a Value can be converted to by ValueAs.
+type Scalar interface {
+	bool | int | int8 | int16 | int32 | int64 | uint | uint8 | uint16 | uint32 | uint64 |
+		float32 | float64 | string | []byte | time.Time
+}
+
+// GetAs fetches the named property and converts it to T, for example
+//
+//	ssid, err := rbus.GetAs[string](ctx, h, "Device.WiFi.SSID.1.SSID")
+//	channel, err := rbus.GetAs[uint32](ctx, h, "Device.WiFi.Radio.1.Channel")
+//
+// See ValueAs for the conversion.
+func GetAs[T Scalar](ctx context.Context, h *Handle, name string) (T, error) {
+	var zero T
+
+	v, err := h.Get(ctx, name)
+	if err != nil {
+		return zero, err
+	}
+
+	t, err := ValueAs[T](v)
+	if err != nil {
+		return zero, fmt.Errorf("get '%s': %w", name, err)
+	}
+
+	return t, nil
+}
+
+// GetAsOr fetches the named property and converts it to T like GetAs, but
+// returns def when the provider reports that the property doesn't exist, or
+// when no provider serves the name.  Every other failure is returned as usual.
+func GetAsOr[T Scalar](ctx context.Context, h *Handle, name string, def T) (T, error) {
+	t, err := GetAs[T](ctx, h, name)
+	if missing(err) {
+		return def, nil
+	}
+	return t, err
+}
+
+// ValueAs converts the value to T.  Strings, booleans, bytes and datetimes
+// only convert to themselves.  Integers convert to any integer type that holds the
+// value, and to a float type that holds it exactly.  Singles and doubles convert to
+// float64, and to float32 when that holds the value exactly.  Anything else
+// fails with an error matching ErrTypeMismatch naming both types.
+func ValueAs[T Scalar](val Value) (T, error) {
+	var t T
+	var err error
+
+	switch p := any(&t).(type) {
+	case *bool:
+		*p, err = val.AsBool()
+	case *string:
+		*p, err = val.AsString()
+	case *int:
+		*p, err = asInt[int](val)
+	case *int8:
+		*p, err = asInt[int8](val)
+	case *int16:
+		*p, err = asInt[int16](val)
+	case *int32:
+		*p, err = asInt[int32](val)
+	case *int64:
+		*p, err = asInt[int64](val)
+	case *uint:
+		*p, err = asUint[uint](val)
+	case *uint8:
+		*p, err = asUint[uint8](val)
+	case *uint16:
+		*p, err = asUint[uint16](val)
+	case *uint32:
+		*p, err = asUint[uint32](val)
+	case *uint64:
+		*p, err = asUint[uint64](val)
+	case *float32:
+		*p, err = asFloat32(val)
+	case *float64:
+		*p, err = val.AsFloat64()
+	case *[]byte:
+		*p, err = val.AsBytes()
+	case *time.Time:
+		*p, err = val.AsTime()
+	default:
+		err = val.mismatch(fmt.Sprintf("%T", t))
+	}
+
+	return t, err
+}
+
+func asInt[I int | int8 | int16 | int32 | int64](val Value) (I, error) {
+	i, err := val.AsInt64()
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(I(i)) != i {
+		return 0, fmt.Errorf("%w: %s value %d overflows %T", ErrTypeMismatch, val.Type(), i, I(0))
+	}
+
+	return I(i), nil
+}
+
+func asUint[U uint | uint8 | uint16 | uint32 | uint64](val Value) (U, error) {
+	u, err := val.AsUint64()
+	if err != nil {
+		return 0, err
+	}
+
+	if uint64(U(u)) != u {
+		return 0, fmt.Errorf("%w: %s value %d overflows %T", ErrTypeMismatch, val.Type(), u, U(0))
+	}
+
+	return U(u), nil
+}
+
+func asFloat32(val Value) (float32, error) {
+	if v, ok := val.Value.(Variant[float32]); ok {
+		return v.unwrap, nil
+	}
+
+	f, err := val.AsFloat64()
+	if err != nil {
+		return 0, err
+	}
+
+	if float64(float32(f)) != f {
+		return 0, fmt.Errorf("%w: %s value %g doesn't fit a float32", ErrTypeMismatch, val.Type(), f)
+	}
+
+	return float32(f), nil
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// conversion is the conversion of a value by ValueAs, to want, or failing
+// when mismatch is set.
+type conversion struct {
+	in       rbus.Value
+	want     any
+	mismatch bool
+}
+
+// checkValueAs checks the conversions to T.
+func checkValueAs[T rbus.Scalar](t *testing.T, conversions ...conversion) {
+	t.Helper()
+
+	for _, c := range conversions {
+		got, err := rbus.ValueAs[T](c.in)
+		if c.mismatch {
+			if !errors.Is(err, rbus.ErrTypeMismatch) {
+				t.Errorf("%T from %s %s: got %v and %v, want %v", got, c.in.Type(), c.in, got, err, rbus.ErrTypeMismatch)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%T from %s %s: got %v and %v, want %v", got, c.in.Type(), c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestValueAs(t *testing.T) {
+	str := rbus.NewValue("s")
+	yes := rbus.NewValue(true)
+	minus := rbus.NewValue(int8(-1))
+	big := rbus.NewValue(uint32(70000))
+	huge := rbus.NewValue(uint64(math.MaxUint64))
+	half := rbus.NewValue(float32(0.5))
+	tenth := rbus.NewValue(0.1)
+	data := rbus.NewValue([]byte{1, 2})
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	date := rbus.NewTimeValue(when)
+
+	t.Run("bool", func(t *testing.T) {
+		checkValueAs[bool](t, conversion{in: yes, want: true}, conversion{in: minus, mismatch: true}, conversion{in: str, mismatch: true})
+	})
+	t.Run("string", func(t *testing.T) {
+		checkValueAs[string](t, conversion{in: str, want: "s"}, conversion{in: big, mismatch: true}, conversion{in: data, mismatch: true})
+	})
+	t.Run("int", func(t *testing.T) {
+		checkValueAs[int](t, conversion{in: minus, want: -1}, conversion{in: big, want: 70000}, conversion{in: huge, mismatch: true}, conversion{in: half, mismatch: true})
+	})
+	t.Run("int8", func(t *testing.T) {
+		checkValueAs[int8](t, conversion{in: minus, want: -1}, conversion{in: big, mismatch: true}, conversion{in: str, mismatch: true})
+	})
+	t.Run("int16", func(t *testing.T) {
+		checkValueAs[int16](t, conversion{in: minus, want: -1}, conversion{in: big, mismatch: true}, conversion{in: yes, mismatch: true})
+	})
+	t.Run("int32", func(t *testing.T) {
+		checkValueAs[int32](t, conversion{in: big, want: 70000}, conversion{in: huge, mismatch: true}, conversion{in: tenth, mismatch: true})
+	})
+	t.Run("int64", func(t *testing.T) {
+		checkValueAs[int64](t, conversion{in: minus, want: -1}, conversion{in: huge, mismatch: true}, conversion{in: date, mismatch: true})
+	})
+	t.Run("uint", func(t *testing.T) {
+		checkValueAs[uint](t, conversion{in: big, want: 70000}, conversion{in: huge, want: uint64(math.MaxUint64)}, conversion{in: minus, mismatch: true})
+	})
+	t.Run("uint8", func(t *testing.T) {
+		checkValueAs[uint8](t, conversion{in: rbus.NewValue(int64(255)), want: 255}, conversion{in: big, mismatch: true}, conversion{in: minus, mismatch: true})
+	})
+	t.Run("uint16", func(t *testing.T) {
+		checkValueAs[uint16](t, conversion{in: rbus.NewValue(uint8(7)), want: 7}, conversion{in: big, mismatch: true}, conversion{in: str, mismatch: true})
+	})
+	t.Run("uint32", func(t *testing.T) {
+		checkValueAs[uint32](t, conversion{in: big, want: 70000}, conversion{in: huge, mismatch: true}, conversion{in: minus, mismatch: true})
+	})
+	t.Run("uint64", func(t *testing.T) {
+		checkValueAs[uint64](t, conversion{in: huge, want: uint64(math.MaxUint64)}, conversion{in: minus, mismatch: true}, conversion{in: half, mismatch: true})
+	})
+	t.Run("float32", func(t *testing.T) {
+		checkValueAs[float32](t, conversion{in: half, want: 0.5}, conversion{in: big, want: 70000}, conversion{in: tenth, mismatch: true},
+			conversion{in: rbus.NewValue(int32(1<<24 + 1)), mismatch: true}, conversion{in: str, mismatch: true})
+	})
+	t.Run("float64", func(t *testing.T) {
+		checkValueAs[float64](t, conversion{in: tenth, want: 0.1}, conversion{in: half, want: 0.5}, conversion{in: minus, want: -1},
+			conversion{in: rbus.NewValue(int64(1 << 53)), want: float64(1 << 53)}, conversion{in: rbus.NewValue(int64(1<<53 + 1)), mismatch: true},
+			conversion{in: yes, mismatch: true})
+	})
+	t.Run("bytes", func(t *testing.T) {
+		checkValueAs[[]byte](t, conversion{in: data, want: []byte{1, 2}}, conversion{in: str, mismatch: true})
+	})
+	t.Run("time", func(t *testing.T) {
+		checkValueAs[time.Time](t, conversion{in: date, want: when}, conversion{in: str, mismatch: true})
+	})
+}
+
+func TestValueAsMismatchNamesBothTypes(t *testing.T) {
+	_, err := rbus.ValueAs[int8](rbus.NewValue("s"))
+	if !errors.Is(err, rbus.ErrTypeMismatch) || !strings.Contains(err.Error(), "string") || !strings.Contains(err.Error(), "int") {
+		t.Fatalf("got %v, want a mismatch naming string and int", err)
+	}
+
+	_, err = rbus.ValueAs[int8](rbus.NewValue(int32(300)))
+	if !errors.Is(err, rbus.ErrTypeMismatch) || !strings.Contains(err.Error(), "int32") || !strings.Contains(err.Error(), "int8") {
+		t.Fatalf("got %v, want a mismatch naming int32 and int8", err)
+	}
+}
+
+func TestGetAs(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	registerValues(t, provider, map[string]rbus.Value{
+		"Device.WiFi.Radio.1.Channel": rbus.NewValue(uint32(6)),
+		"Device.WiFi.SSID.1.SSID":     rbus.NewValue("home"),
+	})
+
+	ctx := context.Background()
+	channel, err := rbus.GetAs[uint8](ctx, consumer, "Device.WiFi.Radio.1.Channel")
+	if err != nil || channel != 6 {
+		t.Fatalf("got %d and %v, want 6", channel, err)
+	}
+
+	if _, err := rbus.GetAs[int](ctx, consumer, "Device.WiFi.SSID.1.SSID"); !errors.Is(err, rbus.ErrTypeMismatch) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrTypeMismatch)
+	}
+	if _, err := rbus.GetAs[string](ctx, consumer, "Device.Nobody.Name"); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+}
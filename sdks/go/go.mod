@@ -1,5 +1,7 @@
 module github.com/schmidtw/rbus-rdk/sdks/go/rbus
 
-go 1.22.0
+go 1.23.0
 
 require github.com/xmidt-org/eventor v1.0.18
+
+require github.com/stretchr/testify v1.11.1 // indirect
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package notify delivers the changes of state of a connection to its
+// listeners, for both rtmessage and rbus.
+package notify
+
+import "sync"
+
+// Notifier delivers the changes of state to the listeners in order.  A single
+// goroutine runs while changes are pending, so none is dropped or reordered
+// however fast they come.  A change to the state last notified, starting with
+// the zero state, is dropped.
+//
+// The zero Notifier is ready to use.
+type Notifier[S comparable] struct {
+	m         sync.Mutex
+	last      S
+	listeners []*entry[S]
+	pending   []change[S]
+	running   bool
+}
+
+// entry is a registered listener.
+type entry[S comparable] struct {
+	listener func(S, error)
+	removed  bool
+}
+
+// change is a change of state waiting to be delivered to the listeners there
+// were when it happened.
+type change[S comparable] struct {
+	state     S
+	err       error
+	listeners []*entry[S]
+}
+
+// Add registers a listener called with each change notified after it was
+// added, returning a function that removes it.
+func (n *Notifier[S]) Add(listener func(S, error)) func() {
+	e := &entry[S]{listener: listener}
+
+	n.m.Lock()
+	n.listeners = append(n.listeners, e)
+	n.m.Unlock()
+
+	return func() {
+		n.m.Lock()
+		defer n.m.Unlock()
+
+		e.removed = true
+		for i, l := range n.listeners {
+			if l == e {
+				n.listeners = append(n.listeners[:i:i], n.listeners[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Notify queues the change of state, along with the error that caused it, if
+// any, for the listeners.  It doesn't wait for them.
+func (n *Notifier[S]) Notify(s S, err error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if s == n.last {
+		return
+	}
+	n.last = s
+
+	if len(n.listeners) == 0 {
+		return
+	}
+
+	n.pending = append(n.pending, change[S]{
+		state:     s,
+		err:       err,
+		listeners: n.listeners,
+	})
+	if !n.running {
+		n.running = true
+		go n.run()
+	}
+}
+
+// run delivers the pending changes until there are none left.
+func (n *Notifier[S]) run() {
+	for {
+		n.m.Lock()
+		if len(n.pending) == 0 {
+			n.running = false
+			n.m.Unlock()
+			return
+		}
+		c := n.pending[0]
+		n.pending = n.pending[1:]
+		n.m.Unlock()
+
+		for _, e := range c.listeners {
+			n.m.Lock()
+			removed := e.removed
+			n.m.Unlock()
+
+			if !removed {
+				e.listener(c.state, c.err)
+			}
+		}
+	}
+}
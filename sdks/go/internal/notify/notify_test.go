@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	var n Notifier[int]
+
+	// The listener is slow, so the changes pile up while it's called.
+	changes := make(chan string, 100)
+	n.Add(func(s int, err error) {
+		time.Sleep(time.Millisecond)
+		changes <- fmt.Sprint(s, err)
+	})
+	removed := n.Add(func(int, error) { t.Error("called after removal") })
+	removed()
+
+	errLost := errors.New("lost")
+	n.Notify(0, nil)
+	for i := range 10 {
+		n.Notify(i%3+1, nil)
+		n.Notify(i%3+1, nil)
+		n.Notify(0, errLost)
+	}
+
+	// The change to the zero state first and the repeated ones are dropped.
+	for i := range 10 {
+		for _, want := range []string{fmt.Sprint(i%3+1, nil), fmt.Sprint(0, errLost)} {
+			select {
+			case got := <-changes:
+				if got != want {
+					t.Fatalf("got %s, want %s", got, want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no change to %s", want)
+			}
+		}
+	}
+	select {
+	case got := <-changes:
+		t.Fatalf("got %s, want no more", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
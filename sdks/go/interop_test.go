@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build interop
+
+// The interop tests run the Go SDK against the C tools, which talk to a real
+// rtrouted.  They are built with the interop tag and expect rtrouted to be
+// running and the tools to be on the PATH:
+//
+//	rtrouted -f -l DEBUG &
+//	go test -tags interop -run Interop ./...
+//
+// RBUS_INTEROP_URL overrides the URL of the router, unix:///tmp/rtrouted.
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// interopURL returns the URL of the router, skipping the test when nothing
+// listens there.
+func interopURL(t *testing.T) string {
+	t.Helper()
+
+	url := os.Getenv("RBUS_INTEROP_URL")
+	if url == "" {
+		url = "unix:///tmp/rtrouted"
+	}
+	if path, ok := strings.CutPrefix(url, "unix://"); ok {
+		if _, err := os.Stat(path); err != nil {
+			t.Skipf("no router at %s: %v", url, err)
+		}
+	}
+
+	return url
+}
+
+// tool returns the path of the C tool, skipping the test when it isn't on the
+// PATH.
+func tool(t *testing.T, name string) string {
+	t.Helper()
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.Skipf("%s: %v", name, err)
+	}
+
+	return path
+}
+
+// run runs the tool to completion, returning its output.
+func run(t *testing.T, path string, args ...string) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %s: %v\n%s", path, strings.Join(args, " "), err, out)
+	}
+
+	return string(out)
+}
+
+func TestInteropRbuscliTableRows(t *testing.T) {
+	url := interopURL(t)
+	rbuscli := tool(t, "rbuscli")
+
+	provider := openHandle(t, url, "go-table-provider")
+	var r rows
+	if err := provider.RegisterTable("Device.GoInterop.Table.", 0, r.callbacks()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := run(t, rbuscli, "addrow", "Device.GoInterop.Table.", "wan")
+	if !strings.Contains(out, "Device.GoInterop.Table.1. added") {
+		t.Fatalf("got %q, want row 1 added", out)
+	}
+	if got := instances(t, provider, "Device.GoInterop.Table."); got != "[1]" {
+		t.Fatalf("got rows %s, want [1]", got)
+	}
+
+	out = run(t, rbuscli, "delrow", "Device.GoInterop.Table.[wan].")
+	if !strings.Contains(out, "deleted successfully") {
+		t.Fatalf("got %q, want the row deleted", out)
+	}
+	if got := instances(t, provider, "Device.GoInterop.Table."); got != "[]" {
+		t.Fatalf("got rows %s, want none", got)
+	}
+
+	// A row the provider doesn't have is refused.
+	out = run(t, rbuscli, "delrow", "Device.GoInterop.Table.7.")
+	if !strings.Contains(out, "failed with error code") {
+		t.Fatalf("got %q, want the deletion to fail", out)
+	}
+}
+
+func TestInteropTableProviderRows(t *testing.T) {
+	url := interopURL(t)
+	provider := tool(t, "rbusTableProvider")
+
+	// The sample provider registers Device.Tables1.T1. and exits after the
+	// number of seconds it's given.
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, provider, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = cmd.Wait()
+	})
+
+	consumer := openHandle(t, url, "go-table-consumer")
+
+	// Wait for the provider to register the table.
+	var instance uint32
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		instance, err = consumer.AddTableRow(context.Background(), "Device.Tables1.T1.", "go")
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, rtmessage.ErrNoRoute) || time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if instance == 0 {
+		t.Fatal("got row 0")
+	}
+
+	names, err := consumer.GetRowNames(context.Background(), "Device.Tables1.T1.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(names, func(r rbus.RowInfo) bool { return r.Instance == instance && r.Alias == "go" }) {
+		t.Fatalf("got %+v, want row %d aliased go", names, instance)
+	}
+
+	if err := consumer.RemoveTableRow(context.Background(), "Device.Tables1.T1.[go]."); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.RemoveTableRow(context.Background(), fmt.Sprintf("Device.Tables1.T1.%d.", instance)); err == nil {
+		t.Fatal("removed the row twice")
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// entries returns the entries the JSON logger wrote to the logs.
+func (l *logs) entries(t *testing.T) []map[string]any {
+	t.Helper()
+
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(l.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// find returns the first entry of the logs at the level with the message
+// and the attributes, waiting a while for it to be written.
+func (l *logs) find(t *testing.T, level, msg string, attrs map[string]any) map[string]any {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, e := range l.entries(t) {
+			if e["level"] != level || e["msg"] != msg {
+				continue
+			}
+			found := true
+			for k, v := range attrs {
+				if fmt.Sprint(e[k]) != fmt.Sprint(v) {
+					found = false
+				}
+			}
+			if found {
+				return e
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s entry %q with %v in\n%s", level, msg, attrs, l.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{"Device.Test.X": rbus.NewValue("x")})
+
+	var l logs
+	logger := slog.New(slog.NewJSONHandler(&l, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	consumer := openHandle(t, b.URL(), "consumer", rbus.WithLogger(logger))
+
+	ctx := context.Background()
+	if _, err := consumer.Get(ctx, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The handle tells of the request and its response, and the connection
+	// it made of the message carrying it.
+	l.find(t, "DEBUG", "request sent", map[string]any{
+		"method": "METHOD_GETPARAMETERVALUES",
+		"topic":  "Device.Test.X",
+		"names":  []any{"Device.Test.X"},
+	})
+	resp := l.find(t, "DEBUG", "response received", map[string]any{
+		"method": "METHOD_GETPARAMETERVALUES",
+		"code":   float64(0),
+	})
+	if _, found := resp["latency"]; !found {
+		t.Fatalf("got %v, want a latency", resp)
+	}
+	sent := 0
+	for _, e := range l.entries(t) {
+		if _, found := e["sequence"]; found && e["msg"] == "request sent" && e["topic"] == "Device.Test.X" {
+			sent++
+		}
+	}
+	if sent != 1 {
+		t.Fatalf("got %d entries of the connection sending the request, want 1 in\n%s", sent, l.String())
+	}
+
+	sub, err := consumer.Subscribe(ctx, "Device.Test.X", func(rbus.Event) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.find(t, "DEBUG", "subscribed", map[string]any{"name": "Device.Test.X"})
+
+	// The reconnect restores the subscription.
+	b.Router().DropConnections()
+	l.find(t, "WARN", "connection lost", map[string]any{"inbox": consumer.Inbox()})
+	l.find(t, "DEBUG", "resubscribed", map[string]any{"name": "Device.Test.X"})
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l.find(t, "DEBUG", "unsubscribed", map[string]any{"name": "Device.Test.X"})
+
+	// What can't be decoded is warned of.
+	msg := rtmessage.Message{Header: &rtmessage.Header{Topic: consumer.Inbox()}, Payload: []byte{0xc1}}
+	if err := b.Router().Inject(msg); err != nil {
+		t.Fatal(err)
+	}
+	l.find(t, "WARN", "malformed event", map[string]any{"topic": consumer.Inbox()})
+}
+
+func TestWithLoggerLevel(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{"Device.Test.X": rbus.NewValue("x")})
+
+	// Only the warnings get through a logger of warnings.
+	var l logs
+	consumer := openHandle(t, b.URL(), "consumer", rbus.WithLogger(l.logger()))
+	if _, err := consumer.Get(context.Background(), "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.String(); got != "" {
+		t.Fatalf("got logs %q, want none", got)
+	}
+
+	if _, err := rbus.New(rbus.WithURL(b.URL()), rbus.WithLogger(nil)); err == nil {
+		t.Fatal("got no error for a nil logger")
+	}
+}
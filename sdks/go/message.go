@@ -0,0 +1,509 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrMalformedMessage = errors.New("malformed message")
+	ErrUnsupportedType  = errors.New("unsupported type")
+)
+
+// ValueWireFormat selects how a Value is serialized into a Message.
+type ValueWireFormat int
+
+const (
+	// RbusTyped encodes a value as its rbus type code followed by the data,
+	// exactly as rbusValue_appendToMessage does in the C library.  Every
+	// provider and consumer built on librbus expects this format, so it is
+	// the default.
+	RbusTyped ValueWireFormat = iota
+
+	// PlainMsgpack encodes a value as a bare msgpack scalar with no type
+	// code.  It is intended for peers that are not rbus providers, such as
+	// tools exchanging msgpack directly over rtmessage.  Since no type code
+	// is present, decoding infers the type from the msgpack family: integers
+	// become Int64 (or UInt64 when too large), floats keep their width,
+	// strings are strings and binary data is bytes.
+	PlainMsgpack
+)
+
+func (f ValueWireFormat) String() string {
+	switch f {
+	case RbusTyped:
+		return "rbus"
+	case PlainMsgpack:
+		return "msgpack"
+	}
+	return "unknown"
+}
+
+// Message is an rbus message: a sequence of msgpack encoded fields optionally
+// followed by a meta section naming the method being invoked.  Fields are
+// appended in order by the sender and popped in the same order by the
+// receiver.
+type Message struct {
+	buf    []byte
+	offset int
+	format ValueWireFormat
+	depth  int
+}
+
+// maxNestingDepth bounds how deeply the objects of a value or the terms of a
+// filter nest, so a message can't exhaust the stack of the goroutine decoding
+// it.
+const maxNestingDepth = 32
+
+// nest enters a nested object or filter while decoding, failing when it's nested too
+// deeply.  The returned function leaves it.
+func (m *Message) nest() (func(), error) {
+	if m.depth >= maxNestingDepth {
+		return nil, m.decodeError(m.offset, fmt.Errorf("nested more than %d levels deep", maxNestingDepth))
+	}
+	m.depth++
+	return func() { m.depth-- }, nil
+}
+
+// NewMessage creates an empty message for writing.
+func NewMessage() *Message {
+	return &Message{}
+}
+
+// NewMessageFromBytes creates a message for reading from the encoded bytes.
+func NewMessageFromBytes(b []byte) *Message {
+	return &Message{buf: b}
+}
+
+// SetValueWireFormat selects the format used by AppendValue and PopValue.
+func (m *Message) SetValueWireFormat(f ValueWireFormat) {
+	m.format = f
+}
+
+// Bytes returns the encoded message.
+func (m *Message) Bytes() []byte {
+	return m.buf
+}
+
+// remaining returns the number of bytes left to read.
+func (m *Message) remaining() int {
+	return len(m.buf) - m.offset
+}
+
+// AppendString appends a string field.  Like the C library, the string is
+// sent with a trailing NUL terminator.
+func (m *Message) AppendString(s string) {
+	b := make([]byte, 0, len(s)+1)
+	b = append(b, s...)
+	m.buf = appendStr(m.buf, append(b, 0))
+}
+
+// AppendInt32 appends a 32 bit integer field.
+func (m *Message) AppendInt32(v int32) {
+	m.buf = appendInt(m.buf, int64(v))
+}
+
+// AppendInt64 appends a 64 bit integer field.
+func (m *Message) AppendInt64(v int64) {
+	m.buf = appendInt(m.buf, v)
+}
+
+// AppendDouble appends a floating point field.
+func (m *Message) AppendDouble(v float64) {
+	m.buf = appendFloat64(m.buf, v)
+}
+
+// AppendBytes appends a binary field.
+func (m *Message) AppendBytes(b []byte) {
+	m.buf = appendBin(m.buf, b)
+}
+
+// AppendValue appends a value using the message's ValueWireFormat.
+func (m *Message) AppendValue(val Value) error {
+	if m.format == PlainMsgpack {
+		return m.appendPlainValue(val)
+	}
+
+	m.AppendInt32(int32(val.Type()))
+
+	switch v := val.Value.(type) {
+	case nil:
+		m.AppendBytes(nil)
+	case Variant[bool]:
+		b := byte(0)
+		if v.unwrap {
+			b = 1
+		}
+		m.AppendBytes([]byte{b})
+	case Variant[int8]:
+		m.AppendBytes([]byte{byte(v.unwrap)})
+	case Variant[uint8]:
+		m.AppendBytes([]byte{v.unwrap})
+	case Variant[int16]:
+		m.AppendInt32(int32(v.unwrap))
+	case Variant[uint16]:
+		m.AppendInt32(int32(v.unwrap))
+	case Variant[int32]:
+		m.AppendInt32(v.unwrap)
+	case Variant[uint32]:
+		m.AppendInt32(int32(v.unwrap))
+	case Variant[int]:
+		m.AppendInt64(int64(v.unwrap))
+	case Variant[int64]:
+		m.AppendInt64(v.unwrap)
+	case Variant[uint64]:
+		m.AppendInt64(int64(v.unwrap))
+	case Variant[float32]:
+		m.AppendDouble(float64(v.unwrap))
+	case Variant[float64]:
+		m.AppendDouble(v.unwrap)
+	case Variant[string]:
+		b := make([]byte, 0, len(v.unwrap)+1)
+		b = append(b, v.unwrap...)
+		m.AppendBytes(append(b, 0))
+	case Variant[[]byte]:
+		m.AppendBytes(v.unwrap)
+	case dateTime:
+		m.AppendBytes(v.marshal())
+	case object:
+		return appendObject(m, "", v.props)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	return nil
+}
+
+func (m *Message) appendPlainValue(val Value) error {
+	switch v := val.Value.(type) {
+	case nil:
+		m.buf = append(m.buf, mpNil)
+	case Variant[bool]:
+		m.buf = appendBool(m.buf, v.unwrap)
+	case Variant[int8]:
+		m.buf = appendInt(m.buf, int64(v.unwrap))
+	case Variant[uint8]:
+		m.buf = appendUint(m.buf, uint64(v.unwrap))
+	case Variant[int16]:
+		m.buf = appendInt(m.buf, int64(v.unwrap))
+	case Variant[uint16]:
+		m.buf = appendUint(m.buf, uint64(v.unwrap))
+	case Variant[int32]:
+		m.buf = appendInt(m.buf, int64(v.unwrap))
+	case Variant[uint32]:
+		m.buf = appendUint(m.buf, uint64(v.unwrap))
+	case Variant[int]:
+		m.buf = appendInt(m.buf, int64(v.unwrap))
+	case Variant[int64]:
+		m.buf = appendInt(m.buf, v.unwrap)
+	case Variant[uint64]:
+		m.buf = appendUint(m.buf, v.unwrap)
+	case Variant[float32]:
+		m.buf = appendFloat32(m.buf, v.unwrap)
+	case Variant[float64]:
+		m.buf = appendFloat64(m.buf, v.unwrap)
+	case Variant[string]:
+		m.buf = appendStr(m.buf, []byte(v.unwrap))
+	case Variant[[]byte]:
+		m.buf = appendBin(m.buf, v.unwrap)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	return nil
+}
+
+// decodeContext is the number of bytes shown on either side of the failure
+// point in decode errors.
+const decodeContext = 8
+
+// decodeError wraps err with the offset the decoding failed at and a hexdump
+// of the surrounding bytes, with the byte at the offset in brackets.
+func (m *Message) decodeError(offset int, err error) error {
+	start := max(offset-decodeContext, 0)
+	end := min(offset+decodeContext+1, len(m.buf))
+
+	var dump string
+	switch {
+	case offset >= len(m.buf):
+		dump = fmt.Sprintf("% x []", m.buf[start:])
+	default:
+		dump = fmt.Sprintf("% x [%02x] % x", m.buf[start:offset], m.buf[offset], m.buf[offset+1:end])
+	}
+
+	return fmt.Errorf("%w: %w at offset %d of %d: %s",
+		ErrMalformedMessage, err, offset, len(m.buf), strings.TrimSpace(dump))
+}
+
+// pop decodes the next field, verifying it is one of the expected kinds.
+func (m *Message) pop(kinds ...mpKind) (mpItem, error) {
+	item, n, err := decodeItem(m.buf[m.offset:])
+	if err != nil {
+		return mpItem{}, m.decodeError(m.offset, err)
+	}
+
+	for _, k := range kinds {
+		if item.kind == k {
+			m.offset += n
+			return item, nil
+		}
+	}
+
+	return mpItem{}, m.decodeError(m.offset, fmt.Errorf("unexpected %s field", item.kind))
+}
+
+// PopString reads the next field as a string, dropping the NUL terminator.
+func (m *Message) PopString() (string, error) {
+	item, err := m.pop(mpKindStr)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(item.raw, []byte{0})), nil
+}
+
+// PopInt32 reads the next field as a 32 bit integer.
+func (m *Message) PopInt32() (int32, error) {
+	item, err := m.pop(mpKindInt, mpKindUint)
+	if err != nil {
+		return 0, err
+	}
+	i, _ := item.asInt64()
+	return int32(i), nil
+}
+
+// PopInt64 reads the next field as a 64 bit integer.
+func (m *Message) PopInt64() (int64, error) {
+	item, err := m.pop(mpKindInt, mpKindUint)
+	if err != nil {
+		return 0, err
+	}
+	i, _ := item.asInt64()
+	return i, nil
+}
+
+// PopDouble reads the next field as a floating point number.
+func (m *Message) PopDouble() (float64, error) {
+	item, err := m.pop(mpKindFloat64, mpKindFloat32)
+	if err != nil {
+		return 0, err
+	}
+	return item.f, nil
+}
+
+// PopBytes reads the next field as binary data.  The returned slice is a
+// copy and may be retained by the caller.
+func (m *Message) PopBytes() ([]byte, error) {
+	item, err := m.pop(mpKindBin)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(item.raw), nil
+}
+
+// PopValue reads the next value using the message's ValueWireFormat.
+func (m *Message) PopValue() (Value, error) {
+	if m.format == PlainMsgpack {
+		return m.popPlainValue()
+	}
+
+	t, err := m.PopInt32()
+	if err != nil {
+		return Value{}, err
+	}
+
+	typ := ValueType(t)
+	switch typ {
+	case ValueTypeInt16, ValueTypeUInt16, ValueTypeInt32, ValueTypeUInt32:
+		i, err := m.PopInt32()
+		if err != nil {
+			return Value{}, err
+		}
+		switch typ {
+		case ValueTypeInt16:
+			return NewValue(int16(i)), nil
+		case ValueTypeUInt16:
+			return NewValue(uint16(i)), nil
+		case ValueTypeInt32:
+			return NewValue(i), nil
+		}
+		return NewValue(uint32(i)), nil
+	case ValueTypeInt64:
+		i, err := m.PopInt64()
+		if err != nil {
+			return Value{}, err
+		}
+		return NewValue(i), nil
+	case ValueTypeUInt64:
+		i, err := m.PopInt64()
+		if err != nil {
+			return Value{}, err
+		}
+		return NewValue(uint64(i)), nil
+	case ValueTypeSingle:
+		f, err := m.PopDouble()
+		if err != nil {
+			return Value{}, err
+		}
+		return NewValue(float32(f)), nil
+	case ValueTypeDouble:
+		f, err := m.PopDouble()
+		if err != nil {
+			return Value{}, err
+		}
+		return NewValue(f), nil
+	case ValueTypeObject:
+		props, err := popObject(m)
+		if err != nil {
+			return Value{}, err
+		}
+		return NewObjectValue(props...), nil
+	}
+
+	// Everything else is sent as the raw bytes of the C value.
+	start := m.offset
+	b, err := m.PopBytes()
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch typ {
+	case ValueTypeBoolean:
+		if len(b) != 1 {
+			return Value{}, m.decodeError(start, fmt.Errorf("boolean of length %d", len(b)))
+		}
+		return NewValue(b[0] != 0), nil
+	case ValueTypeChar, ValueTypeInt8:
+		if len(b) != 1 {
+			return Value{}, m.decodeError(start, fmt.Errorf("int8 of length %d", len(b)))
+		}
+		return NewValue(int8(b[0])), nil
+	case ValueTypeByte, ValueTypeUInt8:
+		if len(b) != 1 {
+			return Value{}, m.decodeError(start, fmt.Errorf("uint8 of length %d", len(b)))
+		}
+		return NewValue(b[0]), nil
+	case ValueTypeString:
+		return NewValue(string(bytes.TrimSuffix(b, []byte{0}))), nil
+	case ValueTypeBytes:
+		return Value{Variant[[]byte]{b}}, nil
+	case ValueTypeDateTime:
+		t, err := unmarshalDateTime(b)
+		if err != nil {
+			return Value{}, m.decodeError(start, err)
+		}
+		return NewTimeValue(t), nil
+	case ValueTypeNone:
+		return Value{}, nil
+	}
+
+	return Value{}, fmt.Errorf("%w: value type 0x%x", ErrUnsupportedType, t)
+}
+
+func (m *Message) popPlainValue() (Value, error) {
+	item, err := m.pop(mpKindNil, mpKindBool, mpKindInt, mpKindUint,
+		mpKindFloat32, mpKindFloat64, mpKindStr, mpKindBin)
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch item.kind {
+	case mpKindBool:
+		return NewValue(item.b), nil
+	case mpKindInt:
+		return NewValue(item.i), nil
+	case mpKindUint:
+		if item.u > math.MaxInt64 {
+			return NewValue(item.u), nil
+		}
+		return NewValue(int64(item.u)), nil
+	case mpKindFloat32:
+		return NewValue(float32(item.f)), nil
+	case mpKindFloat64:
+		return NewValue(item.f), nil
+	case mpKindStr:
+		return NewValue(string(item.raw)), nil
+	case mpKindBin:
+		return NewValue(item.raw), nil
+	}
+
+	return Value{}, nil
+}
+
+// SetMetaInfo appends the meta section carrying the method name and the
+// OpenTelemetry parent and state.  It must be the last thing written to the
+// message.
+func (m *Message) SetMetaInfo(method, otParent, otState string) {
+	offset := len(m.buf)
+
+	m.AppendString(method)
+	m.AppendString(otParent)
+	m.AppendString(otState)
+
+	m.appendMetaOffset(offset)
+}
+
+// setEventMetaInfo appends the meta section of an event, which carries the
+// names of the event and of the object it is about instead of a method, the
+// way rbus_publishSubscriberEvent writes it.
+func (m *Message) setEventMetaInfo(eventName, objectName string) {
+	offset := len(m.buf)
+
+	m.AppendString(eventName)
+	m.AppendString(objectName)
+	m.AppendInt32(1) // rbus 2 event
+
+	m.appendMetaOffset(offset)
+}
+
+// appendMetaOffset ends the message with the offset of its meta section.
+func (m *Message) appendMetaOffset(offset int) {
+	// The C library stores the section offset as a 4-byte msgpack int32 by
+	// masking in the sign bit, then clears it from the packed bytes.
+	m.buf = append(m.buf, mpInt32)
+	m.buf = binary.BigEndian.AppendUint32(m.buf, uint32(offset)&0x7fffffff)
+}
+
+// GetMetaInfo reads the meta section without disturbing the read position
+// of the regular fields.
+func (m *Message) GetMetaInfo() (method, otParent, otState string, err error) {
+	meta, err := m.metaSection()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if method, err = meta.PopString(); err != nil {
+		return "", "", "", err
+	}
+	if otParent, err = meta.PopString(); err != nil {
+		return "", "", "", err
+	}
+	if otState, err = meta.PopString(); err != nil {
+		return "", "", "", err
+	}
+
+	return method, otParent, otState, nil
+}
+
+// metaSection returns a message reading the meta section.  Requests carry the
+// method in it, while events carry the event and object names instead.
+func (m *Message) metaSection() (*Message, error) {
+	const trailer = 5
+
+	if len(m.buf) < trailer || m.buf[len(m.buf)-trailer] != mpInt32 {
+		return nil, fmt.Errorf("%w: missing meta section", ErrMalformedMessage)
+	}
+
+	offset := int(binary.BigEndian.Uint32(m.buf[len(m.buf)-4:]))
+	if offset > len(m.buf)-trailer {
+		return nil, fmt.Errorf("%w: invalid meta section offset %d", ErrMalformedMessage, offset)
+	}
+
+	return &Message{buf: m.buf[:len(m.buf)-trailer], offset: offset, format: m.format}, nil
+}
@@ -0,0 +1,300 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValueWireFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    Value
+		plain Value // what PlainMsgpack decodes, when it differs from in
+	}{
+		{name: "none", in: Value{}},
+		{name: "bool", in: NewValue(true)},
+		{name: "int8", in: NewValue(int8(-8)), plain: NewValue(int64(-8))},
+		{name: "uint8", in: NewValue(uint8(200)), plain: NewValue(int64(200))},
+		{name: "int16", in: NewValue(int16(-1600)), plain: NewValue(int64(-1600))},
+		{name: "uint16", in: NewValue(uint16(60000)), plain: NewValue(int64(60000))},
+		{name: "int32", in: NewValue(int32(math.MinInt32)), plain: NewValue(int64(math.MinInt32))},
+		{name: "uint32", in: NewValue(uint32(math.MaxUint32)), plain: NewValue(int64(math.MaxUint32))},
+		{name: "int64", in: NewValue(int64(math.MinInt64))},
+		{name: "uint64", in: NewValue(uint64(math.MaxUint64))},
+		{name: "single", in: NewValue(float32(1.5))},
+		{name: "double", in: NewValue(-2.25)},
+		{name: "string", in: NewValue("Device.DeviceInfo")},
+		{name: "empty string", in: NewValue("")},
+		{name: "bytes", in: NewValue([]byte{0, 1, 2, 0xff})},
+		{name: "empty bytes", in: NewValue([]byte{})},
+		{name: "one byte", in: NewValue([]byte{0x7f})},
+		{name: "bytes of kilobytes", in: NewValue(bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 4096))},
+	}
+
+	for _, format := range []ValueWireFormat{RbusTyped, PlainMsgpack} {
+		for _, tc := range tests {
+			t.Run(format.String()+"/"+tc.name, func(t *testing.T) {
+				want := tc.in
+				if format == PlainMsgpack && tc.plain.Value != nil {
+					want = tc.plain
+				}
+
+				w := NewMessage()
+				w.SetValueWireFormat(format)
+				if err := w.AppendValue(tc.in); err != nil {
+					t.Fatal(err)
+				}
+				w.AppendString("after")
+
+				r := NewMessageFromBytes(w.Bytes())
+				r.SetValueWireFormat(format)
+				got, err := r.PopValue()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.Equal(want) {
+					t.Fatalf("got %s %s, want %s %s", got.Type(), got, want.Type(), want)
+				}
+
+				// The value must consume exactly its own bytes.
+				if s, err := r.PopString(); err != nil || s != "after" {
+					t.Fatalf("got %q, %v after the value", s, err)
+				}
+			})
+		}
+	}
+}
+
+func TestValueWireFormatsDiffer(t *testing.T) {
+	typed := NewMessage()
+	if err := typed.AppendValue(NewValue(int32(7))); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := NewMessage()
+	plain.SetValueWireFormat(PlainMsgpack)
+	if err := plain.AppendValue(NewValue(int32(7))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The typed format leads with the type code, the plain one is the bare
+	// positive fixint.
+	if want := []byte{0xcd, 0x05, 0x07, 0x07}; string(typed.Bytes()) != string(want) {
+		t.Fatalf("typed: got % x, want % x", typed.Bytes(), want)
+	}
+	if want := []byte{0x07}; string(plain.Bytes()) != string(want) {
+		t.Fatalf("plain: got % x, want % x", plain.Bytes(), want)
+	}
+}
+
+func TestPlainMsgpackRejectsObjects(t *testing.T) {
+	m := NewMessage()
+	m.SetValueWireFormat(PlainMsgpack)
+
+	err := m.AppendValue(NewObjectValue(Property{Name: "a", Value: NewValue(1)}))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("got %v, want %v", err, ErrUnsupportedType)
+	}
+}
+
+func TestDecodeErrorOffset(t *testing.T) {
+	w := NewMessage()
+	w.AppendString("first")
+	w.AppendInt32(7)
+	b := w.Bytes()
+
+	// A string where the integer should be.
+	r := NewMessageFromBytes(b)
+	if _, err := r.PopString(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.PopString()
+	if !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("got %v, want %v", err, ErrMalformedMessage)
+	}
+	if want := "at offset 7 of 8: a6 66 69 72 73 74 00 [07]"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %q, want it to contain %q", err, want)
+	}
+
+	// A field cut short, failing past the end of the buffer.
+	r = NewMessageFromBytes(b[:4])
+	_, err = r.PopString()
+	if !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("got %v, want %v", err, ErrMalformedMessage)
+	}
+	if want := "at offset 0 of 4: [a6] 66 69 72"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %q, want it to contain %q", err, want)
+	}
+
+	// Nothing left at all.
+	r = NewMessageFromBytes(nil)
+	_, err = r.PopInt32()
+	if want := "at offset 0 of 0: []"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %v, want it to contain %q", err, want)
+	}
+}
+
+func TestDecodeErrorOffsetInValue(t *testing.T) {
+	// A boolean of two bytes fails at its bytes, not at its type code.
+	w := NewMessage()
+	w.AppendInt32(int32(ValueTypeBoolean))
+	w.AppendBytes([]byte{1, 1})
+
+	_, err := NewMessageFromBytes(w.Bytes()).PopValue()
+	if !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("got %v, want %v", err, ErrMalformedMessage)
+	}
+	if want := "boolean of length 2 at offset 3 of 7: cd 05 00 [c4] 02 01 01"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %q, want it to contain %q", err, want)
+	}
+}
+
+// nestedProperties encodes an object value whose single property holds an
+// object value, depth objects deep.
+func nestedProperties(depth int) []byte {
+	m := NewMessage()
+	for range depth {
+		m.AppendInt32(int32(ValueTypeObject))
+		m.AppendString("")
+		m.AppendInt32(0)
+		m.AppendInt32(1)
+		m.AppendString("a")
+	}
+	m.AppendInt32(int32(ValueTypeNone))
+	m.AppendBytes(nil)
+	for range depth {
+		m.AppendInt32(0)
+	}
+	return m.Bytes()
+}
+
+// nestedChildren encodes an object value whose single child has a single
+// child, depth objects deep.
+func nestedChildren(depth int) []byte {
+	m := NewMessage()
+	m.AppendInt32(int32(ValueTypeObject))
+	for range depth - 1 {
+		m.AppendString("")
+		m.AppendInt32(0)
+		m.AppendInt32(0)
+		m.AppendInt32(1)
+	}
+	m.AppendString("")
+	m.AppendInt32(0)
+	m.AppendInt32(0)
+	m.AppendInt32(0)
+	return m.Bytes()
+}
+
+func TestPopValueNesting(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		wantErr bool
+	}{
+		{name: "properties at the limit", in: nestedProperties(maxNestingDepth)},
+		{name: "properties past the limit", in: nestedProperties(maxNestingDepth + 1), wantErr: true},
+		{name: "properties far past the limit", in: nestedProperties(1_000_000), wantErr: true},
+		{name: "children at the limit", in: nestedChildren(maxNestingDepth)},
+		{name: "children past the limit", in: nestedChildren(maxNestingDepth + 1), wantErr: true},
+		{name: "children far past the limit", in: nestedChildren(1_000_000), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewMessageFromBytes(tt.in).PopValue()
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformedMessage) {
+					t.Fatalf("got %v, want %v", err, ErrMalformedMessage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want nil", err)
+			}
+			if got := v.Type(); got != ValueTypeObject {
+				t.Fatalf("got %v, want %v", got, ValueTypeObject)
+			}
+		})
+	}
+}
+
+// fuzzValues seed the fuzzing of the value decoder.
+var fuzzValues = []Value{
+	{},
+	NewValue(true),
+	NewValue(int8(-8)),
+	NewValue(uint8(200)),
+	NewValue(int16(-1600)),
+	NewValue(uint32(math.MaxUint32)),
+	NewValue(int64(math.MinInt64)),
+	NewValue(uint64(math.MaxUint64)),
+	NewValue(float32(1.5)),
+	NewValue(-2.25),
+	NewValue("Device.DeviceInfo"),
+	NewValue([]byte{0, 1, 2, 0xff}),
+	NewObjectValue(Property{Name: "a", Value: NewValue(int32(1))},
+		Property{Name: "b", Value: NewObjectValue(Property{Name: "c", Value: NewValue("d")})}),
+}
+
+func FuzzPopValue(f *testing.F) {
+	for _, format := range []ValueWireFormat{RbusTyped, PlainMsgpack} {
+		for _, v := range fuzzValues {
+			m := NewMessage()
+			m.SetValueWireFormat(format)
+			if err := m.AppendValue(v); err != nil {
+				continue
+			}
+			f.Add(format == PlainMsgpack, m.Bytes())
+		}
+	}
+	f.Add(false, nestedProperties(maxNestingDepth+1))
+	f.Add(false, nestedChildren(maxNestingDepth+1))
+
+	f.Fuzz(func(t *testing.T, plain bool, b []byte) {
+		format := RbusTyped
+		if plain {
+			format = PlainMsgpack
+		}
+
+		r := NewMessageFromBytes(b)
+		r.SetValueWireFormat(format)
+		v, err := r.PopValue()
+		if err != nil {
+			if !errors.Is(err, ErrMalformedMessage) && !errors.Is(err, ErrUnsupportedType) {
+				t.Fatalf("got %v, want %v or %v", err, ErrMalformedMessage, ErrUnsupportedType)
+			}
+			return
+		}
+
+		// Whatever decodes encodes to bytes that decode to the same.
+		once, err := encodeValue(format, v)
+		if err != nil {
+			return
+		}
+		r = NewMessageFromBytes(once)
+		r.SetValueWireFormat(format)
+		again, err := r.PopValue()
+		if err != nil {
+			t.Fatalf("decoding % x: %v", once, err)
+		}
+		twice, err := encodeValue(format, again)
+		if err != nil || !bytes.Equal(once, twice) {
+			t.Fatalf("got % x and %v, want % x", twice, err, once)
+		}
+	})
+}
+
+// encodeValue returns the value encoded in the format.
+func encodeValue(format ValueWireFormat, v Value) ([]byte, error) {
+	m := NewMessage()
+	m.SetValueWireFormat(format)
+	err := m.AppendValue(v)
+	return m.Bytes(), err
+}
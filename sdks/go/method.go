@@ -0,0 +1,347 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const methodRPC = "METHOD_RPC"
+
+// Invoke calls the named method of a provider, such as "Device.Reboot()",
+// with the input parameters, returning its output parameters.  The in
+// parameters can be nil for a method that takes none.
+//
+// When the method fails the error matches the ErrorCode the provider
+// returned, and the output parameters it sent anyway, usually "error_code"
+// and "error_string", are returned along with it.  ToComponent sends the
+// call to the named component rather than the provider the router picks.
+func (h *Handle) Invoke(ctx context.Context, methodName string, in []Property, opts ...CallOption) ([]Property, error) {
+	req, err := h.invokeRequest(ctx, methodName, in)
+	if err != nil {
+		return nil, fmt.Errorf("invoke '%s': %w", methodName, err)
+	}
+
+	var out []Property
+	err = h.retry(ctx, true, func() (err error) {
+		out, err = h.invoke(ctx, methodName, req, newCallConfig(opts))
+		return err
+	})
+
+	return out, err
+}
+
+// InvokeAsync calls the named method of a provider like Invoke does, but
+// returns once the call is under way, calling done with the outcome.  It
+// suits methods that take minutes, such as a firmware download, for which
+// the provider answers only when it's done.  The call lasts until the
+// provider answers or the context is done; when the handle is closed first,
+// done is called with an error matching ErrHandleClosed.
+func (h *Handle) InvokeAsync(ctx context.Context, methodName string, in []Property, done func([]Property, error), opts ...CallOption) error {
+	if done == nil {
+		return fmt.Errorf("invoke '%s': nil completion handler", methodName)
+	}
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("invoke '%s': %w", methodName, err)
+	}
+
+	req, err := h.invokeRequest(ctx, methodName, in)
+	if err != nil {
+		return fmt.Errorf("invoke '%s': %w", methodName, err)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	id := h.trackCall(cancel)
+
+	go func() {
+		out, err := h.invoke(ctx, methodName, req, newCallConfig(opts))
+		if errors.Is(context.Cause(ctx), ErrHandleClosed) {
+			out, err = nil, fmt.Errorf("invoke '%s': %w", methodName, ErrHandleClosed)
+		}
+
+		h.untrackCall(id)
+		cancel(nil)
+
+		done(out, err)
+	}()
+
+	return nil
+}
+
+// trackCall makes the method call, made or served, or the request end when
+// the handle is closed, returning its id for untrackCall.
+func (h *Handle) trackCall(cancel context.CancelCauseFunc) uint64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.trackCallLocked(cancel)
+}
+
+// trackCallLocked is trackCall called with h.m held.
+func (h *Handle) trackCallLocked(cancel context.CancelCauseFunc) uint64 {
+	h.lastCall++
+	if h.calls == nil {
+		h.calls = make(map[uint64]context.CancelCauseFunc)
+	}
+	h.calls[h.lastCall] = cancel
+
+	return h.lastCall
+}
+
+// untrackCall forgets the method call or request once it's over.
+func (h *Handle) untrackCall(id uint64) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	delete(h.calls, id)
+}
+
+// cancelCalls ends the outstanding method calls and requests with
+// ErrHandleClosed.
+func (h *Handle) cancelCalls() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for id, cancel := range h.calls {
+		cancel(ErrHandleClosed)
+		delete(h.calls, id)
+	}
+}
+
+// invokeRequest builds the request calling the method the way
+// rbusMethod_InvokeInternal does: the input parameters travel as an object.
+func (h *Handle) invokeRequest(ctx context.Context, methodName string, in []Property) (*Message, error) {
+	h.m.Lock()
+	session := h.session
+	h.m.Unlock()
+
+	req := h.newMessage()
+	req.AppendInt32(int32(session))
+	req.AppendString(methodName)
+	if in == nil {
+		req.AppendInt32(0)
+	} else {
+		req.AppendInt32(1)
+		if err := appendObject(req, "", in); err != nil {
+			return nil, err
+		}
+	}
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodRPC, parent, state)
+
+	return req, nil
+}
+
+// invoke sends the request calling the method and decodes the response.
+func (h *Handle) invoke(ctx context.Context, methodName string, req *Message, cfg callConfig) ([]Property, error) {
+	resp, err := h.request(ctx, cfg.topic(methodName), req)
+	if err != nil {
+		return nil, fmt.Errorf("invoke '%s': %w", methodName, cfg.wrap(err))
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return nil, fmt.Errorf("invoke '%s': %w", methodName, err)
+	}
+
+	out, err := popObject(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invoke '%s': %w", methodName, err)
+	}
+
+	if err := checkReturnCode(rc); err != nil {
+		if msg := errorString(out, err); msg != "" {
+			return out, fmt.Errorf("invoke '%s': %w: %s", methodName, err, msg)
+		}
+		return out, fmt.Errorf("invoke '%s': %w", methodName, err)
+	}
+
+	return out, nil
+}
+
+// errorString returns the "error_string" output parameter of a failed method,
+// less the name of the return code.
+func errorString(out []Property, code error) string {
+	for _, p := range out {
+		if p.Name != "error_string" {
+			continue
+		}
+		s := p.Value.String()
+		if strings.HasPrefix(s, "RBUS_ERROR_") || strings.EqualFold(s, code.Error()) {
+			return ""
+		}
+		return strings.TrimPrefix(s, code.Error()+": ")
+	}
+	return ""
+}
+
+// MethodHandler answers the calls of a method registered by a provider,
+// returning the output parameters.  An error wrapping an ErrorCode is
+// reported to the caller as that code, any other error as ErrBus; unless the
+// output parameters already hold them, "error_code" and "error_string" are
+// added to describe it, like the C library does.
+//
+// A handler that can't answer right away returns ErrAsyncResponse after
+// taking the function MethodReply returns for its context, and calls that
+// function with the outcome once it has it.
+//
+// The handlers are called on a goroutine of their own for each call, so a
+// slow method doesn't hold up other requests, and they must be safe for
+// concurrent use.  The context is done when the handle is closed, and carries
+// the trace context the consumer sent; see TraceContext.
+type MethodHandler func(ctx context.Context, in []Property) ([]Property, error)
+
+// methodReplyKey is the context key of the function answering a method call
+// later.
+type methodReplyKey struct{}
+
+// MethodReply returns the function with which a MethodHandler that returns
+// ErrAsyncResponse answers the call later.  Only the first call of the
+// function counts.  It returns nil for a context other than a handler's.
+func MethodReply(ctx context.Context) func(out []Property, err error) {
+	reply, _ := ctx.Value(methodReplyKey{}).(func([]Property, error))
+	return reply
+}
+
+// RegisterMethod registers the named method, such as "Device.Reboot()", so
+// the calls consumers make of it with Invoke are answered by the handler.
+// Like elements, the methods of table rows are named with "{i}" for the
+// instance.
+func (h *Handle) RegisterMethod(name string, handler MethodHandler) error {
+	if name == "" || strings.HasSuffix(name, ".") {
+		return fmt.Errorf("register '%s': %w: not the name of a method", name, ErrInvalidInput)
+	}
+	if handler == nil {
+		return fmt.Errorf("register '%s': %w: no handler", name, ErrInvalidInput)
+	}
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	h.reg.Lock()
+	defer h.reg.Unlock()
+
+	if err := h.checkRegistration(name); err != nil {
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	if err := h.serveComponent(); err != nil {
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	h.m.Lock()
+	if h.methods == nil {
+		h.methods = make(map[string]MethodHandler)
+	}
+	h.methods[name] = handler
+	h.m.Unlock()
+
+	if err := h.addAlias(name); err != nil {
+		h.m.Lock()
+		delete(h.methods, name)
+		h.m.Unlock()
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// methodOutcome is the outcome of a method call answered later.
+type methodOutcome struct {
+	out []Property
+	err error
+}
+
+// serveMethod answers a method call, the way _method_callback_handler does:
+// the return code is followed by the output parameters.
+func (h *Handle) serveMethod(ctx context.Context, req *Message) *Message {
+	out, err := h.callMethod(ctx, req)
+
+	rc := returnCode(err)
+	if err != nil && !slices.ContainsFunc(out, func(p Property) bool { return p.Name == "error_code" }) {
+		out = append(out,
+			Property{Name: "error_code", Value: NewValue(rc)},
+			Property{Name: "error_string", Value: NewValue(err.Error())},
+		)
+	}
+
+	resp := h.newMessage()
+	resp.AppendInt32(rc)
+	if err := appendObject(resp, "", out); err != nil {
+		resp = h.newMessage()
+		resp.AppendInt32(int32(ErrInvalidParameterType))
+		_ = appendObject(resp, "", []Property{
+			{Name: "error_code", Value: NewValue(int32(ErrInvalidParameterType))},
+			{Name: "error_string", Value: NewValue(err.Error())},
+		})
+	}
+
+	return resp
+}
+
+// callMethod reads the parameters of a method call and calls the handler,
+// waiting for the outcome of one that answers later.
+func (h *Handle) callMethod(ctx context.Context, req *Message) ([]Property, error) {
+	if _, err := req.PopInt32(); err != nil { // session id
+		return nil, ErrInvalidInput
+	}
+
+	name, err := req.PopString()
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	hasIn, err := req.PopInt32()
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	var in []Property
+	if hasIn != 0 {
+		if in, err = popObject(req); err != nil {
+			return nil, ErrInvalidInput
+		}
+	}
+
+	h.m.Lock()
+	handler, found := h.methods[name]
+	if !found {
+		handler, found = h.methods[h.rowTemplate(name)]
+	}
+	h.m.Unlock()
+	if !found {
+		return nil, ErrElementDoesNotExist
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	id := h.trackCall(cancel)
+	defer h.untrackCall(id)
+
+	outcome := make(chan methodOutcome, 1)
+	var once sync.Once
+	reply := func(out []Property, err error) {
+		once.Do(func() {
+			outcome <- methodOutcome{out: out, err: err}
+		})
+	}
+
+	out, err := handler(context.WithValue(ctx, methodReplyKey{}, reply), in)
+	if !errors.Is(err, ErrAsyncResponse) {
+		return out, err
+	}
+
+	select {
+	case o := <-outcome:
+		return o.out, o.err
+	case <-ctx.Done():
+		return nil, ErrTimeout
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// echo answers with its input parameters, each name prefixed with "out.".
+func echo(_ context.Context, in []rbus.Property) ([]rbus.Property, error) {
+	out := make([]rbus.Property, 0, len(in))
+	for _, p := range in {
+		out = append(out, rbus.Property{Name: "out." + p.Name, Value: p.Value})
+	}
+	return out, nil
+}
+
+// list prints the properties as name=value pairs between brackets.
+func list(props []rbus.Property) string {
+	s := make([]string, len(props))
+	for i, p := range props {
+		s[i] = p.Name + "=" + p.Value.String()
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func TestInvoke(t *testing.T) {
+	_, url := newServer(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	err := provider.RegisterMethod("Device.Test.Echo()", echo)
+	if err == nil {
+		err = provider.RegisterMethod("Device.Test.Fail()", func(context.Context, []rbus.Property) ([]rbus.Property, error) {
+			return nil, fmt.Errorf("%w: channel 99", rbus.ErrInvalidParameterValue)
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	out, err := consumer.Invoke(ctx, "Device.Test.Echo()", []rbus.Property{
+		{Name: "a", Value: rbus.NewValue(int32(1))},
+		{Name: "b", Value: rbus.NewValue("two")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := list(out); got != "[out.a=1 out.b=two]" {
+		t.Fatalf("got %s, want [out.a=1 out.b=two]", got)
+	}
+
+	// A method taking no input parameters.
+	if out, err := consumer.Invoke(ctx, "Device.Test.Echo()", nil); err != nil || len(out) != 0 {
+		t.Fatalf("got %v and %v, want nothing", out, err)
+	}
+
+	// The code of a failure reaches the caller, along with its description.
+	out, err = consumer.Invoke(ctx, "Device.Test.Fail()", nil)
+	if !errors.Is(err, rbus.ErrInvalidParameterValue) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrInvalidParameterValue)
+	}
+	if got := list(out); got != "[error_code=30 error_string=invalid parameter value: channel 99]" {
+		t.Fatalf("got %s, want the error code and string", got)
+	}
+
+	if _, err := consumer.Invoke(ctx, "Device.Test.Nope()", nil); err == nil {
+		t.Fatal("invoked a method nobody registered")
+	}
+}
+
+func TestInvokeAsyncResponse(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	// The download answers once it's released, long after the handler
+	// returned.
+	release := make(chan struct{})
+	err := provider.RegisterMethod("Device.Test.Download()", func(ctx context.Context, in []rbus.Property) ([]rbus.Property, error) {
+		reply := rbus.MethodReply(ctx)
+		go func() {
+			<-release
+			reply([]rbus.Property{{Name: "status", Value: rbus.NewValue("done")}}, nil)
+			reply(nil, rbus.ErrBus) // ignored
+		}()
+		return nil, rbus.ErrAsyncResponse
+	})
+	if err == nil {
+		err = provider.RegisterMethod("Device.Test.Echo()", echo)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	err = consumer.InvokeAsync(context.Background(), "Device.Test.Download()", nil, func(out []rbus.Property, err error) {
+		if err == nil && list(out) != "[status=done]" {
+			err = fmt.Errorf("got %v, want status=done", out)
+		}
+		done <- err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pending download holds up no other call.
+	out, err := consumer.Invoke(context.Background(), "Device.Test.Echo()", []rbus.Property{{Name: "x", Value: rbus.NewValue(true)}})
+	if err != nil || list(out) != "[out.x=true]" {
+		t.Fatalf("got %v and %v, want out.x=true", out, err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("answered before the release with %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvokeRowMethod(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	var r rows
+	if err := provider.RegisterTable("Device.Test.Table.", 0, r.callbacks()); err != nil {
+		t.Fatal(err)
+	}
+	err := provider.RegisterMethod("Device.Test.Table.{i}.Reset()", func(ctx context.Context, _ []rbus.Property) ([]rbus.Property, error) {
+		return []rbus.Property{{Name: "row", Value: rbus.NewValue("reset")}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := consumer.AddTableRow(ctx, "Device.Test.Table.", "wan"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The method of a row is called by the row's number or alias, but
+	// not for a row that doesn't exist.
+	for _, name := range []string{"Device.Test.Table.1.Reset()", "Device.Test.Table.[wan].Reset()"} {
+		if out, err := consumer.Invoke(ctx, name, nil); err != nil || list(out) != "[row=reset]" {
+			t.Fatalf("%s: got %v and %v, want row=reset", name, out, err)
+		}
+	}
+	if _, err := consumer.Invoke(ctx, "Device.Test.Table.2.Reset()", nil); !errors.Is(err, rbus.ErrElementDoesNotExist) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrElementDoesNotExist)
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// HandleMetrics receives notifications about the operations of a Handle,
+// set with WithMetrics.  The methods are called synchronously, so
+// implementations must be fast and safe for concurrent use.  It keeps the
+// handle free of a metrics dependency; the metrics/prometheus package has one
+// feeding Prometheus collectors.
+//
+// See rbustest.Metrics for one that records what it's told.
+type HandleMetrics interface {
+	// OperationCompleted is called for each request the handle makes, such
+	// as a get, a set or a method call, once its response is decoded or it
+	// failed.  The method is the rbus method of the request, such as
+	// "METHOD_GETPARAMETERVALUES", and the param the name of the first
+	// property, or of the method, element, table, row or event, it was sent
+	// for, whichever provider it went to.  The code is the return
+	// code of the provider, or the ErrorCode closest to the failure when
+	// there was no response, such as ErrTimeout.
+	OperationCompleted(method string, param string, code int, latency time.Duration)
+
+	// SubscriptionEventReceived is called for each event delivered to a
+	// subscription, with the name of the event.
+	SubscriptionEventReceived(event string)
+
+	// ReconnectOccurred is called each time the handle has reconnected to
+	// the router after losing the connection.
+	ReconnectOccurred()
+}
+
+// operationCode returns the ErrorCode closest to the failure of a request, or
+// zero when it didn't fail.
+func operationCode(err error) int {
+	var code ErrorCode
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &code):
+		return int(code)
+	case errors.Is(err, context.DeadlineExceeded):
+		return int(ErrTimeout)
+	case errors.Is(err, rtmessage.ErrNoRoute):
+		return int(ErrDestinationNotFound)
+	}
+	return int(ErrBus)
+}
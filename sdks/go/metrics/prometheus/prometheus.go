@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package prometheus reports the metrics of an rbus Handle to Prometheus:
+//
+//	m, err := prometheus.New(prom.DefaultRegisterer)
+//	if err != nil {
+//		return err
+//	}
+//	h, err := rbus.New(rbus.WithApplicationName("example"), rbus.WithMetrics(m))
+package prometheus
+
+import (
+	"strconv"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+const namespace = "rbus"
+
+// Metrics is an rbus.HandleMetrics feeding Prometheus collectors:
+//
+//   - rbus_operation_duration_seconds, a histogram of the requests of the
+//     handle by method and return code
+//   - rbus_subscription_events_total, the events received by name
+//   - rbus_reconnects_total, the reconnects to the router
+//
+// The name of the property a request is for isn't a label, as there can be
+// any number of them.  One Metrics can be shared by several handles.
+type Metrics struct {
+	operations *prom.HistogramVec
+	events     *prom.CounterVec
+	reconnects prom.Counter
+}
+
+var _ rbus.HandleMetrics = (*Metrics)(nil)
+
+// New creates the collectors and registers them with reg.  When one can't be
+// registered, such as when they're registered already, none is.
+func New(reg prom.Registerer) (*Metrics, error) {
+	m := Metrics{
+		operations: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "The time the requests of the handle took, by method and return code.",
+			Buckets:   prom.ExponentialBuckets(0.0005, 4, 8),
+		}, []string{"method", "code"}),
+		events: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "subscription_events_total",
+			Help:      "The events delivered to the subscriptions of the handle, by event name.",
+		}, []string{"event"}),
+		reconnects: prom.NewCounter(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "The times the handle reconnected to the router after losing the connection.",
+		}),
+	}
+
+	collectors := []prom.Collector{m.operations, m.events, m.reconnects}
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			for _, registered := range collectors[:i] {
+				reg.Unregister(registered)
+			}
+			return nil, err
+		}
+	}
+
+	return &m, nil
+}
+
+func (m *Metrics) OperationCompleted(method string, _ string, code int, latency time.Duration) {
+	m.operations.WithLabelValues(method, strconv.Itoa(code)).Observe(latency.Seconds())
+}
+
+func (m *Metrics) SubscriptionEventReceived(event string) {
+	m.events.WithLabelValues(event).Inc()
+}
+
+func (m *Metrics) ReconnectOccurred() {
+	m.reconnects.Inc()
+}
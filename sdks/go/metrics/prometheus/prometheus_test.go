@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheus_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/metrics/prometheus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+	m, err := prometheus.New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := rtmessage.NewMemRouter("rbus-prometheus-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	open := func(component string, opts ...rbus.Option) *rbus.Handle {
+		opts = append([]rbus.Option{rbus.WithURL("mem://rbus-prometheus-test"), rbus.WithApplicationName(component)}, opts...)
+		h, err := rbus.New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Open(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = h.Close(context.Background()) })
+		return h
+	}
+
+	provider := open("provider")
+	consumer := open("consumer", rbus.WithMetrics(m))
+
+	err = provider.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(int32(5)), nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for range 3 {
+		if _, err := consumer.Get(ctx, "Device.Test.X"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := consumer.Get(ctx, "Device.Test.Nope"); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+
+	// The gets are counted by their return code.
+	got, err := testutil.GatherAndCount(reg, "rbus_operation_duration_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Fatalf("got %d series, want one per return code", got)
+	}
+
+	m.SubscriptionEventReceived("Device.Test.Event!")
+	m.SubscriptionEventReceived("Device.Test.Event!")
+	m.ReconnectOccurred()
+
+	want := `
+# HELP rbus_reconnects_total The times the handle reconnected to the router after losing the connection.
+# TYPE rbus_reconnects_total counter
+rbus_reconnects_total 1
+# HELP rbus_subscription_events_total The events delivered to the subscriptions of the handle, by event name.
+# TYPE rbus_subscription_events_total counter
+rbus_subscription_events_total{event="Device.Test.Event!"} 2
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(want), "rbus_reconnects_total", "rbus_subscription_events_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewRegisteredTwice(t *testing.T) {
+	reg := prom.NewRegistry()
+	if _, err := prometheus.New(reg); err != nil {
+		t.Fatal(err)
+	}
+
+	var already prom.AlreadyRegisteredError
+	if _, err := prometheus.New(reg); !errors.As(err, &already) {
+		t.Fatalf("got %v, want %T", err, already)
+	}
+}
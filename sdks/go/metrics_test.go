@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rbustest"
+)
+
+func TestMetricsOperations(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.X": rbus.NewValue(int32(5)),
+		"Device.Test.Y": rbus.NewValue(int32(6)),
+	})
+	b.SetError("Device.Test.Y", rbus.ErrAccessNotAllowed)
+	err := b.AddMethod("Device.Test.Echo()", func(_ context.Context, in []rbus.Property) ([]rbus.Property, error) {
+		return in, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m rbustest.Metrics
+	consumer := openHandle(t, b.URL(), "consumer", rbus.WithMetrics(&m))
+
+	ctx := context.Background()
+	if _, err := consumer.Get(ctx, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.Set(ctx, "Device.Test.X", rbus.NewValue(int32(7))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.Get(ctx, "Device.Test.Y"); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	b.SetError("Device.Test.Y", 0)
+	if _, err := consumer.Invoke(ctx, "Device.Test.Echo()", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.Get(ctx, "Device.Test.Nope"); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+
+	// The wildcard get goes to the component, while it's about the path.
+	if _, err := consumer.GetWildcard(ctx, "Device.Test."); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rbustest.Operation{
+		{Method: "METHOD_GETPARAMETERVALUES", Param: "Device.Test.X"},
+		{Method: "METHOD_SETPARAMETERVALUES", Param: "Device.Test.X"},
+		{Method: "METHOD_GETPARAMETERVALUES", Param: "Device.Test.Y", Code: int(rbus.ErrAccessNotAllowed)},
+		{Method: "METHOD_RPC", Param: "Device.Test.Echo()"},
+		{Method: "METHOD_GETPARAMETERVALUES", Param: "Device.Test.Nope", Code: int(rbus.ErrDestinationNotFound)},
+		{Method: "METHOD_GETPARAMETERVALUES", Param: "Device.Test."},
+	}
+	got := m.Operations()
+	if len(got) != len(want) {
+		t.Fatalf("got %d operations %+v, want %d", len(got), got, len(want))
+	}
+	for i, op := range got {
+		if op.Latency <= 0 {
+			t.Fatalf("operation %d: got latency %s, want more than none", i, op.Latency)
+		}
+		op.Latency = 0
+		if op != want[i] {
+			t.Fatalf("operation %d: got %+v, want %+v", i, op, want[i])
+		}
+	}
+}
+
+func TestMetricsEvents(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{"Device.Test.X": rbus.NewValue(int32(5))})
+
+	var m rbustest.Metrics
+	consumer := openHandle(t, b.URL(), "consumer", rbus.WithMetrics(&m))
+
+	events := make(chan rbus.Event, 10)
+	if _, err := consumer.Subscribe(context.Background(), "Device.Test.X", func(e rbus.Event) { events <- e }); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		err := b.Publish(context.Background(), rbus.Event{Name: "Device.Test.X", Type: rbus.EventGeneral})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 3 {
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the events")
+		}
+	}
+
+	if got := m.Events("Device.Test.X"); got != 3 {
+		t.Fatalf("got %d events, want 3", got)
+	}
+	if got := m.Reconnects(); got != 0 {
+		t.Fatalf("got %d reconnects, want 0", got)
+	}
+}
+
+func TestMetricsReconnects(t *testing.T) {
+	b := newBroker(t, nil)
+
+	var m rbustest.Metrics
+	consumer := openHandle(t, b.URL(), "consumer", rbus.WithMetrics(&m))
+
+	reconnected := make(chan struct{}, 1)
+	consumer.OnReconnect(func() { reconnected <- struct{}{} })
+
+	for i := range 2 {
+		b.Router().DropConnections()
+		waitFor(t, reconnected, "OnReconnect")
+
+		if got := m.Reconnects(); got != i+1 {
+			t.Fatalf("got %d reconnects, want %d", got, i+1)
+		}
+	}
+}
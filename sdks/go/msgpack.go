@@ -0,0 +1,319 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The subset of msgpack used by rbus.  The C library uses msgpack-c, which
+// always packs integers into the smallest representation that holds the value.
+const (
+	mpNil     = 0xc0
+	mpFalse   = 0xc2
+	mpTrue    = 0xc3
+	mpBin8    = 0xc4
+	mpBin16   = 0xc5
+	mpBin32   = 0xc6
+	mpFloat32 = 0xca
+	mpFloat64 = 0xcb
+	mpUint8   = 0xcc
+	mpUint16  = 0xcd
+	mpUint32  = 0xce
+	mpUint64  = 0xcf
+	mpInt8    = 0xd0
+	mpInt16   = 0xd1
+	mpInt32   = 0xd2
+	mpInt64   = 0xd3
+	mpStr8    = 0xd9
+	mpStr16   = 0xda
+	mpStr32   = 0xdb
+)
+
+var errShortBuffer = errors.New("short buffer")
+
+// mpKind is the family of a decoded msgpack item.
+type mpKind int
+
+const (
+	mpKindNil mpKind = iota
+	mpKindBool
+	mpKindInt
+	mpKindUint
+	mpKindFloat32
+	mpKindFloat64
+	mpKindStr
+	mpKindBin
+)
+
+func (k mpKind) String() string {
+	switch k {
+	case mpKindNil:
+		return "nil"
+	case mpKindBool:
+		return "bool"
+	case mpKindInt:
+		return "int"
+	case mpKindUint:
+		return "uint"
+	case mpKindFloat32:
+		return "float32"
+	case mpKindFloat64:
+		return "float64"
+	case mpKindStr:
+		return "str"
+	case mpKindBin:
+		return "bin"
+	}
+	return "unknown"
+}
+
+// mpItem is a single decoded msgpack item.  Only the field matching kind is
+// meaningful.
+type mpItem struct {
+	kind mpKind
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	raw  []byte // str and bin bodies, aliasing the source buffer
+}
+
+func appendInt(buf []byte, v int64) []byte {
+	if v >= 0 {
+		return appendUint(buf, uint64(v))
+	}
+
+	switch {
+	case v >= -32:
+		return append(buf, byte(int8(v)))
+	case v >= math.MinInt8:
+		return append(buf, mpInt8, byte(int8(v)))
+	case v >= math.MinInt16:
+		buf = append(buf, mpInt16)
+		return binary.BigEndian.AppendUint16(buf, uint16(int16(v)))
+	case v >= math.MinInt32:
+		buf = append(buf, mpInt32)
+		return binary.BigEndian.AppendUint32(buf, uint32(int32(v)))
+	}
+
+	buf = append(buf, mpInt64)
+	return binary.BigEndian.AppendUint64(buf, uint64(v))
+}
+
+func appendUint(buf []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(buf, byte(v))
+	case v <= math.MaxUint8:
+		return append(buf, mpUint8, byte(v))
+	case v <= math.MaxUint16:
+		buf = append(buf, mpUint16)
+		return binary.BigEndian.AppendUint16(buf, uint16(v))
+	case v <= math.MaxUint32:
+		buf = append(buf, mpUint32)
+		return binary.BigEndian.AppendUint32(buf, uint32(v))
+	}
+
+	buf = append(buf, mpUint64)
+	return binary.BigEndian.AppendUint64(buf, v)
+}
+
+func appendBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, mpTrue)
+	}
+	return append(buf, mpFalse)
+}
+
+func appendFloat32(buf []byte, v float32) []byte {
+	buf = append(buf, mpFloat32)
+	return binary.BigEndian.AppendUint32(buf, math.Float32bits(v))
+}
+
+func appendFloat64(buf []byte, v float64) []byte {
+	buf = append(buf, mpFloat64)
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+func appendStr(buf []byte, s []byte) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, mpStr8, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, mpStr16)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, mpStr32)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendBin(buf []byte, b []byte) []byte {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf = append(buf, mpBin8, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, mpBin16)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, mpBin32)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	return append(buf, b...)
+}
+
+// decodeItem decodes the msgpack item at the start of buf, returning the item
+// and the number of bytes consumed.
+func decodeItem(buf []byte) (mpItem, int, error) {
+	if len(buf) == 0 {
+		return mpItem{}, 0, errShortBuffer
+	}
+
+	tag := buf[0]
+	body := buf[1:]
+
+	fixed := func(n int) ([]byte, error) {
+		if len(body) < n {
+			return nil, errShortBuffer
+		}
+		return body[:n], nil
+	}
+
+	sized := func(lenBytes int, kind mpKind) (mpItem, int, error) {
+		b, err := fixed(lenBytes)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		var n uint64
+		switch lenBytes {
+		case 1:
+			n = uint64(b[0])
+		case 2:
+			n = uint64(binary.BigEndian.Uint16(b))
+		case 4:
+			n = uint64(binary.BigEndian.Uint32(b))
+		}
+		if uint64(len(body)-lenBytes) < n {
+			return mpItem{}, 0, errShortBuffer
+		}
+		start := lenBytes
+		return mpItem{kind: kind, raw: body[start : start+int(n)]}, 1 + start + int(n), nil
+	}
+
+	switch {
+	case tag <= 0x7f:
+		return mpItem{kind: mpKindUint, u: uint64(tag)}, 1, nil
+	case tag >= 0xe0:
+		return mpItem{kind: mpKindInt, i: int64(int8(tag))}, 1, nil
+	case tag&0xe0 == 0xa0:
+		n := int(tag & 0x1f)
+		if len(body) < n {
+			return mpItem{}, 0, errShortBuffer
+		}
+		return mpItem{kind: mpKindStr, raw: body[:n]}, 1 + n, nil
+	}
+
+	switch tag {
+	case mpNil:
+		return mpItem{kind: mpKindNil}, 1, nil
+	case mpFalse, mpTrue:
+		return mpItem{kind: mpKindBool, b: tag == mpTrue}, 1, nil
+	case mpBin8:
+		return sized(1, mpKindBin)
+	case mpBin16:
+		return sized(2, mpKindBin)
+	case mpBin32:
+		return sized(4, mpKindBin)
+	case mpStr8:
+		return sized(1, mpKindStr)
+	case mpStr16:
+		return sized(2, mpKindStr)
+	case mpStr32:
+		return sized(4, mpKindStr)
+	case mpFloat32:
+		b, err := fixed(4)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		f := math.Float32frombits(binary.BigEndian.Uint32(b))
+		return mpItem{kind: mpKindFloat32, f: float64(f)}, 5, nil
+	case mpFloat64:
+		b, err := fixed(8)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindFloat64, f: math.Float64frombits(binary.BigEndian.Uint64(b))}, 9, nil
+	case mpUint8:
+		b, err := fixed(1)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindUint, u: uint64(b[0])}, 2, nil
+	case mpUint16:
+		b, err := fixed(2)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindUint, u: uint64(binary.BigEndian.Uint16(b))}, 3, nil
+	case mpUint32:
+		b, err := fixed(4)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindUint, u: uint64(binary.BigEndian.Uint32(b))}, 5, nil
+	case mpUint64:
+		b, err := fixed(8)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindUint, u: binary.BigEndian.Uint64(b)}, 9, nil
+	case mpInt8:
+		b, err := fixed(1)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindInt, i: int64(int8(b[0]))}, 2, nil
+	case mpInt16:
+		b, err := fixed(2)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindInt, i: int64(int16(binary.BigEndian.Uint16(b)))}, 3, nil
+	case mpInt32:
+		b, err := fixed(4)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindInt, i: int64(int32(binary.BigEndian.Uint32(b)))}, 5, nil
+	case mpInt64:
+		b, err := fixed(8)
+		if err != nil {
+			return mpItem{}, 0, err
+		}
+		return mpItem{kind: mpKindInt, i: int64(binary.BigEndian.Uint64(b))}, 9, nil
+	}
+
+	return mpItem{}, 0, fmt.Errorf("unsupported msgpack type 0x%02x", tag)
+}
+
+// asInt64 returns the integer value of the item, regardless of whether it
+// was packed as a signed or unsigned integer.
+func (it mpItem) asInt64() (int64, bool) {
+	switch it.kind {
+	case mpKindInt:
+		return it.i, true
+	case mpKindUint:
+		return int64(it.u), true
+	}
+	return 0, false
+}
@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const methodGetParameterNames = "METHOD_GETPARAMETERNAMES"
+
+// getNames asks the provider at the topic for the names under the named
+// element, the way rbusElementInfo_get does.  A depth of zero or more asks
+// for the element and everything down to that many levels below it, a
+// negative one for only the level that far below it.
+func (h *Handle) getNames(ctx context.Context, topic, name string, depth int32) ([]ElementInfo, error) {
+	req := h.newMessage()
+	req.AppendString(name)
+	req.AppendInt32(depth)
+	req.AppendInt32(0) // not only row names
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodGetParameterNames, parent, state)
+
+	resp, err := h.request(ctx, topic, req)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReturnCode(rc); err != nil {
+		return nil, err
+	}
+
+	count, err := resp.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("%w: negative name count %d", ErrMalformedMessage, count)
+	}
+
+	names := make([]ElementInfo, 0, min(int(count), resp.remaining()/3))
+	for range count {
+		name, err := resp.PopString()
+		if err != nil {
+			return nil, err
+		}
+		typ, err := resp.PopInt32()
+		if err != nil {
+			return nil, err
+		}
+		access, err := resp.PopInt32()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, ElementInfo{
+			Name:   name,
+			Type:   ElementType(typ),
+			Access: Access(access),
+		})
+	}
+
+	return names, nil
+}
+
+// serveNames answers a names request, the way _get_parameter_names_handler
+// does: either with the rows of a table or with the names under an element.
+func (h *Handle) serveNames(req *Message) *Message {
+	resp := h.newMessage()
+
+	name, err := req.PopString()
+	if err != nil {
+		resp.AppendInt32(int32(ErrInvalidInput))
+		return resp
+	}
+	depth, err := req.PopInt32()
+	if err != nil {
+		resp.AppendInt32(int32(ErrInvalidInput))
+		return resp
+	}
+
+	// CCSP consumers don't send the flag.
+	rowsOnly, _ := req.PopInt32()
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	root := strings.TrimSuffix(name, ".")
+	if _, _, row, rest, found := h.rowOf(root + "."); found {
+		root = strings.TrimSuffix(row.Name+rest, ".")
+	}
+
+	nodes := h.nodes()
+	node, found := nodes[root]
+	if !found {
+		resp.AppendInt32(int32(ErrElementDoesNotExist))
+		return resp
+	}
+
+	if rowsOnly != 0 {
+		if node.Type != ElementTypeTable {
+			resp.AppendInt32(int32(ErrInvalidInput))
+			return resp
+		}
+
+		rows := h.tables[root+"."].rows
+		resp.AppendInt32(0)
+		resp.AppendInt32(int32(len(rows)))
+		for _, row := range rows {
+			resp.AppendInt32(int32(row.Instance))
+			resp.AppendString(row.Alias)
+		}
+		return resp
+	}
+
+	// Like the C library, a depth of zero or more lists every level down to
+	// it and a negative one only the level that far down.
+	levels := max(depth, -depth)
+	var names []string
+	for n := range nodes {
+		var level int32
+		if n != root {
+			rest, ok := strings.CutPrefix(n, root+".")
+			if !ok {
+				continue
+			}
+			level = int32(strings.Count(rest, ".")) + 1
+		}
+
+		if level <= levels && (depth >= 0 || level == levels) {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+
+	resp.AppendInt32(0)
+	resp.AppendInt32(int32(len(names)))
+	for _, n := range names {
+		node := nodes[n]
+		if node.Type == ElementTypeObject || node.Type == ElementTypeTable {
+			n += "."
+		}
+		resp.AppendString(n)
+		resp.AppendInt32(int32(node.Type))
+		resp.AppendInt32(int32(node.Access))
+	}
+
+	return resp
+}
+
+// nodes returns the elements of the handle's data model by name, without the
+// trailing "." of objects and tables, along with the objects they are in.  The
+// elements of table rows are listed for each row.  It's called with h.m held.
+func (h *Handle) nodes() map[string]ElementInfo {
+	nodes := make(map[string]ElementInfo)
+
+	add := func(name string, typ ElementType, access Access) {
+		nodes[name] = ElementInfo{Name: name, Type: typ, Access: access}
+
+		for i := strings.LastIndex(name, "."); i > 0; i = strings.LastIndex(name[:i], ".") {
+			if _, found := nodes[name[:i]]; found {
+				break
+			}
+			nodes[name[:i]] = ElementInfo{Name: name[:i], Type: ElementTypeObject}
+		}
+	}
+
+	for name, t := range h.tables {
+		var access Access
+		if t.callbacks.AddRow != nil {
+			access |= AccessAddRow
+		}
+		if t.callbacks.RemoveRow != nil {
+			access |= AccessRemoveRow
+		}
+		add(strings.TrimSuffix(name, "."), ElementTypeTable, access)
+
+		// Rows show read-write access, as CCSP expects.
+		for _, row := range t.rows {
+			add(strings.TrimSuffix(row.Name, "."), ElementTypeObject, AccessGet|AccessSet)
+		}
+	}
+
+	for name, cb := range h.elements {
+		var access Access
+		if cb.GetHandler != nil {
+			access |= AccessGet
+		}
+		if cb.SetHandler != nil {
+			access |= AccessSet
+		}
+		if cb.SubscribeHandler != nil {
+			access |= AccessSubscribe
+		}
+
+		h.addRowNodes(add, name, ElementTypeProperty, access)
+	}
+
+	for name := range h.methods {
+		h.addRowNodes(add, name, ElementTypeMethod, AccessInvoke)
+	}
+
+	return nodes
+}
+
+// addRowNodes adds the element, or for one named with "{i}" the element of
+// each row of its table.  It's called with h.m held.
+func (h *Handle) addRowNodes(add func(string, ElementType, Access), name string, typ ElementType, access Access) {
+	tableName, leaf, isRow := strings.Cut(name, "{i}.")
+	if !isRow {
+		add(name, typ, access)
+		return
+	}
+
+	for _, row := range h.tables[tableName].rows {
+		add(row.Name+leaf, typ, access)
+	}
+}
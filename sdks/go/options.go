@@ -5,7 +5,10 @@ package rbus
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"time"
 )
 
 // Option interface for setting configuration options
@@ -38,25 +41,162 @@ func WithApplicationName(name string) Option {
 }
 
 // WithInboxID sets the inbox ID for the rbus connection to the specified value.
+// The inbox is then the same for every Handle given the id, so two of them
+// open at once in a process, or in processes with the same name, receive each
+// other's responses; prefer WithInboxAsPID unless a fixed inbox is required.
 func WithInboxID(id int) Option {
 	return optionFunc(func(cfg *config) error {
 		cfg.id = id
+		cfg.fixedInbox = true
 		return nil
 	})
 }
 
-// WithInboxAsPID sets the inbox ID for the rbus connection to the current process ID.
+// WithInboxAsPID sets the inbox ID for the rbus connection to the current process ID,
+// followed by a number unique to the Handle within the process.
 // This is the default behavior.
 func WithInboxAsPID() Option {
-	return WithInboxID(os.Getpid())
+	return optionFunc(func(cfg *config) error {
+		cfg.id = os.Getpid()
+		cfg.fixedInbox = false
+		return nil
+	})
+}
+
+// WithValueWireFormat sets the format used to serialize values in the messages
+// the Handle builds.  The default, RbusTyped, is what rbus providers expect;
+// PlainMsgpack is only for interop with peers that exchange bare msgpack.
+func WithValueWireFormat(format ValueWireFormat) Option {
+	return optionFunc(func(cfg *config) error {
+		switch format {
+		case RbusTyped, PlainMsgpack:
+		default:
+			return fmt.Errorf("unsupported value wire format: %d", format)
+		}
+		cfg.wireFormat = format
+		return nil
+	})
+}
+
+// WithDefaultTimeout bounds the wait for each response from a provider, of a
+// get, set, method call or subscribe, when the caller's context has no
+// deadline of its own.  Running out of it fails the operation with an error
+// matching ErrTimeout and context.DeadlineExceeded, and ErrDefaultTimeout too,
+// which tells it apart from a timeout the provider reports.  Zero, the
+// default, waits as long as the context allows.
+func WithDefaultTimeout(d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if d < 0 {
+			return fmt.Errorf("negative default timeout: %s", d)
+		}
+		cfg.timeout = d
+		return nil
+	})
+}
+
+// WithResubscribePeriod sets how long the subscriptions that can't be made
+// again once the handle reconnected to the router, because their provider
+// isn't back on the bus or doesn't answer, are retried before they're given
+// up on; see SubOnLost.  It defaults to a minute, and zero gives up at once.
+func WithResubscribePeriod(d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if d < 0 {
+			return fmt.Errorf("negative resubscribe period: %s", d)
+		}
+		cfg.resubscribe = d
+		return nil
+	})
+}
+
+// WithRetryPolicy has the Handle try a Get, Set or Invoke that failed again
+// when the policy says so, for example when the provider is still starting
+// and isn't on the bus yet, for as long as the caller's context allows.
+// Committed sets and AddTableRow are tried again only with a policy made
+// with RetryNonIdempotent.  By default nothing is tried again.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return optionFunc(func(cfg *config) error {
+		if p == nil {
+			return errors.New("nil retry policy")
+		}
+		cfg.retry = p
+		return nil
+	})
+}
+
+// WithTransport makes the Handle exchange its messages over the transport
+// instead of connecting to the router at a URL, which isn't needed then.  Open
+// connects the transport and Close disconnects it.
+func WithTransport(t Transport) Option {
+	return optionFunc(func(cfg *config) error {
+		if t == nil {
+			return errors.New("nil transport")
+		}
+		cfg.transport = t
+		return nil
+	})
+}
+
+// WithLogger sets the logger the Handle, and the connection it makes, write
+// to: debug entries for the requests and their responses, the subscriptions
+// and the reconnects, and warnings for the messages that can't be decoded.
+// By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(cfg *config) error {
+		if logger == nil {
+			return errors.New("nil logger")
+		}
+		cfg.logger = logger
+		return nil
+	})
+}
+
+// WithMetrics sets where the Handle reports the latency and outcome of its
+// requests, the events it receives and its reconnects.  By default no
+// metrics are collected.
+func WithMetrics(m HandleMetrics) Option {
+	return optionFunc(func(cfg *config) error {
+		if m == nil {
+			return errors.New("nil metrics")
+		}
+		cfg.metrics = m
+		return nil
+	})
+}
+
+// WithTracePropagator sets how the trace context of the active span is sent
+// with the requests the Handle makes, and taken from the requests it serves.
+// Without one, each request is sent a random traceparent.
+func WithTracePropagator(p TracePropagator) Option {
+	return optionFunc(func(cfg *config) error {
+		if p == nil {
+			return errors.New("nil trace propagator")
+		}
+		cfg.tracer = p
+		return nil
+	})
+}
+
+// WithStagedSets has the Handle hold the values of the sets that don't commit
+// instead of handing them to the SetHandlers, once it's checked that their
+// elements can be set.  The set of the same session that commits then hands
+// over the values held and its own, in the order they were set, stopping at
+// the first one rejected, the last with Commit true in its options.  The
+// values held for a session are dropped when the session manager reports the
+// session over, and those of a consumer when the router reports it gone.  By
+// default, like in the C library, every set is handed over as it comes.
+func WithStagedSets() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.stagedSets = true
+		return nil
+	})
 }
 
 // -------- Below are options that validate the configuration --------
 
-// assertURL validates the URL
+// assertURL validates the URL, which a transport doesn't need
 func assertURL() Option {
 	return optionFunc(func(cfg *config) error {
-		if cfg.url == "" {
+		if cfg.url == "" && cfg.transport == nil {
 			return errors.New("URL is required")
 		}
 		return nil
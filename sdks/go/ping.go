@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// Ping checks that the router answers, by asking it for the route of the
+// handle's own inbox, until the context is done.  It needs a transport that
+// can discover; see Transport.
+func (h *Handle) Ping(ctx context.Context) error {
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+
+	d, err := h.discoverer()
+	if err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+
+	if _, err := d.DiscoverWildcardDestinations(ctx, h.Inbox()); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+
+	return nil
+}
+
+// PingComponent checks that the named component answers, returning how long
+// its response took.  The component is sent a get of its own name, which
+// it answers without calling any of its handlers; the error it is bound to
+// answer with is not a failure of the ping.  When no component of the name
+// is on the bus, the error matches ErrDestinationNotFound.
+func (h *Handle) PingComponent(ctx context.Context, component string) (time.Duration, error) {
+	req := h.getRequest(ctx, []string{component})
+
+	start := time.Now()
+	if _, err := h.request(ctx, component, req); err != nil {
+		if errors.Is(err, rtmessage.ErrNoRoute) {
+			return 0, fmt.Errorf("ping '%s': %w: %w", component, ErrDestinationNotFound, err)
+		}
+		return 0, fmt.Errorf("ping '%s': %w", component, err)
+	}
+
+	return time.Since(start), nil
+}
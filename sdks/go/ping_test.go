@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+func TestPing(t *testing.T) {
+	r, url := newRouter(t)
+
+	// The component answers after a while, once told to.
+	slow, err := rtmessage.New(url, "slow")
+	if err == nil {
+		err = slow.Connect(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = slow.Close() })
+	answer := make(chan struct{})
+	_, err = slow.Serve("slow", func(context.Context, rtmessage.Message) ([]byte, error) {
+		<-answer
+		resp := rbus.NewMessage()
+		resp.AppendInt32(int32(rbus.ErrElementDoesNotExist))
+		resp.SetMetaInfo("METHOD_RESPONSE", "", "")
+		return resp.Bytes(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(r.Subscriptions(), "slow") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The connection is the test's, so its statistics can be looked at.
+	con, err := rtmessage.New(url, "consumer", rtmessage.WithInbox("consumer.INBOX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = con.Close() })
+	h, err := rbus.New(rbus.WithApplicationName("consumer"), rbus.WithTransport(con))
+	if err == nil {
+		err = h.Open(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close(context.Background()) })
+
+	ctx := context.Background()
+	if err := h.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.PingComponent(ctx, "nobody"); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+
+	// A ping timing out leaves nothing pending, so its response, when it
+	// comes, is late.
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := h.PingComponent(short, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(answer)
+
+	deadline = time.Now().Add(5 * time.Second)
+	for con.Stats().LateResponses == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := con.Stats().LateResponses; n != 1 {
+		t.Fatalf("got %d late responses, want 1", n)
+	}
+
+	// The component answering now, the next ping measures it.
+	if took, err := h.PingComponent(ctx, "slow"); err != nil || took <= 0 {
+		t.Fatalf("got %s and %v", took, err)
+	}
+}
@@ -0,0 +1,10 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+// Property is a named value from the data model.
+type Property struct {
+	Name  string
+	Value Value
+}
@@ -0,0 +1,460 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+const methodGetParameterAttributes = "METHOD_GETPARAMETERATTRIBUTES"
+
+// registerTimeout bounds the lookup of the component's name when the handle
+// is opened with a context without a deadline.
+const registerTimeout = 5 * time.Second
+
+// ElementCallbacks are the handlers of a data element registered by a
+// provider.  Either can be nil: an element without a GetHandler can't be read
+// and one without a SetHandler can't be written.
+//
+// The handlers are called on a goroutine of their own for each request, so
+// they must be safe for concurrent use.  The context is done when the handle
+// is closed, and carries the trace context the consumer sent; see
+// TraceContext.  An error wrapping an ErrorCode is reported to the consumer
+// as that code, any other error as ErrBus.
+//
+// Like in the C library, the SetHandlers are called for each property of a
+// set in order, until one rejects its value, and the options of the last
+// property of a set that commits have Commit true; see WithStagedSets for
+// holding the values of the sets that don't commit instead.
+type ElementCallbacks struct {
+	GetHandler func(ctx context.Context, name string) (Value, error)
+	SetHandler func(ctx context.Context, name string, value Value, opts SetHandlerOptions) error
+
+	// SubscribeHandler, when set, is told of each subscription to the
+	// changes of the element as it's added or removed, with the number of
+	// subscriptions there are then, so the provider can start an
+	// expensive source of values for the first and stop it after the last.
+	// The subscriptions of a consumer the router reports gone are removed
+	// too, as it won't unsubscribe.  The calls are made one at a time, in
+	// the order of the changes.  Returning an error from the call for an
+	// added subscription rejects it, the consumer's subscribe failing
+	// with the error's code.
+	SubscribeHandler func(event string, added bool, count int, filter *Filter, interval time.Duration) error
+}
+
+// SetHandlerOptions tells a SetHandler about the set it's called for, like
+// rbusSetHandlerOptions_t.
+type SetHandlerOptions struct {
+	// Session is the session the consumer made the set in, or zero.
+	Session SessionID
+
+	// Commit is true for the last property of a set that commits, so a
+	// provider can apply related values together once it has them all.
+	Commit bool
+
+	// Requester is the component that made the set.
+	Requester string
+}
+
+// RegisterElement registers the named data element, such as
+// "Device.DeviceInfo.SerialNumber", so the gets and sets consumers send for
+// it are answered by the callbacks.  Like the C library, the element is added
+// to the router as an alias of the handle's component, the application name.
+// The elements of table rows are named with "{i}" for the instance; see
+// RegisterTable.
+func (h *Handle) RegisterElement(name string, callbacks ElementCallbacks) error {
+	if name == "" || strings.HasSuffix(name, ".") {
+		return fmt.Errorf("register '%s': %w: not the name of a parameter", name, ErrInvalidInput)
+	}
+	if callbacks.GetHandler == nil && callbacks.SetHandler == nil {
+		return fmt.Errorf("register '%s': %w: no handler", name, ErrInvalidInput)
+	}
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	h.reg.Lock()
+	defer h.reg.Unlock()
+
+	if err := h.checkRegistration(name); err != nil {
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	if err := h.serveComponent(); err != nil {
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	h.m.Lock()
+	if h.elements == nil {
+		h.elements = make(map[string]ElementCallbacks)
+	}
+	h.elements[name] = callbacks
+	h.m.Unlock()
+
+	if err := h.addAlias(name); err != nil {
+		h.m.Lock()
+		delete(h.elements, name)
+		h.m.Unlock()
+		return fmt.Errorf("register '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// UnregisterElement removes the named data element registered with
+// RegisterElement.
+func (h *Handle) UnregisterElement(name string) error {
+	h.reg.Lock()
+	defer h.reg.Unlock()
+
+	h.m.Lock()
+	_, found := h.elements[name]
+	delete(h.elements, name)
+	h.stopDetectionLocked(name)
+	delete(h.detectors, name)
+	delete(h.subscribers, name)
+	open := h.conn != nil
+	h.m.Unlock()
+
+	if !found {
+		return fmt.Errorf("unregister '%s': %w", name, ErrElementDoesNotExist)
+	}
+	if !open {
+		return nil
+	}
+
+	if err := h.removeAlias(name); err != nil {
+		return fmt.Errorf("unregister '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// checkRegistration checks that the element or method isn't registered yet,
+// and that one named for the rows of a table is in a registered table.  It's
+// called with h.reg held.
+func (h *Handle) checkRegistration(name string) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	_, isElement := h.elements[name]
+	_, isMethod := h.methods[name]
+	if isElement || isMethod {
+		return ErrElementNameDuplicate
+	}
+
+	var tableFound bool
+	if tableName, _, ok := strings.Cut(name, "{i}."); ok {
+		_, tableFound = h.tables[tableName]
+	}
+	if strings.Contains(name, "{") && (!tableFound || strings.Count(name, "{") > 1) {
+		return fmt.Errorf("%w: not in a registered table", ErrInvalidInput)
+	}
+
+	return nil
+}
+
+// register adds the component to the bus when the handle is opened, the way
+// rbus_open does with rbus_registerObj, so other components can discover it.
+// The router doesn't acknowledge the route, nor does it reject a duplicate
+// one, so the component is first looked up by name.  A transport that can't
+// serve elements only consumes, and isn't registered.
+func (h *Handle) register(ctx context.Context, con Transport) error {
+	if _, ok := con.(server); !ok {
+		return nil
+	}
+
+	if d, ok := con.(discoverer); ok {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, registerTimeout)
+			defer cancel()
+		}
+
+		dests, err := d.DiscoverWildcardDestinations(ctx, h.cfg.appName)
+		if err != nil {
+			return fmt.Errorf("register '%s': %w", h.cfg.appName, err)
+		}
+		if len(dests) > 0 {
+			return fmt.Errorf("register '%s': %w", h.cfg.appName, ErrComponentNameDuplicate)
+		}
+	}
+
+	h.reg.Lock()
+	defer h.reg.Unlock()
+
+	if err := h.serveComponent(); err != nil {
+		return fmt.Errorf("register '%s': %w", h.cfg.appName, err)
+	}
+
+	return nil
+}
+
+// serveComponent starts answering the requests sent to the component and its
+// aliases.  It's called with h.reg held.
+func (h *Handle) serveComponent() error {
+	if h.stopServing != nil {
+		return nil
+	}
+
+	s, err := h.server()
+	if err != nil {
+		return err
+	}
+
+	stop, err := s.Serve(h.cfg.appName, h.serveProvider)
+	if err != nil {
+		return err
+	}
+	h.stopServing = stop
+
+	return nil
+}
+
+// element returns the callbacks of the registered element, which for the
+// element of a table row is registered with "{i}" for the instance.
+func (h *Handle) element(name string) (ElementCallbacks, bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if cb, found := h.elements[name]; found {
+		return cb, true
+	}
+
+	cb, found := h.elements[h.rowTemplate(name)]
+	return cb, found
+}
+
+// serveProvider answers the requests consumers send to the elements of the
+// handle, the way _callback_handler does.  The context carries the trace
+// context of the request.
+func (h *Handle) serveProvider(ctx context.Context, msg rtmessage.Message) ([]byte, error) {
+	req := NewMessageFromBytes(msg.Payload)
+	req.SetValueWireFormat(h.cfg.wireFormat)
+
+	method, parent, state, err := req.GetMetaInfo()
+	if err != nil {
+		h.cfg.logger.WarnContext(ctx, "malformed request", "topic", msg.Header.Topic, "error", err)
+	}
+	ctx = h.withTraceInfo(ctx, parent, state)
+
+	var resp *Message
+	switch {
+	case err != nil:
+		resp = h.newMessage()
+		resp.AppendInt32(int32(ErrInvalidInput))
+	case method == methodGetParameterValues:
+		resp = h.serveGet(ctx, req)
+	case method == methodSetParameterValues:
+		resp = h.serveSet(ctx, req, msg.Header.ReplyTopic)
+	case method == methodGetParameterNames:
+		resp = h.serveNames(req)
+	case method == methodSubscribe:
+		resp = h.serveSubscribe(ctx, req, true)
+	case method == methodUnsubscribe:
+		resp = h.serveSubscribe(ctx, req, false)
+	case method == methodRPC:
+		resp = h.serveMethod(ctx, req)
+	case method == methodAddTableRow:
+		resp = h.serveAddRow(req)
+	case method == methodDeleteTableRow:
+		resp = h.serveRemoveRow(req)
+	case method == methodGetParameterAttributes:
+		// Components registered directly with rbus report no attributes.
+		resp = h.newMessage()
+		resp.AppendInt32(0)
+	default:
+		resp = h.newMessage()
+		resp.AppendInt32(int32(ErrInvalidMethod))
+	}
+	resp.SetMetaInfo(methodResponse, "", "")
+
+	return resp.Bytes(), nil
+}
+
+// serveGet answers a get, the way _get_callback_handler does.  A partial path
+// ending in "." gets every element under it.  The response carries either all
+// the properties or only the return code of the first failure.
+func (h *Handle) serveGet(ctx context.Context, req *Message) *Message {
+	props, rc := h.getElements(ctx, req)
+
+	resp := h.newMessage()
+	resp.AppendInt32(rc)
+	if rc != 0 {
+		return resp
+	}
+
+	resp.AppendInt32(int32(len(props)))
+	for _, p := range props {
+		resp.AppendString(p.Name)
+		if err := resp.AppendValue(p.Value); err != nil {
+			resp = h.newMessage()
+			resp.AppendInt32(int32(ErrInvalidParameterType))
+			return resp
+		}
+	}
+
+	return resp
+}
+
+// getElements reads the names of a get request and calls the getters.
+func (h *Handle) getElements(ctx context.Context, req *Message) ([]Property, int32) {
+	if _, err := req.PopString(); err != nil { // requesting component
+		return nil, int32(ErrInvalidInput)
+	}
+
+	count, err := req.PopInt32()
+	if err != nil || count <= 0 {
+		return nil, int32(ErrInvalidInput)
+	}
+
+	var props []Property
+	for range count {
+		name, err := req.PopString()
+		if err != nil {
+			return nil, int32(ErrInvalidInput)
+		}
+
+		names := []string{name}
+		if strings.HasSuffix(name, ".") {
+			names = h.elementsUnder(name)
+		}
+
+		for _, name := range names {
+			cb, found := h.element(name)
+			if !found {
+				return nil, int32(ErrElementDoesNotExist)
+			}
+			if cb.GetHandler == nil {
+				return nil, int32(ErrInvalidOperation)
+			}
+
+			v, err := cb.GetHandler(ctx, name)
+			if err != nil {
+				return nil, returnCode(err)
+			}
+			props = append(props, Property{Name: name, Value: v})
+		}
+	}
+
+	return props, 0
+}
+
+// elementsUnder returns the sorted names of the readable elements under the
+// partial path, with those of table rows named for each row.
+func (h *Handle) elementsUnder(partialPath string) []string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	var names []string
+	for name, cb := range h.elements {
+		if cb.GetHandler == nil {
+			continue
+		}
+
+		tableName, leaf, isRow := strings.Cut(name, "{i}.")
+		if !isRow {
+			if strings.HasPrefix(name, partialPath) {
+				names = append(names, name)
+			}
+			continue
+		}
+
+		for _, row := range h.tables[tableName].rows {
+			if name := row.Name + leaf; strings.HasPrefix(name, partialPath) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// serveSet answers a set, the way _set_callback_handler does: the setters are
+// called in order until one fails, whose name then follows the return code.
+// The inbox is the consumer's, to which the response goes.
+func (h *Handle) serveSet(ctx context.Context, req *Message, inbox string) *Message {
+	resp := h.newMessage()
+
+	name, rc := h.setElements(ctx, req, inbox)
+	resp.AppendInt32(rc)
+	if rc != 0 {
+		resp.AppendString(name)
+	}
+
+	return resp
+}
+
+// setElements reads the properties of a set request and calls the setters,
+// returning the name of the one that failed.
+func (h *Handle) setElements(ctx context.Context, req *Message, inbox string) (string, int32) {
+	session, err := req.PopInt32()
+	if err != nil {
+		return "", int32(ErrInvalidInput)
+	}
+
+	component, err := req.PopString()
+	if err != nil {
+		return "", int32(ErrInvalidInput)
+	}
+
+	count, err := req.PopInt32()
+	if err != nil || count <= 0 {
+		return component, int32(ErrInvalidInput)
+	}
+
+	props := make([]stagedProperty, 0, min(int(count), req.remaining()/2))
+	for range count {
+		p := stagedProperty{requester: component, inbox: inbox}
+		if p.Name, err = req.PopString(); err != nil {
+			return component, int32(ErrInvalidInput)
+		}
+		if p.Value, err = req.PopValue(); err != nil {
+			return p.Name, int32(ErrInvalidInput)
+		}
+		props = append(props, p)
+	}
+
+	// The commit flag follows the properties; a set without one commits.
+	commit := true
+	if flag, err := req.PopString(); err == nil {
+		commit = strings.EqualFold(flag, "TRUE")
+	}
+
+	id := SessionID(session)
+	if h.cfg.stagedSets {
+		if !commit {
+			return h.stage(ctx, id, props)
+		}
+		props = append(h.unstage(id), props...)
+	}
+
+	for i, p := range props {
+		cb, found := h.element(p.Name)
+		if !found {
+			return p.Name, int32(ErrElementDoesNotExist)
+		}
+		if cb.SetHandler == nil {
+			return p.Name, int32(ErrInvalidOperation)
+		}
+
+		opts := SetHandlerOptions{
+			Session:   id,
+			Commit:    commit && i == len(props)-1,
+			Requester: p.requester,
+		}
+		if err := cb.SetHandler(ctx, p.Name, p.Value, opts); err != nil {
+			return p.Name, returnCode(err)
+		}
+	}
+
+	return "", 0
+}
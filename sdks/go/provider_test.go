@@ -0,0 +1,524 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rbustest"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage/rtroutedtest"
+)
+
+// routers numbers the routers of the tests, whose names must differ.
+var routers atomic.Int64
+
+// newRouter starts a MemRouter closed at the end of the test, returning it
+// and the URL to connect to it.
+func newRouter(t testing.TB) (*rtmessage.MemRouter, string) {
+	t.Helper()
+
+	name := fmt.Sprintf("rbus-test-%d", routers.Add(1))
+	r, err := rtmessage.NewMemRouter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	return r, "mem://" + name
+}
+
+// newServer starts an rtroutedtest.Server stopped at the end of the test,
+// returning it and the URL to connect to it, for the tests that need the
+// handles to talk over a socket.
+func newServer(t testing.TB) (*rtroutedtest.Server, string) {
+	t.Helper()
+
+	s := rtroutedtest.NewServer()
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Stop() })
+
+	return s, s.Addr()
+}
+
+// newBroker starts an rbustest.Broker providing the values, closed at the end
+// of the test.
+func newBroker(t testing.TB, values map[string]rbus.Value) *rbustest.Broker {
+	t.Helper()
+
+	b, err := rbustest.NewBroker(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	return b
+}
+
+// openHandle opens a handle of the component, closed at the end of the test.
+func openHandle(t testing.TB, url, component string, opts ...rbus.Option) *rbus.Handle {
+	t.Helper()
+
+	opts = append([]rbus.Option{rbus.WithURL(url), rbus.WithApplicationName(component)}, opts...)
+	h, err := rbus.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close(context.Background()) })
+
+	return h
+}
+
+// setter records the values handed to the SetHandlers it's used for, those
+// with Commit in their options marked with a "!", rejecting those of the
+// elements it's told to.
+type setter struct {
+	m      sync.Mutex
+	sets   []string
+	opts   []rbus.SetHandlerOptions
+	reject map[string]rbus.ErrorCode
+}
+
+func (s *setter) set(_ context.Context, name string, v rbus.Value, opts rbus.SetHandlerOptions) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.opts = append(s.opts, opts)
+	if code, found := s.reject[name]; found {
+		return code
+	}
+	set := fmt.Sprintf("%s=%s", name, v)
+	if opts.Commit {
+		set += "!"
+	}
+	s.sets = append(s.sets, set)
+	return nil
+}
+
+// took returns the values handed over since it was last called.
+func (s *setter) took() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	sets := fmt.Sprint(s.sets)
+	s.sets = nil
+	return sets
+}
+
+// register registers the elements with the setter as their SetHandler.
+func (s *setter) register(t *testing.T, h *rbus.Handle, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if err := h.RegisterElement(name, rbus.ElementCallbacks{SetHandler: s.set}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// sessionManager stands in for rbus_session_mgr: it hands out the sessions
+// one at a time, with the ids it's given in turn, and publishes the open one
+// each time one is created or ended.
+type sessionManager struct {
+	h *rbus.Handle
+
+	m     sync.Mutex
+	ids   []rbus.SessionID
+	open  int32
+	ended []int32
+}
+
+func newSessionManager(t *testing.T, url string, ids ...rbus.SessionID) *sessionManager {
+	t.Helper()
+
+	sm := sessionManager{
+		h:   openHandle(t, url, "_rbus_session_mgr"),
+		ids: ids,
+	}
+
+	err := sm.h.RegisterElement("currentSessionIDSignal", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) {
+			sm.m.Lock()
+			defer sm.m.Unlock()
+			return rbus.NewValue(sm.open), nil
+		},
+	})
+	if err == nil {
+		err = sm.h.RegisterMethod("req_new_s", sm.create)
+	}
+	if err == nil {
+		err = sm.h.RegisterMethod("end_of_s", sm.end)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &sm
+}
+
+func (sm *sessionManager) create(ctx context.Context, _ []rbus.Property) ([]rbus.Property, error) {
+	sm.m.Lock()
+	if sm.open != 0 || len(sm.ids) == 0 {
+		sm.m.Unlock()
+		return []rbus.Property{{Name: "return_value", Value: rbus.NewValue(int32(rbus.ErrSessionAlreadyExists))}}, nil
+	}
+	sm.open = int32(sm.ids[0])
+	sm.ids = sm.ids[1:]
+	open := sm.open
+	sm.m.Unlock()
+
+	sm.signal(ctx, open)
+
+	return []rbus.Property{
+		{Name: "return_value", Value: rbus.NewValue(int32(0))},
+		{Name: "sessionid", Value: rbus.NewValue(open)},
+	}, nil
+}
+
+func (sm *sessionManager) end(ctx context.Context, in []rbus.Property) ([]rbus.Property, error) {
+	var id int64
+	if len(in) > 0 {
+		id, _ = in[0].Value.AsInt64()
+	}
+
+	sm.m.Lock()
+	sm.ended = append(sm.ended, int32(id))
+	result := int32(rbus.ErrSessionAlreadyExists)
+	if id != 0 && int32(id) == sm.open {
+		sm.open = 0
+		result = 0
+	}
+	open := sm.open
+	sm.m.Unlock()
+
+	sm.signal(ctx, open)
+
+	return []rbus.Property{{Name: "result", Value: rbus.NewValue(result)}}, nil
+}
+
+// signal publishes the open session, before the method answers.
+func (sm *sessionManager) signal(ctx context.Context, open int32) {
+	_ = sm.h.Publish(ctx, rbus.Event{
+		Name: "currentSessionIDSignal",
+		Type: rbus.EventGeneral,
+		Data: []rbus.Property{
+			{Name: "return_value", Value: rbus.NewValue(int32(0))},
+			{Name: "sessionid", Value: rbus.NewValue(open)},
+		},
+	})
+}
+
+func TestProviderSet(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	s := setter{reject: map[string]rbus.ErrorCode{"Device.Test.Bad": rbus.ErrInvalidParameterValue}}
+	s.register(t, provider, "Device.Test.A", "Device.Test.B", "Device.Test.C", "Device.Test.Bad")
+	if err := provider.RegisterElement("Device.Test.ReadOnly", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(1), nil },
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	set := func(commit bool, names ...string) (rbus.SetResult, error) {
+		props := make([]rbus.Property, len(names))
+		for i, name := range names {
+			props[i] = rbus.Property{Name: name, Value: rbus.NewValue("v")}
+		}
+		return consumer.SetProperties(ctx, props, rbus.WithSession(7), rbus.WithCommit(commit))
+	}
+
+	// Each value is handed over as it comes, the last of a set that commits
+	// marked so.
+	if _, err := set(false, "Device.Test.A", "Device.Test.B"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.A=v Device.Test.B=v]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if _, err := set(true, "Device.Test.A", "Device.Test.B", "Device.Test.C"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.A=v Device.Test.B=v Device.Test.C=v!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	for _, opts := range s.opts {
+		if opts.Session != 7 || opts.Requester != "consumer" {
+			t.Fatalf("got %+v, want session 7 requested by consumer", opts)
+		}
+	}
+
+	// The values before the one rejected are handed over, and none after.
+	result, err := set(true, "Device.Test.A", "Device.Test.Bad", "Device.Test.C")
+	var pe *rbus.PropertyError
+	if !errors.As(err, &pe) || pe.Name != "Device.Test.Bad" || !errors.Is(err, rbus.ErrInvalidParameterValue) {
+		t.Fatalf("got %v, want %v for Device.Test.Bad", err, rbus.ErrInvalidParameterValue)
+	}
+	if got, want := s.took(), "[Device.Test.A=v]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if result.Failed != "Device.Test.Bad" || !result.Properties[1].Attempted || result.Properties[2].Attempted {
+		t.Fatalf("got %+v", result)
+	}
+
+	// So are the elements that can't be set.
+	_, err = set(true, "Device.Test.A", "Device.Test.ReadOnly")
+	if !errors.As(err, &pe) || pe.Name != "Device.Test.ReadOnly" || !errors.Is(err, rbus.ErrInvalidOperation) {
+		t.Fatalf("got %v, want %v for Device.Test.ReadOnly", err, rbus.ErrInvalidOperation)
+	}
+	_, err = set(true, "Device.Test.A", "Device.Test.Missing")
+	if !errors.As(err, &pe) || pe.Name != "Device.Test.Missing" || !errors.Is(err, rbus.ErrElementDoesNotExist) {
+		t.Fatalf("got %v, want %v for Device.Test.Missing", err, rbus.ErrElementDoesNotExist)
+	}
+	if got, want := s.took(), "[Device.Test.A=v Device.Test.A=v]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// A name nobody provides isn't routed.
+	_, err = set(true, "Device.Test.Missing")
+	if !errors.Is(err, rbus.ErrDestinationNotFound) || !errors.Is(err, rtmessage.ErrNoRoute) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+}
+
+func TestProviderStagedSets(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider", rbus.WithStagedSets())
+	consumer := openHandle(t, url, "consumer")
+
+	s := setter{reject: map[string]rbus.ErrorCode{"Device.Test.Bad": rbus.ErrInvalidParameterValue}}
+	s.register(t, provider, "Device.Test.A", "Device.Test.B", "Device.Test.C", "Device.Test.Bad")
+	if err := provider.RegisterElement("Device.Test.ReadOnly", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(1), nil },
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	set := func(name, v string, session rbus.SessionID, commit bool) error {
+		props := []rbus.Property{{Name: name, Value: rbus.NewValue(v)}}
+		_, err := consumer.SetProperties(ctx, props, rbus.WithSession(session), rbus.WithCommit(commit))
+		return err
+	}
+
+	// Staged values wait for the set that commits.
+	if err := set("Device.Test.A", "a", 7, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := set("Device.Test.B", "b", 7, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.took(); got != "[]" {
+		t.Fatalf("staged values handed over: %s", got)
+	}
+	if err := set("Device.Test.C", "c", 7, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.A=a Device.Test.B=b Device.Test.C=c!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// Another session's commit leaves them staged.
+	if err := set("Device.Test.A", "other", 8, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := set("Device.Test.B", "b9", 9, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.B=b9!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if err := set("Device.Test.C", "c8", 8, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.A=other Device.Test.C=c8!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// A value that can't be set is refused when it's staged.
+	var pe *rbus.PropertyError
+	err := set("Device.Test.ReadOnly", "2", 7, false)
+	if !errors.As(err, &pe) || pe.Name != "Device.Test.ReadOnly" || !errors.Is(err, rbus.ErrInvalidOperation) {
+		t.Fatalf("got %v, want %v for Device.Test.ReadOnly", err, rbus.ErrInvalidOperation)
+	}
+
+	// A commit stops at the value rejected, and drops what was staged.
+	if err := set("Device.Test.A", "a2", 7, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := set("Device.Test.Bad", "x", 7, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := set("Device.Test.B", "b2", 7, false); err != nil {
+		t.Fatal(err)
+	}
+	err = set("Device.Test.C", "c2", 7, true)
+	if !errors.As(err, &pe) || pe.Name != "Device.Test.Bad" || !errors.Is(err, rbus.ErrInvalidParameterValue) {
+		t.Fatalf("got %v, want %v for Device.Test.Bad", err, rbus.ErrInvalidParameterValue)
+	}
+	if got, want := s.took(), "[Device.Test.A=a2]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if err := set("Device.Test.C", "c3", 7, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.C=c3!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestProviderStagedSessionEnds(t *testing.T) {
+	_, url := newRouter(t)
+	newSessionManager(t, url, 1, 1)
+	provider := openHandle(t, url, "provider", rbus.WithStagedSets())
+	consumer := openHandle(t, url, "consumer")
+
+	var s setter
+	s.register(t, provider, "Device.Test.A", "Device.Test.B")
+
+	ctx := context.Background()
+	id, err := consumer.CreateSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := []rbus.Property{{Name: "Device.Test.A", Value: rbus.NewValue("a")}}
+	if err := consumer.SetMultiple(ctx, a, false, rbus.WithSession(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.CloseSession(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session manager reuses the id, but not what was staged in it.
+	again, err := consumer.CreateSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Fatalf("got session %d, want %d again", again, id)
+	}
+	b := []rbus.Property{{Name: "Device.Test.B", Value: rbus.NewValue("b")}}
+	if err := consumer.SetMultiple(ctx, b, true, rbus.WithSession(again)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.took(), "[Device.Test.B=b!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestProviderStagedConsumerGone(t *testing.T) {
+	r, url := newRouter(t)
+	provider := openHandle(t, url, "provider", rbus.WithStagedSets())
+	gone := openHandle(t, url, "gone")
+	consumer := openHandle(t, url, "consumer")
+
+	var s setter
+	s.register(t, provider, "Device.Test.A", "Device.Test.B", "Device.Test.C")
+
+	ctx := context.Background()
+	stage := func(h *rbus.Handle, name string, commit bool) {
+		t.Helper()
+		props := []rbus.Property{{Name: name, Value: rbus.NewValue("v")}}
+		if err := h.SetMultiple(ctx, props, commit, rbus.WithSession(5)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stage(gone, "Device.Test.A", false)
+	stage(consumer, "Device.Test.B", false)
+
+	// The router reports the first consumer gone, which won't commit.
+	err := r.Inject(rtmessage.Message{
+		Header:  &rtmessage.Header{Topic: rtmessage.AdvisoryTopic},
+		Payload: fmt.Appendf(nil, `{"event":%d,"inbox":"%s"}`, rtmessage.AdvisoryClientDisconnect, gone.Inbox()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stage(consumer, "Device.Test.C", true)
+	if got, want := s.took(), "[Device.Test.B=v Device.Test.C=v!]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestProviderSubscriberGone(t *testing.T) {
+	r, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	gone := openHandle(t, url, "gone")
+	consumer := openHandle(t, url, "consumer")
+
+	subscribers := make(chan string, 10)
+	err := provider.RegisterElement("Device.Test.Event!", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(int32(0)), nil },
+		SubscribeHandler: func(_ string, added bool, count int, _ *rbus.Filter, _ time.Duration) error {
+			subscribers <- fmt.Sprintf("%t %d", added, count)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	goneEvents := make(chan rbus.Event, 10)
+	events := make(chan rbus.Event, 10)
+	_, err = gone.Subscribe(ctx, "Device.Test.Event!", func(e rbus.Event) { goneEvents <- e })
+	if err == nil {
+		_, err = consumer.Subscribe(ctx, "Device.Test.Event!", func(e rbus.Event) { events <- e })
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"true 1", "true 2"} {
+		if got := <-subscribers; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+
+	// The router reports the first consumer gone without it unsubscribing.
+	err = r.Inject(rtmessage.Message{
+		Header:  &rtmessage.Header{Topic: rtmessage.AdvisoryTopic},
+		Payload: fmt.Appendf(nil, `{"event":%d,"inbox":"%s"}`, rtmessage.AdvisoryClientDisconnect, gone.Inbox()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-subscribers:
+		if want := "false 1"; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the provider wasn't told of the subscriber gone")
+	}
+
+	// Its subscription is dropped, the other kept.
+	if err := provider.Publish(ctx, rbus.Event{Name: "Device.Test.Event!", Type: rbus.EventGeneral}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for the subscriber left")
+	}
+	select {
+	case e := <-goneEvents:
+		t.Fatalf("got %+v for the subscriber gone", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,358 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// subscriber is a consumer subscribed to an element of the handle.
+type subscriber struct {
+	name        string
+	listener    string
+	componentID int32
+	interval    int32
+	duration    int32
+	filter      *filter
+
+	// initial asks for the value of the element to be sent with the
+	// response to the subscribe; it's not part of the subscription.
+	initial bool
+}
+
+// matches reports whether the subscribers are the same subscription.
+func (s *subscriber) matches(o *subscriber) bool {
+	return s.name == o.name &&
+		s.listener == o.listener &&
+		s.componentID == o.componentID &&
+		s.interval == o.interval &&
+		s.duration == o.duration &&
+		s.filter.equal(o.filter)
+}
+
+// serveSubscribe answers a subscribe or unsubscribe, the way
+// _event_subscribe_callback_handler does.  Only the changes of registered
+// elements can be subscribed to, and not at intervals nor for a duration.  The
+// value of the element is sent with the response when the consumer asked for
+// it and the element can be read.
+func (h *Handle) serveSubscribe(ctx context.Context, req *Message, add bool) *Message {
+	resp := h.newMessage()
+
+	s, err := h.popSubscriber(req)
+	if err != nil {
+		resp.AppendInt32(int32(ErrInvalidInput))
+		return resp
+	}
+
+	h.subscribing.Lock()
+	defer h.subscribing.Unlock()
+
+	if !add {
+		if removed, count := h.removeSubscriber(s); removed {
+			_ = h.notifySubscribe(s, false, count)
+		}
+		resp.AppendInt32(0)
+		return resp
+	}
+
+	if _, found := h.element(s.name); !found {
+		resp.AppendInt32(int32(ErrInvalidEvent))
+		return resp
+	}
+	if s.interval != 0 || s.duration != 0 {
+		resp.AppendInt32(int32(ErrInvalidOperation))
+		return resp
+	}
+
+	id, count, err := h.addSubscriber(s)
+	if err == nil {
+		if err = h.notifySubscribe(s, true, count); err != nil {
+			h.removeSubscriber(s)
+		}
+	}
+	if err != nil {
+		resp.AppendInt32(returnCode(err))
+		return resp
+	}
+	resp.AppendInt32(0)
+	if s.initial {
+		h.appendInitialValue(ctx, resp, s)
+	}
+	resp.AppendInt32(id)
+
+	return resp
+}
+
+// appendInitialValue appends the event carrying the value of the element the
+// subscriber subscribed to, preceded by 1, the way _subscribe_callback_handler
+// does; the value is named "initialValue" there.  It appends 0 alone when the
+// value can't be read, and the consumer then gets it by itself.
+func (h *Handle) appendInitialValue(ctx context.Context, resp *Message, s *subscriber) {
+	cb, found := h.element(s.name)
+	if !found || cb.GetHandler == nil {
+		resp.AppendInt32(0)
+		return
+	}
+
+	v, err := cb.GetHandler(ctx, s.name)
+	if err != nil {
+		resp.AppendInt32(0)
+		return
+	}
+
+	// Encoded apart, so a value that can't be leaves the response as it was.
+	m := h.newMessage()
+	err = appendEventData(m, eventData{
+		event: Event{
+			Name: s.name,
+			Type: EventInitialValue,
+			Data: []Property{{Name: "initialValue", Value: v}},
+		},
+		filter:      s.filter,
+		interval:    s.interval,
+		duration:    s.duration,
+		componentID: s.componentID,
+	})
+	if err != nil {
+		resp.AppendInt32(0)
+		return
+	}
+
+	resp.AppendInt32(1)
+	resp.buf = append(resp.buf, m.Bytes()...)
+}
+
+// popSubscriber reads the subscription of a subscribe or unsubscribe
+// request, as written by subscriptionRequest.
+func (h *Handle) popSubscriber(req *Message) (*subscriber, error) {
+	var s subscriber
+	var err error
+
+	if s.name, err = req.PopString(); err != nil {
+		return nil, err
+	}
+	if s.listener, err = req.PopString(); err != nil {
+		return nil, err
+	}
+
+	hasPayload, err := req.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if hasPayload != 0 {
+		b, err := req.PopBytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := h.popSubscriberOptions(b, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	// Older consumers stop at the payload.
+	if publish, err := req.PopInt32(); err == nil {
+		s.initial = publish != 0
+	}
+
+	return &s, nil
+}
+
+// popSubscriberOptions reads the options of the subscription from the nested
+// message of the request.
+func (h *Handle) popSubscriberOptions(b []byte, s *subscriber) error {
+	payload := NewMessageFromBytes(b)
+	payload.SetValueWireFormat(h.cfg.wireFormat)
+
+	var err error
+	if s.componentID, err = payload.PopInt32(); err != nil {
+		return err
+	}
+	if s.interval, err = payload.PopInt32(); err != nil {
+		return err
+	}
+	if s.duration, err = payload.PopInt32(); err != nil {
+		return err
+	}
+
+	hasFilter, err := payload.PopInt32()
+	if err != nil {
+		return err
+	}
+	if hasFilter != 0 {
+		if s.filter, err = popFilter(payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSubscriber adds the subscriber, returning the id of its subscription
+// and the number of subscribers to the element, and starts detecting the
+// changes of the element for its first one.
+func (h *Handle) addSubscriber(s *subscriber) (int32, int, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for _, sub := range h.subscribers[s.name] {
+		if sub.matches(s) {
+			return 0, 0, ErrSubscriptionAlreadyExists
+		}
+	}
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[string][]*subscriber)
+	}
+	h.subscribers[s.name] = append(h.subscribers[s.name], s)
+	if len(h.subscribers[s.name]) == 1 {
+		h.startDetectionLocked(s.name)
+	}
+
+	h.lastSubscriber++
+	return h.lastSubscriber, len(h.subscribers[s.name]), nil
+}
+
+// removeSubscriber removes the subscriber, reporting whether it was there and
+// the number of subscribers to the element left, and stops detecting the
+// changes of the element once it has none.
+func (h *Handle) removeSubscriber(s *subscriber) (bool, int) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	subs := h.subscribers[s.name]
+	i := slices.IndexFunc(subs, s.matches)
+	if i < 0 {
+		return false, len(subs)
+	}
+	subs = append(subs[:i], subs[i+1:]...)
+
+	if len(subs) > 0 {
+		h.subscribers[s.name] = subs
+		return true, len(subs)
+	}
+
+	delete(h.subscribers, s.name)
+	h.stopDetectionLocked(s.name)
+	return true, 0
+}
+
+// notifySubscribe tells the SubscribeHandler of the element, if any, that the
+// subscriber was added or removed.  The caller must hold h.subscribing.
+func (h *Handle) notifySubscribe(s *subscriber, added bool, count int) error {
+	cb, found := h.element(s.name)
+	if !found || cb.SubscribeHandler == nil {
+		return nil
+	}
+
+	var f *Filter
+	if s.filter != nil {
+		f = &Filter{f: s.filter}
+	}
+
+	return cb.SubscribeHandler(s.name, added, count, f, time.Duration(s.interval)*time.Second)
+}
+
+// onAdvisory removes the subscribers of a consumer the router reports gone,
+// as they'll never unsubscribe, and drops the values it staged, as it'll never
+// commit them.  It's called by the connection's reader, so the
+// SubscribeHandlers are called from another goroutine.
+func (h *Handle) onAdvisory(a rtmessage.Advisory) {
+	if a.Kind != rtmessage.AdvisoryClientDisconnect || a.Inbox == "" {
+		return
+	}
+
+	h.dropStagedOf(a.Inbox)
+	go h.removeSubscribersOf(a.Inbox)
+}
+
+// removeSubscribersOf removes the subscribers whose events go to the inbox.
+func (h *Handle) removeSubscribersOf(listener string) {
+	h.subscribing.Lock()
+	defer h.subscribing.Unlock()
+
+	h.m.Lock()
+	var gone []*subscriber
+	for _, subs := range h.subscribers {
+		for _, s := range subs {
+			if s.listener == listener {
+				gone = append(gone, s)
+			}
+		}
+	}
+	h.m.Unlock()
+
+	for _, s := range gone {
+		if removed, count := h.removeSubscriber(s); removed {
+			_ = h.notifySubscribe(s, false, count)
+		}
+	}
+
+	if len(gone) > 0 {
+		h.cfg.logger.Debug("subscribers gone", "inbox", listener, "subscriptions", len(gone))
+	}
+}
+
+// Publish sends the event to the consumers subscribed to the element it's
+// named after, which must be registered with RegisterElement.  A subscriber
+// with a filter only gets the events whose "value" passes it.  Having no
+// subscribers isn't an error.  The value changes of an element are better
+// published with EnableValueChangeDetection.
+func (h *Handle) Publish(ctx context.Context, e Event) error {
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("publish '%s': %w", e.Name, err)
+	}
+	if _, found := h.element(e.Name); !found {
+		return fmt.Errorf("publish '%s': %w", e.Name, ErrInvalidEvent)
+	}
+
+	return h.publish(ctx, e)
+}
+
+// publish sends the event about the named element to each of its
+// subscribers, the way rbus_publishSubscriberEvent does.  A subscriber with a
+// filter only gets the value changes whose new value passes it.
+func (h *Handle) publish(ctx context.Context, e Event) error {
+	h.m.Lock()
+	subs := slices.Clone(h.subscribers[e.Name])
+	con := h.conn
+	h.m.Unlock()
+
+	val, hasValue := eventValue(e)
+
+	var errs []error
+	for _, s := range subs {
+		if s.filter != nil && hasValue && !s.filter.apply(val) {
+			continue
+		}
+
+		m := h.newMessage()
+		err := appendEventData(m, eventData{
+			event:       e,
+			filter:      s.filter,
+			interval:    s.interval,
+			duration:    s.duration,
+			componentID: s.componentID,
+		})
+		if err != nil {
+			return fmt.Errorf("publish '%s': %w", e.Name, err)
+		}
+		m.setEventMetaInfo(e.Name, e.Name)
+
+		if err := con.SendBinary(ctx, m.Bytes(), s.listener); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("publish '%s': %w", e.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
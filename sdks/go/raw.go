@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// RawSubscription is a subscription to the raw data published to a topic.
+type RawSubscription struct {
+	topic  string
+	cancel rtmessage.CancelListenerFunc
+}
+
+// Topic returns the topic, or expression, subscribed to.
+func (s *RawSubscription) Topic() string {
+	return s.topic
+}
+
+// Close ends the subscription.  Closing it again does nothing.
+func (s *RawSubscription) Close() error {
+	s.cancel()
+	return nil
+}
+
+// PublishRaw sends the data to the subscribers of the topic as is, the way
+// rbusMessage_Send does, with none of the encoding of events.  Like an event
+// it is delivered at most once and in the order published, and dropped when
+// nobody is subscribed.
+func (h *Handle) PublishRaw(ctx context.Context, topic string, data []byte) error {
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("publish raw '%s': %w", topic, err)
+	}
+	con, err := h.transport()
+	if err != nil {
+		return fmt.Errorf("publish raw '%s': %w", topic, err)
+	}
+
+	if err := con.SendBinary(ctx, data, topic); err != nil {
+		return fmt.Errorf("publish raw '%s': %w", topic, err)
+	}
+
+	return nil
+}
+
+// SubscribeRaw calls the handler with the raw data published to the topic
+// with PublishRaw or rbusMessage_Send, the way rbusMessage_AddListener does.
+// The topic can end in a "*" segment to match any last segment.  The
+// handler is called from the handle's listener, so it should return quickly,
+// and it must not keep the data past its return.
+func (h *Handle) SubscribeRaw(ctx context.Context, topic string, handler func(topic string, data []byte)) (*RawSubscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("subscribe raw '%s': nil handler", topic)
+	}
+	if err := h.checkOpen(); err != nil {
+		return nil, fmt.Errorf("subscribe raw '%s': %w", topic, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("subscribe raw '%s': %w", topic, err)
+	}
+
+	con, err := h.transport()
+	if err != nil {
+		return nil, fmt.Errorf("subscribe raw '%s': %w", topic, err)
+	}
+	l, ok := con.(topicListener)
+	if !ok {
+		return nil, fmt.Errorf("subscribe raw '%s': %w: the transport can't subscribe to raw data", topic, ErrInvalidOperation)
+	}
+
+	cancel, err := l.Add(rtmessage.MessageListenerFunc(func(msg rtmessage.Message) {
+		if msg.Type() == rtmessage.MsgTypeMessage && rtmessage.MatchTopic(topic, msg.Header.Topic) {
+			handler(msg.Header.Topic, msg.Payload)
+		}
+	}), topic)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe raw '%s': %w", topic, err)
+	}
+
+	return &RawSubscription{topic: topic, cancel: cancel}, nil
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// benchPayload is the telemetry sample published by the benchmarks.
+var benchPayload = bytes.Repeat([]byte{0xa5}, 256)
+
+func TestPublishRaw(t *testing.T) {
+	_, url := newRouter(t)
+	publisher := openHandle(t, url, "publisher")
+	consumer := openHandle(t, url, "consumer")
+
+	got := make(chan string, 3)
+	sub, err := consumer.SubscribeRaw(context.Background(), "Device.Test.*", func(topic string, data []byte) {
+		got <- topic + "=" + string(data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In order, and untouched.
+	for _, s := range []string{"a", "b"} {
+		if err := publisher.PublishRaw(context.Background(), "Device.Test.Raw", []byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"Device.Test.Raw=a", "Device.Test.Raw=b"} {
+		if s := <-got; s != want {
+			t.Fatalf("got %s, want %s", s, want)
+		}
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.PublishRaw(context.Background(), "Device.Test.Raw", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.PublishRaw(context.Background(), "Device.Other", []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case s := <-got:
+		t.Fatalf("got %s after unsubscribing", s)
+	default:
+	}
+}
+
+// BenchmarkPublishRaw measures the throughput of raw data from a publisher to
+// a subscriber, to compare with BenchmarkPublishEvent.
+func BenchmarkPublishRaw(b *testing.B) {
+	_, url := newRouter(b)
+	publisher := openHandle(b, url, "publisher")
+	consumer := openHandle(b, url, "consumer")
+
+	received := make(chan struct{}, 1024)
+	_, err := consumer.SubscribeRaw(context.Background(), "Device.Test.Raw", func(string, []byte) {
+		received <- struct{}{}
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkPublish(b, received, func(ctx context.Context) error {
+		return publisher.PublishRaw(ctx, "Device.Test.Raw", benchPayload)
+	})
+}
+
+// BenchmarkPublishEvent measures the throughput of the same data sent as the
+// value of an event, encoded as a property.
+func BenchmarkPublishEvent(b *testing.B) {
+	_, url := newRouter(b)
+	publisher := openHandle(b, url, "publisher")
+	consumer := openHandle(b, url, "consumer")
+
+	err := publisher.RegisterElement("Device.Test.Event!", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(benchPayload), nil },
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	received := make(chan struct{}, 1024)
+	_, err = consumer.Subscribe(context.Background(), "Device.Test.Event!", func(rbus.Event) {
+		received <- struct{}{}
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	e := rbus.Event{
+		Name: "Device.Test.Event!",
+		Type: rbus.EventGeneral,
+		Data: []rbus.Property{{Name: "value", Value: rbus.NewValue(benchPayload)}},
+	}
+	benchmarkPublish(b, received, func(ctx context.Context) error {
+		return publisher.Publish(ctx, e)
+	})
+}
+
+// benchmarkPublish publishes b.N times, waiting for the subscriber to have
+// received every one.
+func benchmarkPublish(b *testing.B, received <-chan struct{}, publish func(context.Context) error) {
+	b.Helper()
+
+	ctx := context.Background()
+	b.SetBytes(int64(len(benchPayload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	done := make(chan struct{})
+	go func() {
+		for range b.N {
+			<-received
+		}
+		close(done)
+	}()
+
+	for range b.N {
+		if err := publish(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -4,24 +4,103 @@
 package rbus
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/internal/notify"
 	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
 )
 
 // config holds the configuration for the rbus connection
 type config struct {
-	url     string
-	appName string
-	id      int
+	url         string
+	appName     string
+	id          int
+	fixedInbox  bool
+	wireFormat  ValueWireFormat
+	tracer      TracePropagator
+	timeout     time.Duration
+	resubscribe time.Duration
+	retry       RetryPolicy
+	transport   Transport
+	logger      *slog.Logger
+	metrics     HandleMetrics
+	stagedSets  bool
 }
 
 // Assure that optionFunc implements the Options interface.
 var _ Option = optionFunc(nil)
 
+// lastComponentID numbers the handles of the process, like the C library
+// does, so the events published for the subscriptions of a handle can be told
+// apart from those of another.
+var lastComponentID atomic.Int32
+
+// Handle is a connection to the bus, through which a component consumes
+// and provides elements.  All of its methods are safe for concurrent use, as
+// are those of the subscriptions and direct handles it returns: requests made
+// at the same time are sent as they come and their responses matched up, and
+// a method called while the handle is being opened or closed fails with
+// ErrNotOpen or ErrHandleClosed rather than racing it.
 type Handle struct {
-	cfg  config
-	conn *rtmessage.Connection
+	cfg         config
+	cache       subtreeCache
+	componentID int32
+	states      notify.Notifier[State]
+
+	// reg serializes the registration of elements, and guards stopServing.
+	reg         sync.Mutex
+	stopServing rtmessage.CancelListenerFunc
+
+	// subscribing serializes the changes of the subscribers to the
+	// elements, so their SubscribeHandlers are told of them in order.
+	subscribing sync.Mutex
+
+	// watching serializes the subscriptions to the session manager's
+	// signal.
+	watching sync.Mutex
+
+	// m guards the transport, whether the handle is being opened or is
+	// closed, the functions cancelling its listeners, the session, the
+	// subscriptions and their ids, the registered elements, tables and
+	// methods, their subscribers and the detection of their changes, the
+	// values staged by sets waiting for a commit and the watch of the
+	// sessions, the outstanding method calls, both made and served, and
+	// requests, the direct connections, the reconnect functions, the retry
+	// of the subscriptions, and the progress of a reconnect.
+	m              sync.Mutex
+	conn           Transport
+	opening        bool
+	closed         bool
+	stopEvents     rtmessage.CancelListenerFunc
+	stopRestore    rtmessage.CancelListenerFunc
+	stopStates     rtmessage.CancelListenerFunc
+	inflight       sync.WaitGroup
+	session        SessionID
+	subs           []*Subscription
+	elements       map[string]ElementCallbacks
+	staged         map[SessionID][]stagedProperty
+	sessionWatch   *Subscription
+	tables         map[string]*table
+	methods        map[string]MethodHandler
+	subscribers    map[string][]*subscriber
+	lastSubscriber int32
+	detectors      map[string]*valueChange
+	directs        map[*DirectHandle]struct{}
+	lastCall       uint64
+	calls          map[uint64]context.CancelCauseFunc
+	reconnected    []func()
+	stopRetry      context.CancelFunc
+	transportUp    bool
+	restoreDone    bool
 }
 
 // New creates a new rbus handle or returns an error.
@@ -35,6 +114,8 @@ func New(opts ...Option) (*Handle, error) {
 
 	defaults := []Option{
 		WithInboxAsPID(),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithResubscribePeriod(defaultResubscribePeriod),
 	}
 
 	opts = append(defaults, opts...)
@@ -47,39 +128,493 @@ func New(opts ...Option) (*Handle, error) {
 		}
 	}
 
+	h.componentID = lastComponentID.Add(1)
+
 	return &h, nil
 }
 
-// Open creates a new rbus connection or returns an error.
-func (h *Handle) Open() error {
-	con, err := rtmessage.New(h.cfg.url, h.cfg.appName)
-	if err != nil {
+// Open creates a new rbus connection or returns an error.  It gives up when
+// the context is done before the router is reached.  Like rbus_open, it adds
+// the component, named by the application name, to the bus, and fails with
+// an error matching ErrComponentNameDuplicate when another component of the
+// name is there already.  Once open, the handle reconnects whenever the
+// connection is lost and restores its state; see OnReconnect and
+// AddConnectionListener.  A handle is opened once: opening it again, or once
+// closed, fails.
+func (h *Handle) Open(ctx context.Context) error {
+	h.m.Lock()
+	switch {
+	case h.closed:
+		h.m.Unlock()
+		return ErrHandleClosed
+	case h.conn != nil || h.opening:
+		h.m.Unlock()
+		return fmt.Errorf("%w: already open", ErrInvalidOperation)
+	}
+	h.opening = true
+	h.m.Unlock()
+
+	defer func() {
+		h.m.Lock()
+		h.opening = false
+		h.m.Unlock()
+	}()
+
+	con := h.cfg.transport
+	if con == nil {
+		c, err := rtmessage.New(h.cfg.url, h.cfg.appName,
+			rtmessage.WithInbox(h.inbox()),
+			rtmessage.WithLogger(h.cfg.logger),
+			rtmessage.WithAutoReconnect(reconnectDelay, maxReconnectDelay),
+			rtmessage.WithAdvisoryListener(rtmessage.AdvisoryListenerFunc(h.onAdvisory)))
+		if err != nil {
+			return err
+		}
+
+		if err := c.Connect(ctx); err != nil {
+			_ = c.Close()
+			return err
+		}
+		con = c
+	} else if err := con.Connect(ctx); err != nil {
 		return err
 	}
 
-	err = con.Connect()
-	if err != nil {
+	h.attach(con)
+
+	if err := h.register(ctx, con); err != nil {
+		h.detach()
+		h.m.Lock()
+		h.conn = nil
+		h.m.Unlock()
+		_ = h.release(con)
 		return err
 	}
+	h.states.Notify(StateConnected, nil)
 
-	h.conn = con
 	return nil
 }
 
-func (h *Handle) Get(name string) (*Value, error) {
-	return nil, errors.New("not implemented")
+// attach has the handle use the connected transport, handling the events
+// and the reconnects of it.
+func (h *Handle) attach(con Transport) {
+	stopEvents := con.AddInboxListener(rtmessage.MessageListenerFunc(h.onEvent))
+	var stopRestore, stopStates rtmessage.CancelListenerFunc
+	if r, ok := con.(reconnecter); ok {
+		stopRestore = r.AddReconnectListener(rtmessage.ReconnectListenerFunc(h.restore))
+	}
+	if s, ok := con.(stateWatcher); ok {
+		stopStates = s.AddStateListener(rtmessage.StateListenerFunc(h.onStateChange))
+	}
+
+	h.m.Lock()
+	h.conn = con
+	h.stopEvents, h.stopRestore, h.stopStates = stopEvents, stopRestore, stopStates
+	h.m.Unlock()
+}
+
+// detach stops handling the events and the reconnects of the transport,
+// which the handle no longer uses.
+func (h *Handle) detach() {
+	h.m.Lock()
+	stops := []rtmessage.CancelListenerFunc{h.stopEvents, h.stopRestore, h.stopStates}
+	h.stopEvents, h.stopRestore, h.stopStates = nil, nil, nil
+	h.m.Unlock()
+
+	for _, stop := range stops {
+		if stop != nil {
+			stop()
+		}
+	}
 }
 
-func (h *Handle) Set(name string, value *Value) error {
-	return errors.New("not implemented")
+// Inbox returns the topic the handle receives responses and events on, or an
+// empty string before it is open.
+func (h *Handle) Inbox() string {
+	con, err := h.transport()
+	if err != nil {
+		return ""
+	}
+	return con.Inbox()
 }
 
-func (h *Handle) Close() error {
-	var err error
-	if h.conn != nil {
-		err = h.conn.Disconnect()
-		h.conn = nil
+// inbox returns the inbox of the default connection.  Unless the id is fixed
+// it is followed by the component id, which is unique to the handle within
+// the process.
+func (h *Handle) inbox() string {
+	inbox := fmt.Sprintf("%s.%s.INBOX.%d", h.cfg.appName, filepath.Base(os.Args[0]), h.cfg.id)
+	if !h.cfg.fixedInbox {
+		inbox += fmt.Sprintf(".%d", h.componentID)
+	}
+	return inbox
+}
+
+// Get fetches the value of the named property from the provider that owns it,
+// or from the component given with ToComponent, waiting for the response until
+// the context is done.  When the provider fails the request, the error matches
+// its ErrorCode, such as ErrElementDoesNotExist, and when no provider of the
+// name is on the bus, ErrDestinationNotFound.
+func (h *Handle) Get(ctx context.Context, name string, opts ...CallOption) (Value, error) {
+	cfg := newCallConfig(opts)
+	if err := cfg.check(name); err != nil {
+		return Value{}, fmt.Errorf("get '%s': %w", name, err)
+	}
+
+	var props []Property
+	err := h.retry(ctx, true, func() (err error) {
+		props, err = h.getFrom(ctx, cfg.topic(name), []string{name})
+		return cfg.wrap(err)
+	})
+	if err != nil {
+		return Value{}, fmt.Errorf("get '%s': %w", name, err)
+	}
+
+	for _, p := range props {
+		if p.Name == name {
+			return p.Value, nil
+		}
+	}
+
+	return Value{}, fmt.Errorf("get '%s': %w: not in the response", name, ErrMalformedMessage)
+}
+
+// GetOr fetches the named property like Get, but returns def when the
+// provider reports that the property doesn't exist, or when no provider
+// serves the name at all.  Every other failure,
+// such as a timeout or ErrAccessNotAllowed, is returned as usual.
+func (h *Handle) GetOr(ctx context.Context, name string, def Value) (Value, error) {
+	v, err := h.Get(ctx, name)
+	if missing(err) {
+		return def, nil
+	}
+	return v, err
+}
+
+// GetString fetches the named string property.  A property of another type
+// fails with an error matching ErrTypeMismatch.
+func (h *Handle) GetString(ctx context.Context, name string) (string, error) {
+	v, err := h.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	s, err := v.AsString()
+	if err != nil {
+		return "", fmt.Errorf("get '%s': %w", name, err)
+	}
+	return s, nil
+}
+
+// GetInt fetches the named property of any integer type.  See Value.AsInt64
+// for the conversion.
+func (h *Handle) GetInt(ctx context.Context, name string) (int64, error) {
+	v, err := h.Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	i, err := v.AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("get '%s': %w", name, err)
+	}
+	return i, nil
+}
+
+// GetBool fetches the named boolean property.  A property of another type
+// fails with an error matching ErrTypeMismatch.
+func (h *Handle) GetBool(ctx context.Context, name string) (bool, error) {
+	v, err := h.Get(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	b, err := v.AsBool()
+	if err != nil {
+		return false, fmt.Errorf("get '%s': %w", name, err)
+	}
+	return b, nil
+}
+
+// GetFloat fetches the named floating point property.  See Value.AsFloat64
+// for the conversion.
+func (h *Handle) GetFloat(ctx context.Context, name string) (float64, error) {
+	v, err := h.Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := v.AsFloat64()
+	if err != nil {
+		return 0, fmt.Errorf("get '%s': %w", name, err)
+	}
+	return f, nil
+}
+
+// GetBytes fetches the named bytes property, returning a copy of its data.  A
+// property of another type fails with an error matching ErrTypeMismatch.
+func (h *Handle) GetBytes(ctx context.Context, name string) ([]byte, error) {
+	v, err := h.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := v.AsBytes()
+	if err != nil {
+		return nil, fmt.Errorf("get '%s': %w", name, err)
+	}
+	return b, nil
+}
+
+// GetMultiple fetches the values of the named properties with a single
+// request, keyed by name.  See GetProperties for how failures are reported;
+// when only some of the properties failed, the map holds the others.
+func (h *Handle) GetMultiple(ctx context.Context, names ...string) (map[string]Value, error) {
+	props, err := h.GetProperties(ctx, names...)
+
+	values := make(map[string]Value, len(props))
+	for _, p := range props {
+		values[p.Name] = p.Value
+	}
+
+	return values, err
+}
+
+// GetProperties fetches the named properties with a single request, returning
+// them in the order the provider sent them.  The names should belong to the
+// same provider, as the request is routed by the first one.
+//
+// A property that can't be fetched, because its provider fails it or no
+// provider of its name is on the bus, doesn't fail the others: the properties
+// that could be fetched are returned along with the errors of the rest joined,
+// each a *PropertyError wrapping the ErrorCode, ErrDestinationNotFound for a
+// name without a provider.  Since an rbus provider rejects the whole request
+// when one of the names fails, the properties are then fetched one by one to
+// tell which.  Any other failure, such as the context being done or the
+// connection being lost, fails the call as a whole.
+func (h *Handle) GetProperties(ctx context.Context, names ...string) ([]Property, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	props, err := h.get(ctx, names)
+	var code ErrorCode
+	if errors.As(err, &code) && len(names) > 1 {
+		return h.getEach(ctx, names)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
+	}
+
+	found := make(map[string]bool, len(props))
+	for _, p := range props {
+		found[p.Name] = true
+	}
+
+	var errs []error
+	for _, name := range names {
+		if !found[name] {
+			errs = append(errs, &PropertyError{Name: name, Err: ErrElementDoesNotExist})
+		}
+	}
+
+	return props, errors.Join(errs...)
+}
+
+// getEach fetches the properties with a request each, so the failure of one
+// is told apart from the others.
+func (h *Handle) getEach(ctx context.Context, names []string) ([]Property, error) {
+	var props []Property
+	var errs []error
+
+	for _, name := range names {
+		got, err := h.get(ctx, []string{name})
+
+		var code ErrorCode
+		if errors.As(err, &code) {
+			errs = append(errs, &PropertyError{Name: name, Err: err})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get '%s': %w", name, err)
+		}
+
+		props = append(props, got...)
 	}
 
+	return props, errors.Join(errs...)
+}
+
+// get fetches the named properties with a single request to the provider of
+// the first one.  When there's none, the error matches ErrDestinationNotFound.
+func (h *Handle) get(ctx context.Context, names []string) ([]Property, error) {
+	props, err := h.getFrom(ctx, names[0], names)
+	return props, callConfig{}.wrap(err)
+}
+
+// getFrom fetches the named properties with a single request to the topic.
+func (h *Handle) getFrom(ctx context.Context, topic string, names []string) ([]Property, error) {
+	resp, err := h.request(ctx, topic, h.getRequest(ctx, names))
+	if err != nil {
+		return nil, err
+	}
+
+	return popProperties(resp)
+}
+
+// getRequest builds the get request of the named properties.
+func (h *Handle) getRequest(ctx context.Context, names []string) *Message {
+	req := h.newMessage()
+	req.AppendString(h.cfg.appName)
+	req.AppendInt32(int32(len(names)))
+	for _, name := range names {
+		req.AppendString(name)
+	}
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodGetParameterValues, parent, state)
+
+	return req
+}
+
+// GetCached returns every property under the partial name (for example
+// "Device.WiFi."), serving the result from a cache for ttl after it was
+// fetched.  Concurrent callers for the same name share a single request to
+// the bus; when the caller that made it gives up, the others make another.
+// Failed fetches are not cached.
+func (h *Handle) GetCached(ctx context.Context, partialName string, ttl time.Duration) ([]Property, error) {
+	return h.cache.get(ctx, partialName, ttl, func(ctx context.Context) ([]Property, error) {
+		return h.GetWildcard(ctx, partialName)
+	})
+}
+
+// GetWildcard fetches every property under the partial path, such as
+// "Device.WiFi.", or matching a path with "*" wildcards.  The router is asked
+// which providers serve the path and each is sent the request in turn, so the
+// properties are returned in the order the providers sent them.  When a
+// provider fails, the properties fetched so far are returned along with the
+// error.
+func (h *Handle) GetWildcard(ctx context.Context, partialPath string) ([]Property, error) {
+	if err := h.checkOpen(); err != nil {
+		return nil, fmt.Errorf("get '%s': %w", partialPath, err)
+	}
+
+	d, err := h.discoverer()
+	if err != nil {
+		return nil, fmt.Errorf("get '%s': %w", partialPath, err)
+	}
+
+	destinations, err := d.DiscoverWildcardDestinations(ctx, partialPath)
+	if err != nil {
+		return nil, fmt.Errorf("get '%s': %w", partialPath, err)
+	}
+
+	// With no destination the path may be a table row served by a single
+	// provider, which is asked directly like the C library does.
+	if len(destinations) == 0 {
+		destinations = []string{partialPath}
+	}
+
+	var props []Property
+	for _, destination := range destinations {
+		got, err := h.getFrom(ctx, destination, []string{partialPath})
+		if err != nil {
+			return props, fmt.Errorf("get '%s' from '%s': %w", partialPath, destination, err)
+		}
+		props = append(props, got...)
+	}
+
+	return props, nil
+}
+
+// Set sets the named property to the value and commits it, unless
+// WithCommit says otherwise, waiting for the provider to answer until the
+// context is done.  When the provider fails the request, the error matches its
+// ErrorCode, such as ErrInvalidParameterValue.
+func (h *Handle) Set(ctx context.Context, name string, value Value, opts ...SetOption) error {
+	_, err := h.SetProperties(ctx, []Property{{Name: name, Value: value}}, opts...)
 	return err
 }
+
+// Close closes the handle.  New operations fail with ErrHandleClosed right
+// away, while those in flight are given until the context is done to
+// complete; the rest then fail with ErrHandleClosed, as do the outstanding
+// async calls.  Then the direct connections are closed and the subscriptions
+// are ended, the providers being asked to stop publishing for no longer than
+// a few seconds even when the context is done by then, the elements are no
+// longer served, the component is removed from the bus, and the handle
+// disconnects from it.  Once Close returns, no callback of the handle is
+// running or will run.
+//
+// Close can be called more than once, and concurrently with the other
+// methods; only the first call does anything.  It must not be called from a
+// callback of the handle.
+func (h *Handle) Close(ctx context.Context) error {
+	h.m.Lock()
+	con := h.conn
+	if h.closed || con == nil {
+		h.m.Unlock()
+		return nil
+	}
+	h.closed = true
+	if h.stopRetry != nil {
+		h.stopRetry()
+		h.stopRetry = nil
+	}
+	h.m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	h.cancelCalls()
+	<-drained
+
+	// The context may well be done by now, while the providers still ought
+	// to hear that the subscriptions end.  They're given until its deadline
+	// to acknowledge, within bounds.
+	timeout := unsubscribeTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(max(time.Until(deadline), unsubscribeGrace), unsubscribeTimeout)
+	}
+	unsubCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	h.closeDirects(unsubCtx)
+	h.closeSubscriptions(unsubCtx)
+	cancel()
+
+	h.reg.Lock()
+	if h.stopServing != nil {
+		h.stopServing()
+		h.stopServing = nil
+	}
+	h.m.Lock()
+	for name := range h.detectors {
+		h.stopDetectionLocked(name)
+	}
+	h.elements = nil
+	h.staged = nil
+	h.sessionWatch = nil
+	h.tables = nil
+	h.methods = nil
+	h.subscribers = nil
+	h.detectors = nil
+	h.m.Unlock()
+	h.reg.Unlock()
+
+	h.detach()
+
+	err := h.release(con)
+	h.states.Notify(StateDisconnected, nil)
+
+	return err
+}
+
+// release lets go of the transport.  The connection Open made is closed for
+// good, so the handlers it was running are done once that returns, while a
+// transport given with WithTransport is only disconnected, being its
+// owner's.
+func (h *Handle) release(con Transport) error {
+	if c, ok := con.(*rtmessage.Connection); ok && h.cfg.transport == nil {
+		return c.Close()
+	}
+	return con.Disconnect()
+}
@@ -0,0 +1,468 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// getter answers the gets of the elements it's registered for with their
+// values.
+func getter(values map[string]rbus.Value) func(context.Context, string) (rbus.Value, error) {
+	return func(_ context.Context, name string) (rbus.Value, error) {
+		v, found := values[name]
+		if !found {
+			return rbus.Value{}, rbus.ErrElementDoesNotExist
+		}
+		return v, nil
+	}
+}
+
+// registerValues registers an element with a GetHandler for each value.
+func registerValues(t *testing.T, h *rbus.Handle, values map[string]rbus.Value) {
+	t.Helper()
+
+	for name := range values {
+		if err := h.RegisterElement(name, rbus.ElementCallbacks{GetHandler: getter(values)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetMultiplePartial(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	registerValues(t, provider, map[string]rbus.Value{
+		"Device.Test.X": rbus.NewValue(int32(5)),
+		"Device.Test.Y": rbus.NewValue("y"),
+	})
+
+	tests := []struct {
+		name  string
+		names []string
+	}{
+		{name: "missing last", names: []string{"Device.Test.X", "Device.Nope", "Device.Test.Y"}},
+		{name: "missing first", names: []string{"Device.Nope", "Device.Test.X", "Device.Test.Y"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := consumer.GetMultiple(context.Background(), tc.names...)
+
+			var pe *rbus.PropertyError
+			if !errors.As(err, &pe) || pe.Name != "Device.Nope" || !errors.Is(err, rbus.ErrDestinationNotFound) {
+				t.Fatalf("got %v, want %v for Device.Nope", err, rbus.ErrDestinationNotFound)
+			}
+			if len(values) != 2 || values["Device.Test.X"].String() != "5" || values["Device.Test.Y"].String() != "y" {
+				t.Fatalf("got %v, want the other two", values)
+			}
+		})
+	}
+
+	// A failure other than of a property fails the call.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	values, err := consumer.GetMultiple(ctx, "Device.Test.X", "Device.Nope")
+	if !errors.Is(err, context.Canceled) || len(values) != 0 {
+		t.Fatalf("got %v and %v, want %v", values, err, context.Canceled)
+	}
+}
+
+func TestGetOrMissing(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	registerValues(t, provider, map[string]rbus.Value{"Device.Test.X": rbus.NewValue(int32(5))})
+	def := rbus.NewValue("default")
+
+	// Neither a name the provider doesn't know nor one nobody serves
+	// is an error.
+	for _, name := range []string{"Device.Test.Y", "Device.Nobody.Name"} {
+		v, err := consumer.GetOr(context.Background(), name, def)
+		if err != nil || v.String() != "default" {
+			t.Fatalf("%s: got %v and %v, want the default", name, v, err)
+		}
+
+		n, err := rbus.GetAsOr(context.Background(), consumer, name, int32(7))
+		if err != nil || n != 7 {
+			t.Fatalf("%s: got %d and %v, want 7", name, n, err)
+		}
+	}
+
+	v, err := consumer.GetOr(context.Background(), "Device.Test.X", def)
+	if err != nil || v.String() != "5" {
+		t.Fatalf("got %v and %v, want 5", v, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := consumer.GetOr(ctx, "Device.Nobody.Name", def); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestGetWildcardProviders(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.B":  rbus.NewValue(int32(2)),
+		"Device.Test.A":  rbus.NewValue(int32(1)),
+		"Device.Other.Z": rbus.NewValue(int32(0)),
+	})
+	other := openHandle(t, b.URL(), "a_provider")
+	registerValues(t, other, map[string]rbus.Value{
+		"Device.Test.D": rbus.NewValue("d"),
+		"Device.Test.C": rbus.NewValue("c"),
+	})
+	consumer := openHandle(t, b.URL(), "consumer")
+
+	names := func(props []rbus.Property) string {
+		s := make([]string, 0, len(props))
+		for _, p := range props {
+			s = append(s, p.Name+"="+p.Value.String())
+		}
+		return fmt.Sprint(s)
+	}
+
+	// Each provider answers with its own sorted properties, the providers
+	// in the order the router reports them.
+	props, err := consumer.GetWildcard(context.Background(), "Device.Test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(props), "[Device.Test.C=c Device.Test.D=d Device.Test.A=1 Device.Test.B=2]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// When the second provider fails, those of the first are returned.
+	b.SetError("Device.Test.A", rbus.ErrAccessNotAllowed)
+	props, err = consumer.GetWildcard(context.Background(), "Device.Test.")
+	if !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	if got, want := names(props), "[Device.Test.C=c Device.Test.D=d]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestGetCached(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	var gets atomic.Int32
+	release := make(chan struct{})
+	err := provider.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) {
+			gets.Add(1)
+			<-release
+			return rbus.NewValue(int32(5)), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every caller within the TTL shares the one request to the bus.
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			props, err := consumer.GetCached(context.Background(), "Device.Test.", time.Hour)
+			if err == nil && (len(props) != 1 || props[0].Value.String() != "5") {
+				err = fmt.Errorf("got %v, want Device.Test.X=5", props)
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := consumer.GetCached(context.Background(), "Device.Test.", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := gets.Load(); got != 1 {
+		t.Fatalf("got %d gets, want 1", got)
+	}
+}
+
+func TestCloseDuringGets(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	registerValues(t, provider, map[string]rbus.Value{"Device.Test.X": rbus.NewValue(int32(5))})
+
+	const getters = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, getters)
+	for range getters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, err := consumer.Get(context.Background(), "Device.Test.X")
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := consumer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, rbus.ErrHandleClosed) {
+			t.Fatalf("got %v, want %v", err, rbus.ErrHandleClosed)
+		}
+	}
+}
+
+func TestCloseWaitsForCallbacks(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	entered := make(chan struct{})
+	var done atomic.Bool
+	err := provider.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) {
+			close(entered)
+			time.Sleep(50 * time.Millisecond)
+			done.Store(true)
+			return rbus.NewValue(int32(5)), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider closing leaves the get without an answer.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go func() { _, _ = consumer.Get(ctx, "Device.Test.X") }()
+	<-entered
+
+	// The provider's callback is done by the time it's closed.
+	if err := provider.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !done.Load() {
+		t.Fatal("the callback is still running")
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	registerValues(t, provider, map[string]rbus.Value{
+		"Device.Test.String":  rbus.NewValue("s"),
+		"Device.Test.Bool":    rbus.NewValue(true),
+		"Device.Test.Int16":   rbus.NewValue(int16(-16)),
+		"Device.Test.UInt32":  rbus.NewValue(uint32(math.MaxUint32)),
+		"Device.Test.Int64":   rbus.NewValue(int64(math.MinInt64)),
+		"Device.Test.UInt64":  rbus.NewValue(uint64(math.MaxInt64)),
+		"Device.Test.Huge":    rbus.NewValue(uint64(math.MaxInt64) + 1),
+		"Device.Test.MaxU64":  rbus.NewValue(uint64(math.MaxUint64)),
+		"Device.Test.Exact":   rbus.NewValue(uint64(1 << 53)),
+		"Device.Test.Inexact": rbus.NewValue(int64(1<<53 + 1)),
+		"Device.Test.Single":  rbus.NewValue(float32(0.5)),
+		"Device.Test.Double":  rbus.NewValue(-2.25),
+		"Device.Test.Numeric": rbus.NewValue("42"),
+	})
+
+	ctx := context.Background()
+	getInt := func(name string) (any, error) { return consumer.GetInt(ctx, name) }
+	getFloat := func(name string) (any, error) { return consumer.GetFloat(ctx, name) }
+	getString := func(name string) (any, error) { return consumer.GetString(ctx, name) }
+	getBool := func(name string) (any, error) { return consumer.GetBool(ctx, name) }
+
+	tests := []struct {
+		get  func(string) (any, error)
+		name string
+		want any // nil for a mismatch
+	}{
+		{get: getString, name: "Device.Test.String", want: "s"},
+		{get: getString, name: "Device.Test.Numeric", want: "42"},
+		{get: getString, name: "Device.Test.Bool"},
+		{get: getBool, name: "Device.Test.Bool", want: true},
+		{get: getBool, name: "Device.Test.Int16"},
+		{get: getInt, name: "Device.Test.Int16", want: int64(-16)},
+		{get: getInt, name: "Device.Test.UInt32", want: int64(math.MaxUint32)},
+		{get: getInt, name: "Device.Test.Int64", want: int64(math.MinInt64)},
+		{get: getInt, name: "Device.Test.UInt64", want: int64(math.MaxInt64)},
+		{get: getInt, name: "Device.Test.Huge"},
+		{get: getInt, name: "Device.Test.MaxU64"},
+		{get: getInt, name: "Device.Test.Double"},
+		{get: getInt, name: "Device.Test.Numeric"},
+		{get: getFloat, name: "Device.Test.Single", want: 0.5},
+		{get: getFloat, name: "Device.Test.Double", want: -2.25},
+		{get: getFloat, name: "Device.Test.Int16", want: -16.0},
+		{get: getFloat, name: "Device.Test.UInt32", want: float64(math.MaxUint32)},
+		{get: getFloat, name: "Device.Test.Exact", want: float64(1 << 53)},
+		{get: getFloat, name: "Device.Test.Huge", want: float64(1 << 63)},
+		{get: getFloat, name: "Device.Test.Int64", want: float64(math.MinInt64)},
+		{get: getFloat, name: "Device.Test.Inexact"},
+		{get: getFloat, name: "Device.Test.MaxU64"},
+		{get: getFloat, name: "Device.Test.Numeric"},
+	}
+
+	for _, tc := range tests {
+		got, err := tc.get(tc.name)
+		if tc.want == nil {
+			if !errors.Is(err, rbus.ErrTypeMismatch) {
+				t.Errorf("%s: got %v and %v, want %v", tc.name, got, err, rbus.ErrTypeMismatch)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %v and %v, want %v", tc.name, got, err, tc.want)
+		}
+	}
+
+	// A uint64 above the largest int64 is still had as such.
+	v, err := consumer.Get(ctx, "Device.Test.MaxU64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := v.AsUint64(); err != nil || u != math.MaxUint64 {
+		t.Fatalf("got %d and %v, want %d", u, err, uint64(math.MaxUint64))
+	}
+}
+
+func TestBytesCopied(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	// The value keeps a copy of the data it's made of.
+	data := []byte{1, 2, 3}
+	v := rbus.NewValue(data)
+	data[0] = 0
+	registerValues(t, provider, map[string]rbus.Value{"Device.Test.Bytes": v})
+
+	// And hands out copies of its own.
+	b, err := v.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[1] = 0
+	if again, _ := v.AsBytes(); !bytes.Equal(again, []byte{1, 2, 3}) {
+		t.Fatalf("got %v, want [1 2 3]", again)
+	}
+
+	ctx := context.Background()
+	for range 2 {
+		b, err := consumer.GetBytes(ctx, "Device.Test.Bytes")
+		if err != nil || !bytes.Equal(b, []byte{1, 2, 3}) {
+			t.Fatalf("got %v and %v, want [1 2 3]", b, err)
+		}
+		b[2] = 0
+	}
+	if b, _ := v.AsBytes(); !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Fatalf("got %v from the provider, want [1 2 3]", b)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.Slow":    rbus.NewValue("slow"),
+		"Device.Test.Timeout": rbus.NewValue("timeout"),
+	})
+	b.SetLatency("Device.Test.Slow", 200*time.Millisecond)
+	b.SetError("Device.Test.Timeout", rbus.ErrTimeout)
+
+	bounded := openHandle(t, b.URL(), "bounded", rbus.WithDefaultTimeout(20*time.Millisecond))
+	patient := openHandle(t, b.URL(), "patient", rbus.WithDefaultTimeout(time.Minute))
+	unbounded := openHandle(t, b.URL(), "unbounded")
+
+	tests := []struct {
+		desc     string
+		h        *rbus.Handle
+		name     string
+		deadline time.Duration
+		want     error
+		not      error
+	}{
+		{
+			desc:     "caller deadline sooner",
+			h:        patient,
+			name:     "Device.Test.Slow",
+			deadline: 20 * time.Millisecond,
+			want:     context.DeadlineExceeded,
+			not:      rbus.ErrDefaultTimeout,
+		}, {
+			desc: "option sooner",
+			h:    bounded,
+			name: "Device.Test.Slow",
+			want: rbus.ErrDefaultTimeout,
+		}, {
+			desc: "neither set",
+			h:    unbounded,
+			name: "Device.Test.Slow",
+		}, {
+			desc: "provider timeout",
+			h:    bounded,
+			name: "Device.Test.Timeout",
+			want: rbus.ErrTimeout,
+			not:  rbus.ErrDefaultTimeout,
+		},
+	}
+
+	for _, tc := range tests {
+		ctx := context.Background()
+		if tc.deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.deadline)
+			defer cancel()
+		}
+
+		_, err := tc.h.Get(ctx, tc.name)
+		switch {
+		case tc.want == nil && err != nil:
+			t.Errorf("%s: got %v, want no error", tc.desc, err)
+		case tc.want != nil && !errors.Is(err, tc.want):
+			t.Errorf("%s: got %v, want %v", tc.desc, err, tc.want)
+		case tc.not != nil && errors.Is(err, tc.not):
+			t.Errorf("%s: got %v, which isn't %v", tc.desc, err, tc.not)
+		}
+	}
+
+	// The default timeout is a timeout and a deadline too.
+	_, err := bounded.Get(context.Background(), "Device.Test.Slow")
+	for _, want := range []error{rbus.ErrTimeout, context.DeadlineExceeded} {
+		if !errors.Is(err, want) {
+			t.Fatalf("got %v, want %v", err, want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbustest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// brokerComponent is the component the parameters of a Broker belong to.
+const brokerComponent = "rbustest_broker"
+
+// brokers numbers the routers of the brokers, whose names must differ.
+var brokers atomic.Int64
+
+// Broker is an in-process bus with a provider of canned parameters, for the
+// tests of code that uses rbus.Handle the way it does on a device.  Unlike
+// FakeTransport it goes through a router, an rtmessage.MemRouter, and a real
+// provider, so gets, sets, subscribes, events and method calls are encoded
+// and answered as they are on the bus.  Connect the handles under test with
+// the URL of the broker:
+//
+//	b, err := rbustest.NewBroker(map[string]rbus.Value{
+//		"Device.DeviceInfo.SerialNumber": rbus.NewValue("1234"),
+//	})
+//	defer b.Close()
+//	h, err := rbus.New(rbus.WithURL(b.URL()), rbus.WithApplicationName("test"))
+//
+// A get of a parameter returns its value, and a set stores the value, so
+// it's returned by later gets and by Value, and records it; see Sets.  A set
+// keeps the type of the parameter.  Subscribes to the parameters succeed
+// unless made to fail with SetSubscribeError, and the events sent to them
+// with Publish.  Methods are added with AddMethod.
+type Broker struct {
+	url    string
+	router *rtmessage.MemRouter
+	h      *rbus.Handle
+
+	m         sync.Mutex
+	values    map[string]rbus.Value
+	errs      map[string]rbus.ErrorCode
+	subErrs   map[string]rbus.ErrorCode
+	latencies map[string]time.Duration
+	subs      map[string]int
+	sets      []rbus.Property
+}
+
+// NewBroker starts a Broker providing the parameters with their values.
+func NewBroker(values map[string]rbus.Value) (*Broker, error) {
+	name := fmt.Sprintf("rbustest-broker-%d", brokers.Add(1))
+	router, err := rtmessage.NewMemRouter(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := Broker{
+		url:       "mem://" + name,
+		router:    router,
+		values:    make(map[string]rbus.Value),
+		errs:      make(map[string]rbus.ErrorCode),
+		subErrs:   make(map[string]rbus.ErrorCode),
+		latencies: make(map[string]time.Duration),
+		subs:      make(map[string]int),
+	}
+
+	b.h, err = rbus.New(rbus.WithURL(b.URL()), rbus.WithApplicationName(brokerComponent))
+	if err == nil {
+		err = b.h.Open(context.Background())
+	}
+	if err != nil {
+		_ = router.Close()
+		return nil, err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if err := b.SetValue(name, values[name]); err != nil {
+			_ = b.Close()
+			return nil, err
+		}
+	}
+
+	return &b, nil
+}
+
+// URL returns the URL to connect the handles to the broker with.
+func (b *Broker) URL() string {
+	return b.url
+}
+
+// Router returns the router of the broker, to look at the messages that went
+// through it or to drop the connections.
+func (b *Broker) Router() *rtmessage.MemRouter {
+	return b.router
+}
+
+// Close stops the broker and drops the connections of the handles.
+func (b *Broker) Close() error {
+	err := b.h.Close(context.Background())
+	return errors.Join(err, b.router.Close())
+}
+
+// SetValue sets the value of the named parameter, adding the parameter when
+// the broker doesn't provide it yet.  It doesn't publish a value change; see
+// Publish.
+func (b *Broker) SetValue(name string, value rbus.Value) error {
+	b.m.Lock()
+	_, found := b.values[name]
+	b.values[name] = value
+	b.m.Unlock()
+
+	if found {
+		return nil
+	}
+
+	err := b.h.RegisterElement(name, rbus.ElementCallbacks{
+		GetHandler:       b.get,
+		SetHandler:       b.set,
+		SubscribeHandler: b.subscribe,
+	})
+	if err != nil && !errors.Is(err, rbus.ErrElementNameDuplicate) {
+		b.m.Lock()
+		delete(b.values, name)
+		b.m.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Value returns the value of the named parameter, as last set with SetValue
+// or by a set request, and whether it has one.
+func (b *Broker) Value(name string) (rbus.Value, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	v, found := b.values[name]
+	return v, found
+}
+
+// SetError makes the gets and sets of the named parameter, or the calls of
+// the named method, fail with the code.  A code of 0 makes them succeed
+// again.
+func (b *Broker) SetError(name string, code rbus.ErrorCode) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if code == 0 {
+		delete(b.errs, name)
+		return
+	}
+	b.errs[name] = code
+}
+
+// SetSubscribeError makes the subscribes to the named parameter fail with the
+// code.  A code of 0 makes them succeed again.
+func (b *Broker) SetSubscribeError(name string, code rbus.ErrorCode) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if code == 0 {
+		delete(b.subErrs, name)
+		return
+	}
+	b.subErrs[name] = code
+}
+
+// SetLatency delays the answers to the gets and sets of the named parameter,
+// or to the calls of the named method, by d.  A d of 0 removes the delay.
+func (b *Broker) SetLatency(name string, d time.Duration) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if d == 0 {
+		delete(b.latencies, name)
+		return
+	}
+	b.latencies[name] = d
+}
+
+// Sets returns the parameters set by the sets the broker accepted, with
+// their values, in the order they were made.
+func (b *Broker) Sets() []rbus.Property {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return slices.Clone(b.sets)
+}
+
+// Subscribed returns the number of subscriptions to the named parameter
+// currently in place.
+func (b *Broker) Subscribed(name string) int {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.subs[name]
+}
+
+// Publish sends the event to the subscribers of the parameter it's named
+// after; see rbus.Handle.Publish.  A value change carries the value as
+// "value", and the one before as "oldValue":
+//
+//	b.Publish(ctx, rbus.Event{
+//		Name: "Device.WiFi.Radio.1.Channel",
+//		Type: rbus.EventValueChanged,
+//		Data: []rbus.Property{{Name: "value", Value: rbus.NewValue(int32(6))}},
+//	})
+func (b *Broker) Publish(ctx context.Context, e rbus.Event) error {
+	return b.h.Publish(ctx, e)
+}
+
+// AddMethod makes the calls of the named method, such as "Device.Reboot()",
+// answered by the handler, delayed and failed as set with SetLatency and
+// SetError.
+func (b *Broker) AddMethod(name string, handler rbus.MethodHandler) error {
+	return b.h.RegisterMethod(name, func(ctx context.Context, in []rbus.Property) ([]rbus.Property, error) {
+		if err := b.wait(ctx, name); err != nil {
+			return nil, err
+		}
+		return handler(ctx, in)
+	})
+}
+
+// wait waits for the latency of the name, returning the error it's to fail
+// with.
+func (b *Broker) wait(ctx context.Context, name string) error {
+	b.m.Lock()
+	d := b.latencies[name]
+	code := b.errs[name]
+	b.m.Unlock()
+
+	if d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if code != 0 {
+		return code
+	}
+	return nil
+}
+
+// get answers the get of a parameter.
+func (b *Broker) get(ctx context.Context, name string) (rbus.Value, error) {
+	if err := b.wait(ctx, name); err != nil {
+		return rbus.Value{}, err
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	v, found := b.values[name]
+	if !found {
+		return rbus.Value{}, rbus.ErrElementDoesNotExist
+	}
+	return v, nil
+}
+
+// set answers the set of a parameter, storing and recording the value.
+func (b *Broker) set(ctx context.Context, name string, value rbus.Value, _ rbus.SetHandlerOptions) error {
+	if err := b.wait(ctx, name); err != nil {
+		return err
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	old, found := b.values[name]
+	if !found {
+		return rbus.ErrElementDoesNotExist
+	}
+	if value.Type() != old.Type() {
+		return rbus.ErrInvalidParameterType
+	}
+
+	b.values[name] = value
+	b.sets = append(b.sets, rbus.Property{Name: name, Value: value})
+
+	return nil
+}
+
+// subscribe keeps count of the subscriptions to a parameter.
+func (b *Broker) subscribe(name string, added bool, count int, _ *rbus.Filter, _ time.Duration) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if code, found := b.subErrs[name]; found && added {
+		return code
+	}
+	b.subs[name] = count
+
+	return nil
+}
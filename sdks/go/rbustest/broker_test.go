@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbustest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rbustest"
+)
+
+// open opens a handle of the component to the URL, closed at the end of the
+// test.
+func open(t *testing.T, component string, opts ...rbus.Option) *rbus.Handle {
+	t.Helper()
+
+	h, err := rbus.New(append([]rbus.Option{rbus.WithApplicationName(component)}, opts...)...)
+	if err == nil {
+		err = h.Open(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close(context.Background()) })
+
+	return h
+}
+
+// newBroker starts a broker providing Device.Test.X, closed at the end of the
+// test, and opens a handle to it.
+func newBroker(t *testing.T) (*rbustest.Broker, *rbus.Handle) {
+	t.Helper()
+
+	b, err := rbustest.NewBroker(map[string]rbus.Value{"Device.Test.X": rbus.NewValue("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	return b, open(t, "consumer", rbus.WithURL(b.URL()))
+}
+
+func TestBrokerGetSet(t *testing.T) {
+	b, h := newBroker(t)
+	ctx := context.Background()
+
+	if v, err := h.GetString(ctx, "Device.Test.X"); err != nil || v != "x" {
+		t.Fatalf("got %q and %v, want x", v, err)
+	}
+
+	// A set is kept, and recorded, unless its type differs.
+	if err := h.Set(ctx, "Device.Test.X", rbus.NewValue("y")); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Set(ctx, "Device.Test.X", rbus.NewValue(int32(1))); !errors.Is(err, rbus.ErrInvalidParameterType) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrInvalidParameterType)
+	}
+	if v, err := h.GetString(ctx, "Device.Test.X"); err != nil || v != "y" {
+		t.Fatalf("got %q and %v, want y", v, err)
+	}
+	if v, found := b.Value("Device.Test.X"); !found || v.String() != "y" {
+		t.Fatalf("got %v and %t, want y", v, found)
+	}
+	if got, want := fmt.Sprint(b.Sets()), "[{Device.Test.X y}]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// SetValue adds the parameters it doesn't provide yet.
+	if err := b.SetValue("Device.Test.Y", rbus.NewValue(int32(2))); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := h.GetInt(ctx, "Device.Test.Y"); err != nil || v != 2 {
+		t.Fatalf("got %d and %v, want 2", v, err)
+	}
+	if _, err := h.Get(ctx, "Device.Test.Nope"); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+}
+
+func TestBrokerErrorsAndLatency(t *testing.T) {
+	b, h := newBroker(t)
+	ctx := context.Background()
+
+	b.SetError("Device.Test.X", rbus.ErrAccessNotAllowed)
+	if _, err := h.Get(ctx, "Device.Test.X"); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	if err := h.Set(ctx, "Device.Test.X", rbus.NewValue("y")); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	b.SetError("Device.Test.X", 0)
+
+	b.SetLatency("Device.Test.X", 50*time.Millisecond)
+	start := time.Now()
+	if _, err := h.Get(ctx, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Fatalf("took %s, want at least 50ms", took)
+	}
+	b.SetLatency("Device.Test.X", 0)
+
+	start = time.Now()
+	if _, err := h.Get(ctx, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took >= 50*time.Millisecond {
+		t.Fatalf("took %s without the latency", took)
+	}
+}
+
+func TestBrokerSubscribe(t *testing.T) {
+	b, h := newBroker(t)
+	ctx := context.Background()
+
+	b.SetSubscribeError("Device.Test.X", rbus.ErrAccessNotAllowed)
+	if _, err := h.Subscribe(ctx, "Device.Test.X", func(rbus.Event) {}); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	b.SetSubscribeError("Device.Test.X", 0)
+
+	events := make(chan rbus.Event, 10)
+	sub, err := h.Subscribe(ctx, "Device.Test.X", func(e rbus.Event) { events <- e })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := b.Subscribed("Device.Test.X"); n != 1 {
+		t.Fatalf("got %d subscriptions, want 1", n)
+	}
+
+	err = b.Publish(ctx, rbus.Event{
+		Name: "Device.Test.X",
+		Type: rbus.EventValueChanged,
+		Data: []rbus.Property{{Name: "value", Value: rbus.NewValue("y")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.NewValue.String() != "y" {
+			t.Fatalf("got %+v, want the value changed to y", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.Subscribed("Device.Test.X"); n != 0 {
+		t.Fatalf("got %d subscriptions, want 0", n)
+	}
+}
+
+func TestBrokerMethod(t *testing.T) {
+	b, h := newBroker(t)
+	ctx := context.Background()
+
+	err := b.AddMethod("Device.Test.Double()", func(_ context.Context, in []rbus.Property) ([]rbus.Property, error) {
+		n, err := in[0].Value.AsInt64()
+		return []rbus.Property{{Name: "out", Value: rbus.NewValue(int32(2 * n))}}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := h.Invoke(ctx, "Device.Test.Double()", []rbus.Property{{Name: "in", Value: rbus.NewValue(int32(2))}})
+	if err != nil || len(out) != 1 || out[0].Value.String() != "4" {
+		t.Fatalf("got %v and %v, want 4", out, err)
+	}
+
+	b.SetError("Device.Test.Double()", rbus.ErrInvalidMethod)
+	if _, err := h.Invoke(ctx, "Device.Test.Double()", nil); !errors.Is(err, rbus.ErrInvalidMethod) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrInvalidMethod)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b, err := rbustest.NewBroker(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := open(t, "consumer", rbus.WithURL(b.URL()))
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.Router().Connections(); n != 0 {
+		t.Fatalf("got %d connections after closing", n)
+	}
+	if _, err := h.Get(context.Background(), "Device.Test.X"); err == nil {
+		t.Fatal("got a value after closing")
+	}
+}
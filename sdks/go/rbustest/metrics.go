@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbustest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// Operation is an operation reported to Metrics.
+type Operation struct {
+	Method  string
+	Param   string
+	Code    int
+	Latency time.Duration
+}
+
+// Metrics is an rbus.HandleMetrics recording what it's told, so a test can
+// check it.  The zero value is ready to use:
+//
+//	var metrics rbustest.Metrics
+//	h, err := rbus.New(rbus.WithApplicationName("test"), rbus.WithMetrics(&metrics))
+type Metrics struct {
+	m          sync.Mutex
+	operations []Operation
+	events     map[string]int
+	reconnects int
+}
+
+var _ rbus.HandleMetrics = (*Metrics)(nil)
+
+func (m *Metrics) OperationCompleted(method string, param string, code int, latency time.Duration) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.operations = append(m.operations, Operation{
+		Method:  method,
+		Param:   param,
+		Code:    code,
+		Latency: latency,
+	})
+}
+
+func (m *Metrics) SubscriptionEventReceived(event string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[string]int)
+	}
+	m.events[event]++
+}
+
+func (m *Metrics) ReconnectOccurred() {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.reconnects++
+}
+
+// Operations returns the operations reported, in order.
+func (m *Metrics) Operations() []Operation {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	return append([]Operation(nil), m.operations...)
+}
+
+// Events returns the number of events of the name reported.
+func (m *Metrics) Events(event string) int {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	return m.events[event]
+}
+
+// Reconnects returns the number of reconnects reported.
+func (m *Metrics) Reconnects() int {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	return m.reconnects
+}
@@ -0,0 +1,363 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package rbustest provides fakes for testing code built on rbus.Handle
+// without a router or providers.
+package rbustest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// The methods of the requests FakeTransport answers, and of its responses.
+const (
+	methodGet         = "METHOD_GETPARAMETERVALUES"
+	methodSet         = "METHOD_SETPARAMETERVALUES"
+	methodSubscribe   = "METHOD_SUBSCRIBE"
+	methodUnsubscribe = "METHOD_UNSUBSCRIBE"
+	methodResponse    = "METHOD_RESPONSE"
+)
+
+// ErrNotConnected is returned for requests made before Connect or after
+// Disconnect.
+var ErrNotConnected = errors.New("fake transport not connected")
+
+// FakeTransport is an rbus.Transport answering gets, sets and subscribes
+// itself from canned values and return codes, keyed by parameter name.  Pass
+// it to rbus.New with rbus.WithTransport:
+//
+//	fake := rbustest.NewFakeTransport()
+//	fake.SetValue("Device.DeviceInfo.SerialNumber", rbus.NewValue("1234"))
+//	h, err := rbus.New(rbus.WithApplicationName("test"), rbus.WithTransport(fake))
+//
+// A get of a parameter that has no value fails with
+// rbus.ErrElementDoesNotExist, and a set stores the value, so it's returned
+// by later gets and by Value.  Subscribes succeed unless made to fail with
+// SetSubscribeError.  Other requests fail as if no provider was there.
+type FakeTransport struct {
+	m         sync.Mutex
+	connected bool
+	values    map[string]rbus.Value
+	errs      map[string]rbus.ErrorCode
+	subErrs   map[string]rbus.ErrorCode
+	subs      map[string]int
+	lastSub   int32
+}
+
+var _ rbus.Transport = (*FakeTransport)(nil)
+
+// NewFakeTransport creates a FakeTransport without any values.
+func NewFakeTransport() *FakeTransport {
+	return &FakeTransport{
+		values:  make(map[string]rbus.Value),
+		errs:    make(map[string]rbus.ErrorCode),
+		subErrs: make(map[string]rbus.ErrorCode),
+		subs:    make(map[string]int),
+	}
+}
+
+// SetValue sets the value gets of the named parameter return.
+func (f *FakeTransport) SetValue(name string, value rbus.Value) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.values[name] = value
+}
+
+// Value returns the value of the named parameter, as last set with SetValue
+// or by a set request, and whether it has one.
+func (f *FakeTransport) Value(name string) (rbus.Value, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	v, found := f.values[name]
+	return v, found
+}
+
+// SetError makes the gets and sets of the named parameter fail with the code.
+// A code of 0 makes them succeed again.
+func (f *FakeTransport) SetError(name string, code rbus.ErrorCode) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if code == 0 {
+		delete(f.errs, name)
+		return
+	}
+	f.errs[name] = code
+}
+
+// SetSubscribeError makes the subscribes to the named event or parameter fail
+// with the code.  A code of 0 makes them succeed again.
+func (f *FakeTransport) SetSubscribeError(name string, code rbus.ErrorCode) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if code == 0 {
+		delete(f.subErrs, name)
+		return
+	}
+	f.subErrs[name] = code
+}
+
+// Subscribed returns the number of subscriptions to the named event or
+// parameter currently in place.
+func (f *FakeTransport) Subscribed(name string) int {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.subs[name]
+}
+
+// Connect connects the fake.
+func (f *FakeTransport) Connect(context.Context) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.connected = true
+	return nil
+}
+
+// Disconnect disconnects the fake.
+func (f *FakeTransport) Disconnect() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.connected = false
+	return nil
+}
+
+// Inbox returns the inbox of the fake.
+func (f *FakeTransport) Inbox() string {
+	return "rbustest.INBOX"
+}
+
+// AddInboxListener does nothing: the fake sends nothing to the inbox other
+// than responses.
+func (f *FakeTransport) AddInboxListener(rtmessage.MessageListener) rtmessage.CancelListenerFunc {
+	return func() {}
+}
+
+// SendBinary drops the message.
+func (f *FakeTransport) SendBinary(context.Context, []byte, string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if !f.connected {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// RequestBinary answers the request.
+func (f *FakeTransport) RequestBinary(ctx context.Context, payload []byte, topic string) (rtmessage.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return rtmessage.Message{}, err
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if !f.connected {
+		return rtmessage.Message{}, ErrNotConnected
+	}
+
+	req := rbus.NewMessageFromBytes(payload)
+	method, _, _, err := req.GetMetaInfo()
+	if err != nil {
+		return rtmessage.Message{}, err
+	}
+
+	var resp *rbus.Message
+	switch method {
+	case methodGet:
+		resp = f.get(req)
+	case methodSet:
+		resp = f.set(req)
+	case methodSubscribe:
+		resp = f.subscribe(req, true)
+	case methodUnsubscribe:
+		resp = f.subscribe(req, false)
+	default:
+		return rtmessage.Message{}, fmt.Errorf("%w: '%s'", rtmessage.ErrNoRoute, topic)
+	}
+	resp.SetMetaInfo(methodResponse, "", "")
+
+	return rtmessage.Message{
+		Header:  &rtmessage.Header{Topic: f.Inbox()},
+		Payload: resp.Bytes(),
+	}, nil
+}
+
+// get answers a get request with the values of the names, or of every
+// parameter under a partial path ending in ".".
+func (f *FakeTransport) get(req *rbus.Message) *rbus.Message {
+	resp := rbus.NewMessage()
+
+	if _, err := req.PopString(); err != nil { // requesting component
+		resp.AppendInt32(int32(rbus.ErrInvalidInput))
+		return resp
+	}
+	count, err := req.PopInt32()
+	if err != nil {
+		resp.AppendInt32(int32(rbus.ErrInvalidInput))
+		return resp
+	}
+
+	var props []rbus.Property
+	for range count {
+		name, err := req.PopString()
+		if err != nil {
+			resp.AppendInt32(int32(rbus.ErrInvalidInput))
+			return resp
+		}
+
+		names := []string{name}
+		if strings.HasSuffix(name, ".") {
+			names = names[:0]
+			for n := range f.values {
+				if strings.HasPrefix(n, name) {
+					names = append(names, n)
+				}
+			}
+			slices.Sort(names)
+		}
+
+		for _, n := range names {
+			if code, found := f.errs[n]; found {
+				resp.AppendInt32(int32(code))
+				return resp
+			}
+			v, found := f.values[n]
+			if !found {
+				resp.AppendInt32(int32(rbus.ErrElementDoesNotExist))
+				return resp
+			}
+			props = append(props, rbus.Property{Name: n, Value: v})
+		}
+	}
+
+	resp.AppendInt32(0)
+	resp.AppendInt32(int32(len(props)))
+	for _, p := range props {
+		resp.AppendString(p.Name)
+		if err := resp.AppendValue(p.Value); err != nil {
+			resp = rbus.NewMessage()
+			resp.AppendInt32(int32(rbus.ErrInvalidParameterType))
+			return resp
+		}
+	}
+
+	return resp
+}
+
+// set answers a set request, storing the values unless one of them fails.
+func (f *FakeTransport) set(req *rbus.Message) *rbus.Message {
+	resp := rbus.NewMessage()
+
+	if _, err := req.PopInt32(); err != nil { // session id
+		resp.AppendInt32(int32(rbus.ErrInvalidInput))
+		return resp
+	}
+	if _, err := req.PopString(); err != nil { // requesting component
+		resp.AppendInt32(int32(rbus.ErrInvalidInput))
+		return resp
+	}
+	count, err := req.PopInt32()
+	if err != nil {
+		resp.AppendInt32(int32(rbus.ErrInvalidInput))
+		return resp
+	}
+
+	var props []rbus.Property
+	for range count {
+		var p rbus.Property
+		if p.Name, err = req.PopString(); err != nil {
+			resp.AppendInt32(int32(rbus.ErrInvalidInput))
+			return resp
+		}
+		if p.Value, err = req.PopValue(); err != nil {
+			resp.AppendInt32(int32(rbus.ErrInvalidInput))
+			return resp
+		}
+		props = append(props, p)
+	}
+
+	for _, p := range props {
+		if code, found := f.errs[p.Name]; found {
+			resp.AppendInt32(int32(code))
+			resp.AppendString(p.Name)
+			return resp
+		}
+	}
+
+	for _, p := range props {
+		f.values[p.Name] = p.Value
+	}
+	resp.AppendInt32(0)
+
+	return resp
+}
+
+// subscribe answers a subscribe or unsubscribe request.
+func (f *FakeTransport) subscribe(req *rbus.Message, add bool) *rbus.Message {
+	resp := rbus.NewMessage()
+
+	name, err := req.PopString()
+	if err != nil {
+		resp.AppendInt32(int32(rbus.ErrInvalidInput))
+		return resp
+	}
+
+	if !add {
+		if f.subs[name] > 0 {
+			f.subs[name]--
+		}
+		resp.AppendInt32(0)
+		return resp
+	}
+
+	if code, found := f.subErrs[name]; found {
+		resp.AppendInt32(int32(code))
+		return resp
+	}
+
+	f.subs[name]++
+	f.lastSub++
+	resp.AppendInt32(0)
+	if publishOnSubscribe(req) {
+		// No initial value follows, so the handle gets it instead.
+		resp.AppendInt32(0)
+	}
+	resp.AppendInt32(f.lastSub)
+
+	return resp
+}
+
+// publishOnSubscribe reports whether the subscribe request, read up to its
+// name, asks for the initial value.
+func publishOnSubscribe(req *rbus.Message) bool {
+	if _, err := req.PopString(); err != nil { // listener
+		return false
+	}
+	hasPayload, err := req.PopInt32()
+	if err != nil {
+		return false
+	}
+	if hasPayload != 0 {
+		if _, err := req.PopBytes(); err != nil {
+			return false
+		}
+	}
+
+	publish, err := req.PopInt32()
+	return err == nil && publish != 0
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbustest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rbustest"
+)
+
+// newFake creates a FakeTransport with Device.Test.X and Device.Test.Y, and
+// opens a handle with it.
+func newFake(t *testing.T) (*rbustest.FakeTransport, *rbus.Handle) {
+	t.Helper()
+
+	fake := rbustest.NewFakeTransport()
+	fake.SetValue("Device.Test.X", rbus.NewValue("x"))
+	fake.SetValue("Device.Test.Y", rbus.NewValue(int32(1)))
+
+	return fake, open(t, "test", rbus.WithTransport(fake))
+}
+
+func TestFakeTransportGetSet(t *testing.T) {
+	fake, h := newFake(t)
+	ctx := context.Background()
+
+	if v, err := h.GetString(ctx, "Device.Test.X"); err != nil || v != "x" {
+		t.Fatalf("got %q and %v, want x", v, err)
+	}
+	if _, err := h.Get(ctx, "Device.Test.Nope"); !errors.Is(err, rbus.ErrElementDoesNotExist) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrElementDoesNotExist)
+	}
+
+	// A partial path gets everything under it, in order.
+	req := rbus.NewMessage()
+	req.AppendString("test")
+	req.AppendInt32(1)
+	req.AppendString("Device.Test.")
+	req.SetMetaInfo("METHOD_GETPARAMETERVALUES", "", "")
+	msg, err := fake.RequestBinary(ctx, req.Bytes(), "Device.Test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := rbus.NewMessageFromBytes(msg.Payload)
+	if rc, _ := resp.PopInt32(); rc != 0 {
+		t.Fatalf("got %d, want 0", rc)
+	}
+	if n, _ := resp.PopInt32(); n != 2 {
+		t.Fatalf("got %d properties, want 2", n)
+	}
+	for _, want := range []string{"Device.Test.X=x", "Device.Test.Y=1"} {
+		name, _ := resp.PopString()
+		v, err := resp.PopValue()
+		if got := name + "=" + v.String(); err != nil || got != want {
+			t.Fatalf("got %s and %v, want %s", got, err, want)
+		}
+	}
+
+	if err := h.Set(ctx, "Device.Test.X", rbus.NewValue("y")); err != nil {
+		t.Fatal(err)
+	}
+	if v, found := fake.Value("Device.Test.X"); !found || v.String() != "y" {
+		t.Fatalf("got %v and %t, want y", v, found)
+	}
+	if v, err := h.GetString(ctx, "Device.Test.X"); err != nil || v != "y" {
+		t.Fatalf("got %q and %v, want y", v, err)
+	}
+}
+
+func TestFakeTransportErrors(t *testing.T) {
+	fake, h := newFake(t)
+	ctx := context.Background()
+
+	fake.SetError("Device.Test.X", rbus.ErrAccessNotAllowed)
+	if _, err := h.Get(ctx, "Device.Test.X"); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+
+	// A set failing for one property stores none.
+	props := []rbus.Property{
+		{Name: "Device.Test.Y", Value: rbus.NewValue(int32(2))},
+		{Name: "Device.Test.X", Value: rbus.NewValue("y")},
+	}
+	var perr *rbus.PropertyError
+	if err := h.SetMultiple(ctx, props, true); !errors.As(err, &perr) || perr.Name != "Device.Test.X" || !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want Device.Test.X failing with %v", err, rbus.ErrAccessNotAllowed)
+	}
+	if v, _ := fake.Value("Device.Test.Y"); v.String() != "1" {
+		t.Fatalf("got %v, want 1", v)
+	}
+
+	fake.SetError("Device.Test.X", 0)
+	if _, err := h.Get(ctx, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Anything else has no provider.
+	if _, err := h.Invoke(ctx, "Device.Test.Reboot()", nil); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+}
+
+func TestFakeTransportSubscribe(t *testing.T) {
+	fake, h := newFake(t)
+	ctx := context.Background()
+
+	fake.SetSubscribeError("Device.Test.X", rbus.ErrAccessNotAllowed)
+	if _, err := h.Subscribe(ctx, "Device.Test.X", func(rbus.Event) {}); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	fake.SetSubscribeError("Device.Test.X", 0)
+
+	// The initial value is got, the fake sending none with the response.
+	var initial []rbus.Event
+	sub, err := h.Subscribe(ctx, "Device.Test.X", func(e rbus.Event) { initial = append(initial, e) }, rbus.SubWithInitialValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(initial) != 1 || initial[0].NewValue.String() != "x" {
+		t.Fatalf("got %+v, want the initial value x", initial)
+	}
+	if n := fake.Subscribed("Device.Test.X"); n != 1 {
+		t.Fatalf("got %d subscriptions, want 1", n)
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Subscribed("Device.Test.X"); n != 0 {
+		t.Fatalf("got %d subscriptions, want 0", n)
+	}
+}
+
+func TestFakeTransportDisconnected(t *testing.T) {
+	fake := rbustest.NewFakeTransport()
+
+	if _, err := fake.RequestBinary(context.Background(), nil, "Device.Test.X"); !errors.Is(err, rbustest.ErrNotConnected) {
+		t.Fatalf("got %v, want %v", err, rbustest.ErrNotConnected)
+	}
+	if err := fake.SendBinary(context.Background(), nil, "Device.Test.X"); !errors.Is(err, rbustest.ErrNotConnected) {
+		t.Fatalf("got %v, want %v", err, rbustest.ErrNotConnected)
+	}
+
+	if err := fake.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.SendBinary(context.Background(), nil, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.SendBinary(context.Background(), nil, "Device.Test.X"); !errors.Is(err, rbustest.ErrNotConnected) {
+		t.Fatalf("got %v, want %v", err, rbustest.ErrNotConnected)
+	}
+}
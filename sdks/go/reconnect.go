@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// The connection to the router is reestablished when it's lost, with attempts
+// spaced starting at reconnectDelay and doubling up to maxReconnectDelay.
+const (
+	reconnectDelay    = 100 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+)
+
+// restoreTimeout bounds the wait for each provider to acknowledge the
+// subscriptions made again after reconnecting.
+const restoreTimeout = 5 * time.Second
+
+// The subscriptions that can't be made again after reconnecting are retried
+// for defaultResubscribePeriod, unless WithResubscribePeriod says otherwise,
+// with attempts spaced starting at resubscribeDelay and doubling up to
+// maxReconnectDelay.
+const (
+	defaultResubscribePeriod = time.Minute
+	resubscribeDelay         = time.Second
+)
+
+// OnReconnect registers a function called each time the handle has
+// reconnected to the router after losing the connection, for example because
+// rtrouted restarted, and has restored its state, so the application can
+// refresh the values it keeps.  The subscriptions whose provider isn't back
+// yet are still being retried then; see SubOnResubscribed and SubOnLost.  The
+// functions are called in the order they were registered, from a goroutine of
+// the handle.
+//
+// The requests that were waiting for a response when the connection was lost
+// fail with an error matching ErrConnectionLost.
+func (h *Handle) OnReconnect(f func()) {
+	if f == nil {
+		return
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.reconnected = append(h.reconnected, f)
+}
+
+// restore brings back the state of the handle once the connection to the
+// router is reestablished.  The routes of the registered elements are added
+// again by the connection; the subscriptions are made again here, since the
+// providers may have dropped them along with the lost client.  Those whose
+// provider isn't back yet are retried in the background, until the next
+// reconnect starts over or the handle is closed.
+func (h *Handle) restore() {
+	if h.cfg.metrics != nil {
+		h.cfg.metrics.ReconnectOccurred()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h.m.Lock()
+	if h.closed {
+		h.m.Unlock()
+		cancel()
+		return
+	}
+	if h.stopRetry != nil {
+		h.stopRetry()
+	}
+	h.stopRetry = cancel
+	subs := append([]*Subscription(nil), h.subs...)
+	h.m.Unlock()
+
+	var pending []resubscription
+	for _, s := range subs {
+		err := h.resubscribe(ctx, s)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+		case retryable(err):
+			pending = append(pending, resubscription{sub: s, err: err})
+		default:
+			h.lose(s, err)
+		}
+	}
+
+	h.cfg.logger.Debug("state restored", "subscriptions", len(subs), "pending", len(pending))
+	if len(pending) > 0 {
+		go h.retrySubscriptions(ctx, pending)
+	}
+	h.restored()
+
+	h.m.Lock()
+	reconnected := append([]func(){}, h.reconnected...)
+	h.m.Unlock()
+
+	for _, f := range reconnected {
+		f()
+	}
+}
+
+// resubscription is a subscription waiting to be made again, and why the last
+// attempt failed.
+type resubscription struct {
+	sub *Subscription
+	err error
+}
+
+// retrySubscriptions makes the subscriptions again, backing off between the
+// attempts, until the resubscribe period is over; then those left are lost.
+func (h *Handle) retrySubscriptions(ctx context.Context, pending []resubscription) {
+	deadline := time.Now().Add(h.cfg.resubscribe)
+	delay := resubscribeDelay
+
+	for len(pending) > 0 {
+		wait := min(delay, time.Until(deadline))
+		if wait <= 0 {
+			break
+		}
+		delay = min(2*delay, maxReconnectDelay)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		left := pending[:0]
+		for _, p := range pending {
+			err := h.resubscribe(ctx, p.sub)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err == nil:
+			case retryable(err):
+				left = append(left, resubscription{sub: p.sub, err: err})
+			default:
+				h.lose(p.sub, err)
+			}
+		}
+		pending = left
+	}
+
+	for _, p := range pending {
+		h.lose(p.sub, p.err)
+	}
+}
+
+// resubscribe makes the subscription again, unless it was closed meanwhile,
+// and tells the application.
+func (h *Handle) resubscribe(ctx context.Context, s *Subscription) error {
+	if !h.hasSubscription(s) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, restoreTimeout)
+	defer cancel()
+
+	req, err := h.subscriptionRequest(ctx, s, methodSubscribe)
+	if err != nil {
+		return err
+	}
+
+	id, initial, err := h.subscribe(ctx, s, req)
+
+	// A provider that kept the subscription refuses the duplicate, and the
+	// id it assigned stands.
+	kept := errors.Is(err, ErrSubscriptionAlreadyExists)
+	if err != nil && !kept {
+		h.cfg.logger.Debug("resubscribe failed", "name", s.name, "error", err)
+		return err
+	}
+
+	h.m.Lock()
+	live := slices.Contains(h.subs, s)
+	if live && !kept {
+		s.id = id
+	}
+	h.m.Unlock()
+
+	// The subscription was closed while being made again.
+	if !live {
+		_ = h.unsubscribe(ctx, s)
+		return nil
+	}
+
+	h.cfg.logger.Debug("resubscribed", "name", s.name, "id", s.ID())
+	if !kept {
+		if err := h.initialValue(ctx, s, initial); err != nil {
+			h.cfg.logger.Debug("initial value unavailable", "name", s.name, "error", err)
+		}
+	}
+	if s.cfg.onResubscribed != nil {
+		s.cfg.onResubscribed()
+	}
+
+	return nil
+}
+
+// lose ends the subscription that couldn't be made again, and tells the
+// application why.
+func (h *Handle) lose(s *Subscription, err error) {
+	if !h.removeSubscription(s) {
+		return
+	}
+
+	err = fmt.Errorf("resubscribe '%s': %w", s.name, err)
+	h.cfg.logger.Warn("subscription lost", "name", s.name, "error", err)
+
+	if s.cfg.onLost != nil {
+		s.cfg.onLost(err)
+	}
+	if s.cfg.onClose != nil {
+		s.cfg.onClose()
+	}
+}
+
+// retryable reports whether a subscribe that failed may succeed later: the
+// provider isn't on the bus, can't be reached or didn't answer in time.
+func retryable(err error) bool {
+	return errors.Is(err, rtmessage.ErrNoRoute) ||
+		errors.Is(err, ErrConnectionLost) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrDestinationNotFound) ||
+		errors.Is(err, ErrDestinationNotReachable) ||
+		errors.Is(err, ErrTimeout)
+}
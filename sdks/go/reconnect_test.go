@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// waitFor waits up to a few seconds for the channel to be signaled.
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestReconnectRestoresState(t *testing.T) {
+	s, url := newServer(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	// The get of Device.Test.Blocked is held until the end of the test.
+	blocked := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	err := provider.RegisterElement("Device.Test.Blocked", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) {
+			blocked <- struct{}{}
+			<-release
+			return rbus.NewValue(int32(0)), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerValues(t, provider, map[string]rbus.Value{
+		"Device.Test.X":      rbus.NewValue(int32(5)),
+		"Device.Test.Event!": rbus.NewValue(int32(0)),
+	})
+	if err := s.ExpectSubscribe(context.Background(), "Device.Test.Event!"); err != nil {
+		t.Fatal(err)
+	}
+
+	reconnected := make(chan struct{}, 1)
+	consumer.OnReconnect(func() { reconnected <- struct{}{} })
+
+	events := make(chan rbus.Event, 10)
+	resubscribed := make(chan struct{}, 1)
+	_, err = consumer.Subscribe(context.Background(), "Device.Test.Event!", func(e rbus.Event) { events <- e },
+		rbus.SubOnResubscribed(func() { resubscribed <- struct{}{} }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A workload of gets runs through the restart, failing while the
+	// router is down.
+	ctx, stop := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				get, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				_, _ = consumer.Get(get, "Device.Test.X")
+				cancel()
+			}
+		}()
+	}
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := consumer.Get(context.Background(), "Device.Test.Blocked")
+		pending <- err
+	}()
+	waitFor(t, blocked, "the blocked get")
+
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The request waiting for its response fails rather than hanging.
+	if err := <-pending; !errors.Is(err, rbus.ErrConnectionLost) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrConnectionLost)
+	}
+
+	waitFor(t, reconnected, "OnReconnect")
+	waitFor(t, resubscribed, "the subscription to be made again")
+	stop()
+	wg.Wait()
+
+	// The element is served again, and the subscription delivers events.
+	if v, err := consumer.GetInt(context.Background(), "Device.Test.X"); err != nil || v != 5 {
+		t.Fatalf("got %d and %v, want 5", v, err)
+	}
+	if err := provider.Publish(context.Background(), rbus.Event{Name: "Device.Test.Event!", Type: rbus.EventGeneral}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.Name != "Device.Test.Event!" {
+			t.Fatalf("got %+v, want Device.Test.Event!", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after reconnecting")
+	}
+}
+
+func TestResubscribeAfterOutage(t *testing.T) {
+	s, url := newServer(t)
+	provider := openHandle(t, url, "provider")
+	lasting := openHandle(t, url, "lasting", rbus.WithResubscribePeriod(time.Minute))
+	fleeting := openHandle(t, url, "fleeting", rbus.WithResubscribePeriod(100*time.Millisecond))
+
+	values := map[string]rbus.Value{"Device.Test.Event!": rbus.NewValue(int32(0))}
+	registerValues(t, provider, values)
+
+	ctx := context.Background()
+	if err := s.ExpectSubscribe(ctx, "Device.Test.Event!"); err != nil {
+		t.Fatal(err)
+	}
+	resubscribed := make(chan struct{}, 1)
+	lost := make(chan error, 1)
+	_, err := lasting.Subscribe(ctx, "Device.Test.Event!", func(rbus.Event) {},
+		rbus.SubOnResubscribed(func() { resubscribed <- struct{}{} }),
+		rbus.SubOnLost(func(error) { t.Error("lost the subscription while its provider came back") }))
+	if err == nil {
+		_, err = fleeting.Subscribe(ctx, "Device.Test.Event!", func(rbus.Event) {},
+			rbus.SubOnResubscribed(func() { t.Error("resubscribed with the provider gone") }),
+			rbus.SubOnLost(func(err error) { lost <- err }))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider goes away along with the router, so neither subscription
+	// can be made again right after reconnecting.
+	if err := provider.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The short resubscribe period runs out before the provider is back.
+	select {
+	case err := <-lost:
+		if !errors.Is(err, rtmessage.ErrNoRoute) {
+			t.Fatalf("got %v, want %v", err, rtmessage.ErrNoRoute)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscription wasn't lost")
+	}
+
+	// The provider coming back within the long one recovers the other.
+	provider = openHandle(t, url, "provider")
+	registerValues(t, provider, values)
+	waitFor(t, resubscribed, "the subscription to be made again")
+
+	// Unsubscribed while the provider is still there to answer.
+	if err := lasting.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
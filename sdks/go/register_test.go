@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// capture relays the connections to the server at the URL, keeping what the
+// clients send, and returns the URL to connect to instead.  The function it
+// returns waits for the clients to hang up, then returns the messages they
+// sent.
+func capture(t *testing.T, url string) (string, func() []rtmessage.Message) {
+	t.Helper()
+
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "capture"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		m       sync.Mutex
+		sent    bytes.Buffer
+		clients sync.WaitGroup
+		relays  sync.WaitGroup
+	)
+	t.Cleanup(func() {
+		_ = l.Close()
+		relays.Wait()
+	})
+
+	relays.Add(1)
+	go func() {
+		defer relays.Done()
+		for {
+			client, err := l.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("unix", strings.TrimPrefix(url, "unix://"))
+			if err != nil {
+				_ = client.Close()
+				continue
+			}
+
+			clients.Add(1)
+			relays.Add(2)
+			go func() {
+				defer relays.Done()
+				defer clients.Done()
+				defer server.Close()
+				buf := make([]byte, 4096)
+				for {
+					n, err := client.Read(buf)
+					m.Lock()
+					sent.Write(buf[:n])
+					m.Unlock()
+					if err != nil {
+						return
+					}
+					if _, err := server.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}()
+			go func() {
+				defer relays.Done()
+				defer client.Close()
+				_, _ = io.Copy(client, server)
+			}()
+		}
+	}()
+
+	return "unix://" + l.Addr().String(), func() []rtmessage.Message {
+		hungUp := make(chan struct{})
+		go func() {
+			clients.Wait()
+			close(hungUp)
+		}()
+		select {
+		case <-hungUp:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the clients are still connected")
+		}
+
+		m.Lock()
+		r := bytes.NewReader(bytes.Clone(sent.Bytes()))
+		m.Unlock()
+
+		var msgs []rtmessage.Message
+		for {
+			msg, err := rtmessage.ReadMessage(r)
+			if err != nil {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+}
+
+// TestOpenRegisters checks that Open and Close register and deregister the
+// component the way rbus_open and rbus_close do.  From rtConnection.c and
+// rbuscore.c, the C library subscribes the inbox with the route id 1 on
+// connecting, then rbus_registerObj subscribes the component name, and
+// rbus_unregisterObj unsubscribes it with the route id it was subscribed
+// with, each a message to _RTROUTED.INBOX.SUBSCRIBE such as
+//
+//	{"add":1,"topic":"provider","route_id":3}
+//
+// The handle looks the name up before subscribing it, to fail a duplicate.
+func TestOpenRegisters(t *testing.T) {
+	srv, url := newServer(t)
+	url, sent := capture(t, url)
+
+	h, err := rbus.New(rbus.WithURL(url), rbus.WithApplicationName("provider"))
+	if err == nil {
+		err = h.Open(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := h.Inbox()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.ExpectSubscribe(ctx, "provider"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	routes := make(map[string]int)
+	for _, msg := range sent() {
+		switch msg.Header.Topic {
+		case "_RTROUTED.INBOX.QUERY":
+			got = append(got, "query "+string(bytes.TrimRight(msg.Payload, "\x00")))
+		case "_RTROUTED.INBOX.SUBSCRIBE":
+			var s struct {
+				Add     int    `json:"add"`
+				Topic   string `json:"topic"`
+				RouteID int    `json:"route_id"`
+			}
+			if err := json.Unmarshal(msg.Payload, &s); err != nil {
+				t.Fatalf("%q: %v", msg.Payload, err)
+			}
+			if id, found := routes[s.Topic]; found && id != s.RouteID {
+				t.Fatalf("got %s unsubscribed with the route id %d, want %d", s.Topic, s.RouteID, id)
+			}
+			routes[s.Topic] = s.RouteID
+
+			// The advisories are the handle's own business.
+			switch s.Topic {
+			case "_RTROUTED.ADVISORY":
+			case inbox:
+				got = append(got, fmt.Sprintf("subscribe %d inbox", s.Add))
+			default:
+				got = append(got, fmt.Sprintf("subscribe %d %s", s.Add, s.Topic))
+			}
+		}
+	}
+
+	want := []string{
+		"subscribe 1 inbox",
+		`query {"expression":"provider"}`,
+		"subscribe 1 provider",
+		"subscribe 0 provider",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if routes[inbox] != 1 {
+		t.Fatalf("got the route id %d for the inbox, want 1", routes[inbox])
+	}
+}
+
+func TestOpenDuplicate(t *testing.T) {
+	srv, url := newServer(t)
+	openHandle(t, url, "provider")
+
+	// The router doesn't acknowledge the route, so it's waited for.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.ExpectSubscribe(ctx, "provider"); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := rbus.New(rbus.WithURL(url), rbus.WithApplicationName("provider"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Open(context.Background()); !errors.Is(err, rbus.ErrComponentNameDuplicate) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrComponentNameDuplicate)
+	}
+}
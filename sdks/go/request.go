@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// The methods named in the meta section of rbus messages.
+const (
+	methodGetParameterValues = "METHOD_GETPARAMETERVALUES"
+	methodSetParameterValues = "METHOD_SETPARAMETERVALUES"
+	methodResponse           = "METHOD_RESPONSE"
+)
+
+// newMessage creates a message in the handle's value wire format.
+func (h *Handle) newMessage() *Message {
+	m := NewMessage()
+	m.SetValueWireFormat(h.cfg.wireFormat)
+	return m
+}
+
+// checkOpen returns ErrNotOpen before Open and ErrHandleClosed once Close has
+// been called.
+func (h *Handle) checkOpen() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.checkOpenLocked()
+}
+
+// checkOpenLocked is checkOpen called with h.m held.
+func (h *Handle) checkOpenLocked() error {
+	switch {
+	case h.closed:
+		return ErrHandleClosed
+	case h.conn == nil:
+		return ErrNotOpen
+	}
+	return nil
+}
+
+// request sends the message to the topic and waits for the provider's
+// response, bounded by the context, or by the default timeout when the
+// context has no deadline.  Close waits for the requests in flight, and fails
+// those that outlast it with ErrHandleClosed.
+func (h *Handle) request(ctx context.Context, topic string, req *Message) (*Message, error) {
+	if _, ok := ctx.Deadline(); !ok && h.cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, h.cfg.timeout, ErrDefaultTimeout)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	h.m.Lock()
+	if err := h.checkOpenLocked(); err != nil {
+		h.m.Unlock()
+		return nil, err
+	}
+	h.inflight.Add(1)
+	id := h.trackCallLocked(cancel)
+	h.m.Unlock()
+
+	defer h.inflight.Done()
+	defer h.untrackCall(id)
+
+	done := h.observeRequest(ctx, topic, req)
+	resp, err := h.roundTrip(ctx, topic, req)
+	done(resp, err)
+	if err == nil {
+		return resp, nil
+	}
+
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrHandleClosed):
+		return nil, ErrHandleClosed
+	case cause == ErrDefaultTimeout:
+		return nil, fmt.Errorf("%w after %s: %w: %w", ErrDefaultTimeout, h.cfg.timeout, ErrTimeout, context.DeadlineExceeded)
+	}
+
+	return nil, err
+}
+
+// roundTrip sends the request like request does, but also while the handle is
+// closing, for the requests Close makes itself.
+func (h *Handle) roundTrip(ctx context.Context, topic string, req *Message) (*Message, error) {
+	con, err := h.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := con.RequestBinary(ctx, req.Bytes(), topic)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := NewMessageFromBytes(msg.Payload)
+	resp.SetValueWireFormat(h.cfg.wireFormat)
+
+	method, _, _, err := resp.GetMetaInfo()
+	if err != nil {
+		return nil, err
+	}
+	if method != methodResponse {
+		return nil, fmt.Errorf("%w: unexpected method '%s' in response", ErrMalformedMessage, method)
+	}
+
+	return resp, nil
+}
+
+// popProperties reads the properties of a get response: the return code,
+// the number of properties and then the name and value of each.  A failure
+// reported by the provider is returned as its ErrorCode.
+func popProperties(resp *Message) ([]Property, error) {
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReturnCode(rc); err != nil {
+		return nil, err
+	}
+
+	count, err := resp.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("%w: negative property count %d", ErrMalformedMessage, count)
+	}
+
+	// Each property takes at least two bytes, which bounds what a bogus
+	// count can allocate.
+	props := make([]Property, 0, min(int(count), resp.remaining()/2))
+	for range count {
+		var p Property
+		if p.Name, err = resp.PopString(); err != nil {
+			return nil, err
+		}
+		if p.Value, err = resp.PopValue(); err != nil {
+			return nil, err
+		}
+		props = append(props, p)
+	}
+
+	return props, nil
+}
+
+// observeRequest logs the request sent to the topic, returning the function
+// that logs its response and reports it to the metrics.  A response that
+// can't be decoded is logged as a warning.
+func (h *Handle) observeRequest(ctx context.Context, topic string, req *Message) func(*Message, error) {
+	logger := h.cfg.logger
+	debug := logger.Enabled(ctx, slog.LevelDebug)
+
+	var method, param string
+	if debug || h.cfg.metrics != nil {
+		method, _, _, _ = req.GetMetaInfo()
+	}
+	if h.cfg.metrics != nil {
+		param = requestParam(method, req, topic)
+	}
+
+	if debug {
+		attrs := []any{"method", method, "topic", topic}
+		if names := requestNames(method, req); len(names) > 0 {
+			attrs = append(attrs, "names", names)
+		}
+		logger.DebugContext(ctx, "request sent", attrs...)
+	}
+
+	start := time.Now()
+	return func(resp *Message, err error) {
+		latency := time.Since(start)
+
+		code := operationCode(err)
+		if err == nil {
+			rc, _ := returnCodeOf(resp)
+			code = int(rc)
+		}
+		if h.cfg.metrics != nil {
+			h.cfg.metrics.OperationCompleted(method, param, code, latency)
+		}
+
+		switch {
+		case errors.Is(err, ErrMalformedMessage):
+			logger.WarnContext(ctx, "malformed response", "topic", topic, "error", err)
+		case !debug:
+		case err != nil:
+			logger.DebugContext(ctx, "response received", "method", method, "topic", topic, "latency", latency, "error", err)
+		default:
+			logger.DebugContext(ctx, "response received", "method", method, "topic", topic, "latency", latency, "code", code)
+		}
+	}
+}
+
+// requestNames returns the names of the properties a get or a set request is
+// about, for logging.
+func requestNames(method string, req *Message) []string {
+	m := *req
+	m.offset = 0
+
+	switch method {
+	case methodGetParameterValues:
+	case methodSetParameterValues:
+		if _, err := m.PopInt32(); err != nil { // session id
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if _, err := m.PopString(); err != nil { // component
+		return nil
+	}
+	count, err := m.PopInt32()
+	if err != nil || count < 0 {
+		return nil
+	}
+
+	names := make([]string, 0, min(int(count), m.remaining()))
+	for range count {
+		name, err := m.PopString()
+		if err != nil {
+			break
+		}
+		names = append(names, name)
+
+		if method == methodSetParameterValues {
+			if _, err := m.PopValue(); err != nil {
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// requestParam returns the name a request is about, for the metrics: that of
+// its first property, or of the method, element, table, row or event it's
+// for.  It's the topic for a request about none.
+func requestParam(method string, req *Message, topic string) string {
+	m := *req
+	m.offset = 0
+
+	switch method {
+	case methodGetParameterValues, methodSetParameterValues:
+		if names := requestNames(method, req); len(names) > 0 {
+			return names[0]
+		}
+		return topic
+	case methodRPC, methodAddTableRow, methodDeleteTableRow:
+		if _, err := m.PopInt32(); err != nil { // session id
+			return topic
+		}
+	case methodGetParameterNames, methodSubscribe, methodUnsubscribe:
+	default:
+		return topic
+	}
+
+	if name, err := m.PopString(); err == nil {
+		return name
+	}
+	return topic
+}
+
+// returnCodeOf reads the return code every rbus response starts with, leaving
+// the response as it was.
+func returnCodeOf(resp *Message) (int32, bool) {
+	m := *resp
+	rc, err := m.PopInt32()
+	return rc, err == nil
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"errors"
+	"testing"
+)
+
+func FuzzPopProperties(f *testing.F) {
+	ok := NewMessage()
+	ok.AppendInt32(0)
+	ok.AppendInt32(int32(len(fuzzValues)))
+	for _, v := range fuzzValues {
+		ok.AppendString("Device.Test." + v.Type().String())
+		if err := ok.AppendValue(v); err != nil {
+			f.Fatal(err)
+		}
+	}
+	f.Add(ok.Bytes())
+
+	failed := NewMessage()
+	failed.AppendInt32(int32(ErrElementDoesNotExist))
+	f.Add(failed.Bytes())
+
+	bogus := NewMessage()
+	bogus.AppendInt32(0)
+	bogus.AppendInt32(1 << 30)
+	f.Add(bogus.Bytes())
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		props, err := popProperties(NewMessageFromBytes(b))
+
+		var code ErrorCode
+		switch {
+		case err == nil:
+			// Each property takes at least two bytes.
+			if len(props) > len(b)/2 {
+				t.Fatalf("got %d properties out of %d bytes", len(props), len(b))
+			}
+		case errors.As(err, &code), errors.Is(err, ErrMalformedMessage), errors.Is(err, ErrUnsupportedType):
+		default:
+			t.Fatalf("got %v, want a return code or a malformed message", err)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy decides whether a Get, Set, Invoke or AddTableRow that failed is
+// tried again; see WithRetryPolicy.
+type RetryPolicy interface {
+	// Retry is called with the error of the attempt that failed and the
+	// number of attempts made so far, starting at 1.  It returns whether to
+	// try again, and after how long.  The error matches the ErrorCode the
+	// provider returned, or rtmessage.ErrNoRoute when no provider of the
+	// name is on the bus, for example because it's still starting.
+	Retry(err error, attempt int) (delay time.Duration, retry bool)
+}
+
+// RetryPolicyFunc is a function that implements the RetryPolicy interface.
+type RetryPolicyFunc func(err error, attempt int) (time.Duration, bool)
+
+func (f RetryPolicyFunc) Retry(err error, attempt int) (time.Duration, bool) {
+	return f(err, attempt)
+}
+
+// nonIdempotent is a RetryPolicy applied to every operation.
+type nonIdempotent struct {
+	RetryPolicy
+}
+
+// RetryNonIdempotent makes the policy apply to the operations that may not be
+// safe to repeat too: the sets that are committed, which the provider may
+// have applied before the response was lost, and AddTableRow, which would add
+// another row.  Without it those are tried once.
+func RetryNonIdempotent(p RetryPolicy) RetryPolicy {
+	return nonIdempotent{RetryPolicy: p}
+}
+
+// retry calls fn until it succeeds, the retry policy gives up or the context
+// is done, returning the error of the last attempt.  Each attempt sends its
+// request anew, with a sequence number of its own.  An operation that isn't
+// idempotent is tried once, unless the policy opted in with
+// RetryNonIdempotent.
+func (h *Handle) retry(ctx context.Context, idempotent bool, fn func() error) error {
+	p := h.cfg.retry
+	if _, all := p.(nonIdempotent); p == nil || !idempotent && !all {
+		return fn()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || errors.Is(err, ErrHandleClosed) || errors.Is(err, ErrNotOpen) || ctx.Err() != nil {
+			return err
+		}
+
+		delay, again := p.Retry(err, attempt)
+		if !again {
+			return err
+		}
+		h.cfg.logger.DebugContext(ctx, "retrying", "attempt", attempt, "delay", delay, "error", err)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// attempts is a RetryPolicy retrying up to three attempts, recording the
+// errors it's asked about.
+type attempts struct {
+	errs    []error
+	onRetry func(attempt int)
+}
+
+func (a *attempts) Retry(err error, attempt int) (time.Duration, bool) {
+	a.errs = append(a.errs, err)
+	if attempt >= 3 {
+		return 0, false
+	}
+	if a.onRetry != nil {
+		a.onRetry(attempt)
+	}
+	return time.Millisecond, true
+}
+
+func TestRetry(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{"Device.Test.X": rbus.NewValue("x")})
+	if err := b.AddMethod("Device.Test.Echo()", echo); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		desc string
+		name string
+		op   func(h *rbus.Handle) error
+	}{
+		{
+			desc: "get",
+			name: "Device.Test.X",
+			op: func(h *rbus.Handle) error {
+				_, err := h.Get(ctx, "Device.Test.X")
+				return err
+			},
+		}, {
+			desc: "uncommitted set",
+			name: "Device.Test.X",
+			op: func(h *rbus.Handle) error {
+				return h.SetMultiple(ctx, []rbus.Property{{Name: "Device.Test.X", Value: rbus.NewValue("y")}}, false)
+			},
+		}, {
+			desc: "invoke",
+			name: "Device.Test.Echo()",
+			op: func(h *rbus.Handle) error {
+				_, err := h.Invoke(ctx, "Device.Test.Echo()", nil)
+				return err
+			},
+		},
+	}
+
+	for i, tc := range tests {
+		// The provider fails the first two attempts, and recovers before
+		// the third.
+		b.SetError(tc.name, rbus.ErrDestinationResponseFailure)
+		p := attempts{onRetry: func(attempt int) {
+			if attempt == 2 {
+				b.SetError(tc.name, 0)
+			}
+		}}
+		h := openHandle(t, b.URL(), fmt.Sprintf("consumer-%d", i), rbus.WithRetryPolicy(&p))
+
+		if err := tc.op(h); err != nil {
+			t.Fatalf("%s: %v", tc.desc, err)
+		}
+		if len(p.errs) != 2 {
+			t.Fatalf("%s: got %d retries, want 2", tc.desc, len(p.errs))
+		}
+		for _, err := range p.errs {
+			if !errors.Is(err, rbus.ErrDestinationResponseFailure) {
+				t.Fatalf("%s: got %v, want %v", tc.desc, err, rbus.ErrDestinationResponseFailure)
+			}
+		}
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{"Device.Test.X": rbus.NewValue("x")})
+	b.SetError("Device.Test.X", rbus.ErrDestinationResponseFailure)
+
+	ctx := context.Background()
+	tests := []struct {
+		desc string
+		op   func(h *rbus.Handle) error
+	}{
+		{
+			desc: "committed set",
+			op: func(h *rbus.Handle) error {
+				return h.Set(ctx, "Device.Test.X", rbus.NewValue("y"))
+			},
+		}, {
+			// The broker has no tables, so there's no provider to add the
+			// row.
+			desc: "add row",
+			op: func(h *rbus.Handle) error {
+				_, err := h.AddTableRow(ctx, "Device.Test.Table.", "")
+				return err
+			},
+		},
+	}
+
+	for i, tc := range tests {
+		for _, all := range []bool{false, true} {
+			var p attempts
+			policy := rbus.RetryPolicy(&p)
+			want := 0
+			if all {
+				policy = rbus.RetryNonIdempotent(policy)
+				want = 3
+			}
+			h := openHandle(t, b.URL(), fmt.Sprintf("consumer-%d-%t", i, all), rbus.WithRetryPolicy(policy))
+
+			if err := tc.op(h); err == nil {
+				t.Fatalf("%s: succeeded", tc.desc)
+			}
+			if len(p.errs) != want {
+				t.Fatalf("%s, retrying all %t: asked the policy %d times, want %d", tc.desc, all, len(p.errs), want)
+			}
+		}
+	}
+}
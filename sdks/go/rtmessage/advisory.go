@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AdvisoryTopic is the topic rtrouted publishes advisory messages on.
+const AdvisoryTopic = "_RTROUTED.ADVISORY"
+
+// AdvisoryKind identifies the event an advisory message reports.  The values
+// match rtAdviseEvent in the C library.
+type AdvisoryKind int
+
+const (
+	AdvisoryClientConnect AdvisoryKind = iota
+	AdvisoryClientDisconnect
+)
+
+func (k AdvisoryKind) String() string {
+	switch k {
+	case AdvisoryClientConnect:
+		return "client connect"
+	case AdvisoryClientDisconnect:
+		return "client disconnect"
+	}
+	return fmt.Sprintf("unknown advisory (%d)", int(k))
+}
+
+// Advisory is a decoded advisory message from the router.
+type Advisory struct {
+	// Kind is the event being reported.
+	Kind AdvisoryKind
+
+	// Inbox is the inbox of the client the event is about.
+	Inbox string
+
+	// Reason is the explanation given by the router, if any.
+	Reason string
+
+	// Raw is the undecoded payload.  It is only set when the Kind is not
+	// one of the known kinds, so newer router events are not lost.
+	Raw []byte
+}
+
+// AdvisoryListener is notified about advisory messages from the router.
+type AdvisoryListener interface {
+	OnAdvisory(Advisory)
+}
+
+// AdvisoryListenerFunc is a function that implements the AdvisoryListener
+// interface.
+type AdvisoryListenerFunc func(Advisory)
+
+func (f AdvisoryListenerFunc) OnAdvisory(a Advisory) {
+	f(a)
+}
+
+var _ AdvisoryListener = AdvisoryListenerFunc(nil)
+
+// advisoryPayload is the JSON body rtrouted sends.
+type advisoryPayload struct {
+	Event  *int   `json:"event"`
+	Inbox  string `json:"inbox"`
+	Reason string `json:"reason"`
+}
+
+// decodeAdvisory decodes the payload of an advisory message.
+func decodeAdvisory(payload []byte) (Advisory, error) {
+	var p advisoryPayload
+	if err := json.Unmarshal(trimNul(payload), &p); err != nil {
+		return Advisory{}, fmt.Errorf("%w: advisory payload: %w", ErrInvalidInput, err)
+	}
+
+	if p.Event == nil {
+		return Advisory{}, fmt.Errorf("%w: advisory payload is missing the event", ErrInvalidInput)
+	}
+
+	a := Advisory{
+		Kind:   AdvisoryKind(*p.Event),
+		Inbox:  p.Inbox,
+		Reason: p.Reason,
+	}
+
+	switch a.Kind {
+	case AdvisoryClientConnect, AdvisoryClientDisconnect:
+	default:
+		a.Raw = payload
+	}
+
+	return a, nil
+}
+
+// trimNul removes the trailing NUL the C library includes in JSON payloads.
+func trimNul(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
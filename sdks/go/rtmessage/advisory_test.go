@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeAdvisory(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Advisory
+		err     error
+	}{
+		{
+			name:    "connect",
+			payload: "{\"event\":0,\"inbox\":\"client.INBOX.1\"}\x00",
+			want:    Advisory{Kind: AdvisoryClientConnect, Inbox: "client.INBOX.1"},
+		}, {
+			name:    "disconnect",
+			payload: `{"event":1,"inbox":"client.INBOX.1","reason":"socket closed"}`,
+			want:    Advisory{Kind: AdvisoryClientDisconnect, Inbox: "client.INBOX.1", Reason: "socket closed"},
+		}, {
+			// The payload of an event a newer router reports is kept whole,
+			// the trailing NUL included, as it came.
+			name:    "unknown",
+			payload: "{\"event\":7,\"inbox\":\"client.INBOX.1\",\"route\":\"Device.X\"}\x00",
+			want: Advisory{
+				Kind:  AdvisoryKind(7),
+				Inbox: "client.INBOX.1",
+				Raw:   []byte("{\"event\":7,\"inbox\":\"client.INBOX.1\",\"route\":\"Device.X\"}\x00"),
+			},
+		},
+		{name: "no event", payload: `{"inbox":"client.INBOX.1"}`, err: ErrInvalidInput},
+		{name: "not JSON", payload: "event=0", err: ErrInvalidInput},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := decodeAdvisory([]byte(tc.payload))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			if a.Kind != tc.want.Kind || a.Inbox != tc.want.Inbox || a.Reason != tc.want.Reason {
+				t.Fatalf("got %+v, want %+v", a, tc.want)
+			}
+			if string(a.Raw) != string(tc.want.Raw) || (a.Raw == nil) != (tc.want.Raw == nil) {
+				t.Fatalf("got raw %q, want %q", a.Raw, tc.want.Raw)
+			}
+		})
+	}
+}
+
+func TestAdvisoryListener(t *testing.T) {
+	r, url := newTestRouter(t)
+
+	advisories := make(chan Advisory, 10)
+	newTestConnection(t, url, "test.INBOX", WithAdvisoryListener(AdvisoryListenerFunc(func(a Advisory) {
+		advisories <- a
+	})))
+	eventually(t, "the route to the advisories", func() bool {
+		return routes(r, AdvisoryTopic) > 0
+	})
+
+	for _, payload := range []string{
+		`{"event":1,"inbox":"client.INBOX.1"}`,
+		`{"event":9,"inbox":"client.INBOX.2","detail":{"fd":7}}`,
+	} {
+		msg := Message{Header: &Header{Topic: AdvisoryTopic}, Payload: []byte(payload)}
+		if err := r.Inject(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []Advisory{
+		{Kind: AdvisoryClientDisconnect, Inbox: "client.INBOX.1"},
+		{Kind: AdvisoryKind(9), Inbox: "client.INBOX.2", Raw: []byte(`{"event":9,"inbox":"client.INBOX.2","detail":{"fd":7}}`)},
+	} {
+		select {
+		case a := <-advisories:
+			if a.Kind != want.Kind || a.Inbox != want.Inbox || string(a.Raw) != string(want.Raw) {
+				t.Fatalf("got %+v, want %+v", a, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s advisory", want.Kind)
+		}
+	}
+}
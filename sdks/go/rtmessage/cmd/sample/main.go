@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
 	"time"
 
 	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
@@ -20,14 +23,30 @@ func main() {
 		panic(fmt.Sprintf("Failed to create connection. %s", err.Error()))
 	}
 
-	if err := con.Connect(); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := con.Connect(ctx); err != nil {
 		panic(fmt.Sprintf("Failed to connect. %s", err.Error()))
 	}
 
 	con.Add(rtmessage.MessageListenerFunc(func(msg rtmessage.Message) {
-		fmt.Printf("Received message: %s\n", string(msg.Payload))
+		fmt.Printf("Received %s message: %s\n", msg.PayloadType(), string(msg.Payload))
 	}), "A.B.C")
 
-	// Only run for a minute, then exit.
-	time.Sleep(1 * time.Minute)
+	if err := con.SendBinary(ctx, []byte("hello"), "A.B.C"); err != nil {
+		fmt.Printf("Failed to send. %s\n", err.Error())
+	}
+
+	// Run until the connection ends, closing it when interrupted.
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-interrupted.Done()
+		_ = con.Close()
+	}()
+
+	<-con.Done()
+	if err := con.Err(); err != nil {
+		fmt.Printf("Connection ended. %s\n", err.Error())
+	}
 }
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expectedWhileDown reports if the error is one an operation may fail with
+// because the connection is down or being closed.
+func expectedWhileDown(err error) bool {
+	return err == nil ||
+		errors.Is(err, ErrInvalidState) ||
+		errors.Is(err, ErrClosed) ||
+		errors.Is(err, ErrConnectionClosed) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	r, url := newTestRouter(t)
+	goroutines := runtime.NumGoroutine()
+
+	c, err := New(url, "test", WithInbox("test.INBOX"), WithRequestTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	run := func(name string, op func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				if err := op(i); !expectedWhileDown(err) {
+					errs <- fmt.Errorf("%s: %w", name, err)
+					return
+				}
+			}
+		}()
+	}
+
+	for n := range 4 {
+		run("Send", func(i int) error {
+			return c.Send(ctx, []byte("payload"), fmt.Sprintf("Test.Send.%d", n))
+		})
+	}
+	run("SendAsync", func(i int) error {
+		err := c.SendAsync(Message{Header: &Header{Topic: "Test.Async"}})
+		if errors.Is(err, ErrSendQueueFull) {
+			return nil
+		}
+		return err
+	})
+	run("SendBatch", func(i int) error {
+		err := c.SendBatch(ctx, batch(5, "Test.Batch"))
+		var be *BatchError
+		if errors.As(err, &be) {
+			return be.Err
+		}
+		return err
+	})
+	run("Request", func(i int) error {
+		_, err := c.Request(ctx, nil, "Test.Nobody")
+		if errors.Is(err, ErrNoRoute) {
+			return nil
+		}
+		return err
+	})
+	run("Subscribe", func(i int) error {
+		return c.Subscribe(fmt.Sprintf("Test.Sub.%d", i%10))
+	})
+	run("Add", func(i int) error {
+		cancel, err := c.Add(MessageListenerFunc(func(Message) {}), fmt.Sprintf("Test.Add.%d", i%10))
+		if err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+	run("State", func(i int) error {
+		_ = c.State()
+		_ = c.Stats()
+		_ = c.Subscriptions()
+		_ = c.Err()
+		<-time.After(time.Millisecond)
+		return nil
+	})
+	run("Disconnect", func(i int) error {
+		if err := c.Disconnect(); err != nil {
+			return err
+		}
+		time.Sleep(time.Millisecond)
+		if err := c.Connect(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Still usable afterwards.
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ch := subscribe(t, r, c, "Test.After")
+	if err := c.Send(context.Background(), []byte("after"), "Test.After"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if msg := receive(t, ch); msg.Header.Topic == "Test.After" {
+			break
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the goroutines to exit", func() bool {
+		return runtime.NumGoroutine() <= goroutines
+	})
+}
+
+// stalledRouter accepts connections and never reads from them, so writes
+// block once the socket buffers are full.
+func stalledRouter(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			con, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = con.Close() })
+		}
+	}()
+
+	return "tcp://" + l.Addr().String()
+}
+
+func TestDisconnectDuringStalledWrite(t *testing.T) {
+	url := stalledRouter(t)
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Enough to fill the socket buffers and block the writer.
+	payload := make([]byte, 1<<20)
+	sent := make(chan error, 100)
+	for range 16 {
+		go func() { sent <- c.Send(context.Background(), payload, "Test.Big") }()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// A subscription queued behind the stalled writes.
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- c.Subscribe("Test.Event") }()
+	time.Sleep(50 * time.Millisecond)
+
+	// Neither State nor Disconnect waits on the stalled writer.
+	done := make(chan error, 1)
+	go func() {
+		_ = c.State()
+		done <- c.Disconnect()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Disconnect waits on the stalled writer")
+	}
+
+	for range 16 {
+		select {
+		case err := <-sent:
+			if err != nil && !errors.Is(err, ErrClosed) {
+				t.Fatalf("Send: got %v, want %v", err, ErrClosed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Send still blocked after Disconnect")
+		}
+	}
+
+	// The subscription cut off by Disconnect is kept, to be made when
+	// connecting again.
+	select {
+	case err := <-subscribed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe still blocked after Disconnect")
+	}
+	if _, ok := c.SubscriptionID("Test.Event"); !ok {
+		t.Fatal("subscription lost")
+	}
+}
@@ -7,17 +7,36 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"net"
 	"net/url"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/internal/notify"
 	"github.com/xmidt-org/eventor"
 )
 
 var (
-	ErrInvalidState = errors.New("invalid state")
-	ErrInvalidInput = errors.New("invalid input")
+	ErrInvalidState     = errors.New("invalid state")
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrClosed           = errors.New("connection closed")
+	ErrMalformedMessage = errors.New("malformed message")
+	ErrMessageTooLarge  = errors.New("message too large")
+	ErrNoRoute          = errors.New("no route")
+
+	// ErrNotConnected means there is no connection to the router at the
+	// moment.  It matches ErrInvalidState as well.
+	ErrNotConnected = fmt.Errorf("%w: not connected", ErrInvalidState)
+
+	// ErrUnknownPayloadType means a payload was to be sent without saying how
+	// it is encoded.  It matches ErrInvalidInput as well.
+	ErrUnknownPayloadType = fmt.Errorf("%w: unknown payload type", ErrInvalidInput)
 )
 
 type SubscriptionIDGenerator struct {
@@ -28,278 +47,868 @@ func (s *SubscriptionIDGenerator) getNextSubscriptionID() int {
 	return int(atomic.AddUint32(&s.counter, 1))
 }
 
-type ReadState int
-
-const (
-	ReadStateReadHeaderPreamble = iota
-	ReadStateReadHeader
-	ReadStateReadPayload
-)
-
 type Connection struct {
-	url       *url.URL
+	urls      []*url.URL
 	con       net.Conn
 	cancel    context.CancelFunc
 	m         sync.Mutex
 	appName   string
+	inbox     string
 	generator SubscriptionIDGenerator
-	state     ReadState
 	listeners eventor.Eventor[MessageListener]
+
+	errListeners       eventor.Eventor[ReadErrorListener]
+	gapListeners       eventor.Eventor[GapListener]
+	reconnectListeners eventor.Eventor[ReconnectListener]
+	states             notify.Notifier[State]
+
+	undeliverableListeners eventor.Eventor[MessageListener]
+
+	requestTimeout time.Duration
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	idlePolicy     IdlePolicy
+	keepAlive      time.Duration
+	compact        bool
+	ignoreSelf     bool
+	maxMessageSize int
+	metrics        Metrics
+	dedup          *dedupWindow
+	seqTracker     *seqTracker
+	latency        func(topic string, d time.Duration)
+	advisory       AdvisoryListener
+	stats          connStats
+	reconnect      *backoff
+	logger         *slog.Logger
+
+	sendQueueSize   int
+	sendQueuePolicy QueuePolicy
+	dispatchWorkers int
+	dispatchQueue   int
+	dispatchPolicy  QueuePolicy
+
+	// Guarded by m, which is never held while reading from or writing to
+	// the router.  Only the writer goroutine writes to the socket, fed by
+	// the send queue, and closing the socket unblocks it.
+	state           State
+	closed          bool
+	dialing         chan struct{}
+	queue           *sendQueue
+	term            *termination
+	handover        bool
+	up              chan struct{}
+	reconnectCancel context.CancelFunc
+	preferred       int
+
+	// ctx is canceled by Close, ending the work the connection does on its
+	// own behalf, such as handling the requests of Serve.
+	ctx  context.Context
+	stop context.CancelFunc
+
+	wg      sync.WaitGroup
+	pending pendingRequests
+	subs    subscriptions
 }
 
+// State is the state of a Connection.
+type State int
+
+const (
+	// StateDisconnected means there is no connection to the server.
+	StateDisconnected State = iota
+
+	// StateConnecting means a connection is being dialed, or reestablished
+	// when automatic reconnecting is enabled.
+	StateConnecting
+
+	// StateConnected means the connection to the server is up.
+	StateConnected
+
+	// StateClosing means Close has been called and is waiting for the
+	// connection to wind down.
+	StateClosing
+
+	// StateClosed means the connection has been closed for good.
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// subscribeTopic is the topic the router receives subscription changes on.
+const subscribeTopic = "_RTROUTED.INBOX.SUBSCRIBE"
+
 type subscriptionRequest struct {
 	Topic   string `json:"topic"`
 	Add     int    `json:"add"`
 	RouteID int    `json:"route_id"`
 }
 
-// New creates a new connection or returns an error.
-func New(rawURL string, appName string) (*Connection, error) {
-	u, err := url.Parse(rawURL)
+// New creates a new connection or returns an error.  The URL scheme is
+// either "unix" or "tcp" for rtrouted, or "mem" for a MemRouter.
+func New(rawURL string, appName string, opts ...Option) (*Connection, error) {
+	u, err := parseURL(rawURL)
 	if err != nil {
 		return nil, err
 	}
 
-	switch u.Scheme {
-	case "unix", "tcp":
-	default:
-		return nil, fmt.Errorf("%w: unsupported URL scheme", ErrInvalidInput)
+	c := Connection{
+		urls:    []*url.URL{u},
+		appName: appName,
+		subs:    subscriptions{exprs: make(map[string]*subscription)},
+		inbox:   fmt.Sprintf("%s.%s.INBOX.%d", appName, filepath.Base(os.Args[0]), os.Getpid()),
+		up:      make(chan struct{}),
+		term:    newTermination(),
+
+		sendQueueSize:  defaultSendQueueSize,
+		dispatchPolicy: QueueBlock,
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
 	}
 
-	return &Connection{
-		url:     u,
-		appName: appName,
-		state:   ReadStateReadHeaderPreamble,
-	}, nil
+	for _, opt := range opts {
+		if err := opt.apply(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	c.ctx, c.stop = context.WithCancel(context.Background())
+
+	return &c, nil
+}
+
+// Connect establishes a connection to the server, giving up when the context
+// is done before the connection is made and the routes are added.
+func (c *Connection) Connect(ctx context.Context) error {
+	_, err := c.establish(ctx)
+	return err
+}
+
+// establish connects to the server and restores the subscriptions.  The
+// connection may be up even when an error is returned, which is reported by
+// connected.
+func (c *Connection) establish(ctx context.Context) (connected bool, err error) {
+	created, err := c.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !created {
+		return true, nil
+	}
+
+	routes := map[string]int{
+		c.inbox: c.generator.getNextSubscriptionID(),
+	}
+	if c.advisory != nil {
+		routes[AdvisoryTopic] = c.generator.getNextSubscriptionID()
+	}
+	maps.Copy(routes, c.subs.routes())
+
+	for expression, routeID := range routes {
+		if err := c.subscribe(ctx, expression, routeID, true); err != nil {
+			return true, err
+		}
+	}
+
+	// The aliases go after the routes they are added to.
+	for alias, routeID := range c.subs.aliasRoutes() {
+		if err := c.subscribe(ctx, alias, routeID, true); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
 }
 
-// Connect establishes a connection to the server.
-func (c *Connection) Connect() error {
+// connect dials the server and starts the read loop, reporting if a new
+// connection was made.  The dial happens without holding the lock, so the
+// state can be observed and a Disconnect racing with the attempt wins.
+func (c *Connection) connect(ctx context.Context) (bool, error) {
 	c.m.Lock()
-	defer c.m.Unlock()
+	for c.dialing != nil {
+		// Another Connect, or the reconnect loop, is already dialing.
+		dialing := c.dialing
+		c.m.Unlock()
+		select {
+		case <-dialing:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		c.m.Lock()
+	}
+
+	if c.closed {
+		c.m.Unlock()
+		return false, ErrClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		c.m.Unlock()
+		return false, err
+	}
 
 	if c.con != nil {
-		return nil
+		c.m.Unlock()
+		return false, nil
 	}
 
-	var con net.Conn
-	var err error
+	dialing := make(chan struct{})
+	c.dialing = dialing
+	c.setState(StateConnecting, nil)
+	c.m.Unlock()
 
-	switch c.url.Scheme {
-	case "unix":
-		con, err = net.Dial(c.url.Scheme, c.url.Path)
-	case "tcp":
-		con, err = net.Dial(c.url.Scheme, c.url.Host)
+	con, err := c.dial(ctx)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.dialing = nil
+	close(dialing)
+
+	if err == nil && c.state != StateConnecting {
+		// Disconnected or closed while dialing.
+		_ = con.Close()
+		err = ErrClosed
+	}
+
+	if err == nil {
+		err = ctx.Err()
+		if err != nil {
+			_ = con.Close()
+		}
 	}
 
 	if err != nil {
-		return err
+		if c.state == StateConnecting && c.reconnectCancel == nil {
+			c.setState(StateDisconnected, err)
+		}
+		return false, err
 	}
 
+	if c.term.bound && !c.handover {
+		c.term = newTermination()
+	}
+	c.term.bound = true
+	c.handover = false
+
 	ctx, cancel := context.WithCancel(context.Background())
 	c.con = con
 	c.cancel = cancel
+	c.queue = newSendQueue(c.sendQueueSize)
+	c.reconnectCancel = nil
+	c.setState(StateConnected, nil)
+	close(c.up)
+
+	c.stats.connected(con.RemoteAddr().String(), time.Now())
+	if c.metrics != nil {
+		c.metrics.Connected()
+	}
+
+	c.wg.Add(2)
+	go c.readLoop(ctx, con, c.term)
+	go c.writeLoop(ctx, con, c.queue)
+
+	return true, nil
+}
+
+// parseURL parses the URL of a router and checks that its scheme is supported.
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "unix", "tcp", "mem":
+	default:
+		return nil, fmt.Errorf("%w: unsupported URL scheme", ErrInvalidInput)
+	}
+
+	return u, nil
+}
+
+// dial opens the network connection to the server.  The URLs are tried in
+// order, starting with the one that last succeeded.  When all of them fail,
+// the errors of each attempt are joined.
+func (c *Connection) dial(ctx context.Context) (net.Conn, error) {
+	if len(c.urls) == 1 {
+		return c.dialURL(ctx, c.urls[0])
+	}
 
-	// TODO: check if this is needed
-	// inboxName := fmt.Sprintf("%s.INBOX.%d", c.appName, os.Getpid())
-	// c.AddListener(inboxName)
+	c.m.Lock()
+	preferred := c.preferred
+	c.m.Unlock()
+
+	var errs []error
+	for i := range c.urls {
+		n := (preferred + i) % len(c.urls)
+		con, err := c.dialURL(ctx, c.urls[n])
+		if err == nil {
+			c.m.Lock()
+			c.preferred = n
+			c.m.Unlock()
+			return con, nil
+		}
 
-	go c.readLoop(ctx)
+		errs = append(errs, fmt.Errorf("%s: %w", c.urls[n], err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// dialURL opens the network connection to a single URL, bounded by the
+// connect timeout and the context, whichever ends sooner.
+func (c *Connection) dialURL(ctx context.Context, u *url.URL) (net.Conn, error) {
+	if c.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.connectTimeout)
+		defer cancel()
+	}
+
+	address := u.Host
+	switch u.Scheme {
+	case "unix":
+		address = u.Path
+	case "mem":
+		return dialMem(ctx, address)
+	}
+
+	d := net.Dialer{KeepAlive: c.keepAlive}
+	con, err := d.DialContext(ctx, u.Scheme, address)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
 
-	return nil
+	return con, err
 }
 
-// Disconnect closes the connection to the server.
+// Disconnect closes the connection to the server and stops any reconnect
+// attempts.  Pending requests fail with ErrClosed.  Closing the socket on
+// purpose is not reported to the ReadErrorListeners.  The connection may be
+// connected again afterwards.
 func (c *Connection) Disconnect() error {
+	err := c.disconnect()
+	c.pending.failAll(ErrClosed, false)
+	return err
+}
+
+func (c *Connection) disconnect() error {
 	c.m.Lock()
 	defer c.m.Unlock()
 
+	if c.reconnectCancel != nil {
+		c.reconnectCancel()
+		c.reconnectCancel = nil
+	}
+
+	if c.handover {
+		// There is no read loop left to signal the end.
+		c.term.finish(nil)
+		c.handover = false
+	}
+
+	if !c.closed {
+		c.setState(StateDisconnected, nil)
+	}
+
 	if c.con == nil {
 		return nil
 	}
 
 	c.cancel()
 	err := c.con.Close()
+	c.down()
+
+	return err
+}
+
+// Close disconnects and releases the connection for good: it waits for the
+// background goroutines to exit and fails pending and future requests with
+// ErrClosed.  It must not be called from a listener.
+func (c *Connection) Close() error {
+	c.m.Lock()
+	c.closed = true
+	c.setState(StateClosing, nil)
+	c.m.Unlock()
+
+	err := c.disconnect()
+	c.pending.failAll(ErrClosed, true)
+	c.stop()
+	c.wg.Wait()
+
+	c.m.Lock()
+	c.setState(StateClosed, nil)
+	c.m.Unlock()
+
+	return err
+}
+
+// State returns the current state of the connection.
+func (c *Connection) State() State {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.state
+}
+
+// Connected reports if the connection to the server is currently up.
+func (c *Connection) Connected() bool {
+	return c.State() == StateConnected
+}
+
+// down forgets the current connection.  The caller must hold the lock.
+func (c *Connection) down() {
 	c.con = nil
 	c.cancel = nil
+	c.queue = nil
+	c.up = make(chan struct{})
+	c.stats.disconnected()
+}
 
-	return err
+// connectionLost tears down a connection the read loop failed on and, when
+// enabled, starts reconnecting.  The pending requests fail with
+// ErrConnectionClosed, as their responses can't arrive over another
+// connection.  Unless reconnecting, the termination of the connection is
+// signaled with the cause.
+func (c *Connection) connectionLost(con net.Conn, t *termination, cause error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.con != con {
+		// Already replaced or disconnected on purpose.
+		t.finish(nil)
+		return
+	}
+
+	c.logger.Warn("connection lost", "inbox", c.inbox, "error", cause)
+
+	c.cancel()
+	_ = con.Close()
+	c.down()
+	c.pending.failAll(ErrConnectionClosed, false)
+
+	if c.closed {
+		t.finish(nil)
+		return
+	}
+
+	c.setState(StateDisconnected, cause)
+	if c.reconnect == nil {
+		t.finish(cause)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.reconnectCancel = cancel
+	c.setState(StateConnecting, cause)
+	c.handover = true
+
+	c.wg.Add(1)
+	go c.reconnectLoop(ctx)
+}
+
+// termination signals the end of a connection.  Connections reestablished by
+// the reconnect loop share the termination of the one that was lost.
+type termination struct {
+	done   chan struct{}
+	err    error
+	bound  bool
+	closed bool
+}
+
+func newTermination() *termination {
+	return &termination{done: make(chan struct{})}
+}
+
+// finish records the cause and closes the done channel.  The connection lock
+// must be held.
+func (t *termination) finish(err error) {
+	if t.closed {
+		return
+	}
+
+	t.err = err
+	t.closed = true
+	close(t.done)
 }
 
+// Done returns a channel that is closed once the connection has shut down for
+// good: the read loop has exited and the socket is closed, whether because of
+// Disconnect, Close or a fatal read error that is not followed by
+// reconnecting.  Called before Connect, the channel belongs to the connection
+// that Connect will establish.
+func (c *Connection) Done() <-chan struct{} {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.term.done
+}
+
+// Err returns the error that ended the connection, or nil when it ended on
+// purpose or has not ended.
+func (c *Connection) Err() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.term.err
+}
+
+// upSignal returns a channel that is closed once the connection is up, and
+// whether it is worth waiting on: either connected or reconnecting.
+func (c *Connection) upSignal() (<-chan struct{}, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.up, c.con != nil || c.reconnectCancel != nil
+}
+
+// Add registers the listener and subscribes to the expression.  Listeners
+// receive every message routed to the connection, not only those matching
+// their own expression.  The subscription is dropped once every listener
+// added for it has been canceled, unless it was made with Subscribe or
+// WithSubscription.
 func (c *Connection) Add(listener MessageListener, expression string) (CancelListenerFunc, error) {
+	if err := validateExpression(expression); err != nil {
+		return nil, err
+	}
+
+	if err := c.acquire(expression, false); err != nil {
+		return nil, err
+	}
+
+	cancel := c.listeners.Add(listener)
+	c.stats.subscriptions.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			c.release(expression)
+			c.stats.subscriptions.Add(-1)
+		})
+	}, nil
+}
+
+// subscribe asks the router to route messages matching the expression to this
+// connection, or to stop doing so.
+func (c *Connection) subscribe(ctx context.Context, expression string, routeID int, add bool) error {
 	req := subscriptionRequest{
 		Topic:   expression,
-		Add:     1,
-		RouteID: c.generator.getNextSubscriptionID(),
+		RouteID: routeID,
+	}
+	if add {
+		req.Add = 1
 	}
 
 	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if err := c.Send(context.Background(), jsonData, "_RTROUTED.INBOX.SUBSCRIBE"); err != nil {
-		return nil, err
-	}
+	ctx, cancel := c.withRequestTimeout(ctx)
+	defer cancel()
 
-	// TODO: you need to associate this listener with the req.RouteID
-	return CancelListenerFunc(c.listeners.Add(listener)), nil
+	return c.Send(ctx, jsonData, subscribeTopic)
 }
 
-func sendAll(ctx context.Context, conn net.Conn, buff []byte) error {
-	total := len(buff)
-	sent := 0
+// withRequestTimeout derives a context bounded by the configured request
+// timeout when the caller's context has no deadline of its own.
+func (c *Connection) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
 
-	for sent < total {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			n, err := conn.Write(buff[sent:])
-			if err != nil {
-				return err
-			}
-			sent += n
-		}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
 	}
 
-	return nil
+	return context.WithTimeout(ctx, c.requestTimeout)
 }
 
-func (c *Connection) makeEncodedHeader(payload []byte, topic string, replyTopic string) ([]byte, error) {
-	topicLength := len(topic)
-	replyTopicLength := 0
-	sizeWithoutStringsInBytes := 32
-	sizeWithoutStringsInBytes += 20 // 4 time_t fields
-
-	header := Header{
-		Version:        2,
-		HeaderLength:   uint16(sizeWithoutStringsInBytes + topicLength + replyTopicLength),
+// newMessage creates a message for the topic with the next sequence number.
+func (c *Connection) newMessage(payload []byte, topic string, replyTopic string, flags uint32) Message {
+	h := Header{
+		Version:        header_VERSION,
 		SequenceNumber: uint32(c.generator.getNextSubscriptionID()),
-		Flags:          0,
-		ControlData:    0,
-		PayloadLength:  uint32(len(payload)),
+		Flags:          flags,
 		Topic:          topic,
 		ReplyTopic:     replyTopic,
 	}
+	c.markOwn(&h)
 
-	encodedHeader, err := header.encode()
-	if err != nil {
-		return nil, err
+	return Message{
+		Header:  &h,
+		Payload: payload,
 	}
+}
 
-	return encodedHeader, nil
+// markOwn sets the reply topic of a published message to the inbox when
+// WithIgnoreSelf is enabled, so the message can be recognized when the
+// router delivers it back to this connection.
+func (c *Connection) markOwn(h *Header) {
+	if c.ignoreSelf && h.ReplyTopic == "" && h.Flags&(FLAGS_REQUEST|FLAGS_RESPONSE) == 0 {
+		h.ReplyTopic = c.inbox
+	}
+}
+
+// own reports if the message is one this connection published itself.
+// Requests and messages addressed to the inbox are never considered its own.
+func (c *Connection) own(msg Message) bool {
+	return c.ignoreSelf && msg.Type() == MsgTypeMessage &&
+		msg.Header.ReplyTopic == c.inbox && msg.Header.Topic != c.inbox
+}
+
+// marshal encodes the message in the header form selected for the
+// connection.
+func (c *Connection) marshal(msg *Message) ([]byte, error) {
+	if c.maxMessageSize > 0 && msg.Header != nil {
+		size := header_MIN + len(msg.Header.Topic) + len(msg.Header.ReplyTopic) + len(msg.Payload)
+		if !c.compact {
+			size += header_TIMESTAMPS_LEN
+		}
+		if size > c.maxMessageSize {
+			return nil, fmt.Errorf("%w: sending %d bytes on '%s', the limit is %d",
+				ErrMessageTooLarge, size, msg.Header.Topic, c.maxMessageSize)
+		}
+	}
+	return msg.marshal(c.compact)
 }
 
 // Send sends a message to the server.  If the context is canceled, the function
-// will return immediately with the context error.
+// will return immediately with the context error.  When there is no connection
+// the error matches ErrNotConnected, and errors writing to the router match
+// ErrConnectionClosed while wrapping the cause, so it can still be inspected
+// with errors.Is and errors.As.
 func (c *Connection) Send(ctx context.Context, payload []byte, topic string) error {
-	encodedHeader, err := c.makeEncodedHeader(payload, topic, "")
+	return c.sendMessage(ctx, c.newMessage(payload, topic, "", 0))
+}
+
+// SendBinary sends a raw binary payload, flagged as such so the receiver
+// doesn't try to decode it as msgpack.
+func (c *Connection) SendBinary(ctx context.Context, payload []byte, topic string) error {
+	return c.SendPayload(ctx, payload, topic, PayloadTypeBinary)
+}
+
+// SendMsgPack sends a msgpack encoded payload, which is what the receiver
+// expects of a message that isn't flagged as raw binary.
+func (c *Connection) SendMsgPack(ctx context.Context, payload []byte, topic string) error {
+	return c.SendPayload(ctx, payload, topic, PayloadTypeMsgpack)
+}
+
+// SendPayload sends the payload flagged with its type.  PayloadTypeUnknown is
+// only accepted for an empty payload, as the receiver couldn't tell how to
+// decode any other; the error then matches ErrUnknownPayloadType.
+func (c *Connection) SendPayload(ctx context.Context, payload []byte, topic string, t PayloadType) error {
+	flags, err := payloadFlags(t, payload)
 	if err != nil {
 		return err
 	}
 
-	return c.sendWithHeader(ctx, encodedHeader, payload)
+	return c.sendMessage(ctx, c.newMessage(payload, topic, "", flags))
 }
 
-func (c *Connection) sendWithHeader(ctx context.Context, header []byte, payload []byte) error {
-	c.m.Lock()
-	defer c.m.Unlock()
-
-	if c.con == nil {
-		return ErrInvalidState
+// payloadFlags returns the flags marking a payload of the type.
+func payloadFlags(t PayloadType, payload []byte) (uint32, error) {
+	switch {
+	case t == PayloadTypeBinary:
+		return FLAGS_RAW_BINARY, nil
+	case t == PayloadTypeMsgpack, t == PayloadTypeUnknown && len(payload) == 0:
+		return 0, nil
 	}
 
-	if err := sendAll(ctx, c.con, header); err != nil {
-		return err
-	}
+	return 0, fmt.Errorf("%w: %s for %d bytes of payload", ErrUnknownPayloadType, t, len(payload))
+}
 
-	if err := sendAll(ctx, c.con, payload); err != nil {
-		return err
-	}
+// readLoop reads messages from the server and sends events to registered listeners.
+func (c *Connection) readLoop(ctx context.Context, con net.Conn, t *termination) {
+	defer c.wg.Done()
+
+	d := c.newDispatcher()
+	defer d.stop()
 
-	return nil
+	err := c.readMessages(ctx, con, d)
+	c.connectionLost(con, t, err)
 }
 
-func (c *Connection) readUntil(ctx context.Context, buf []byte) error {
-	total := len(buf)
-	read := 0
+// readMessages handles the messages from the server until the connection is
+// torn down, returning the fatal error if it wasn't on purpose.
+func (c *Connection) readMessages(ctx context.Context, con net.Conn, d *dispatcher) error {
+	r := countingReader{r: con}
+	mr := messageReader{r: &r, limit: c.maxMessageSize}
+	idle := 0
+	for {
+		if c.readTimeout > 0 {
+			if err := con.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
 
-	for read < total {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			n, err := c.con.Read(buf[read:])
-			if err != nil {
+				err = classifyReadError(err, false)
+				c.readError(err)
 				return err
 			}
-			read += n
 		}
-	}
-
-	return nil
-}
 
-// readLoop reads messages from the server and sends events to registered listeners.
-func (c *Connection) readLoop(ctx context.Context) {
-	var header *Header
+		r.n = 0
+		msg, err := mr.next()
+		if err != nil {
+			if ctx.Err() != nil {
+				// Disconnected on purpose, which closed the socket.
+				return nil
+			}
 
-	const headerPreambleLength = uint16(6)
+			err = classifyReadError(err, r.n > 0)
+			c.readError(err)
+			if fatalReadError(err) {
+				return err
+			}
+			if errors.Is(err, ErrIdleTimeout) {
+				idle++
+				if c.idlePolicy.MaxIdle > 0 && idle >= c.idlePolicy.MaxIdle {
+					err = fmt.Errorf("%w: no message within %d read timeouts", ErrConnectionClosed, idle)
+					c.readError(err)
+					return err
+				}
+			}
+			continue
+		}
+		idle = 0
 
-	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
-			switch c.state {
-			case ReadStateReadHeaderPreamble:
-				header = &Header{}
-				buff := make([]byte, headerPreambleLength)
-
-				if err := c.readUntil(ctx, buff); err != nil {
-					fmt.Printf("Failed to read header preamble: %v\n", err)
-					return
-				}
+		}
 
-				if err := header.decodePreamble(buff); err != nil {
-					fmt.Printf("Failed to decode header preamble: %v\n", err)
-					return
-				}
+		c.stats.received(int(msg.Header.HeaderLength)+len(msg.Payload), time.Now())
+		if c.metrics != nil {
+			c.metrics.MessageReceived(msg.Header.Topic, int(msg.Header.HeaderLength)+len(msg.Payload))
+			if msg.Header.Flags&FLAGS_UNDELIVERABLE != 0 {
+				c.metrics.Undeliverable(msg.Header.Topic)
+			}
+		}
 
-				c.state = ReadStateReadHeader
+		c.trackSequence(msg)
 
-			case ReadStateReadHeader:
-				buff := make([]byte, header.HeaderLength-headerPreambleLength)
+		if c.latency != nil {
+			if d, ok := msg.TransitLatency(); ok {
+				c.latency(msg.Header.Topic, d)
+			}
+		}
 
-				if err := c.readUntil(ctx, buff); err != nil {
-					fmt.Printf("Failed to read header: %v\n", err)
-					return
-				}
+		if c.dedup != nil && c.dedup.duplicate(msg.Header, time.Now()) {
+			if c.metrics != nil {
+				c.metrics.Duplicate(msg.Header.Topic)
+			}
+			continue
+		}
 
-				if err := header.decodePostPreamble(buff); err != nil {
-					fmt.Printf("Failed to decode header: %v\n", err)
-					return
-				}
+		if msg.Header.Flags&(FLAGS_RESPONSE|FLAGS_UNDELIVERABLE) != 0 &&
+			c.pending.resolve(msg.Header.SequenceNumber, msg) {
+			continue
+		}
 
-				c.state = ReadStateReadPayload
+		// A response nobody waits for anymore must not reach the
+		// listeners, which would take it for a message of their own.
+		if msg.Header.Flags&FLAGS_RESPONSE != 0 {
+			c.stats.lateResponses.Add(1)
+			c.logger.Debug("late response", "topic", msg.Header.Topic, "sequence", msg.Header.SequenceNumber)
+			if msg.Header.Flags&FLAGS_UNDELIVERABLE == 0 {
+				continue
+			}
+		}
 
-			case ReadStateReadPayload:
-				buff := make([]byte, header.PayloadLength)
-				if err := c.readUntil(ctx, buff); err != nil {
-					fmt.Printf("Failed to read payload: %v\n", err)
-					return
-				}
+		if c.own(msg) {
+			c.stats.ignoredSelf.Add(1)
+			continue
+		}
 
-				c.listeners.Visit(func(listener MessageListener) {
-					listener.OnMessage(Message{
-						Header:  header,
-						Payload: buff,
-					})
-				})
+		if msg.Header.Flags&FLAGS_UNDELIVERABLE != 0 {
+			c.undeliverableListeners.Visit(func(listener MessageListener) {
+				listener.OnMessage(msg)
+			})
+			continue
+		}
 
-				c.state = ReadStateReadHeaderPreamble
+		if c.advisory != nil && msg.Header.Topic == AdvisoryTopic {
+			a, err := decodeAdvisory(msg.Payload)
+			if err != nil {
+				c.readError(err)
+				continue
 			}
+			c.advisory.OnAdvisory(a)
 		}
+
+		c.dispatch(d, msg)
 	}
 }
+
+// Inbox returns the topic of the connection's inbox, which responses and
+// messages addressed to the connection are sent to.  The connection is always
+// subscribed to it.
+func (c *Connection) Inbox() string {
+	return c.inbox
+}
+
+// AddInboxListener registers a listener for the messages sent to the inbox
+// that don't belong to a pending Request.  Unlike Add, it doesn't subscribe to
+// anything.
+func (c *Connection) AddInboxListener(listener MessageListener) CancelListenerFunc {
+	return CancelListenerFunc(c.listeners.Add(MessageListenerFunc(func(msg Message) {
+		if msg.Header.Topic == c.inbox {
+			listener.OnMessage(msg)
+		}
+	})))
+}
+
+// AddUndeliverableListener registers a listener for the messages the router
+// turned around as undeliverable that don't belong to a pending Request.  The
+// message is the one the router returned, so its topic is the reply topic of
+// the message sent.  These messages are not delivered to other listeners.
+func (c *Connection) AddUndeliverableListener(listener MessageListener) CancelListenerFunc {
+	return CancelListenerFunc(c.undeliverableListeners.Add(listener))
+}
+
+// AddReconnectListener registers a listener called each time automatic
+// reconnecting has reestablished the connection and restored its
+// subscriptions.  It's called from the reconnecting goroutine, so it may make
+// requests.
+func (c *Connection) AddReconnectListener(listener ReconnectListener) CancelListenerFunc {
+	return CancelListenerFunc(c.reconnectListeners.Add(listener))
+}
+
+// AddReadErrorListener registers a listener for the errors encountered while
+// reading from the server.
+func (c *Connection) AddReadErrorListener(listener ReadErrorListener) CancelListenerFunc {
+	return CancelListenerFunc(c.errListeners.Add(listener))
+}
+
+// readError reports a failure of the read loop to the logger and the error
+// listeners.
+func (c *Connection) readError(err error) {
+	c.stats.readError(err)
+	if c.metrics != nil {
+		c.metrics.ReadError(err)
+	}
+
+	c.logger.Warn("read error", "inbox", c.inbox, "error", err)
+	c.errListeners.Visit(func(listener ReadErrorListener) {
+		listener.OnReadError(err)
+	})
+}
@@ -0,0 +1,567 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRouters numbers the routers of the tests, whose names must differ.
+var testRouters atomic.Int64
+
+// newTestRouter starts a MemRouter closed at the end of the test, returning
+// it with the URL to connect to it.
+func newTestRouter(t *testing.T) (*MemRouter, string) {
+	t.Helper()
+
+	name := fmt.Sprintf("test-router-%d", testRouters.Add(1))
+	r, err := NewMemRouter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	return r, "mem://" + name
+}
+
+// newTestConnection connects to the URL with the inbox, closing the
+// connection at the end of the test.
+func newTestConnection(t *testing.T, url, inbox string, opts ...Option) *Connection {
+	t.Helper()
+
+	c, err := New(url, "test", append([]Option{WithInbox(inbox)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// subscribe subscribes the connection to the expression, returning a channel
+// of the messages it receives once the router has the route.
+func subscribe(t *testing.T, r *MemRouter, c *Connection, expression string) <-chan Message {
+	t.Helper()
+
+	ch, cancel := c.Messages(100, QueueBlock)
+	t.Cleanup(cancel)
+
+	before := routes(r, expression)
+	if err := c.Subscribe(expression); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the route to "+expression, func() bool {
+		return routes(r, expression) > before
+	})
+
+	return ch
+}
+
+// routes returns the number of routes the router has for the expression.
+func routes(r *MemRouter, expression string) int {
+	n := 0
+	for _, s := range r.Subscriptions() {
+		if s == expression {
+			n++
+		}
+	}
+	return n
+}
+
+// receive returns the next message of the channel, failing the test if none
+// arrives in time.
+func receive(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return Message{}
+}
+
+// nothingReceived fails the test if a message arrives on the channel within
+// the wait.
+func nothingReceived(t *testing.T, ch <-chan Message, wait time.Duration) {
+	t.Helper()
+
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message %v", msg)
+	case <-time.After(wait):
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		option   time.Duration
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{name: "option only", option: 50 * time.Millisecond, want: 50 * time.Millisecond},
+		{name: "caller deadline sooner", option: time.Minute, deadline: 50 * time.Millisecond, want: 50 * time.Millisecond},
+		{name: "caller deadline later", option: 10 * time.Millisecond, deadline: 200 * time.Millisecond, want: 200 * time.Millisecond},
+		{name: "caller deadline only", deadline: 50 * time.Millisecond, want: 50 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, url := newTestRouter(t)
+			c := newTestConnection(t, url, "test.INBOX", WithRequestTimeout(tc.option))
+
+			// Requests to the topic come back to the connection, which
+			// never answers them.
+			if err := c.Subscribe("Test.Unanswered"); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if tc.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.deadline)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err := c.Request(ctx, []byte("ping"), "Test.Unanswered")
+			took := time.Since(start)
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+			}
+			if took < tc.want || took > tc.want+time.Second {
+				t.Fatalf("gave up after %v, want %v", took, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutZeroIsUnbounded(t *testing.T) {
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	if err := c.Subscribe("Test.Unanswered"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Request(ctx, []byte("ping"), "Test.Unanswered")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("request ended without a deadline: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRequestTimeoutNegative(t *testing.T) {
+	if _, err := New("mem://x", "test", WithRequestTimeout(-time.Second)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	_, memURL := newTestRouter(t)
+	tcpURL, _ := rawRouter(t)
+
+	// The routers are there, but the timeout is over before they can be
+	// reached, whatever the scheme.
+	for _, url := range []string{memURL, tcpURL} {
+		c, err := New(url, "test", WithConnectTimeout(time.Nanosecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		if err := c.Connect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%s: got %v, want %v", url, err, context.DeadlineExceeded)
+		}
+		if c.Connected() {
+			t.Fatalf("%s: connected", url)
+		}
+	}
+
+	// It bounds each attempt.
+	c, err := New(memURL, "test", WithFallbackURLs(tcpURL), WithConnectTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Connect(context.Background())
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("got %v, want the errors of both attempts", err)
+	}
+	for _, err := range joined.Unwrap() {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	}
+
+	// One long enough connects.
+	newTestConnection(t, tcpURL, "test.INBOX", WithConnectTimeout(5*time.Second))
+}
+
+func TestConnectTimeoutNegative(t *testing.T) {
+	if _, err := New("mem://x", "test", WithConnectTimeout(-time.Second)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+// closed reports if the channel is closed, waiting a little for it to be.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestDone(t *testing.T) {
+	_, url := newTestRouter(t)
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Before Connect, the channel is that of the connection to come.
+	done := c.Done()
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Done() != done {
+		t.Fatal("Connect replaced the channel")
+	}
+	select {
+	case <-done:
+		t.Fatal("closed while connected")
+	default:
+	}
+
+	for range 2 {
+		if err := c.Disconnect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !closed(done) {
+		t.Fatal("not closed by Disconnect")
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("got %v after Disconnect", err)
+	}
+
+	// Connecting again brings a new channel.
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	again := c.Done()
+	if again == done {
+		t.Fatal("same channel for the new connection")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !closed(again) {
+		t.Fatal("not closed by Close")
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("got %v after Close", err)
+	}
+}
+
+func TestDoneWithoutConnect(t *testing.T) {
+	c, err := New("mem://x", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := c.Done()
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("closed without a connection")
+	default:
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoneAfterReadError(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	done := c.Done()
+	r.DropConnections()
+
+	if !closed(done) {
+		t.Fatal("not closed by the read error")
+	}
+	if !errors.Is(c.Err(), ErrConnectionClosed) {
+		t.Fatalf("got %v, want %v", c.Err(), ErrConnectionClosed)
+	}
+}
+
+func TestDoneReconnecting(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX", WithAutoReconnect(time.Millisecond, time.Millisecond))
+
+	done := c.Done()
+	states, cancel := recordStates(c)
+	defer cancel()
+
+	// A connection reestablished by reconnecting is the same connection.
+	r.DropConnections()
+	expectStates(t, states, StateDisconnected, StateConnecting, StateConnected)
+	if c.Done() != done {
+		t.Fatal("reconnecting replaced the channel")
+	}
+	select {
+	case <-done:
+		t.Fatal("closed by a connection that was reestablished")
+	default:
+	}
+
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if !closed(done) {
+		t.Fatal("not closed by Disconnect")
+	}
+}
+
+func TestMaxMessageSizeSend(t *testing.T) {
+	_, url := newTestRouter(t)
+
+	const limit = 200
+	c := newTestConnection(t, url, "test.INBOX", WithMaxMessageSize(limit))
+
+	topic := "Test.Event"
+	atLimit := make([]byte, limit-header_MIN-header_TIMESTAMPS_LEN-len(topic))
+
+	if err := c.Send(context.Background(), atLimit, topic); err != nil {
+		t.Fatalf("at the limit: %v", err)
+	}
+
+	err := c.Send(context.Background(), append(atLimit, 0), topic)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+	if want := "sending 201 bytes on 'Test.Event', the limit is 200"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %q, want it to contain %q", err, want)
+	}
+
+	// The reply topic counts as well.
+	if _, err := c.Request(context.Background(), atLimit, topic); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+	if err := c.SendAsync(Message{Header: &Header{Topic: topic}, Payload: append(atLimit, 0)}); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+func TestMaxMessageSizeReceive(t *testing.T) {
+	r, url := newTestRouter(t)
+
+	const limit = 200
+	c := newTestConnection(t, url, "test.INBOX", WithMaxMessageSize(limit))
+	errs := readErrors(c)
+	ch := subscribe(t, r, c, "Test.Event")
+
+	topic := "Test.Event"
+	atLimit := make([]byte, limit-header_MIN-header_TIMESTAMPS_LEN-len(topic))
+
+	for _, payload := range [][]byte{append(atLimit, 0), atLimit} {
+		if err := r.Inject(Message{Header: &Header{Topic: topic}, Payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The message over the limit is skipped, and the connection carries on
+	// with the next.
+	err := nextReadError(t, errs)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+	if want := "received 201 bytes on 'Test.Event', the limit is 200"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %q, want it to contain %q", err, want)
+	}
+
+	if got := receive(t, ch); len(got.Payload) != len(atLimit) {
+		t.Fatalf("got %d bytes of payload, want %d", len(got.Payload), len(atLimit))
+	}
+	if !c.Connected() {
+		t.Fatal("not connected")
+	}
+}
+
+func TestMaxMessageSizeNegative(t *testing.T) {
+	if _, err := New("mem://x", "test", WithMaxMessageSize(-1)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestSendPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		send    func(c *Connection, payload []byte) error
+		payload []byte
+		want    PayloadType
+		err     error
+	}{
+		{
+			name:    "binary",
+			send:    func(c *Connection, p []byte) error { return c.SendBinary(context.Background(), p, "Test.Event") },
+			payload: []byte{0, 1, 2},
+			want:    PayloadTypeBinary,
+		}, {
+			name:    "msgpack",
+			send:    func(c *Connection, p []byte) error { return c.SendMsgPack(context.Background(), p, "Test.Event") },
+			payload: []byte{0xa2, 'h', 'i'},
+			want:    PayloadTypeMsgpack,
+		}, {
+			name: "unknown without payload",
+			send: func(c *Connection, p []byte) error {
+				return c.SendPayload(context.Background(), p, "Test.Event", PayloadTypeUnknown)
+			},
+			want: PayloadTypeMsgpack,
+		}, {
+			name: "unknown with payload",
+			send: func(c *Connection, p []byte) error {
+				return c.SendPayload(context.Background(), p, "Test.Event", PayloadTypeUnknown)
+			},
+			payload: []byte("ambiguous"),
+			err:     ErrUnknownPayloadType,
+		}, {
+			name: "invalid type",
+			send: func(c *Connection, p []byte) error {
+				return c.SendPayload(context.Background(), p, "Test.Event", PayloadType(42))
+			},
+			payload: []byte("ambiguous"),
+			err:     ErrUnknownPayloadType,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, url := newTestRouter(t)
+			c := newTestConnection(t, url, "test.INBOX")
+
+			err := tc.send(c, tc.payload)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) || !errors.Is(err, ErrInvalidInput) {
+					t.Fatalf("got %v, want %v", err, tc.err)
+				}
+
+				// Nothing reached the wire.
+				time.Sleep(50 * time.Millisecond)
+				if msgs := r.Messages(); len(msgs) != 0 {
+					t.Fatalf("sent %v", msgs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var msgs []Message
+			eventually(t, "the message", func() bool {
+				msgs = r.Messages()
+				return len(msgs) > 0
+			})
+			if got := msgs[0].PayloadType(); got != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+			if string(msgs[0].Payload) != string(tc.payload) {
+				t.Fatalf("got %q, want %q", msgs[0].Payload, tc.payload)
+			}
+		})
+	}
+}
+
+func TestUndeliverableListener(t *testing.T) {
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	messages, stop := c.Messages(10, QueueReject)
+	t.Cleanup(stop)
+
+	listener := func() (<-chan Message, CancelListenerFunc) {
+		ch := make(chan Message, 10)
+		return ch, c.AddUndeliverableListener(MessageListenerFunc(func(msg Message) { ch <- msg }))
+	}
+	first, cancel := listener()
+
+	// A request nobody is subscribed to, sent without waiting for its
+	// response, is turned around by the router without its payload.
+	request := func(seq uint32) {
+		t.Helper()
+		err := c.SendAsync(Message{
+			Header: &Header{
+				SequenceNumber: seq,
+				Flags:          FLAGS_REQUEST,
+				Topic:          "Device.Nobody",
+				ReplyTopic:     c.Inbox(),
+			},
+			Payload: []byte("hello"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request(7)
+
+	msg := receive(t, first)
+	if msg.Header.SequenceNumber != 7 || msg.Header.Topic != c.Inbox() {
+		t.Fatalf("got %d on %s, want 7 on %s", msg.Header.SequenceNumber, msg.Header.Topic, c.Inbox())
+	}
+	if want := uint32(FLAGS_RESPONSE | FLAGS_UNDELIVERABLE); msg.Header.Flags&want != want || len(msg.Payload) != 0 {
+		t.Fatalf("got flags %#x and payload %q, want %#x and none", msg.Header.Flags, msg.Payload, want)
+	}
+
+	// Once canceled the listener isn't called, while another still is.
+	cancel()
+	second, _ := listener()
+	request(8)
+
+	if msg := receive(t, second); msg.Header.SequenceNumber != 8 {
+		t.Fatalf("got %d, want 8", msg.Header.SequenceNumber)
+	}
+	nothingReceived(t, first, 20*time.Millisecond)
+
+	// Nor do the other listeners get them.
+	nothingReceived(t, messages, 20*time.Millisecond)
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"sync"
+	"time"
+)
+
+// dedupMaxEntries bounds the memory used by the dedup window regardless of
+// how busy the connection is.  When the limit is reached the oldest entries
+// are forgotten early.
+const dedupMaxEntries = 4096
+
+type dedupKey struct {
+	topic string
+	seq   uint32
+}
+
+type dedupEntry struct {
+	key  dedupKey
+	seen time.Time
+}
+
+// dedupWindow remembers the (topic, sequence number) pairs seen recently so
+// that a message delivered twice within the window can be dropped.
+type dedupWindow struct {
+	m      sync.Mutex
+	window time.Duration
+	seen   map[dedupKey]time.Time
+	order  []dedupEntry
+}
+
+func newDedupWindow(window time.Duration) *dedupWindow {
+	return &dedupWindow{
+		window: window,
+		seen:   make(map[dedupKey]time.Time),
+	}
+}
+
+// duplicate records the message and reports whether it was already seen
+// within the window.
+func (d *dedupWindow) duplicate(h *Header, now time.Time) bool {
+	key := dedupKey{topic: h.Topic, seq: h.SequenceNumber}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.expire(now)
+
+	if _, found := d.seen[key]; found {
+		return true
+	}
+
+	if len(d.order) >= dedupMaxEntries {
+		d.evict()
+	}
+
+	d.seen[key] = now
+	d.order = append(d.order, dedupEntry{key: key, seen: now})
+
+	return false
+}
+
+// expire forgets the entries that have fallen out of the window.
+func (d *dedupWindow) expire(now time.Time) {
+	cutoff := now.Add(-d.window)
+	for len(d.order) > 0 && !d.order[0].seen.After(cutoff) {
+		d.evict()
+	}
+}
+
+// evict forgets the oldest entry.
+func (d *dedupWindow) evict() {
+	delete(d.seen, d.order[0].key)
+	d.order[0] = dedupEntry{}
+	d.order = d.order[1:]
+}
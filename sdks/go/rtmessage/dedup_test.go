@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDedupWindow(t *testing.T) {
+	d := newDedupWindow(time.Second)
+	now := time.Now()
+
+	a := &Header{Topic: "A", SequenceNumber: 1}
+	if d.duplicate(a, now) {
+		t.Fatal("first delivery taken for a duplicate")
+	}
+	if !d.duplicate(a, now.Add(time.Second/2)) {
+		t.Fatal("second delivery within the window not detected")
+	}
+
+	// The same sequence number on another topic is another message.
+	if d.duplicate(&Header{Topic: "B", SequenceNumber: 1}, now) {
+		t.Fatal("other topic taken for a duplicate")
+	}
+
+	// Past the window the message is forgotten.
+	if d.duplicate(a, now.Add(2*time.Second)) {
+		t.Fatal("delivery after the window taken for a duplicate")
+	}
+}
+
+func TestDedupWindowBounded(t *testing.T) {
+	d := newDedupWindow(time.Hour)
+	now := time.Now()
+
+	for i := range 2 * dedupMaxEntries {
+		d.duplicate(&Header{Topic: "A", SequenceNumber: uint32(i)}, now)
+	}
+	if len(d.seen) != dedupMaxEntries || len(d.order) != dedupMaxEntries {
+		t.Fatalf("remembers %d, %d entries, want %d", len(d.seen), len(d.order), dedupMaxEntries)
+	}
+
+	// The oldest were forgotten early, the newest are still known.
+	if d.duplicate(&Header{Topic: "A", SequenceNumber: 0}, now) {
+		t.Fatal("evicted entry taken for a duplicate")
+	}
+	if !d.duplicate(&Header{Topic: "A", SequenceNumber: 2*dedupMaxEntries - 1}, now) {
+		t.Fatal("recent entry forgotten")
+	}
+}
+
+func TestDedup(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		name := "disabled"
+		if enabled {
+			name = "enabled"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			r, url := newTestRouter(t)
+
+			counters := new(Counters)
+			opts := []Option{WithMetrics(counters)}
+			if enabled {
+				opts = append(opts, WithDedup(time.Minute))
+			}
+			c := newTestConnection(t, url, "test.INBOX", opts...)
+			ch := subscribe(t, r, c, "Test.Event")
+
+			msg := Message{
+				Header:  &Header{SequenceNumber: 42, Topic: "Test.Event"},
+				Payload: []byte("once"),
+			}
+			for range 2 {
+				if err := r.Inject(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := receive(t, ch); string(got.Payload) != "once" {
+				t.Fatalf("got %q", got.Payload)
+			}
+
+			if enabled {
+				nothingReceived(t, ch, 100*time.Millisecond)
+				if n := counters.Duplicates.Load(); n != 1 {
+					t.Fatalf("counted %d duplicates, want 1", n)
+				}
+				return
+			}
+
+			receive(t, ch)
+			if n := counters.Duplicates.Load(); n != 0 {
+				t.Fatalf("counted %d duplicates, want 0", n)
+			}
+		})
+	}
+}
+
+func TestDedupNegative(t *testing.T) {
+	if _, err := New("mem://x", "test", WithDedup(-time.Second)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// diagTopic is where rtrouted takes diagnostic commands, as sent by the C
+// rtm_diag tool.
+const diagTopic = "_RTROUTED.INBOX.DIAG"
+
+type diagRequest struct {
+	Command string `json:"_RTROUTED.INBOX.DIAG.KEY"`
+	Value   string `json:"_RTROUTED.INBOX.DIAG.VALUE,omitempty"`
+}
+
+// registeredComponentsTopic is where rtrouted answers which routes its
+// clients registered.
+const registeredComponentsTopic = "_registered_components"
+
+// Diagnostics sends diagnostic commands to the router.  The router doesn't
+// reply to the commands; what they dump ends up in the router's log.  A nil
+// error only means the command was written to the router.  Queries, such as
+// RegisteredComponents, wait for the router's reply.
+type Diagnostics struct {
+	c *Connection
+}
+
+// Diagnostics returns the diagnostic commands of the router the connection is
+// connected to.
+func (c *Connection) Diagnostics() Diagnostics {
+	return Diagnostics{c: c}
+}
+
+// SetVerboseLogs switches the router between debug and info level logging.
+func (d Diagnostics) SetVerboseLogs(ctx context.Context, verbose bool) error {
+	if verbose {
+		return d.send(ctx, "enableVerboseLogs", "")
+	}
+	return d.send(ctx, "disableVerboseLogs", "")
+}
+
+// SetTrafficMonitor turns logging of each message routed on or off.
+func (d Diagnostics) SetTrafficMonitor(ctx context.Context, enabled bool) error {
+	if enabled {
+		return d.send(ctx, "enableTrafficMonitor", "")
+	}
+	return d.send(ctx, "disableTrafficMonitor", "")
+}
+
+// LogRoutingStats has the router log the statistics of its routing tree.
+func (d Diagnostics) LogRoutingStats(ctx context.Context) error {
+	return d.send(ctx, "logRoutingStats", "")
+}
+
+// LogRoutingTopics has the router log its topic tree.
+func (d Diagnostics) LogRoutingTopics(ctx context.Context) error {
+	return d.send(ctx, "logRoutingTopics", "")
+}
+
+// LogRoutingRoutes has the router log its routes.
+func (d Diagnostics) LogRoutingRoutes(ctx context.Context) error {
+	return d.send(ctx, "logRoutingRoutes", "")
+}
+
+// DumpBenchmarkData has the router print its benchmarking data.
+func (d Diagnostics) DumpBenchmarkData(ctx context.Context) error {
+	return d.send(ctx, "dumpBenchmarkData", "")
+}
+
+// ResetBenchmarkData clears the router's benchmarking data.
+func (d Diagnostics) ResetBenchmarkData(ctx context.Context) error {
+	return d.send(ctx, "resetBenchmarkData", "")
+}
+
+// AddListener has the router additionally listen on the socket, given as a
+// URL such as "tcp://127.0.0.1:10001".
+func (d Diagnostics) AddListener(ctx context.Context, socket string) error {
+	if socket == "" {
+		return fmt.Errorf("%w: empty socket", ErrInvalidInput)
+	}
+	return d.send(ctx, "addNewListener", socket)
+}
+
+// Heartbeat has the router log that it is running.
+func (d Diagnostics) Heartbeat(ctx context.Context) error {
+	return d.send(ctx, "heartbeat", "")
+}
+
+// Shutdown stops the router.
+func (d Diagnostics) Shutdown(ctx context.Context) error {
+	return d.send(ctx, "shutdown", "")
+}
+
+// RegisteredComponents is the router's reply to a query of the routes its
+// clients registered.
+type RegisteredComponents struct {
+	// Items are the expressions of the routes, those of the router's own
+	// topics, starting with "_", left out.
+	Items []string
+
+	// Raw holds the fields of the reply that aren't decoded above, so the
+	// additions of newer routers aren't lost.  It is nil when there are
+	// none.
+	Raw map[string]json.RawMessage
+}
+
+// RegisteredComponents asks the router which routes its clients registered:
+// the names of the components and the elements they provide.
+func (d Diagnostics) RegisteredComponents(ctx context.Context) (RegisteredComponents, error) {
+	msg, err := d.c.Request(ctx, nil, registeredComponentsTopic)
+	if err != nil {
+		return RegisteredComponents{}, err
+	}
+
+	return decodeRegisteredComponents(msg.Payload)
+}
+
+// decodeRegisteredComponents decodes the reply rtrouted writes for a query of
+// the registered components: a "count" and an "items" field, the latter left
+// out when there are none.
+func decodeRegisteredComponents(payload []byte) (RegisteredComponents, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimNul(payload), &fields); err != nil {
+		return RegisteredComponents{}, fmt.Errorf("%w: registered components: %w", ErrMalformedMessage, err)
+	}
+
+	var rc RegisteredComponents
+	if items, found := fields["items"]; found {
+		if err := json.Unmarshal(items, &rc.Items); err != nil {
+			return RegisteredComponents{}, fmt.Errorf("%w: registered components: %w", ErrMalformedMessage, err)
+		}
+	}
+	delete(fields, "items")
+	delete(fields, "count")
+
+	if len(fields) > 0 {
+		rc.Raw = fields
+	}
+
+	return rc, nil
+}
+
+func (d Diagnostics) send(ctx context.Context, command, value string) error {
+	payload, err := json.Marshal(diagRequest{Command: command, Value: value})
+	if err != nil {
+		return err
+	}
+
+	return d.c.Send(ctx, payload, diagTopic)
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDecodeRegisteredComponents(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		items   string
+		raw     string
+		err     error
+	}{
+		{
+			name:    "rtrouted",
+			payload: "{\"count\":2,\"items\":[\"provider\",\"Device.Test.X\"]}\x00",
+			items:   "[provider Device.Test.X]",
+			raw:     "map[]",
+		}, {
+			name:    "none",
+			payload: `{"count":0}`,
+			items:   "[]",
+			raw:     "map[]",
+		}, {
+			// The fields of a newer router are kept as they came.
+			name:    "newer router",
+			payload: `{"count":1,"items":["provider"],"clients":[{"ident":"provider","fd":7}],"uptime":42}`,
+			items:   "[provider]",
+			raw:     `map[clients:[{"ident":"provider","fd":7}] uptime:42]`,
+		}, {
+			name:    "malformed",
+			payload: `{"count":1,"items":"provider"}`,
+			err:     ErrMalformedMessage,
+		}, {
+			name:    "not JSON",
+			payload: "count=1",
+			err:     ErrMalformedMessage,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, err := decodeRegisteredComponents([]byte(tc.payload))
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("got %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw := make(map[string]string)
+			for k, v := range rc.Raw {
+				raw[k] = string(v)
+			}
+			if got := fmt.Sprint(rc.Items); got != tc.items {
+				t.Fatalf("got items %s, want %s", got, tc.items)
+			}
+			if got := fmt.Sprint(raw); got != tc.raw {
+				t.Fatalf("got raw %s, want %s", got, tc.raw)
+			}
+			if len(rc.Raw) == 0 && rc.Raw != nil {
+				t.Fatal("got an empty raw map, want nil")
+			}
+		})
+	}
+}
+
+func TestRegisteredComponents(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	subscribe(t, r, c, "Device.Test.X")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rc, err := c.Diagnostics().RegisteredComponents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The advisories and the like are the router's own.
+	if got := fmt.Sprint(rc.Items); got != "[Device.Test.X test.INBOX]" {
+		t.Fatalf("got %s", got)
+	}
+	if rc.Raw != nil {
+		t.Fatalf("got raw %v, want none", rc.Raw)
+	}
+}
+
+func TestDiagnosticsCommands(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	d := c.Diagnostics()
+
+	ctx := context.Background()
+	if err := d.SetVerboseLogs(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddListener(ctx, "tcp://127.0.0.1:10001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddListener(ctx, ""); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+
+	// The commands are written the way rtm_diag writes them.
+	want := []string{
+		`{"_RTROUTED.INBOX.DIAG.KEY":"enableVerboseLogs"}`,
+		`{"_RTROUTED.INBOX.DIAG.KEY":"addNewListener","_RTROUTED.INBOX.DIAG.VALUE":"tcp://127.0.0.1:10001"}`,
+	}
+	eventually(t, "the commands", func() bool {
+		var got []string
+		for _, msg := range r.Messages() {
+			if msg.Header.Topic == diagTopic {
+				got = append(got, string(trimNul(msg.Payload)))
+			}
+		}
+		return fmt.Sprint(got) == fmt.Sprint(want)
+	})
+}
@@ -0,0 +1,205 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// discoverWildcardTopic is where rtrouted answers which destinations serve the
+// topics under a partial path.
+const discoverWildcardTopic = "_RTROUTED.INBOX.QUERY"
+
+type discoveryRequest struct {
+	Expression string `json:"expression"`
+}
+
+type discoveryResponse struct {
+	Result int      `json:"result"`
+	Count  int      `json:"count"`
+	Items  []string `json:"items"`
+}
+
+// DiscoverWildcardDestinations asks the router which destinations have routes
+// for topics matching the expression, a partial path such as "Device.WiFi."
+// or one containing a "*" wildcard.  Each destination is a topic the matching
+// requests can be sent to.
+func (c *Connection) DiscoverWildcardDestinations(ctx context.Context, expression string) ([]string, error) {
+	if expression == "" {
+		return nil, fmt.Errorf("%w: empty expression", ErrInvalidInput)
+	}
+
+	payload, err := json.Marshal(discoveryRequest{Expression: expression})
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.Request(ctx, payload, discoverWildcardTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp discoveryResponse
+	if err := json.Unmarshal(trimNul(msg.Payload), &resp); err != nil {
+		return nil, fmt.Errorf("%w: discovery response: %w", ErrMalformedMessage, err)
+	}
+
+	if resp.Result != 0 {
+		return nil, fmt.Errorf("%w: router rejected the expression '%s'", ErrInvalidInput, expression)
+	}
+
+	return resp.Items, nil
+}
+
+// discoverObjectElementsTopic is where rtrouted answers which topics a route
+// serves.
+const discoverObjectElementsTopic = "_enumerate_elements"
+
+// DiscoverObjectElements asks the router for the topics of the route whose
+// first topic is the expression, which for an rbus provider is its component
+// name: the component name itself followed by the elements it added as
+// aliases.  An expression nobody has a route for has no topics.
+func (c *Connection) DiscoverObjectElements(ctx context.Context, expression string) ([]string, error) {
+	if expression == "" {
+		return nil, fmt.Errorf("%w: empty expression", ErrInvalidInput)
+	}
+
+	payload, err := json.Marshal(discoveryRequest{Expression: expression})
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.Request(ctx, payload, discoverObjectElementsTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp discoveryResponse
+	if err := json.Unmarshal(trimNul(msg.Payload), &resp); err != nil {
+		return nil, fmt.Errorf("%w: discovery response: %w", ErrMalformedMessage, err)
+	}
+
+	return resp.Items, nil
+}
+
+// discoverElementObjectsTopic is where rtrouted answers which routes serve
+// each of a list of topics.
+const discoverElementObjectsTopic = "_trace_origin_object"
+
+// elementObjectsMessage is the request and response of an element objects
+// discovery.  rtrouted writes a "count" field for each topic of the request
+// but a single "items" array holding the routes of all of them, so the
+// response can't be decoded with encoding/json alone.
+type elementObjectsMessage struct {
+	Result int
+	Counts []int
+	Items  []string
+}
+
+// marshal encodes the message the way rtrouted does, with a "count" field for
+// each of the counts.
+func (m elementObjectsMessage) marshal(response bool) ([]byte, error) {
+	var fields []string
+	if response {
+		fields = append(fields, fmt.Sprintf(`"result":%d`, m.Result))
+	}
+	for i, count := range m.Counts {
+		fields = append(fields, fmt.Sprintf(`"count":%d`, count))
+		if i == 0 && m.Items != nil {
+			items, err := json.Marshal(m.Items)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, `"items":`+string(items))
+		}
+	}
+
+	return []byte("{" + strings.Join(fields, ",") + "}"), nil
+}
+
+// unmarshalElementObjects decodes an element objects message, keeping every
+// "count" field in order.
+func unmarshalElementObjects(payload []byte) (elementObjectsMessage, error) {
+	var m elementObjectsMessage
+
+	dec := json.NewDecoder(bytes.NewReader(trimNul(payload)))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return m, fmt.Errorf("%w: element objects message is not an object", ErrMalformedMessage)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return m, fmt.Errorf("%w: element objects message: %w", ErrMalformedMessage, err)
+		}
+
+		switch tok {
+		case "result":
+			err = dec.Decode(&m.Result)
+		case "count":
+			var count int
+			err = dec.Decode(&count)
+			m.Counts = append(m.Counts, count)
+		case "items":
+			err = dec.Decode(&m.Items)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return m, fmt.Errorf("%w: element objects message: %w", ErrMalformedMessage, err)
+		}
+	}
+
+	return m, nil
+}
+
+// DiscoverElementObjects asks the router which routes serve each of the
+// topics, such as "Device.WiFi.SSID.1.SSID".  Each route is reported by its
+// first topic, which for an rbus provider is its component name.  The result
+// holds the routes of each topic in order, with none for a topic nobody
+// serves.
+func (c *Connection) DiscoverElementObjects(ctx context.Context, topics ...string) ([][]string, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("%w: no topics", ErrInvalidInput)
+	}
+
+	payload, err := elementObjectsMessage{
+		Counts: []int{len(topics)},
+		Items:  topics,
+	}.marshal(false)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.Request(ctx, payload, discoverElementObjectsTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := unmarshalElementObjects(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Result != 0 {
+		return nil, fmt.Errorf("%w: router rejected the topics", ErrInvalidInput)
+	}
+	if len(resp.Counts) != len(topics) {
+		return nil, fmt.Errorf("%w: %d counts for %d topics", ErrMalformedMessage, len(resp.Counts), len(topics))
+	}
+
+	routes := make([][]string, len(topics))
+	items := resp.Items
+	for i, count := range resp.Counts {
+		if count < 0 || count > len(items) {
+			return nil, fmt.Errorf("%w: %d routes for '%s', %d left", ErrMalformedMessage, count, topics[i], len(items))
+		}
+		routes[i], items = items[:count:count], items[count:]
+	}
+
+	return routes, nil
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+var ErrDispatchQueueFull = errors.New("dispatch queue full")
+
+// dispatcher hands received messages to a pool of workers that call the
+// listeners.  Messages on the same topic always go to the same worker, so they
+// are delivered in the order they were received.
+type dispatcher struct {
+	queues []chan Message
+}
+
+// newDispatcher starts the workers for a single connection, or returns nil
+// when listeners are called from the read loop.
+func (c *Connection) newDispatcher() *dispatcher {
+	if c.dispatchWorkers <= 0 {
+		return nil
+	}
+
+	d := dispatcher{
+		queues: make([]chan Message, c.dispatchWorkers),
+	}
+
+	c.wg.Add(len(d.queues))
+	for i := range d.queues {
+		d.queues[i] = make(chan Message, c.dispatchQueue)
+		go c.dispatchLoop(d.queues[i])
+	}
+
+	return &d
+}
+
+// dispatch delivers the message to the listeners, directly or via the worker
+// for its topic.
+func (c *Connection) dispatch(d *dispatcher, msg Message) {
+	if d == nil {
+		c.deliver(msg)
+		return
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(msg.Header.Topic))
+	q := d.queues[h.Sum32()%uint32(len(d.queues))]
+
+	if c.dispatchPolicy == QueueBlock {
+		q <- msg
+		return
+	}
+
+	select {
+	case q <- msg:
+	default:
+		c.readError(fmt.Errorf("%w: dropped message on '%s'", ErrDispatchQueueFull, msg.Header.Topic))
+	}
+}
+
+// stop lets the workers finish the queued messages and exit.
+func (d *dispatcher) stop() {
+	if d == nil {
+		return
+	}
+
+	for _, q := range d.queues {
+		close(q)
+	}
+}
+
+func (c *Connection) dispatchLoop(q <-chan Message) {
+	defer c.wg.Done()
+
+	for msg := range q {
+		c.deliver(msg)
+	}
+}
+
+// deliver calls the listeners with the message.
+func (c *Connection) deliver(msg Message) {
+	c.listeners.Visit(func(listener MessageListener) {
+		listener.OnMessage(msg)
+	})
+}
@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listen adds the listener for the messages on the topics under "Test.",
+// once the router has the route.
+func listen(t *testing.T, r *MemRouter, c *Connection, f func(Message)) {
+	t.Helper()
+
+	cancel, err := c.Add(MessageListenerFunc(f), "Test.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cancel)
+	eventually(t, "the route to Test.*", func() bool {
+		return routes(r, "Test.*") > 0
+	})
+}
+
+// worker returns the dispatch worker of the topic.
+func worker(topic string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(topic))
+	return int(h.Sum32() % uint32(workers))
+}
+
+func TestDispatchOrder(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX", WithDispatchWorkers(2, 10))
+
+	// The topics of the workers, the first held up by a slow listener.
+	var slow, fast string
+	for i := 0; slow == "" || fast == ""; i++ {
+		topic := fmt.Sprintf("Test.T%d", i)
+		switch {
+		case worker(topic, 2) == 0 && slow == "":
+			slow = topic
+		case worker(topic, 2) == 1 && fast == "":
+			fast = topic
+		}
+	}
+
+	var (
+		m   sync.Mutex
+		got = make(map[string][]string)
+	)
+	gate := make(chan struct{})
+	var release sync.Once
+	t.Cleanup(func() { release.Do(func() { close(gate) }) })
+	listen(t, r, c, func(msg Message) {
+		if msg.Header.Topic == slow {
+			<-gate
+		}
+		m.Lock()
+		defer m.Unlock()
+		got[msg.Header.Topic] = append(got[msg.Header.Topic], string(msg.Payload))
+	})
+
+	var want []string
+	for i := range 10 {
+		want = append(want, fmt.Sprint(i))
+		inject(t, r, c, slow, fmt.Sprint(i))
+		inject(t, r, c, fast, fmt.Sprint(i))
+	}
+
+	// The other worker goes on meanwhile.
+	eventually(t, "the messages on "+fast, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(got[fast]) == len(want)
+	})
+	m.Lock()
+	if len(got[slow]) != 0 {
+		t.Fatalf("got %v on %s before its listener was done", got[slow], slow)
+	}
+	m.Unlock()
+
+	// Each topic is delivered in order.
+	release.Do(func() { close(gate) })
+	eventually(t, "the messages on "+slow, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(got[slow]) == len(want)
+	})
+	m.Lock()
+	defer m.Unlock()
+	for _, topic := range []string{slow, fast} {
+		if !slices.Equal(got[topic], want) {
+			t.Fatalf("got %v on %s, want %v", got[topic], topic, want)
+		}
+	}
+}
+
+func TestDispatchPolicy(t *testing.T) {
+	tests := []struct {
+		policy QueuePolicy
+		// delivered are the messages the listener gets, dropped the number
+		// reported dropped.
+		delivered string
+		dropped   int
+	}{
+		{policy: QueueBlock, delivered: "[0 1 2 3 4]"},
+		{policy: QueueReject, delivered: "[0 1]", dropped: 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.policy), func(t *testing.T) {
+			r, url := newTestRouter(t)
+			c, err := New(url, "test", WithInbox("test.INBOX"), WithDispatchWorkers(1, 1), WithDispatchPolicy(tc.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = c.Close() })
+			errs := readErrors(c)
+			if err := c.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				m   sync.Mutex
+				got []string
+			)
+			started := make(chan struct{}, 10)
+			gate := make(chan struct{})
+			var release sync.Once
+			t.Cleanup(func() { release.Do(func() { close(gate) }) })
+			listen(t, r, c, func(msg Message) {
+				started <- struct{}{}
+				<-gate
+				m.Lock()
+				defer m.Unlock()
+				got = append(got, string(msg.Payload))
+			})
+
+			// The worker holds the first message, the queue the second, and
+			// there's no room for the rest.
+			inject(t, r, c, "Test.Event", "0")
+			<-started
+			for i := 1; i < 5; i++ {
+				// Not waited for, as the reader waits for room when it
+				// blocks.
+				msg := Message{Header: &Header{Topic: "Test.Event"}, Payload: []byte(fmt.Sprint(i))}
+				if err := r.Inject(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for range tc.dropped {
+				if err := nextReadError(t, errs); !errors.Is(err, ErrDispatchQueueFull) {
+					t.Fatalf("got %v, want %v", err, ErrDispatchQueueFull)
+				}
+			}
+			release.Do(func() { close(gate) })
+
+			eventually(t, "the messages", func() bool {
+				m.Lock()
+				defer m.Unlock()
+				return fmt.Sprint(got) == tc.delivered
+			})
+			time.Sleep(10 * time.Millisecond)
+			m.Lock()
+			defer m.Unlock()
+			if fmt.Sprint(got) != tc.delivered {
+				t.Fatalf("got %v, want %s", got, tc.delivered)
+			}
+			select {
+			case err := <-errs:
+				t.Fatalf("got %v, want no more read errors", err)
+			default:
+			}
+		})
+	}
+}
+
+func TestDispatchOptionsInvalid(t *testing.T) {
+	for _, opt := range []Option{
+		WithDispatchWorkers(-1, 1),
+		WithDispatchWorkers(1, -1),
+		WithDispatchPolicy(QueuePolicy(99)),
+	} {
+		if _, err := New("mem://x", "test", opt); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+		}
+	}
+}
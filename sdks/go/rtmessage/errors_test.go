@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestErrorDialRefused(t *testing.T) {
+	// A port nothing listens on any more.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "tcp://" + l.Addr().String()
+	_ = l.Close()
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Connect(context.Background())
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("got %v, want %v", err, syscall.ECONNREFUSED)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		t.Fatalf("got %v, want a dial *net.OpError", err)
+	}
+}
+
+func TestErrorDialTimeout(t *testing.T) {
+	c, err := New("tcp://127.0.0.1:1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Already expired, so the dial fails on the deadline whatever the host.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if err := c.Connect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestErrorClosedMidRead(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	con := <-conns
+
+	b := frame(t, Message{Header: &Header{Topic: "Test.Event"}})
+	if _, err := con.Write(b[:10]); err != nil {
+		t.Fatal(err)
+	}
+	// A FIN rather than a reset, whatever the connection sent.
+	_ = con.(*net.TCPConn).CloseWrite()
+
+	err = nextReadError(t, errs)
+	if !errors.Is(err, ErrConnectionClosed) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want %v and %v", err, ErrConnectionClosed, io.ErrUnexpectedEOF)
+	}
+
+	<-c.Done()
+	if err := c.Err(); !errors.Is(err, ErrConnectionClosed) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want %v and %v", err, ErrConnectionClosed, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestErrorReadDeadline(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	c, err := New(url, "test", WithReadTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	con := <-conns
+
+	// Between messages the timeout keeps what the net package said of it.
+	err = nextReadError(t, errs)
+	if !errors.Is(err, ErrIdleTimeout) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want %v and %v", err, ErrIdleTimeout, os.ErrDeadlineExceeded)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("got %v, want a net.Error that timed out", err)
+	}
+
+	// As does one part way through a message.
+	b := frame(t, Message{Header: &Header{Topic: "Test.Event"}})
+	if _, err := con.Write(b[:10]); err != nil {
+		t.Fatal(err)
+	}
+	for errors.Is(err, ErrIdleTimeout) {
+		err = nextReadError(t, errs)
+	}
+	if !errors.Is(err, ErrProtocol) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want %v and %v", err, ErrProtocol, os.ErrDeadlineExceeded)
+	}
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("got %v, want a net.Error that timed out", err)
+	}
+}
+
+func TestErrorSend(t *testing.T) {
+	r, url := newTestRouter(t)
+
+	c, err := New(url, "test", WithMaxMessageSize(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Send(context.Background(), nil, "Test.Event")
+	if !errors.Is(err, ErrNotConnected) || !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want %v", err, ErrNotConnected)
+	}
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send(context.Background(), make([]byte, 200), "Test.Event"); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+	if _, err := c.Request(context.Background(), nil, "Test.Nobody"); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("got %v, want %v", err, ErrNoRoute)
+	}
+
+	// A request cut off by the router going away.
+	if err := c.Subscribe("Test.Unanswered"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the route", func() bool { return routes(r, "Test.Unanswered") > 0 })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Request(context.Background(), nil, "Test.Unanswered")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	r.DropConnections()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Fatalf("got %v, want %v", err, ErrConnectionClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request outlived the connection")
+	}
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// missingURL returns the URL of a MemRouter that doesn't exist.
+func missingURL() string {
+	return fmt.Sprintf("mem://missing-router-%d", testRouters.Add(1))
+}
+
+func TestFallbackURLs(t *testing.T) {
+	b, urlB := newTestRouter(t)
+	c, urlC := newTestRouter(t)
+
+	// The URLs are tried in order, so the first router there is reached.
+	con := newTestConnection(t, missingURL(), "test.INBOX",
+		WithFallbackURLs(urlB, urlC),
+		WithAutoReconnect(time.Millisecond, time.Millisecond))
+	if b.Connections() != 1 || c.Connections() != 0 {
+		t.Fatalf("got %d and %d connections, want 1 and 0", b.Connections(), c.Connections())
+	}
+
+	states, cancel := recordStates(con)
+	defer cancel()
+
+	// Once B is gone, the next one is.
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, states, StateDisconnected, StateConnecting, StateConnected)
+	if c.Connections() != 1 {
+		t.Fatalf("got %d connections to C, want 1", c.Connections())
+	}
+
+	// B is back, but C, reached last, is tried first.
+	b, err := NewMemRouter(strings.TrimPrefix(urlB, "mem://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	c.DropConnections()
+	expectStates(t, states, StateDisconnected, StateConnecting, StateConnected)
+	if b.Connections() != 0 || c.Connections() != 1 {
+		t.Fatalf("got %d and %d connections, want 0 and 1", b.Connections(), c.Connections())
+	}
+}
+
+func TestFallbackURLsFail(t *testing.T) {
+	urls := []string{missingURL(), missingURL(), missingURL()}
+	con, err := New(urls[0], "test", WithFallbackURLs(urls[1:]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = con.Connect(ctx)
+	if !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidState)
+	}
+
+	// Each attempt is told of, in order.
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("got %v, want the errors joined", err)
+	}
+	errs := joined.Unwrap()
+	if len(errs) != len(urls) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(urls), err)
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), urls[i]+": ") || !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("got %v for %s", err, urls[i])
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// goldenFrame is a frame of testdata, written by the C library with
+// testdata/golden.c.
+type goldenFrame struct {
+	name string
+	msg  Message
+
+	// timestamps are those of the roundtrip build.
+	timestamps [5]uint32
+}
+
+var (
+	requestTimestamps  = [5]uint32{1700000001, 1700000002, 1700000003}
+	responseTimestamps = [5]uint32{1700000001, 1700000002, 1700000003, 1700000004, 1700000005}
+)
+
+var goldenFrames = []goldenFrame{
+	{
+		name: "subscribe",
+		msg: Message{
+			Header: &Header{
+				SequenceNumber: 1,
+				Topic:          "_RTROUTED.INBOX.SUBSCRIBE",
+			},
+			Payload: []byte(`{"add":1,"topic":"Device.Test.*","route_id":5}`),
+		},
+	},
+	{
+		name: "request",
+		msg: Message{
+			Header: &Header{
+				SequenceNumber: 2,
+				Flags:          FLAGS_REQUEST | FLAGS_RAW_BINARY,
+				Topic:          "Device.Test.Value",
+				ReplyTopic:     "test.INBOX.4242",
+			},
+			Payload: []byte("\x81\xa3get\xa6Device"),
+		},
+		timestamps: requestTimestamps,
+	},
+	{
+		name: "response",
+		msg: Message{
+			Header: &Header{
+				SequenceNumber: 2,
+				Flags:          FLAGS_RESPONSE | FLAGS_RAW_BINARY,
+				ControlData:    5,
+				Topic:          "test.INBOX.4242",
+			},
+			Payload: []byte("\x92\x00\xa2ok"),
+		},
+		timestamps: responseTimestamps,
+	},
+	{
+		name: "undeliverable",
+		msg: Message{
+			Header: &Header{
+				SequenceNumber: 2,
+				Flags:          FLAGS_RESPONSE | FLAGS_UNDELIVERABLE,
+				Topic:          "test.INBOX.4242",
+			},
+		},
+		timestamps: responseTimestamps,
+	},
+	{
+		name: "event",
+		msg: Message{
+			Header: &Header{
+				SequenceNumber: 3,
+				ControlData:    5,
+				Topic:          "Device.Test.Event",
+			},
+		},
+	},
+}
+
+// readGolden returns the bytes of the frame of testdata.
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name+".bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// checkGolden reads the frame, checking it decodes to the message with the
+// timestamps and is followed by nothing.
+func checkGolden(t *testing.T, b []byte, want Message, timestamps [5]uint32) Message {
+	t.Helper()
+
+	r := bytes.NewReader(b)
+	got, err := ReadMessage(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("%d bytes left after the frame", r.Len())
+	}
+
+	want = want.Clone()
+	want.Header.Timestamps = timestamps
+	if !got.Equal(want, EqualTimestamps) {
+		t.Fatalf("got %v with timestamps %v, want %v with %v",
+			got, got.Header.Timestamps, want, timestamps)
+	}
+	if got.Header.Version != header_VERSION {
+		t.Fatalf("got version %d", got.Header.Version)
+	}
+	if int(got.Header.HeaderLength)+len(got.Payload) != len(b) {
+		t.Fatalf("header length %d with %d bytes of payload in a frame of %d",
+			got.Header.HeaderLength, len(got.Payload), len(b))
+	}
+	if int(got.Header.PayloadLength) != len(got.Payload) {
+		t.Fatalf("payload length %d of %d bytes", got.Header.PayloadLength, len(got.Payload))
+	}
+
+	return got
+}
+
+func TestGoldenRoundTrip(t *testing.T) {
+	for _, g := range goldenFrames {
+		t.Run(g.name, func(t *testing.T) {
+			b := readGolden(t, g.name+"-roundtrip")
+			got := checkGolden(t, b, g.msg, g.timestamps)
+
+			// Marshal writes the header of the roundtrip build, so the
+			// frame comes back byte for byte.
+			again, err := got.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, b) {
+				t.Fatalf("got\n% x\nwant\n% x", again, b)
+			}
+
+			msg := g.msg.Clone()
+			msg.Header.Timestamps = g.timestamps
+			fresh, err := msg.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(fresh, b) {
+				t.Fatalf("got\n% x\nwant\n% x", fresh, b)
+			}
+		})
+	}
+}
+
+func TestGoldenWithoutTimestamps(t *testing.T) {
+	for _, g := range goldenFrames {
+		t.Run(g.name, func(t *testing.T) {
+			checkGolden(t, readGolden(t, g.name), g.msg, [5]uint32{})
+		})
+	}
+}
+
+func TestGoldenStream(t *testing.T) {
+	// The frames of both builds, back to back, as a router in the middle
+	// of an upgrade might send them.
+	var stream []byte
+	for _, g := range goldenFrames {
+		stream = append(stream, readGolden(t, g.name)...)
+		stream = append(stream, readGolden(t, g.name+"-roundtrip")...)
+	}
+
+	r := bytes.NewReader(stream)
+	for _, g := range goldenFrames {
+		for _, timestamps := range [][5]uint32{{}, g.timestamps} {
+			got, err := ReadMessage(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := g.msg.Clone()
+			want.Header.Timestamps = timestamps
+			if !got.Equal(want, EqualTimestamps) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	}
+	if r.Len() != 0 {
+		t.Fatalf("%d bytes left after the frames", r.Len())
+	}
+}
+
+func TestGoldenCompact(t *testing.T) {
+	for _, g := range goldenFrames {
+		t.Run(g.name, func(t *testing.T) {
+			b := readGolden(t, g.name)
+			got := checkGolden(t, b, g.msg, [5]uint32{})
+
+			if want := header_MIN + len(g.msg.Header.Topic) + len(g.msg.Header.ReplyTopic); int(got.Header.HeaderLength) != want {
+				t.Fatalf("got header length %d, want %d", got.Header.HeaderLength, want)
+			}
+
+			// The compact header is that of the default build.
+			for _, msg := range []Message{got, g.msg} {
+				again, err := msg.marshal(true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(again, b) {
+					t.Fatalf("got\n% x\nwant\n% x", again, b)
+				}
+			}
+		})
+	}
+}
+
+func TestCompactHeaders(t *testing.T) {
+	for _, compact := range []bool{true, false} {
+		t.Run(fmt.Sprint(compact), func(t *testing.T) {
+			r, url := newTestRouter(t)
+			c := newTestConnection(t, url, "test.INBOX", WithCompactHeaders(compact))
+
+			if err := c.Send(context.Background(), []byte("payload"), "Test.Event"); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []Message
+			eventually(t, "the message", func() bool {
+				got = r.Messages()
+				return len(got) > 0
+			})
+
+			want := header_MIN + len("Test.Event")
+			if !compact {
+				want += header_TIMESTAMPS_LEN
+			}
+			if h := got[0].Header; int(h.HeaderLength) != want {
+				t.Fatalf("got header length %d, want %d", h.HeaderLength, want)
+			}
+
+			// Either way the router's answers are read, with or without
+			// timestamps.
+			resp, err := c.Request(context.Background(), nil, "Test.Nobody")
+			if !errors.Is(err, ErrNoRoute) {
+				t.Fatalf("got %v, %v, want %v", resp, err, ErrNoRoute)
+			}
+		})
+	}
+}
+
+func TestCompactHeadersMaxMessageSize(t *testing.T) {
+	_, url := newTestRouter(t)
+
+	// The payload fits with the compact header only.
+	const limit = 200
+	payload := make([]byte, limit-header_MIN-len("Test.Event"))
+
+	compact := newTestConnection(t, url, "compact.INBOX", WithCompactHeaders(true), WithMaxMessageSize(limit))
+	if err := compact.Send(context.Background(), payload, "Test.Event"); err != nil {
+		t.Fatal(err)
+	}
+
+	full := newTestConnection(t, url, "full.INBOX", WithMaxMessageSize(limit))
+	if err := full.Send(context.Background(), payload, "Test.Event"); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+}
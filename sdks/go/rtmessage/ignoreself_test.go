@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIgnoreSelf(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX", WithIgnoreSelf(true))
+	other := newTestConnection(t, url, "other.INBOX")
+
+	// Both subscriptions overlap the topic published to.
+	ch := subscribe(t, r, c, "Device.X.*")
+	subscribe(t, r, c, "Device.X.Event")
+
+	if err := c.Send(context.Background(), []byte("mine"), "Device.X.Event"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Send(context.Background(), []byte("theirs"), "Device.X.Event"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The router delivers each message once; only the other connection's
+	// gets through.
+	if msg := receive(t, ch); string(msg.Payload) != "theirs" {
+		t.Fatalf("got %q, want the other connection's message", msg.Payload)
+	}
+	nothingReceived(t, ch, 50*time.Millisecond)
+
+	if n := c.Stats().IgnoredSelf; n != 1 {
+		t.Fatalf("ignored %d messages, want 1", n)
+	}
+
+	// A request of its own to the topic is never dropped.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	go func() { _, _ = c.Request(ctx, []byte("request"), "Device.X.Event") }()
+
+	msg := receive(t, ch)
+	if msg.Type() != MsgTypeRequest || string(msg.Payload) != "request" {
+		t.Fatalf("got %v, want the request", msg)
+	}
+}
+
+func TestIgnoreSelfDisabled(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	ch := subscribe(t, r, c, "Device.X.*")
+	if err := c.Send(context.Background(), []byte("mine"), "Device.X.Event"); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := receive(t, ch); string(msg.Payload) != "mine" {
+		t.Fatalf("got %q", msg.Payload)
+	}
+	if n := c.Stats().IgnoredSelf; n != 0 {
+		t.Fatalf("ignored %d messages", n)
+	}
+}
@@ -0,0 +1,551 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	memRoutersLock sync.Mutex
+	memRouters     = map[string]*MemRouter{}
+)
+
+// MemRouter is an in-process stand-in for rtrouted, intended for tests.  A
+// Connection created with a "mem://name" URL connects to the MemRouter
+// registered under that name instead of dialing a socket.
+//
+// Like rtrouted, the MemRouter handles the JSON subscription and discovery
+// messages and routes every other message to the connections with a
+// subscription matching its topic.  A
+// subscription token of "*" matches any single topic token, and one of "{i}"
+// a table row instance.  A request nobody is subscribed to is turned around
+// to the sender as an undeliverable response.
+type MemRouter struct {
+	name string
+
+	m        sync.Mutex
+	clients  map[*memClient]struct{}
+	messages []Message
+	closed   bool
+}
+
+type memRoute struct {
+	id     int
+	tokens []string
+}
+
+// memClient is a connection to the MemRouter.  Writes are queued and done by
+// a goroutine of their own so that routing never blocks on a slow reader.
+type memClient struct {
+	con    net.Conn
+	routes []memRoute
+
+	m      sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte
+	closed bool
+}
+
+// NewMemRouter creates a MemRouter and registers it under the name.  The
+// name must not be in use by another MemRouter.
+func NewMemRouter(name string) (*MemRouter, error) {
+	memRoutersLock.Lock()
+	defer memRoutersLock.Unlock()
+
+	if _, found := memRouters[name]; found {
+		return nil, fmt.Errorf("%w: mem router '%s' already exists", ErrInvalidInput, name)
+	}
+
+	r := MemRouter{
+		name:    name,
+		clients: make(map[*memClient]struct{}),
+	}
+	memRouters[name] = &r
+
+	return &r, nil
+}
+
+// dialMem connects to the MemRouter registered under the name.
+func dialMem(ctx context.Context, name string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	memRoutersLock.Lock()
+	r, found := memRouters[name]
+	memRoutersLock.Unlock()
+
+	if !found {
+		return nil, fmt.Errorf("%w: no mem router named '%s'", ErrInvalidState, name)
+	}
+
+	return r.connect()
+}
+
+func (r *MemRouter) connect() (net.Conn, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.closed {
+		return nil, ErrClosed
+	}
+
+	client, server := net.Pipe()
+
+	mc := memClient{con: server}
+	mc.cond = sync.NewCond(&mc.m)
+	r.clients[&mc] = struct{}{}
+
+	go r.readLoop(&mc)
+	go mc.writeLoop()
+
+	return client, nil
+}
+
+// Close unregisters the MemRouter and drops all of its connections.
+func (r *MemRouter) Close() error {
+	memRoutersLock.Lock()
+	if memRouters[r.name] == r {
+		delete(memRouters, r.name)
+	}
+	memRoutersLock.Unlock()
+
+	r.m.Lock()
+	r.closed = true
+	r.m.Unlock()
+
+	r.DropConnections()
+
+	return nil
+}
+
+// DropConnections closes every connection to the MemRouter, as if the router
+// had restarted.  Subscriptions are forgotten.
+func (r *MemRouter) DropConnections() {
+	r.m.Lock()
+	clients := make([]*memClient, 0, len(r.clients))
+	for mc := range r.clients {
+		clients = append(clients, mc)
+	}
+	r.m.Unlock()
+
+	for _, mc := range clients {
+		r.drop(mc)
+	}
+}
+
+// Connections returns the number of connections to the MemRouter.
+func (r *MemRouter) Connections() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return len(r.clients)
+}
+
+// Subscriptions returns the subscription expressions of all connections.
+func (r *MemRouter) Subscriptions() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var rv []string
+	for mc := range r.clients {
+		for _, route := range mc.routes {
+			rv = append(rv, strings.Join(route.tokens, "."))
+		}
+	}
+	slices.Sort(rv)
+
+	return rv
+}
+
+// Messages returns the messages routed so far, excluding subscription
+// messages, in the order they were received.
+func (r *MemRouter) Messages() []Message {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return slices.Clone(r.messages)
+}
+
+// Inject routes the message as if a connection had sent it.
+func (r *MemRouter) Inject(msg Message) error {
+	if _, err := msg.Marshal(); err != nil {
+		return err
+	}
+
+	h := *msg.Header
+	r.route(nil, Message{Header: &h, Payload: msg.Payload})
+
+	return nil
+}
+
+func (r *MemRouter) readLoop(mc *memClient) {
+	defer r.drop(mc)
+
+	for {
+		msg, err := ReadMessage(mc.con)
+		if err != nil {
+			return
+		}
+
+		if msg.Header.Topic == subscribeTopic {
+			r.subscribe(mc, msg.Payload)
+			continue
+		}
+
+		if msg.Header.Topic == discoverWildcardTopic {
+			r.discover(mc, msg)
+			continue
+		}
+
+		if msg.Header.Topic == discoverObjectElementsTopic {
+			r.discoverElements(mc, msg)
+			continue
+		}
+
+		if msg.Header.Topic == discoverElementObjectsTopic {
+			r.discoverObjects(mc, msg)
+			continue
+		}
+
+		if msg.Header.Topic == registeredComponentsTopic {
+			r.registeredComponents(mc, msg)
+			continue
+		}
+
+		r.route(mc, msg)
+	}
+}
+
+func (r *MemRouter) subscribe(mc *memClient, payload []byte) {
+	var req subscriptionRequest
+	if err := json.Unmarshal(trimNul(payload), &req); err != nil {
+		return
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if req.Add == 0 {
+		// Like rtrouted, removing the first topic of a route removes the
+		// route with its aliases, while removing an alias leaves the rest.
+		first := slices.IndexFunc(mc.routes, func(route memRoute) bool {
+			return route.id == req.RouteID
+		})
+		if first >= 0 && strings.Join(mc.routes[first].tokens, ".") != req.Topic {
+			mc.routes = slices.DeleteFunc(mc.routes, func(route memRoute) bool {
+				return route.id == req.RouteID && strings.Join(route.tokens, ".") == req.Topic
+			})
+			return
+		}
+		mc.routes = slices.DeleteFunc(mc.routes, func(route memRoute) bool {
+			return route.id == req.RouteID
+		})
+		return
+	}
+
+	mc.routes = append(mc.routes, memRoute{
+		id:     req.RouteID,
+		tokens: strings.Split(req.Topic, "."),
+	})
+}
+
+// discover answers a wildcard discovery request.  Like rtrouted, each route
+// with a topic under the expression, a partial path ending in ".", or else
+// with the topic of the expression, is reported by its first topic.  Aliases
+// share the route of the topic they were added to, so for an rbus provider
+// that is its component name.
+func (r *MemRouter) discover(mc *memClient, req Message) {
+	var query discoveryRequest
+	if err := json.Unmarshal(trimNul(req.Payload), &query); err != nil {
+		return
+	}
+
+	partial := strings.HasSuffix(query.Expression, ".")
+	prefix := strings.Split(strings.TrimSuffix(query.Expression, "."), ".")
+
+	var resp discoveryResponse
+	r.m.Lock()
+	for c := range r.clients {
+		found := make(map[int]bool)
+		for _, route := range c.routes {
+			if found[route.id] || len(route.tokens) < len(prefix) {
+				continue
+			}
+			if !partial && len(route.tokens) != len(prefix) {
+				continue
+			}
+			// Either side can hold the wildcard: the expression a "*", the
+			// route the "{i}" of a table.
+			under := route.tokens[:len(prefix)]
+			if !matchTokens(prefix, under) && !matchTokens(under, prefix) {
+				continue
+			}
+			found[route.id] = true
+
+			first := c.routes[slices.IndexFunc(c.routes, func(other memRoute) bool {
+				return other.id == route.id
+			})]
+			resp.Items = append(resp.Items, strings.Join(first.tokens, "."))
+		}
+	}
+	r.m.Unlock()
+
+	slices.Sort(resp.Items)
+	resp.Count = len(resp.Items)
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	msg, err := req.NewResponse(payload)
+	if err != nil {
+		return
+	}
+
+	if frame, err := msg.Marshal(); err == nil {
+		mc.enqueue(frame)
+	}
+}
+
+// registeredComponents answers a query of the registered components with
+// the topics of every route but the router's own.  Like rtrouted, it leaves
+// out the items when there are none.
+func (r *MemRouter) registeredComponents(mc *memClient, req Message) {
+	var resp struct {
+		Count int      `json:"count"`
+		Items []string `json:"items,omitempty"`
+	}
+	r.m.Lock()
+	for c := range r.clients {
+		for _, route := range c.routes {
+			if topic := strings.Join(route.tokens, "."); !strings.HasPrefix(topic, "_") {
+				resp.Items = append(resp.Items, topic)
+			}
+		}
+	}
+	r.m.Unlock()
+
+	slices.Sort(resp.Items)
+	resp.Count = len(resp.Items)
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	msg, err := req.NewResponse(payload)
+	if err != nil {
+		return
+	}
+
+	if frame, err := msg.Marshal(); err == nil {
+		mc.enqueue(frame)
+	}
+}
+
+// discoverElements answers an object elements discovery request with the
+// topics of the route whose first topic is the expression, in the order they
+// were added.
+func (r *MemRouter) discoverElements(mc *memClient, req Message) {
+	var query discoveryRequest
+	if err := json.Unmarshal(trimNul(req.Payload), &query); err != nil {
+		return
+	}
+
+	resp := discoveryResponse{Items: []string{}}
+	r.m.Lock()
+	for c := range r.clients {
+		first := slices.IndexFunc(c.routes, func(route memRoute) bool {
+			return strings.Join(route.tokens, ".") == query.Expression
+		})
+		if first < 0 {
+			continue
+		}
+
+		// An alias with the name of the expression doesn't count.
+		id := c.routes[first].id
+		if slices.IndexFunc(c.routes, func(route memRoute) bool { return route.id == id }) != first {
+			continue
+		}
+		for _, route := range c.routes[first:] {
+			if route.id == id {
+				resp.Items = append(resp.Items, strings.Join(route.tokens, "."))
+			}
+		}
+		break
+	}
+	r.m.Unlock()
+
+	resp.Count = len(resp.Items)
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	msg, err := req.NewResponse(payload)
+	if err != nil {
+		return
+	}
+
+	if frame, err := msg.Marshal(); err == nil {
+		mc.enqueue(frame)
+	}
+}
+
+// discoverObjects answers an element objects discovery request.  Like
+// rtrouted, each route matching a topic is reported by its first topic.
+func (r *MemRouter) discoverObjects(mc *memClient, req Message) {
+	query, err := unmarshalElementObjects(req.Payload)
+	if err != nil {
+		return
+	}
+
+	resp := elementObjectsMessage{Items: []string{}}
+	if len(query.Counts) == 0 || query.Counts[0] <= 0 || query.Counts[0] > len(query.Items) {
+		resp.Result = 1
+	}
+
+	r.m.Lock()
+	for _, topic := range query.Items {
+		if resp.Result != 0 {
+			break
+		}
+
+		tokens := strings.Split(topic, ".")
+		count := 0
+		for c := range r.clients {
+			found := make(map[int]bool)
+			for _, route := range c.routes {
+				if found[route.id] || !route.matches(tokens) {
+					continue
+				}
+				found[route.id] = true
+
+				first := c.routes[slices.IndexFunc(c.routes, func(other memRoute) bool {
+					return other.id == route.id
+				})]
+				resp.Items = append(resp.Items, strings.Join(first.tokens, "."))
+				count++
+			}
+		}
+		resp.Counts = append(resp.Counts, count)
+	}
+	r.m.Unlock()
+
+	payload, err := resp.marshal(true)
+	if err != nil {
+		return
+	}
+
+	msg, err := req.NewResponse(payload)
+	if err != nil {
+		return
+	}
+
+	if frame, err := msg.Marshal(); err == nil {
+		mc.enqueue(frame)
+	}
+}
+
+// route delivers the message to every matching connection, with the control
+// data set to the ID of the matching route like rtrouted does.  The sender is
+// nil for injected messages.
+func (r *MemRouter) route(sender *memClient, msg Message) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.messages = append(r.messages, msg)
+
+	topic := strings.Split(msg.Header.Topic, ".")
+
+	delivered := false
+	for mc := range r.clients {
+		for _, route := range mc.routes {
+			if route.matches(topic) {
+				h := *msg.Header
+				h.ControlData = uint32(route.id)
+				routed := Message{Header: &h, Payload: msg.Payload}
+				if frame, err := routed.Marshal(); err == nil {
+					mc.enqueue(frame)
+				}
+				delivered = true
+				break
+			}
+		}
+	}
+
+	if delivered || sender == nil || msg.Header.Flags&FLAGS_REQUEST == 0 {
+		return
+	}
+
+	// Turn the request around without the payload, like rtrouted does.
+	h := *msg.Header
+	h.Topic = h.ReplyTopic
+	h.Flags &^= FLAGS_REQUEST
+	h.Flags |= FLAGS_RESPONSE | FLAGS_UNDELIVERABLE
+
+	undeliverable := Message{Header: &h}
+	if frame, err := undeliverable.Marshal(); err == nil {
+		sender.enqueue(frame)
+	}
+}
+
+func (r *MemRouter) drop(mc *memClient) {
+	r.m.Lock()
+	delete(r.clients, mc)
+	r.m.Unlock()
+
+	mc.m.Lock()
+	mc.closed = true
+	mc.cond.Signal()
+	mc.m.Unlock()
+
+	_ = mc.con.Close()
+}
+
+func (route memRoute) matches(topic []string) bool {
+	return matchRoute(route.tokens, topic)
+}
+
+func (mc *memClient) enqueue(frame []byte) {
+	mc.m.Lock()
+	defer mc.m.Unlock()
+
+	if mc.closed {
+		return
+	}
+
+	mc.queue = append(mc.queue, frame)
+	mc.cond.Signal()
+}
+
+func (mc *memClient) writeLoop() {
+	for {
+		mc.m.Lock()
+		for len(mc.queue) == 0 && !mc.closed {
+			mc.cond.Wait()
+		}
+		if mc.closed {
+			mc.m.Unlock()
+			return
+		}
+		frame := mc.queue[0]
+		mc.queue[0] = nil
+		mc.queue = mc.queue[1:]
+		mc.m.Unlock()
+
+		if _, err := mc.con.Write(frame); err != nil {
+			return
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"slices"
 )
 
 const (
@@ -20,6 +22,9 @@ const (
 	header_MARKER        = 0xaaaa
 	header_MAX_TOPIC_LEN = 128
 	header_MIN           = 32
+
+	header_PREAMBLE_LEN   = 6
+	header_TIMESTAMPS_LEN = 20
 )
 
 type Header struct {
@@ -31,6 +36,13 @@ type Header struct {
 	PayloadLength  uint32
 	Topic          string
 	ReplyTopic     string
+
+	// Timestamps are the T1 to T5 fields, in seconds, that routers built
+	// with MSG_ROUNDTRIP_TIME record as a request travels: the consumer
+	// sending it, the router receiving it, the router writing it to the
+	// provider, the provider responding and the router receiving the
+	// response.  They are zero when the header doesn't carry them.
+	Timestamps [5]uint32
 }
 
 type Message struct {
@@ -39,105 +51,296 @@ type Message struct {
 }
 
 func (h *Header) decodePreamble(buff []byte) error {
-	const headerMagic = uint16(0xaaaa)
+	marker := binary.BigEndian.Uint16(buff)
+	if marker != header_MARKER {
+		return fmt.Errorf("invalid header maggic: 0x%02x. Expected: 0x%02x", marker, header_MARKER)
+	}
+
+	h.Version = binary.BigEndian.Uint16(buff[2:])
+	h.HeaderLength = binary.BigEndian.Uint16(buff[4:])
+
+	return nil
+}
+
+// decodePostPreamble decodes the header following the preamble.  The numbers
+// are read straight from the buffer and both topics share a single string to
+// keep the allocations per message down.
+func (h *Header) decodePostPreamble(buff []byte) error {
+	// sequence number, flags, control data, payload length, topic length
+	if len(buff) < 20 {
+		return io.ErrUnexpectedEOF
+	}
+
+	h.SequenceNumber = binary.BigEndian.Uint32(buff)
+	h.Flags = binary.BigEndian.Uint32(buff[4:])
+	h.ControlData = binary.BigEndian.Uint32(buff[8:])
+	h.PayloadLength = binary.BigEndian.Uint32(buff[12:])
 
-	reader := bytes.NewReader(buff)
-	marker := uint16(0)
+	// topic
+	topicLength := binary.BigEndian.Uint32(buff[16:])
+	if topicLength > header_MAX_TOPIC_LEN {
+		return fmt.Errorf("invalid topic length: %d", topicLength)
+	}
+	topicStart := 20
+	topicEnd := topicStart + int(topicLength)
 
-	// first two bytes are a magic number
-	if err := binary.Read(reader, binary.BigEndian, &marker); err != nil {
-		return err
+	// reply_topic
+	if len(buff) < topicEnd+4 {
+		return io.ErrUnexpectedEOF
+	}
+	replyTopicLen := binary.BigEndian.Uint32(buff[topicEnd:])
+	if replyTopicLen > header_MAX_TOPIC_LEN {
+		return fmt.Errorf("invalid reply topic length: %d", replyTopicLen)
 	}
+	replyStart := topicEnd + 4
+	replyEnd := replyStart + int(replyTopicLen)
+	if len(buff) < replyEnd {
+		return io.ErrUnexpectedEOF
+	}
+
+	topics := string(buff[topicStart:replyEnd])
+	h.Topic = topics[:topicLength]
+	h.ReplyTopic = topics[replyStart-topicStart:]
 
-	if marker != headerMagic {
-		return fmt.Errorf("invalid header maggic: 0x%02x. Expected: 0x%02x", marker, headerMagic)
+	// Those 5 timestamps are only present when rtrouted was built with
+	// MSG_ROUNDTRIP_TIME, so rely on the header length to tell.
+	rest := buff[replyEnd:]
+	if len(rest) >= header_TIMESTAMPS_LEN+2 {
+		for i := range h.Timestamps {
+			h.Timestamps[i] = binary.BigEndian.Uint32(rest[4*i:])
+		}
+		rest = rest[header_TIMESTAMPS_LEN:]
 	}
 
-	// header_version
-	if err := binary.Read(reader, binary.BigEndian, &h.Version); err != nil {
-		return err
+	if len(rest) < 2 {
+		return io.ErrUnexpectedEOF
 	}
 
-	// header_length
-	if err := binary.Read(reader, binary.BigEndian, &h.HeaderLength); err != nil {
-		return err
+	magic := binary.BigEndian.Uint16(rest)
+	if magic != header_MARKER {
+		return fmt.Errorf("invalid header trailer: 0x%02x. Expected: 0x%02x", magic, header_MARKER)
 	}
 
 	return nil
 }
 
-func (h *Header) decodePostPreamble(buff []byte) error {
-	reader := bytes.NewReader(buff)
+// ReadMessage reads exactly one framed message from the reader.  The
+// preamble carries the header length, the header carries the payload length,
+// and each part is read in full so short reads and messages coalesced into a
+// single segment are both handled.
+//
+// The error is io.EOF only if the reader ended cleanly before the message
+// began; a message cut short yields io.ErrUnexpectedEOF.  A frame that does
+// not follow the wire format yields an error matching ErrMalformedMessage.
+// Other errors are returned from the reader as is.
+func ReadMessage(r io.Reader) (Message, error) {
+	mr := messageReader{r: r}
+	return mr.next()
+}
 
-	if err := binary.Read(reader, binary.BigEndian, &h.SequenceNumber); err != nil {
-		return err
+// ReadMessageBuffer reads a message like ReadMessage, reading the payload into
+// buf when it is large enough, so a caller decoding many messages can reuse
+// one buffer, or take them from a sync.Pool, instead of allocating a payload
+// per message.  The payload then shares the memory of buf, and is only valid
+// until buf is used again.  A payload too large for buf is allocated as usual.
+func ReadMessageBuffer(r io.Reader, buf []byte) (Message, error) {
+	mr := messageReader{r: r, payload: buf}
+	return mr.next()
+}
+
+// messageReader reads messages from a stream, reusing its buffer for the
+// headers.  When limit is positive, the payload of a larger message is
+// skipped and an error matching ErrMessageTooLarge is returned, leaving the
+// reader at the next message.  The payloads are read into payload when it is
+// large enough, and allocated otherwise.
+type messageReader struct {
+	r       io.Reader
+	limit   int
+	header  []byte
+	payload []byte
+}
+
+func (mr *messageReader) next() (Message, error) {
+	if cap(mr.header) < header_PREAMBLE_LEN {
+		mr.header = make([]byte, 0, header_MIN+header_TIMESTAMPS_LEN+2*header_MAX_TOPIC_LEN)
 	}
 
-	if err := binary.Read(reader, binary.BigEndian, &h.Flags); err != nil {
-		return err
+	preamble := mr.header[:header_PREAMBLE_LEN]
+	if _, err := io.ReadFull(mr.r, preamble); err != nil {
+		return Message{}, fmt.Errorf("failed to read header preamble: %w", err)
 	}
 
-	if err := binary.Read(reader, binary.BigEndian, &h.ControlData); err != nil {
-		return err
+	header := new(Header)
+	if err := header.decodePreamble(preamble); err != nil {
+		return Message{}, fmt.Errorf("%w: header preamble: %w", ErrMalformedMessage, err)
 	}
 
-	if err := binary.Read(reader, binary.BigEndian, &h.PayloadLength); err != nil {
-		return err
+	if header.HeaderLength < header_MIN {
+		return Message{}, fmt.Errorf("%w: invalid header length: %d", ErrMalformedMessage, header.HeaderLength)
 	}
 
-	// topic
-	topicLength := uint32(0)
-	if err := binary.Read(reader, binary.BigEndian, &topicLength); err != nil {
-		return err
-	}
-	if topicLength > 0 {
-		topic := make([]byte, topicLength)
-		if _, err := reader.Read(topic); err != nil {
-			return err
+	n := int(header.HeaderLength - header_PREAMBLE_LEN)
+	if cap(mr.header) < n {
+		mr.header = make([]byte, 0, n)
+	}
+	buff := mr.header[:n]
+	if _, err := io.ReadFull(mr.r, buff); err != nil {
+		return Message{}, fmt.Errorf("failed to read header: %w", unexpectedEOF(err))
+	}
+
+	if err := header.decodePostPreamble(buff); err != nil {
+		return Message{}, fmt.Errorf("%w: header: %w", ErrMalformedMessage, err)
+	}
+
+	if size := int(header.HeaderLength) + int(header.PayloadLength); mr.limit > 0 && size > mr.limit {
+		if _, err := io.CopyN(io.Discard, mr.r, int64(header.PayloadLength)); err != nil {
+			return Message{}, fmt.Errorf("failed to skip payload: %w", unexpectedEOF(err))
 		}
-		h.Topic = string(topic)
+		return Message{}, fmt.Errorf("%w: received %d bytes on '%s', the limit is %d",
+			ErrMessageTooLarge, size, header.Topic, mr.limit)
 	}
 
-	// reply_topic
-	replyTopicLen := uint32(0)
-	if err := binary.Read(reader, binary.BigEndian, &replyTopicLen); err != nil {
-		return err
+	payload, err := readPayload(mr.r, header.PayloadLength, mr.payload)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to read payload: %w", unexpectedEOF(err))
 	}
-	if replyTopicLen > 0 {
-		replyTopic := make([]byte, replyTopicLen)
-		if _, err := reader.Read(replyTopic); err != nil {
-			return err
+
+	return Message{
+		Header:  header,
+		Payload: payload,
+	}, nil
+}
+
+// payloadChunk bounds what is allocated for a payload before its bytes are
+// read, so that the length in a bogus header can't exhaust the memory.
+const payloadChunk = 64 << 10
+
+// readPayload reads the payload of the length, into dst if it is large
+// enough.  Otherwise a large one is read into a buffer growing as its bytes
+// come in.
+func readPayload(r io.Reader, n uint32, dst []byte) ([]byte, error) {
+	if dst != nil && int64(n) <= int64(cap(dst)) {
+		payload := dst[:n]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, err
 		}
-		h.ReplyTopic = string(replyTopic)
+		return payload, nil
 	}
 
-	// Those 5 timestamps
-	unused := uint32(0)
-	if err := binary.Read(reader, binary.BigEndian, &unused); err != nil {
-		return err
+	if n <= payloadChunk {
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
 	}
-	if err := binary.Read(reader, binary.BigEndian, &unused); err != nil {
-		return err
+
+	var buf bytes.Buffer
+	buf.Grow(payloadChunk)
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, err
 	}
-	if err := binary.Read(reader, binary.BigEndian, &unused); err != nil {
-		return err
+	return buf.Bytes(), nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for reads past the
+// start of a message.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
 	}
-	if err := binary.Read(reader, binary.BigEndian, &unused); err != nil {
-		return err
+	return err
+}
+
+// Marshal encodes the message into the wire format, ready to be written to
+// the router.  The header and payload lengths are computed from the message,
+// so they need not be set, and a zero Version is sent as the current
+// version.  The header always carries the timestamp fields; see
+// WithCompactHeaders for leaving them out.  An error matching ErrInvalidInput
+// is returned when the message has no header, no topic, or a topic that is too
+// long.
+func (m *Message) Marshal() ([]byte, error) {
+	return m.marshal(false)
+}
+
+// marshal encodes the message, leaving out the timestamp fields of the header
+// when compact is set.
+func (m *Message) marshal(compact bool) ([]byte, error) {
+	if m.Header == nil {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidInput)
 	}
-	if err := binary.Read(reader, binary.BigEndian, &unused); err != nil {
-		return err
+
+	h := *m.Header
+	if h.Version == 0 {
+		h.Version = header_VERSION
 	}
 
-	magic := uint16(0)
-	if err := binary.Read(reader, binary.BigEndian, &magic); err != nil {
-		return err
+	// The C library keeps topics in fixed buffers that include the NUL.
+	if len(h.Topic) == 0 || len(h.Topic) >= header_MAX_TOPIC_LEN || len(h.ReplyTopic) >= header_MAX_TOPIC_LEN {
+		return nil, fmt.Errorf("%w: invalid topic length", ErrInvalidInput)
 	}
 
-	return nil
+	h.HeaderLength = uint16(header_MIN + len(h.Topic) + len(h.ReplyTopic))
+	if !compact {
+		h.HeaderLength += header_TIMESTAMPS_LEN
+	}
+	h.PayloadLength = uint32(len(m.Payload))
+
+	header, err := h.encode(compact)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, m.Payload...), nil
+}
+
+// Clone returns a deep copy of the message, so the header and payload of the
+// copy can be changed without affecting the original.
+func (m Message) Clone() Message {
+	clone := Message{}
+	if m.Header != nil {
+		h := *m.Header
+		clone.Header = &h
+	}
+	if m.Payload != nil {
+		clone.Payload = append([]byte{}, m.Payload...)
+	}
+	return clone
 }
 
-func (h *Header) encode() ([]byte, error) {
+// EqualOption changes what Message.Equal compares.
+type EqualOption int
+
+const (
+	// EqualTimestamps compares the timestamps of the headers as well.
+	EqualTimestamps EqualOption = iota + 1
+)
+
+// Equal reports whether the messages carry the same sequence number, flags,
+// control data, topics and payload.  The version and the lengths are ignored
+// since Marshal fills them in, as are the timestamps the router records unless
+// EqualTimestamps is given.  A nil payload equals an empty one.
+func (m Message) Equal(o Message, opts ...EqualOption) bool {
+	if (m.Header == nil) != (o.Header == nil) {
+		return false
+	}
+	if m.Header != nil {
+		a, b := m.Header, o.Header
+		if a.SequenceNumber != b.SequenceNumber ||
+			a.Flags != b.Flags ||
+			a.ControlData != b.ControlData ||
+			a.Topic != b.Topic ||
+			a.ReplyTopic != b.ReplyTopic {
+			return false
+		}
+		if slices.Contains(opts, EqualTimestamps) && a.Timestamps != b.Timestamps {
+			return false
+		}
+	}
+	return bytes.Equal(m.Payload, o.Payload)
+}
+
+func (h *Header) encode(compact bool) ([]byte, error) {
 	buf := new(bytes.Buffer)
 
 	if err := binary.Write(buf, binary.BigEndian, uint16(header_MARKER)); err != nil {
@@ -171,7 +374,7 @@ func (h *Header) encode() ([]byte, error) {
 	// read topic length and topic
 	topicLength := uint32(len(h.Topic))
 	if topicLength == 0 {
-		return nil, fmt.Errorf("invalid topic length of zero")
+		return nil, fmt.Errorf("%w: invalid topic length of zero", ErrInvalidInput)
 	}
 
 	if err := binary.Write(buf, binary.BigEndian, topicLength); err != nil {
@@ -194,26 +397,10 @@ func (h *Header) encode() ([]byte, error) {
 		}
 	}
 
-	// TODO: read the timestamps (not recording them right now)
-	zero := 0
-	if err := binary.Write(buf, binary.BigEndian, uint32(zero)); err != nil {
-		return nil, err
-	}
-
-	if err := binary.Write(buf, binary.BigEndian, uint32(zero)); err != nil {
-		return nil, err
-	}
-
-	if err := binary.Write(buf, binary.BigEndian, uint32(zero)); err != nil {
-		return nil, err
-	}
-
-	if err := binary.Write(buf, binary.BigEndian, uint32(zero)); err != nil {
-		return nil, err
-	}
-
-	if err := binary.Write(buf, binary.BigEndian, uint32(zero)); err != nil {
-		return nil, err
+	if !compact {
+		if err := binary.Write(buf, binary.BigEndian, h.Timestamps); err != nil {
+			return nil, err
+		}
 	}
 
 	// read trailing marker
@@ -238,6 +425,34 @@ func (f MessageListenerFunc) OnMessage(m Message) {
 	f(m)
 }
 
+// ReadErrorListener provides a way to get notified about the errors
+// encountered while reading from the bus.
+type ReadErrorListener interface {
+	OnReadError(error)
+}
+
+// ReadErrorListenerFunc is a function that implements the ReadErrorListener
+// interface.
+type ReadErrorListenerFunc func(error)
+
+func (f ReadErrorListenerFunc) OnReadError(err error) {
+	f(err)
+}
+
+// ReconnectListener provides a way to get notified when a lost connection has
+// been reestablished by automatic reconnecting.
+type ReconnectListener interface {
+	OnReconnect()
+}
+
+// ReconnectListenerFunc is a function that implements the ReconnectListener
+// interface.
+type ReconnectListenerFunc func()
+
+func (f ReconnectListenerFunc) OnReconnect() {
+	f()
+}
+
 // CancelListenerFunc removes the listener it's associated with and cancels any
 // future events sent to that listener.
 //
@@ -0,0 +1,424 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// testMessages are the messages framed by the tests.
+var testMessages = []Message{
+	{
+		Header: &Header{
+			SequenceNumber: 1,
+			Flags:          FLAGS_REQUEST,
+			Topic:          "Device.Test.Get",
+			ReplyTopic:     "test.INBOX",
+		},
+		Payload: []byte("request"),
+	},
+	{
+		Header: &Header{
+			SequenceNumber: 1,
+			Flags:          FLAGS_RESPONSE,
+			ControlData:    7,
+			Topic:          "test.INBOX",
+		},
+	},
+	{
+		Header: &Header{
+			SequenceNumber: 3,
+			Topic:          "Device.Test.Event",
+			Timestamps:     [5]uint32{1, 2, 3, 4, 5},
+		},
+		Payload: bytes.Repeat([]byte{0xa5}, 3*payloadChunk/2),
+	},
+}
+
+// frame marshals the message, failing the test on an error.
+func frame(t testing.TB, m Message) []byte {
+	t.Helper()
+
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// frames marshals the test messages back to back, as a stream.
+func frames(t testing.TB) []byte {
+	t.Helper()
+
+	var b []byte
+	for _, m := range testMessages {
+		b = append(b, frame(t, m)...)
+	}
+	return b
+}
+
+// readAll reads the test messages from the reader, checking each is read back
+// the way it was framed and that the stream then ends cleanly.
+func readAll(t *testing.T, r io.Reader) {
+	t.Helper()
+
+	for i, want := range testMessages {
+		got, err := ReadMessage(r)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !got.Equal(want, EqualTimestamps) {
+			t.Fatalf("message %d: got %v, want %v", i, got, want)
+		}
+	}
+
+	if _, err := ReadMessage(r); err == nil || !errors.Is(err, io.EOF) {
+		t.Fatalf("got %v after the last message, want %v", err, io.EOF)
+	}
+}
+
+func TestReadMessageConcatenated(t *testing.T) {
+	readAll(t, bytes.NewReader(frames(t)))
+}
+
+func TestReadMessageOneByteReads(t *testing.T) {
+	readAll(t, iotest.OneByteReader(bytes.NewReader(frames(t))))
+}
+
+func TestReadMessageHalfReads(t *testing.T) {
+	readAll(t, iotest.HalfReader(bytes.NewReader(frames(t))))
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	b := frame(t, testMessages[0])
+
+	// Every cut short of the whole frame is an unexpected EOF, except
+	// before the frame began.
+	for n := 1; n < len(b); n++ {
+		_, err := ReadMessage(bytes.NewReader(b[:n]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("cut at %d of %d: got %v, want %v", n, len(b), err, io.ErrUnexpectedEOF)
+		}
+	}
+
+	if _, err := ReadMessage(bytes.NewReader(nil)); err == nil || !errors.Is(err, io.EOF) {
+		t.Fatalf("got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReadMessageOversized(t *testing.T) {
+	// The header claims 4 GiB of payload, but only a few bytes follow.
+	b := frame(t, testMessages[0])
+	binary.BigEndian.PutUint32(b[16:], 0xffffffff)
+
+	allocs := testing.AllocsPerRun(1, func() {
+		_, err := ReadMessage(bytes.NewReader(b))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("got %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+	if allocs > 20 {
+		t.Fatalf("%v allocations for a bogus payload length", allocs)
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	// The last test message is left out, as its payload is too large for
+	// the fuzzer to get anywhere with.
+	var stream []byte
+	for _, m := range testMessages[:len(testMessages)-1] {
+		b := frame(f, m)
+		f.Add(b)
+		f.Add(b[:len(b)/2])
+		stream = append(stream, b...)
+	}
+	f.Add(stream)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		msg, err := ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, ErrMalformedMessage) {
+				t.Fatalf("got %v, want an EOF or %v", err, ErrMalformedMessage)
+			}
+			return
+		}
+
+		// Whatever is read is framed again the same way.
+		again, err := msg.Marshal()
+		if err != nil {
+			return
+		}
+		got, err := ReadMessage(bytes.NewReader(again))
+		if err != nil {
+			t.Fatalf("reading % x: %v", again, err)
+		}
+		if !got.Equal(msg, EqualTimestamps) {
+			t.Fatalf("got %v, want %v", got, msg)
+		}
+	})
+}
+
+func TestReadMessageTooLargeSkipsPayload(t *testing.T) {
+	big := testMessages[2]
+	b := append(frame(t, big), frame(t, testMessages[1])...)
+
+	mr := messageReader{r: bytes.NewReader(b), limit: 1024}
+	if _, err := mr.next(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooLarge)
+	}
+
+	// The reader is left at the next message.
+	got, err := mr.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(testMessages[1]) {
+		t.Fatalf("got %v, want %v", got, testMessages[1])
+	}
+}
+
+func TestReadMessageMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		mangle func(b []byte)
+	}{
+		{name: "marker", mangle: func(b []byte) { b[0] = 0 }},
+		{name: "short header length", mangle: func(b []byte) { binary.BigEndian.PutUint16(b[4:], header_MIN-1) }},
+		{name: "topic length", mangle: func(b []byte) { binary.BigEndian.PutUint32(b[22:], header_MAX_TOPIC_LEN+1) }},
+		{name: "reply topic length", mangle: func(b []byte) {
+			binary.BigEndian.PutUint32(b[26+len(testMessages[0].Header.Topic):], 0xffffffff)
+		}},
+		{name: "trailer", mangle: func(b []byte) {
+			n := binary.BigEndian.Uint16(b[4:])
+			b[n-1] = 0
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := frame(t, testMessages[0])
+			tc.mangle(b)
+
+			if _, err := ReadMessage(bytes.NewReader(b)); !errors.Is(err, ErrMalformedMessage) {
+				t.Fatalf("got %v, want %v", err, ErrMalformedMessage)
+			}
+		})
+	}
+}
+
+func TestReadMessageReaderError(t *testing.T) {
+	boom := errors.New("boom")
+	b := frame(t, testMessages[0])
+
+	r := io.MultiReader(bytes.NewReader(b[:10]), iotest.ErrReader(boom))
+	if _, err := ReadMessage(r); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := Message{
+		Header: &Header{
+			SequenceNumber: 1,
+			Topic:          "Device.Test",
+			Timestamps:     [5]uint32{1, 2, 3, 4, 5},
+		},
+		Payload: []byte("payload"),
+	}
+
+	clone := m.Clone()
+	if !clone.Equal(m, EqualTimestamps) {
+		t.Fatalf("got %v, want %v", clone, m)
+	}
+
+	clone.Header.Topic = "Device.Other"
+	clone.Header.Flags = FLAGS_TAINTED
+	clone.Header.Timestamps[0] = 42
+	clone.Payload[0] = 'P'
+	if m.Header.Topic != "Device.Test" || m.Header.Flags != 0 || m.Header.Timestamps[0] != 1 ||
+		string(m.Payload) != "payload" {
+		t.Fatalf("changing the clone changed the original: %v %q", m, m.Payload)
+	}
+
+	if c := (Message{}).Clone(); c.Header != nil || c.Payload != nil {
+		t.Fatalf("got %v", c)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	base := Message{
+		Header: &Header{
+			Version:        header_VERSION,
+			HeaderLength:   60,
+			SequenceNumber: 1,
+			Flags:          FLAGS_REQUEST,
+			ControlData:    2,
+			PayloadLength:  7,
+			Topic:          "Device.Test",
+			ReplyTopic:     "test.INBOX",
+			Timestamps:     [5]uint32{1, 2, 3, 4, 5},
+		},
+		Payload: []byte("payload"),
+	}
+
+	tests := []struct {
+		name       string
+		change     func(m *Message)
+		equal      bool
+		timestamps bool // whether equal with EqualTimestamps
+	}{
+		{name: "same", change: func(m *Message) {}, equal: true, timestamps: true},
+		{name: "version", change: func(m *Message) { m.Header.Version = 1 }, equal: true, timestamps: true},
+		{name: "lengths", change: func(m *Message) { m.Header.HeaderLength, m.Header.PayloadLength = 0, 0 }, equal: true, timestamps: true},
+		{name: "timestamps", change: func(m *Message) { m.Header.Timestamps = [5]uint32{} }, equal: true},
+		{name: "sequence number", change: func(m *Message) { m.Header.SequenceNumber++ }},
+		{name: "flags", change: func(m *Message) { m.Header.Flags |= FLAGS_RAW_BINARY }},
+		{name: "control data", change: func(m *Message) { m.Header.ControlData++ }},
+		{name: "topic", change: func(m *Message) { m.Header.Topic = "Device.Other" }},
+		{name: "reply topic", change: func(m *Message) { m.Header.ReplyTopic = "" }},
+		{name: "payload", change: func(m *Message) { m.Payload = []byte("other") }},
+		{name: "header", change: func(m *Message) { m.Header = nil }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := base.Clone()
+			tc.change(&m)
+
+			if got := m.Equal(base); got != tc.equal {
+				t.Fatalf("Equal: got %t, want %t", got, tc.equal)
+			}
+			if got := base.Equal(m); got != tc.equal {
+				t.Fatalf("Equal reversed: got %t, want %t", got, tc.equal)
+			}
+			if got := m.Equal(base, EqualTimestamps); got != tc.timestamps {
+				t.Fatalf("Equal with timestamps: got %t, want %t", got, tc.timestamps)
+			}
+		})
+	}
+
+	empty := Message{Header: &Header{Topic: "A"}}
+	if !empty.Equal(Message{Header: &Header{Topic: "A"}, Payload: []byte{}}) {
+		t.Fatal("nil payload differs from an empty one")
+	}
+}
+
+func TestReadMessageBuffer(t *testing.T) {
+	want := testMessages[0]
+	b := frame(t, want)
+
+	buf := make([]byte, 64)
+	got, err := ReadMessageBuffer(bytes.NewReader(b), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if &got.Payload[0] != &buf[0] {
+		t.Fatal("payload not read into the buffer")
+	}
+
+	// A buffer too small is left alone.
+	small := make([]byte, 2)
+	got, err = ReadMessageBuffer(bytes.NewReader(b), small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if string(small) != "\x00\x00" {
+		t.Fatalf("buffer too small written to: %q", small)
+	}
+}
+
+func TestReadMessagePayloadNotShared(t *testing.T) {
+	// Without a buffer of the caller's, each message gets its own payload.
+	r := bytes.NewReader(frames(t))
+	mr := messageReader{r: r}
+
+	first, err := mr.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range len(testMessages) - 1 {
+		if _, err := mr.next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(first.Payload) != string(testMessages[0].Payload) {
+		t.Fatalf("got %q after reading on", first.Payload)
+	}
+}
+
+func TestReadMessageAllocs(t *testing.T) {
+	b := frame(t, testMessages[0])
+	r := bytes.NewReader(b)
+
+	// The header, the string shared by both topics, and the payload.
+	mr := messageReader{r: r}
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(b)
+		if _, err := mr.next(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 3 {
+		t.Fatalf("%v allocations per message, want at most 3", allocs)
+	}
+
+	// The payload comes from the buffer.
+	mr = messageReader{r: r, payload: make([]byte, 64)}
+	allocs = testing.AllocsPerRun(100, func() {
+		r.Reset(b)
+		if _, err := mr.next(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 2 {
+		t.Fatalf("%v allocations per message with a buffer, want at most 2", allocs)
+	}
+}
+
+// benchmarkReadMessage reads the test messages over and over, through read.
+func benchmarkReadMessage(b *testing.B, read func(r io.Reader) (Message, error)) {
+	stream := frames(b)
+	r := bytes.NewReader(stream)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(stream)))
+	b.ResetTimer()
+	for range b.N {
+		r.Reset(stream)
+		for range testMessages {
+			if _, err := read(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkReadMessage(b *testing.B) {
+	benchmarkReadMessage(b, ReadMessage)
+}
+
+func BenchmarkReadMessageBuffer(b *testing.B) {
+	buf := make([]byte, 2*payloadChunk)
+	benchmarkReadMessage(b, func(r io.Reader) (Message, error) {
+		return ReadMessageBuffer(r, buf)
+	})
+}
+
+func BenchmarkMessageReader(b *testing.B) {
+	mr := messageReader{}
+	benchmarkReadMessage(b, func(r io.Reader) (Message, error) {
+		mr.r = r
+		return mr.next()
+	})
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// Messages returns a channel receiving the messages routed to the connection,
+// as an alternative to adding a MessageListener.  Like a listener, it doesn't
+// subscribe to anything by itself.  The channel holds up to buffer messages;
+// when it is full the policy decides whether the message is dropped
+// (QueueReject), the oldest message in the channel is dropped to make room
+// (QueueDropOldest), or delivery waits for room (QueueBlock), stalling the
+// other listeners as well.
+//
+// The channel is closed when the cancel function is called or the connection
+// ends, as signaled by Done.
+func (c *Connection) Messages(buffer int, policy QueuePolicy) (<-chan Message, CancelListenerFunc) {
+	ch := make(chan Message, max(buffer, 0))
+	stop := make(chan struct{})
+
+	// Sending holds the read lock, so closing the channel under the write
+	// lock can't race with a send.
+	var m sync.RWMutex
+
+	listener := MessageListenerFunc(func(msg Message) {
+		m.RLock()
+		defer m.RUnlock()
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		switch policy {
+		case QueueBlock:
+			select {
+			case ch <- msg:
+			case <-stop:
+			}
+		case QueueDropOldest:
+			select {
+			case ch <- msg:
+				return
+			default:
+			}
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- msg:
+			default:
+			}
+		default:
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	})
+
+	remove := c.listeners.Add(listener)
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			// Unblock a pending send first, as removing the listener
+			// waits for the delivery in progress.
+			close(stop)
+			remove()
+
+			m.Lock()
+			close(ch)
+			m.Unlock()
+		})
+	}
+
+	done := c.Done()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-stop:
+		}
+	}()
+
+	return ch, cancel
+}
+
+// iterBuffer is the number of messages Iter buffers for the loop body.
+const iterBuffer = 64
+
+// Iter returns an iterator over the messages routed to the connection, in the
+// order they are read from the router; with WithDispatchWorkers, only the
+// messages on a single topic are guaranteed to be in order.  Like Messages,
+// it doesn't subscribe to anything by itself.  Up to 64 messages are buffered
+// while the loop body runs, after which delivery to the other listeners waits
+// for the loop.
+//
+// The iteration ends when the loop breaks, the context is done or the
+// connection ends.  In the latter two cases the final iteration yields the
+// context's error or the error that ended the connection, unless it was ended
+// on purpose.
+func (c *Connection) Iter(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		ch, cancel := c.Messages(iterBuffer, QueueBlock)
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				yield(Message{}, ctx.Err())
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					if err := c.Err(); err != nil {
+						yield(Message{}, err)
+					}
+					return
+				}
+				if !yield(msg, nil) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+// inject routes messages with the payloads to the topic, waiting for the
+// connection to have received them.
+func inject(t *testing.T, r *MemRouter, c *Connection, topic string, payloads ...string) {
+	t.Helper()
+
+	before := c.Stats().MessagesReceived
+	for _, p := range payloads {
+		if err := r.Inject(Message{Header: &Header{Topic: topic}, Payload: []byte(p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, "the messages", func() bool {
+		return c.Stats().MessagesReceived >= before+uint64(len(payloads))
+	})
+
+	// Let the dispatcher hand the last one over.
+	time.Sleep(20 * time.Millisecond)
+}
+
+// payloads drains the channel, returning the payloads of its messages.
+func payloads(ch <-chan Message) []string {
+	var got []string
+	for {
+		select {
+		case msg := <-ch:
+			got = append(got, string(msg.Payload))
+		default:
+			return got
+		}
+	}
+}
+
+func TestMessagesPolicy(t *testing.T) {
+	tests := []struct {
+		policy QueuePolicy
+		want   []string
+	}{
+		{policy: QueueReject, want: []string{"1", "2"}},
+		{policy: QueueDropOldest, want: []string{"3", "4"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			r, url := newTestRouter(t)
+			c := newTestConnection(t, url, "test.INBOX")
+
+			ch, cancel := c.Messages(2, tc.policy)
+			defer cancel()
+			if err := c.Subscribe("Test.Event"); err != nil {
+				t.Fatal(err)
+			}
+			eventually(t, "the route", func() bool { return routes(r, "Test.Event") > 0 })
+
+			inject(t, r, c, "Test.Event", "1", "2", "3", "4")
+			if got := payloads(ch); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMessagesBlock(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	ch, cancel := c.Messages(1, QueueBlock)
+	defer cancel()
+	other := subscribe(t, r, c, "Test.Event")
+
+	// Not inject, as the read loop waits for the channel.
+	for _, p := range []string{"1", "2", "3"} {
+		if err := r.Inject(Message{Header: &Header{Topic: "Test.Event"}, Payload: []byte(p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Nothing is lost: the delivery waits for the channel, holding up the
+	// other listeners meanwhile.
+	for _, want := range []string{"1", "2", "3"} {
+		if got := receive(t, ch); string(got.Payload) != want {
+			t.Fatalf("got %q, want %q", got.Payload, want)
+		}
+	}
+	for _, want := range []string{"1", "2", "3"} {
+		if got := receive(t, other); string(got.Payload) != want {
+			t.Fatalf("other listener: got %q, want %q", got.Payload, want)
+		}
+	}
+}
+
+func TestMessagesCancel(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	listeners := c.Stats().Subscriptions
+
+	// Canceling unblocks a delivery waiting for room.
+	ch, cancel := c.Messages(0, QueueBlock)
+	if err := c.Subscribe("Test.Event"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the route", func() bool { return routes(r, "Test.Event") > 0 })
+	if err := r.Inject(Message{Header: &Header{Topic: "Test.Event"}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatal("channel not closed by cancel")
+	}
+	if n := c.Stats().Subscriptions; n != listeners {
+		t.Fatalf("%d listeners after cancel, want %d", n, listeners)
+	}
+
+	// The connection carries on with its other listeners.
+	other := subscribe(t, r, c, "Test.Other")
+	inject(t, r, c, "Test.Other", "after")
+	if got := receive(t, other); string(got.Payload) != "after" {
+		t.Fatalf("got %q", got.Payload)
+	}
+}
+
+func TestMessagesConnectionEnds(t *testing.T) {
+	_, url := newTestRouter(t)
+	goroutines := runtime.NumGoroutine()
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var channels []<-chan Message
+	for range 10 {
+		ch, _ := c.Messages(1, QueueDropOldest)
+		channels = append(channels, ch)
+	}
+
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range channels {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatal("message after Disconnect")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("channel not closed by Disconnect")
+		}
+	}
+
+	if n := c.Stats().Subscriptions; n != 0 {
+		t.Fatalf("%d listeners left", n)
+	}
+	eventually(t, "the goroutines to exit", func() bool {
+		return runtime.NumGoroutine() <= goroutines
+	})
+}
+
+func ExampleConnection_Messages() {
+	r, err := NewMemRouter("example-messages")
+	if err != nil {
+		panic(err)
+	}
+	defer r.Close()
+
+	c, err := New("mem://example-messages", "example", WithSubscription("Device.Example.*"))
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	ch, cancel := c.Messages(16, QueueBlock)
+	defer cancel()
+
+	ctx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+
+	if err := c.Connect(ctx); err != nil {
+		panic(err)
+	}
+	for !slices.Contains(r.Subscriptions(), "Device.Example.*") {
+		time.Sleep(time.Millisecond)
+	}
+	for _, s := range []string{"one", "two", "three"} {
+		_ = r.Inject(Message{Header: &Header{Topic: "Device.Example.Event"}, Payload: []byte(s)})
+	}
+
+	for received := 0; received < 3; {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				fmt.Println("connection ended:", c.Err())
+				return
+			}
+			fmt.Printf("%s: %s\n", msg.Header.Topic, msg.Payload)
+			received++
+		case <-ctx.Done():
+			fmt.Println("gave up:", ctx.Err())
+			return
+		}
+	}
+
+	// Output:
+	// Device.Example.Event: one
+	// Device.Example.Event: two
+	// Device.Example.Event: three
+}
+
+func TestIterBreak(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	listeners := c.Stats().Subscriptions
+
+	if err := c.Subscribe("Test.Event"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the route", func() bool { return routes(r, "Test.Event") > 0 })
+
+	go func() {
+		for _, p := range []string{"1", "2", "3", "4"} {
+			_ = r.Inject(Message{Header: &Header{Topic: "Test.Event"}, Payload: []byte(p)})
+		}
+	}()
+
+	var got []string
+	for msg, err := range c.Iter(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(msg.Payload))
+		if len(got) == 2 {
+			break
+		}
+	}
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("got %v, want the first two in order", got)
+	}
+
+	// Breaking out removed the listener.
+	if n := c.Stats().Subscriptions; n != listeners {
+		t.Fatalf("%d listeners after the loop, want %d", n, listeners)
+	}
+}
+
+func TestIterContext(t *testing.T) {
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	listeners := c.Stats().Subscriptions
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var errs []error
+	for _, err := range c.Iter(ctx) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a final %v", errs, context.DeadlineExceeded)
+	}
+	if n := c.Stats().Subscriptions; n != listeners {
+		t.Fatalf("%d listeners after the loop, want %d", n, listeners)
+	}
+}
+
+func TestIterConnectionLost(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r.DropConnections()
+	}()
+
+	var errs []error
+	for _, err := range c.Iter(context.Background()) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrConnectionClosed) {
+		t.Fatalf("got %v, want a final %v", errs, ErrConnectionClosed)
+	}
+}
+
+func TestIterDisconnect(t *testing.T) {
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = c.Disconnect()
+	}()
+
+	// Ended on purpose, so without an error.
+	for _, err := range c.Iter(context.Background()) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import "sync/atomic"
+
+// Metrics receives notifications about the traffic on a Connection.  The
+// methods are called synchronously from the sending goroutine or the read
+// loop, so implementations must be fast and safe for concurrent use.
+type Metrics interface {
+	// Connected is called each time the connection to the router is
+	// established.
+	Connected()
+
+	// MessageSent is called after a message has been written to the router.
+	// The bytes include the header.
+	MessageSent(topic string, bytes int)
+
+	// MessageReceived is called for each message read from the router.  The
+	// bytes include the header.
+	MessageReceived(topic string, bytes int)
+
+	// Undeliverable is called when the router reflects a message back
+	// because nobody is listening on the topic.
+	Undeliverable(topic string)
+
+	// Duplicate is called when a message is dropped because it was already
+	// received within the dedup window.
+	Duplicate(topic string)
+
+	// ReadError is called when the read loop fails or a message from the
+	// router cannot be decoded.
+	ReadError(err error)
+}
+
+// Counters is a Metrics implementation that simply counts events.  It is
+// useful in tests and is easy to publish, for example via expvar:
+//
+//	counters := new(rtmessage.Counters)
+//	expvar.Publish("rtmessage", expvar.Func(func() any {
+//		return counters.Map()
+//	}))
+//
+//	con, err := rtmessage.New(url, appName, rtmessage.WithMetrics(counters))
+type Counters struct {
+	Connects         atomic.Uint64
+	MessagesSent     atomic.Uint64
+	BytesSent        atomic.Uint64
+	MessagesReceived atomic.Uint64
+	BytesReceived    atomic.Uint64
+	Undeliverables   atomic.Uint64
+	Duplicates       atomic.Uint64
+	ReadErrors       atomic.Uint64
+}
+
+var _ Metrics = (*Counters)(nil)
+
+// Connected counts a connection to the router established.
+func (c *Counters) Connected() {
+	c.Connects.Add(1)
+}
+
+// MessageSent counts a message written to the router and its bytes.
+func (c *Counters) MessageSent(_ string, bytes int) {
+	c.MessagesSent.Add(1)
+	c.BytesSent.Add(uint64(bytes))
+}
+
+// MessageReceived counts a message read from the router and its bytes.
+func (c *Counters) MessageReceived(_ string, bytes int) {
+	c.MessagesReceived.Add(1)
+	c.BytesReceived.Add(uint64(bytes))
+}
+
+// Undeliverable counts a message the router reflected back.
+func (c *Counters) Undeliverable(string) {
+	c.Undeliverables.Add(1)
+}
+
+// Duplicate counts a message dropped as already received.
+func (c *Counters) Duplicate(string) {
+	c.Duplicates.Add(1)
+}
+
+// ReadError counts a failure of the read loop or to decode a message.
+func (c *Counters) ReadError(error) {
+	c.ReadErrors.Add(1)
+}
+
+// Map returns the current counter values keyed by name.
+func (c *Counters) Map() map[string]uint64 {
+	return map[string]uint64{
+		"connects":          c.Connects.Load(),
+		"messages_sent":     c.MessagesSent.Load(),
+		"bytes_sent":        c.BytesSent.Load(),
+		"messages_received": c.MessagesReceived.Load(),
+		"bytes_received":    c.BytesReceived.Load(),
+		"undeliverables":    c.Undeliverables.Load(),
+		"duplicates":        c.Duplicates.Load(),
+		"read_errors":       c.ReadErrors.Load(),
+	}
+}
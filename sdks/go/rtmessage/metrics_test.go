@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	r, url := newTestRouter(t)
+	counters := new(Counters)
+	c := newTestConnection(t, url, "test.INBOX", WithMetrics(counters), WithDedup(time.Minute))
+	ch := subscribe(t, r, c, "Test.Event")
+
+	if n := counters.Connects.Load(); n != 1 {
+		t.Fatalf("counted %d connects, want 1", n)
+	}
+
+	event := Message{
+		Header:  &Header{SequenceNumber: 42, Topic: "Test.Event"},
+		Payload: []byte("once"),
+	}
+
+	// Each step moves the counters by the messages, along with the bytes of
+	// those sent and received.
+	steps := []struct {
+		name string
+		do   func()
+		want map[string]uint64
+	}{
+		{
+			name: "send",
+			do: func() {
+				err := c.SendAsync(Message{
+					Header:  &Header{Topic: "Test.Other"},
+					Payload: []byte("hello"),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]uint64{"messages_sent": 1},
+		}, {
+			name: "receive",
+			do: func() {
+				if err := r.Inject(event); err != nil {
+					t.Fatal(err)
+				}
+				receive(t, ch)
+			},
+			want: map[string]uint64{"messages_received": 1},
+		}, {
+			name: "duplicate",
+			do: func() {
+				if err := r.Inject(event); err != nil {
+					t.Fatal(err)
+				}
+				nothingReceived(t, ch, 20*time.Millisecond)
+			},
+			want: map[string]uint64{"messages_received": 1, "duplicates": 1},
+		}, {
+			name: "undeliverable",
+			do: func() {
+				err := c.SendAsync(Message{
+					Header: &Header{
+						SequenceNumber: 7,
+						Flags:          FLAGS_REQUEST,
+						Topic:          "Device.Nobody",
+						ReplyTopic:     c.Inbox(),
+					},
+					Payload: []byte("hello"),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]uint64{"messages_sent": 1, "messages_received": 1, "undeliverables": 1},
+		},
+	}
+
+	for _, step := range steps {
+		before := counters.Map()
+		step.do()
+
+		delta := func() map[string]uint64 {
+			d := make(map[string]uint64)
+			for k, v := range counters.Map() {
+				if n := v - before[k]; n != 0 {
+					d[k] = n
+				}
+			}
+			return d
+		}
+		moved := func(k string) bool { return delta()[k] == step.want[k] }
+		eventually(t, step.name, func() bool {
+			return moved("messages_sent") && moved("messages_received") && moved("undeliverables")
+		})
+
+		got := delta()
+		for messages, bytes := range map[string]string{"messages_sent": "bytes_sent", "messages_received": "bytes_received"} {
+			if (got[bytes] > 0) != (got[messages] > 0) {
+				t.Fatalf("%s: got %d %s along with %d %s", step.name, got[bytes], bytes, got[messages], messages)
+			}
+			delete(got, bytes)
+		}
+		if !maps.Equal(got, step.want) {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Option interface for setting configuration options on a Connection.
+type Option interface {
+	apply(*Connection) error
+}
+
+// optionFunc wraps a function that modifies a Connection into an
+// implementation of the Option interface.
+type optionFunc func(*Connection) error
+
+func (f optionFunc) apply(c *Connection) error {
+	return f(c)
+}
+
+// Assure that optionFunc implements the Option interface.
+var _ Option = optionFunc(nil)
+
+// WithRequestTimeout sets the default deadline applied to round trips with
+// the router (such as subscription requests) when the caller's context does
+// not already carry a deadline.  A caller supplied deadline always takes
+// precedence.  A zero value disables the default and keeps the round trip
+// unbounded.
+func WithRequestTimeout(d time.Duration) Option {
+	return optionFunc(func(c *Connection) error {
+		if d < 0 {
+			return fmt.Errorf("%w: negative request timeout", ErrInvalidInput)
+		}
+		c.requestTimeout = d
+		return nil
+	})
+}
+
+// WithFallbackURLs adds routers to try, in order, when the one given to New
+// can't be reached.  The router that was reached last is tried first when
+// reconnecting.  When none can be reached, Connect returns the errors of each
+// attempt joined.  The connect timeout applies to each attempt.
+func WithFallbackURLs(rawURLs ...string) Option {
+	return optionFunc(func(c *Connection) error {
+		for _, rawURL := range rawURLs {
+			u, err := parseURL(rawURL)
+			if err != nil {
+				return err
+			}
+			c.urls = append(c.urls, u)
+		}
+		return nil
+	})
+}
+
+// WithConnectTimeout bounds how long Connect waits for the connection to the
+// router to be established.  When the timeout fires, Connect returns an error
+// matching context.DeadlineExceeded.  A zero value leaves the dial bounded
+// only by the operating system, which is the default.
+func WithConnectTimeout(d time.Duration) Option {
+	return optionFunc(func(c *Connection) error {
+		if d < 0 {
+			return fmt.Errorf("%w: negative connect timeout", ErrInvalidInput)
+		}
+		c.connectTimeout = d
+		return nil
+	})
+}
+
+// WithReadTimeout sets how long a read from the router may wait.  A timeout
+// between messages is reported to the ReadErrorListeners as ErrIdleTimeout and
+// the connection stays up; a timeout part way through a message is reported
+// as ErrProtocol and ends the connection.  See WithIdlePolicy for ending the
+// connection after a long enough quiet period.  A zero value disables the
+// timeout, which is the default.
+func WithReadTimeout(d time.Duration) Option {
+	return optionFunc(func(c *Connection) error {
+		if d < 0 {
+			return fmt.Errorf("%w: negative read timeout", ErrInvalidInput)
+		}
+		c.readTimeout = d
+		return nil
+	})
+}
+
+// WithCompactHeaders sends messages with the 32 byte header variant that
+// leaves out the timestamp fields, as used by routers built without
+// MSG_ROUNDTRIP_TIME; some of them reject the longer header.  Messages are read
+// in either form regardless.  The default sends the timestamp fields.
+func WithCompactHeaders(compact bool) Option {
+	return optionFunc(func(c *Connection) error {
+		c.compact = compact
+		return nil
+	})
+}
+
+// WithMaxMessageSize limits the size of a message, header included.  Sending
+// a larger message fails with an error matching ErrMessageTooLarge instead of
+// having the router hang up, and a larger message received is skipped and
+// reported to the ReadErrorListeners as ErrMessageTooLarge.  Zero means no
+// limit, which is the default.
+func WithMaxMessageSize(n int) Option {
+	return optionFunc(func(c *Connection) error {
+		if n < 0 {
+			return fmt.Errorf("%w: negative max message size", ErrInvalidInput)
+		}
+		c.maxMessageSize = n
+		return nil
+	})
+}
+
+// WithIdlePolicy sets what happens when the read timeout expires between
+// messages.  By default the connection stays up, and each timeout is only
+// reported as ErrIdleTimeout.
+func WithIdlePolicy(p IdlePolicy) Option {
+	return optionFunc(func(c *Connection) error {
+		if p.MaxIdle < 0 {
+			return fmt.Errorf("%w: negative max idle", ErrInvalidInput)
+		}
+		c.idlePolicy = p
+		return nil
+	})
+}
+
+// WithTCPKeepAlive sets the interval of the TCP keep-alive probes on tcp
+// connections, so a router that became unreachable without closing the
+// connection is noticed: once the probes go unanswered, after roughly ten
+// intervals on Linux, the read fails and the connection is treated as lost,
+// reconnecting if enabled.  WithReadTimeout doesn't help there, as an idle
+// timeout leaves the connection up.  The option is ignored for other schemes.
+// A zero value keeps the default of the net package, 15 seconds.
+func WithTCPKeepAlive(interval time.Duration) Option {
+	return optionFunc(func(c *Connection) error {
+		if interval < 0 {
+			return fmt.Errorf("%w: negative keep-alive interval", ErrInvalidInput)
+		}
+		c.keepAlive = interval
+		return nil
+	})
+}
+
+// WithSendQueueSize sets how many messages can wait to be written to the
+// router.  The default is 64.
+func WithSendQueueSize(n int) Option {
+	return optionFunc(func(c *Connection) error {
+		if n <= 0 {
+			return fmt.Errorf("%w: send queue size must be positive", ErrInvalidInput)
+		}
+		c.sendQueueSize = n
+		return nil
+	})
+}
+
+// WithSendQueuePolicy sets what SendAsync does when the send queue is full.
+// The default is QueueReject.  Send always waits for room, bounded by its
+// context.
+func WithSendQueuePolicy(p QueuePolicy) Option {
+	return optionFunc(func(c *Connection) error {
+		switch p {
+		case QueueReject, QueueBlock:
+		default:
+			return fmt.Errorf("%w: unknown queue policy", ErrInvalidInput)
+		}
+		c.sendQueuePolicy = p
+		return nil
+	})
+}
+
+// WithDispatchWorkers calls the message listeners from n worker goroutines
+// instead of the goroutine reading from the router, so a slow listener doesn't
+// stall the connection.  Each worker has a queue of the given size, and all
+// messages on a topic go to the same worker so they stay in order.  When a
+// queue is full the reader waits for room, unless WithDispatchPolicy selected
+// QueueReject, in which case the message is dropped and reported to the read
+// error listeners as ErrDispatchQueueFull.  The default of zero workers calls
+// the listeners from the reader.
+func WithDispatchWorkers(n int, queue int) Option {
+	return optionFunc(func(c *Connection) error {
+		if n < 0 || queue < 0 {
+			return fmt.Errorf("%w: negative dispatch workers or queue", ErrInvalidInput)
+		}
+		c.dispatchWorkers = n
+		c.dispatchQueue = queue
+		return nil
+	})
+}
+
+// WithDispatchPolicy sets what happens when a dispatch queue is full.  The
+// default is QueueBlock.
+func WithDispatchPolicy(p QueuePolicy) Option {
+	return optionFunc(func(c *Connection) error {
+		switch p {
+		case QueueReject, QueueBlock:
+		default:
+			return fmt.Errorf("%w: unknown queue policy", ErrInvalidInput)
+		}
+		c.dispatchPolicy = p
+		return nil
+	})
+}
+
+// WithSubscription subscribes to the expression each time the connection is
+// established.
+func WithSubscription(expression string) Option {
+	return WithSubscriptions(expression)
+}
+
+// WithSubscriptions subscribes to the expressions each time the connection is
+// established.
+func WithSubscriptions(expressions ...string) Option {
+	return optionFunc(func(c *Connection) error {
+		for _, expression := range expressions {
+			if err := validateExpression(expression); err != nil {
+				return err
+			}
+			if _, found := c.subs.exprs[expression]; !found {
+				c.subs.exprs[expression] = &subscription{
+					routeID: c.generator.getNextSubscriptionID(),
+					pinned:  true,
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// WithInbox sets the topic of the connection's inbox, which responses and
+// messages to the connection are sent to.  The default is made of the
+// application name, the program name and the process id, so it has to be set
+// for the connections of a process to be told apart.
+func WithInbox(topic string) Option {
+	return optionFunc(func(c *Connection) error {
+		if topic == "" {
+			return fmt.Errorf("%w: empty inbox", ErrInvalidInput)
+		}
+		c.inbox = topic
+		return nil
+	})
+}
+
+// WithMetrics sets the sink notified about the traffic on the connection.  By
+// default no metrics are collected.
+func WithMetrics(m Metrics) Option {
+	return optionFunc(func(c *Connection) error {
+		c.metrics = m
+		return nil
+	})
+}
+
+// WithDedup enables dropping messages that are delivered more than once, as
+// can happen around a reconnect.  A message is a duplicate when a message with
+// the same topic and sequence number was received within the window.  Dropped
+// messages are reported via Metrics.Duplicate.  A zero window disables the
+// check, which is the default.
+func WithDedup(window time.Duration) Option {
+	return optionFunc(func(c *Connection) error {
+		if window < 0 {
+			return fmt.Errorf("%w: negative dedup window", ErrInvalidInput)
+		}
+		c.dedup = nil
+		if window > 0 {
+			c.dedup = newDedupWindow(window)
+		}
+		return nil
+	})
+}
+
+// WithSequenceTracking watches the sequence numbers of the messages received
+// from each sender, identified by its reply topic, and reports gaps and
+// duplicates to the GapListeners.  It is purely observational: the messages
+// are delivered regardless.  Memory use is bounded by tracking a fixed window
+// of sequence numbers for a limited number of recent senders.
+func WithSequenceTracking() Option {
+	return optionFunc(func(c *Connection) error {
+		c.seqTracker = newSeqTracker()
+		return nil
+	})
+}
+
+// WithLatencyListener calls the function with the transit latency of each
+// message received that carries timestamps; see Message.TransitLatency.  It is
+// called from the read loop, so it must be fast.
+func WithLatencyListener(f func(topic string, d time.Duration)) Option {
+	return optionFunc(func(c *Connection) error {
+		if f == nil {
+			return fmt.Errorf("%w: nil latency listener", ErrInvalidInput)
+		}
+		c.latency = f
+		return nil
+	})
+}
+
+// WithIgnoreSelf drops the messages this connection published that the router
+// delivers back to it because it is subscribed to their topic as well.  To tell
+// them apart, published messages without a reply topic are sent with the
+// connection's inbox as the reply topic.  Requests, responses and messages
+// addressed to the inbox are never dropped.  The number of messages dropped
+// is in Stats.
+func WithIgnoreSelf(ignore bool) Option {
+	return optionFunc(func(c *Connection) error {
+		c.ignoreSelf = ignore
+		return nil
+	})
+}
+
+// WithAdvisoryListener subscribes to the router's advisory messages when the
+// connection is established and delivers them, decoded, to the listener.  This
+// allows noticing that a peer went away instead of waiting for a timeout.
+func WithAdvisoryListener(l AdvisoryListener) Option {
+	return optionFunc(func(c *Connection) error {
+		if l == nil {
+			return fmt.Errorf("%w: nil advisory listener", ErrInvalidInput)
+		}
+		c.advisory = l
+		return nil
+	})
+}
+
+// WithLogger sets the logger the connection writes to: debug entries for the
+// requests, their responses and the reconnect attempts, and warnings for the
+// read errors and the lost connections.  By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(c *Connection) error {
+		if logger == nil {
+			return fmt.Errorf("%w: nil logger", ErrInvalidInput)
+		}
+		c.logger = logger
+		return nil
+	})
+}
+
+// WithAutoReconnect reestablishes the connection when it is lost, restoring
+// the subscriptions.  Attempts are spaced starting at initial and doubling up
+// to maxDelay.  Requests made while reconnecting wait for the connection to come
+// back.  Disconnect and Close stop reconnecting.
+func WithAutoReconnect(initial, maxDelay time.Duration) Option {
+	return optionFunc(func(c *Connection) error {
+		if initial <= 0 || maxDelay < initial {
+			return fmt.Errorf("%w: invalid reconnect backoff", ErrInvalidInput)
+		}
+		c.reconnect = &backoff{initial: initial, max: maxDelay}
+		return nil
+	})
+}
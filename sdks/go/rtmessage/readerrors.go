@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// The classes of errors reported to the ReadErrorListeners.  Only
+// ErrIdleTimeout leaves the connection up; the others end it.  A message
+// skipped for exceeding WithMaxMessageSize is reported as ErrMessageTooLarge
+// and also leaves the connection up.
+var (
+	// ErrIdleTimeout means the read timeout expired without any part of a
+	// message having arrived.  The bus was merely quiet.
+	ErrIdleTimeout = errors.New("idle timeout")
+
+	// ErrConnectionClosed means the connection to the router is gone.
+	ErrConnectionClosed = errors.New("connection lost")
+
+	// ErrProtocol means the stream from the router can no longer be trusted,
+	// either because a message did not follow the wire format or because
+	// the read timed out part way through a message.
+	ErrProtocol = errors.New("protocol error")
+)
+
+// IdlePolicy decides what happens when the read timeout set by
+// WithReadTimeout expires between messages.
+type IdlePolicy struct {
+	// MaxIdle is the number of consecutive idle timeouts after which the
+	// connection is treated as lost, as ErrConnectionClosed.  Zero keeps the
+	// connection up however long the bus is quiet.
+	MaxIdle int
+}
+
+// classifyReadError wraps an error from reading a message with its class.
+// The partial flag reports whether any bytes of the message had been read.
+// The keep-alive probes going unanswered fail the read with ETIMEDOUT, which
+// is a timeout too but means the router is gone, not that the bus is quiet.
+func classifyReadError(err error, partial bool) error {
+	var ne net.Error
+	switch {
+	case errors.Is(err, syscall.ETIMEDOUT):
+		return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	case errors.As(err, &ne) && ne.Timeout() && !partial:
+		return fmt.Errorf("%w: %w", ErrIdleTimeout, err)
+	case errors.As(err, &ne) && ne.Timeout():
+		return fmt.Errorf("%w: timed out part way through a message: %w", ErrProtocol, err)
+	case errors.Is(err, ErrMessageTooLarge):
+		return err
+	case errors.Is(err, ErrMalformedMessage):
+		return fmt.Errorf("%w: %w", ErrProtocol, err)
+	}
+
+	return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+}
+
+// fatalReadError reports if the classified error ends the connection.
+func fatalReadError(err error) bool {
+	return !errors.Is(err, ErrIdleTimeout) && !errors.Is(err, ErrMessageTooLarge)
+}
+
+// countingReader counts the bytes read, so a timeout between messages can be
+// told apart from one in the middle of a message.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
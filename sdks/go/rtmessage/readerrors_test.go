@@ -0,0 +1,442 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// keepAliveError returns the error a read fails with once the keep-alive
+// probes went unanswered, which times out like a read deadline does.
+func keepAliveError() error {
+	return &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ETIMEDOUT)}
+}
+
+// rawRouter listens on a TCP socket, handing the accepted connections to the
+// test, which plays the router by writing bytes as it pleases.  What the
+// connection sends is read and dropped.
+func rawRouter(t testing.TB) (string, <-chan net.Conn) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			con, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = con.Close() })
+			go func() { _, _ = io.Copy(io.Discard, con) }()
+			conns <- con
+		}
+	}()
+
+	return "tcp://" + l.Addr().String(), conns
+}
+
+// readErrors returns a channel of the errors reported to the read error
+// listeners of the connection.
+func readErrors(c *Connection) <-chan error {
+	ch := make(chan error, 100)
+	c.AddReadErrorListener(ReadErrorListenerFunc(func(err error) {
+		select {
+		case ch <- err:
+		default:
+		}
+	}))
+	return ch
+}
+
+// nextReadError returns the next error of the channel, failing the test if
+// none is reported in time.
+func nextReadError(t *testing.T, ch <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("no read error")
+	}
+	return nil
+}
+
+func TestClassifyReadError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		partial bool
+		want    error
+		fatal   bool
+	}{
+		{name: "timeout between messages", err: timeoutError{}, want: ErrIdleTimeout},
+		{name: "deadline between messages", err: os.ErrDeadlineExceeded, want: ErrIdleTimeout},
+		{name: "timeout mid-message", err: timeoutError{}, partial: true, want: ErrProtocol, fatal: true},
+		{name: "malformed", err: fmt.Errorf("%w: bad marker", ErrMalformedMessage), partial: true, want: ErrProtocol, fatal: true},
+		{name: "too large", err: fmt.Errorf("%w: big", ErrMessageTooLarge), partial: true, want: ErrMessageTooLarge},
+		{name: "EOF", err: io.EOF, want: ErrConnectionClosed, fatal: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, partial: true, want: ErrConnectionClosed, fatal: true},
+		{name: "closed", err: net.ErrClosed, want: ErrConnectionClosed, fatal: true},
+		{name: "keep-alive", err: keepAliveError(), want: ErrConnectionClosed, fatal: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyReadError(tc.err, tc.partial)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("%v doesn't wrap %v", err, tc.err)
+			}
+			if fatal := fatalReadError(err); fatal != tc.fatal {
+				t.Fatalf("fatal %t, want %t", fatal, tc.fatal)
+			}
+		})
+	}
+}
+
+func TestReadTimeoutBetweenMessages(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	c, err := New(url, "test", WithReadTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	con := <-conns
+
+	// Nothing arrives: each timeout is benign and the deadline is rearmed.
+	for range 3 {
+		if err := nextReadError(t, errs); !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("got %v, want %v", err, ErrIdleTimeout)
+		}
+	}
+	if !c.Connected() {
+		t.Fatal("idle timeout ended the connection")
+	}
+
+	// Messages still get through afterwards.
+	ch, cancel := c.Messages(1, QueueBlock)
+	defer cancel()
+
+	b := frame(t, Message{Header: &Header{Topic: "Test.Event"}, Payload: []byte("hi")})
+	if _, err := con.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, ch); string(got.Payload) != "hi" {
+		t.Fatalf("got %q", got.Payload)
+	}
+}
+
+func TestReadTimeoutMidHeader(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	c, err := New(url, "test", WithReadTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	con := <-conns
+
+	// Part of a header, and then silence.
+	b := frame(t, Message{Header: &Header{Topic: "Test.Event"}})
+	if _, err := con.Write(b[:10]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Timeouts before the bytes arrived are benign.
+	err = nextReadError(t, errs)
+	for errors.Is(err, ErrIdleTimeout) {
+		err = nextReadError(t, errs)
+	}
+	if !errors.Is(err, ErrProtocol) {
+		t.Fatalf("got %v, want %v", err, ErrProtocol)
+	}
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection survived a timeout mid-header")
+	}
+	if !errors.Is(c.Err(), ErrProtocol) {
+		t.Fatalf("got %v, want %v", c.Err(), ErrProtocol)
+	}
+}
+
+func TestReadErrorMalformed(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	con := <-conns
+
+	if _, err := con.Write([]byte{0xbb, 0xbb, 0, 2, 0, 32}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nextReadError(t, errs); !errors.Is(err, ErrProtocol) || !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("got %v, want %v", err, ErrProtocol)
+	}
+	<-c.Done()
+}
+
+func TestReadErrorConnectionClosed(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_ = (<-conns).Close()
+
+	if err := nextReadError(t, errs); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("got %v, want %v", err, ErrConnectionClosed)
+	}
+	<-c.Done()
+	if !errors.Is(c.Err(), ErrConnectionClosed) {
+		t.Fatalf("got %v, want %v", c.Err(), ErrConnectionClosed)
+	}
+}
+
+func TestIdlePolicyMaxIdle(t *testing.T) {
+	url, _ := rawRouter(t)
+
+	c, err := New(url, "test", WithReadTimeout(20*time.Millisecond), WithIdlePolicy(IdlePolicy{MaxIdle: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three idle timeouts, each reported, and then the connection is lost.
+	for range 3 {
+		if err := nextReadError(t, errs); !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("got %v, want %v", err, ErrIdleTimeout)
+		}
+	}
+	if err := nextReadError(t, errs); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("got %v, want %v", err, ErrConnectionClosed)
+	}
+
+	if !closed(c.Done()) {
+		t.Fatal("the connection survived its idle timeouts")
+	}
+	if !errors.Is(c.Err(), ErrConnectionClosed) {
+		t.Fatalf("got %v, want %v", c.Err(), ErrConnectionClosed)
+	}
+}
+
+func TestIdlePolicyMessageResets(t *testing.T) {
+	url, conns := rawRouter(t)
+
+	const maxIdle = 5
+	c, err := New(url, "test", WithReadTimeout(50*time.Millisecond), WithIdlePolicy(IdlePolicy{MaxIdle: maxIdle}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	ch, cancel := c.Messages(1, QueueBlock)
+	defer cancel()
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	con := <-conns
+
+	for range 2 {
+		if err := nextReadError(t, errs); !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("got %v, want %v", err, ErrIdleTimeout)
+		}
+	}
+
+	b := frame(t, Message{Header: &Header{Topic: "Test.Event"}, Payload: []byte("hi")})
+	if _, err := con.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch)
+
+	// The timeouts reported before the message count no longer.
+	for drained := false; !drained; {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrIdleTimeout) {
+				t.Fatalf("got %v, want %v", err, ErrIdleTimeout)
+			}
+		default:
+			drained = true
+		}
+	}
+
+	for i := range maxIdle {
+		if err := nextReadError(t, errs); !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("timeout %d after the message: got %v, want %v", i+1, err, ErrIdleTimeout)
+		}
+	}
+	if err := nextReadError(t, errs); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("got %v, want %v", err, ErrConnectionClosed)
+	}
+}
+
+// TestTCPKeepAliveReadTimeout checks that the keep-alive probes and the read
+// timeout don't get in each other's way: the bus being quiet leaves the
+// connection up, while the probes going unanswered ends it.
+func TestTCPKeepAliveReadTimeout(t *testing.T) {
+	if err := keepAliveError(); !err.(net.Error).Timeout() {
+		t.Fatalf("%v doesn't time out", err)
+	}
+
+	url, conns := rawRouter(t)
+	c, err := New(url, "test", WithTCPKeepAlive(time.Second), WithReadTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := readErrors(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-conns
+
+	for range 3 {
+		if err := nextReadError(t, errs); !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("got %v, want %v", err, ErrIdleTimeout)
+		}
+	}
+	if !c.Connected() {
+		t.Fatal("idle timeout ended the connection")
+	}
+
+	err = classifyReadError(keepAliveError(), false)
+	if errors.Is(err, ErrIdleTimeout) || !fatalReadError(err) {
+		t.Fatalf("got %v, want it to end the connection", err)
+	}
+}
+
+func TestTCPKeepAliveOtherSchemes(t *testing.T) {
+	// The option is ignored for a MemRouter.
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX", WithTCPKeepAlive(time.Second))
+	if !c.Connected() {
+		t.Fatal("not connected")
+	}
+
+	if _, err := New(url, "test", WithTCPKeepAlive(-time.Second)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestIdlePolicyNegative(t *testing.T) {
+	if _, err := New("mem://x", "test", WithIdlePolicy(IdlePolicy{MaxIdle: -1})); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestNoReadErrorOnDisconnect(t *testing.T) {
+	r, memURL := newTestRouter(t)
+	tcpURL, _ := rawRouter(t)
+
+	for name, url := range map[string]string{"mem": memURL, "tcp": tcpURL} {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(url, "test", WithReadTimeout(time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			errs := readErrors(c)
+
+			// Again and again, to catch the read loop at various points.
+			for range 20 {
+				if err := c.Connect(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if err := c.Subscribe("Test.Event"); err != nil {
+					t.Fatal(err)
+				}
+				if name == "mem" {
+					if err := r.Inject(Message{Header: &Header{Topic: "Test.Event"}}); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				done := c.Done()
+				if err := c.Disconnect(); err != nil {
+					t.Fatal(err)
+				}
+				if !closed(done) {
+					t.Fatal("Done not closed")
+				}
+				if err := c.Err(); err != nil {
+					t.Fatalf("got %v after Disconnect", err)
+				}
+			}
+
+			// Nor is closing the connection while it is up.
+			if err := c.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case err := <-errs:
+				t.Fatalf("read error reported: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"time"
+)
+
+// backoff is the delay policy between reconnect attempts.  The delay starts
+// at initial and doubles after each failed attempt up to max.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+func (b backoff) next(d time.Duration) time.Duration {
+	return min(d*2, b.max)
+}
+
+// reconnectLoop keeps trying to reestablish the connection until it succeeds
+// or the context is canceled by Disconnect or Close.
+func (c *Connection) reconnectLoop(ctx context.Context) {
+	defer c.wg.Done()
+
+	delay := c.reconnect.initial
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		// Once connected, a failure to subscribe shows up as a read error
+		// which starts a new loop, so this one is done either way.
+		connected, err := c.establish(ctx)
+		if err != nil {
+			c.logger.Debug("reconnect failed", "inbox", c.inbox, "delay", delay, "error", err)
+		}
+		if connected && err == nil {
+			c.logger.Debug("reconnected", "inbox", c.inbox)
+			c.reconnectListeners.Visit(func(listener ReconnectListener) {
+				listener.OnReconnect()
+			})
+		}
+		if connected || ctx.Err() != nil {
+			return
+		}
+
+		delay = c.reconnect.next(delay)
+		timer.Reset(delay)
+	}
+}
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// eventually polls the condition until it holds, failing the test if it
+// doesn't in time.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := backoff{initial: time.Second, max: 5 * time.Second}
+
+	d := b.initial
+	for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		d = b.next(d)
+		if d != want {
+			t.Fatalf("got %v, want %v", d, want)
+		}
+	}
+}
+
+func TestCloseDuringReconnectBackoff(t *testing.T) {
+	for _, closing := range []bool{true, false} {
+		name := "Disconnect"
+		if closing {
+			name = "Close"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			r, url := newTestRouter(t)
+
+			goroutines := runtime.NumGoroutine()
+
+			// The backoff is long enough to last the whole test.
+			c, err := New(url, "test", WithInbox("test.INBOX"), WithAutoReconnect(time.Hour, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			r.DropConnections()
+			eventually(t, "the connection to be lost", func() bool {
+				return c.State() == StateConnecting
+			})
+
+			// The requests are held until the connection is back.
+			const requests = 10
+			errs := make(chan error, requests)
+			for range requests {
+				go func() {
+					_, err := c.Request(context.Background(), []byte("ping"), "Test.Method")
+					errs <- err
+				}()
+			}
+			eventually(t, "the requests to be pending", func() bool {
+				c.pending.m.Lock()
+				defer c.pending.m.Unlock()
+				return len(c.pending.requests) == requests
+			})
+
+			stop := c.Disconnect
+			if closing {
+				stop = c.Close
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if err := stop(); err != nil {
+					t.Error(err)
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s hung", name)
+			}
+
+			for range requests {
+				if err := <-errs; !errors.Is(err, ErrClosed) {
+					t.Fatalf("got %v, want %v", err, ErrClosed)
+				}
+			}
+
+			want := StateDisconnected
+			if closing {
+				want = StateClosed
+			}
+			if s := c.State(); s != want {
+				t.Fatalf("got %s, want %s", s, want)
+			}
+			if !closing {
+				_ = c.Close()
+			}
+
+			// The reconnect loop, the read and write loops and the
+			// requests are all gone.
+			eventually(t, "the goroutines to exit", func() bool {
+				return runtime.NumGoroutine() <= goroutines
+			})
+		})
+	}
+}
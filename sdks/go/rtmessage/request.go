@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type requestResult struct {
+	msg Message
+	err error
+}
+
+// pendingRequests tracks the requests waiting for a response, keyed by the
+// sequence number the response will carry.
+type pendingRequests struct {
+	m        sync.Mutex
+	closed   bool
+	requests map[uint32]chan requestResult
+}
+
+// add registers a request.  It fails with ErrClosed once the connection has
+// been closed.
+func (p *pendingRequests) add(seq uint32) (chan requestResult, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		return nil, ErrClosed
+	}
+
+	if p.requests == nil {
+		p.requests = make(map[uint32]chan requestResult)
+	}
+
+	ch := make(chan requestResult, 1)
+	p.requests[seq] = ch
+
+	return ch, nil
+}
+
+func (p *pendingRequests) remove(seq uint32) {
+	p.m.Lock()
+	delete(p.requests, seq)
+	p.m.Unlock()
+}
+
+// resolve hands the response to the request waiting for it, reporting if
+// there was one.
+func (p *pendingRequests) resolve(seq uint32, msg Message) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	ch, found := p.requests[seq]
+	if !found {
+		return false
+	}
+
+	delete(p.requests, seq)
+	ch <- requestResult{msg: msg}
+
+	return true
+}
+
+// failAll completes every pending request with the error.  When closing, no
+// further requests are accepted.
+func (p *pendingRequests) failAll(err error, closing bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if closing {
+		p.closed = true
+	}
+
+	for seq, ch := range p.requests {
+		delete(p.requests, seq)
+		ch <- requestResult{err: err}
+	}
+}
+
+// Request sends the payload to the topic and waits for the response.  The
+// response is matched to the request by its sequence number.  When the
+// response comes back flagged undeliverable, because nobody is subscribed to
+// the topic or the responder failed, the error matches ErrNoRoute.
+//
+// If the connection is down while automatic reconnecting is enabled (see
+// WithAutoReconnect), the request is held until the connection is
+// reestablished, the context is done or the connection is closed.  Requests
+// still pending when the connection is disconnected or closed fail with
+// ErrClosed, and those pending when it's lost with ErrConnectionClosed.
+func (c *Connection) Request(ctx context.Context, payload []byte, topic string) (Message, error) {
+	return c.request(ctx, payload, topic, FLAGS_REQUEST)
+}
+
+// RequestBinary is like Request, but flags the payload as raw binary, the way
+// rtConnection_SendBinaryRequest does.  This is how rbus sends its requests.
+func (c *Connection) RequestBinary(ctx context.Context, payload []byte, topic string) (Message, error) {
+	return c.request(ctx, payload, topic, FLAGS_REQUEST|FLAGS_RAW_BINARY)
+}
+
+func (c *Connection) request(ctx context.Context, payload []byte, topic string, flags uint32) (resp Message, err error) {
+	ctx, cancel := c.withRequestTimeout(ctx)
+	defer cancel()
+
+	msg := c.newMessage(payload, topic, c.inbox, flags)
+	seq := msg.Header.SequenceNumber
+
+	frame, err := c.marshal(&msg)
+	if err != nil {
+		return Message{}, err
+	}
+
+	result, err := c.pending.add(seq)
+	if err != nil {
+		return Message{}, err
+	}
+	defer c.pending.remove(seq)
+
+	if c.logger.Enabled(ctx, slog.LevelDebug) {
+		start := time.Now()
+		c.logger.DebugContext(ctx, "request sent", "topic", topic, "sequence", seq)
+		defer func() {
+			attrs := []any{"topic", topic, "sequence", seq, "latency", time.Since(start)}
+			if err != nil {
+				attrs = append(attrs, "error", err)
+			}
+			c.logger.DebugContext(ctx, "response received", attrs...)
+		}()
+	}
+
+	for {
+		err := c.sendFrame(ctx, topic, frame)
+		if err == nil {
+			break
+		}
+
+		// The connection is either down or went down with the request
+		// queued; both are worth waiting out when reconnecting.
+		if !errors.Is(err, ErrInvalidState) && !errors.Is(err, ErrClosed) {
+			return Message{}, err
+		}
+
+		up, reconnecting := c.upSignal()
+		if !reconnecting {
+			return Message{}, err
+		}
+
+		select {
+		case <-up:
+		case r := <-result:
+			return r.response(topic)
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		}
+	}
+
+	select {
+	case r := <-result:
+		return r.response(topic)
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// response returns the outcome of the request to the topic.
+func (r requestResult) response(topic string) (Message, error) {
+	if r.err != nil {
+		return Message{}, r.err
+	}
+
+	if r.msg.Header.Flags&FLAGS_UNDELIVERABLE != 0 {
+		return Message{}, fmt.Errorf("%w: '%s'", ErrNoRoute, topic)
+	}
+
+	return r.msg, nil
+}
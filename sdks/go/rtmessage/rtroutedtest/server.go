@@ -0,0 +1,511 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package rtroutedtest provides a scriptable fake rtrouted for integration
+// tests.  The Server listens on a temporary unix socket and speaks the real
+// wire format, so an rtmessage.Connection can be pointed at it unchanged.
+package rtroutedtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+const (
+	subscribeTopic = "_RTROUTED.INBOX.SUBSCRIBE"
+	queryTopic     = "_RTROUTED.INBOX.QUERY"
+)
+
+var ErrNotStarted = errors.New("server not started")
+
+// Server is a fake rtrouted.  Like the real router it handles subscription
+// messages, answers which routes match an expression and routes every other
+// message to the clients subscribed to its topic, the "{i}" of a table
+// matching any row, turning requests nobody is subscribed to around as
+// undeliverable.
+// On top of that it can be scripted to answer requests itself, inject
+// messages and drop clients.
+type Server struct {
+	m         sync.Mutex
+	changed   chan struct{}
+	dir       string
+	listener  net.Listener
+	clients   map[*client]struct{}
+	received  []rtmessage.Message
+	subs      []string
+	responses map[string]response
+	dropAfter int
+	count     int
+	wg        sync.WaitGroup
+}
+
+type response struct {
+	payload []byte
+	delay   time.Duration
+}
+
+type route struct {
+	id     int
+	tokens []string
+}
+
+type client struct {
+	con    net.Conn
+	m      sync.Mutex
+	routes []route
+}
+
+// NewServer creates a Server.  It must be started before use.
+func NewServer() *Server {
+	return &Server{
+		changed:   make(chan struct{}),
+		clients:   make(map[*client]struct{}),
+		responses: make(map[string]response),
+	}
+}
+
+// Start listens on a new unix socket in a temporary directory.
+func (s *Server) Start() error {
+	dir, err := os.MkdirTemp("", "rtroutedtest")
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("unix", filepath.Join(dir, "rtrouted"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return err
+	}
+
+	s.m.Lock()
+	s.dir = dir
+	s.listener = l
+	s.m.Unlock()
+
+	s.wg.Add(1)
+	go s.acceptLoop(l)
+
+	return nil
+}
+
+// Stop closes the listener and all client connections, waits for the
+// server's goroutines to exit and removes the socket.
+func (s *Server) Stop() error {
+	s.m.Lock()
+	l := s.listener
+	dir := s.dir
+	s.listener = nil
+	s.m.Unlock()
+
+	if l == nil {
+		return ErrNotStarted
+	}
+
+	err := l.Close()
+	s.CloseClientConn()
+	s.wg.Wait()
+
+	return errors.Join(err, os.RemoveAll(dir))
+}
+
+// Restart closes the listener and all client connections, like Stop, and
+// listens again on the same socket, as if rtrouted had been restarted.  The
+// clients reconnect to the same Addr and have to subscribe again.
+func (s *Server) Restart() error {
+	s.m.Lock()
+	l := s.listener
+	s.listener = nil
+	s.m.Unlock()
+
+	if l == nil {
+		return ErrNotStarted
+	}
+
+	err := l.Close()
+	s.CloseClientConn()
+	s.wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	l, err = net.Listen("unix", l.Addr().String())
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.listener = l
+	s.m.Unlock()
+
+	s.wg.Add(1)
+	go s.acceptLoop(l)
+
+	return nil
+}
+
+// Addr returns the URL to pass to rtmessage.New to connect to the server.
+func (s *Server) Addr() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.listener == nil {
+		return ""
+	}
+
+	return "unix://" + s.listener.Addr().String()
+}
+
+// ExpectSubscribe waits until a client has subscribed to the expression, or
+// the context is done.
+func (s *Server) ExpectSubscribe(ctx context.Context, expression string) error {
+	for {
+		s.m.Lock()
+		found := slices.Contains(s.subs, expression)
+		changed := s.changed
+		s.m.Unlock()
+
+		if found {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("subscription to '%s' not seen: %w", expression, ctx.Err())
+		}
+	}
+}
+
+// Respond makes the server answer requests sent to the topic with the payload
+// after the delay, instead of routing them.
+func (s *Server) Respond(topic string, payload []byte, delay time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.responses[topic] = response{payload: payload, delay: delay}
+}
+
+// DropAfter makes the server close the client connection that sends the nth
+// message counted from now, subscriptions included.  Zero disables it.
+func (s *Server) DropAfter(n int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.dropAfter = n
+	s.count = 0
+}
+
+// InjectMessage routes the message to the subscribed clients as if another
+// client had sent it.
+func (s *Server) InjectMessage(msg rtmessage.Message) error {
+	frame, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.route(msg.Header.Topic, frame) == 0 {
+		return fmt.Errorf("%w: no client subscribed to '%s'", rtmessage.ErrNoRoute, msg.Header.Topic)
+	}
+
+	return nil
+}
+
+// CloseClientConn closes all client connections, as if the router had
+// restarted.
+func (s *Server) CloseClientConn() {
+	s.m.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.m.Unlock()
+
+	for _, c := range clients {
+		_ = c.con.Close()
+	}
+}
+
+// Received returns the messages received from clients so far, excluding
+// subscription messages.
+func (s *Server) Received() []rtmessage.Message {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return slices.Clone(s.received)
+}
+
+func (s *Server) acceptLoop(l net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		con, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		c := client{con: con}
+
+		s.m.Lock()
+		s.clients[&c] = struct{}{}
+		s.m.Unlock()
+
+		s.wg.Add(1)
+		go s.readLoop(&c)
+	}
+}
+
+func (s *Server) readLoop(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.m.Lock()
+		delete(s.clients, c)
+		s.notify()
+		s.m.Unlock()
+		_ = c.con.Close()
+	}()
+
+	for {
+		msg, err := rtmessage.ReadMessage(c.con)
+		if err != nil {
+			return
+		}
+
+		if !s.handle(c, msg) {
+			return
+		}
+	}
+}
+
+// handle processes a message from the client, reporting if the client should
+// stay connected.
+func (s *Server) handle(c *client, msg rtmessage.Message) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.count++
+	if s.dropAfter > 0 && s.count >= s.dropAfter {
+		s.dropAfter = 0
+		return false
+	}
+
+	if msg.Header.Topic == subscribeTopic {
+		s.subscribe(c, msg.Payload)
+		return true
+	}
+
+	s.received = append(s.received, msg)
+
+	if msg.Header.Flags&rtmessage.FLAGS_REQUEST != 0 {
+		if r, found := s.responses[msg.Header.Topic]; found {
+			s.respond(c, msg.Header, r)
+			return true
+		}
+		if msg.Header.Topic == queryTopic {
+			s.respond(c, msg.Header, response{payload: s.query(msg.Payload)})
+			return true
+		}
+	}
+
+	frame, err := msg.Marshal()
+	if err != nil {
+		return false
+	}
+
+	if s.route(msg.Header.Topic, frame) > 0 || msg.Header.Flags&rtmessage.FLAGS_REQUEST == 0 {
+		return true
+	}
+
+	h := *msg.Header
+	h.Topic = h.ReplyTopic
+	h.Flags &^= rtmessage.FLAGS_REQUEST
+	h.Flags |= rtmessage.FLAGS_RESPONSE | rtmessage.FLAGS_UNDELIVERABLE
+
+	undeliverable := rtmessage.Message{Header: &h}
+	if frame, err := undeliverable.Marshal(); err == nil {
+		c.write(frame)
+	}
+
+	return true
+}
+
+// respond sends the scripted response.  The lock must be held.
+func (s *Server) respond(c *client, req *rtmessage.Header, r response) {
+	h := rtmessage.Header{
+		SequenceNumber: req.SequenceNumber,
+		Flags:          rtmessage.FLAGS_RESPONSE,
+		Topic:          req.ReplyTopic,
+		ReplyTopic:     req.Topic,
+	}
+
+	msg := rtmessage.Message{Header: &h, Payload: r.payload}
+	frame, err := msg.Marshal()
+	if err != nil {
+		return
+	}
+
+	if r.delay <= 0 {
+		c.write(frame)
+		return
+	}
+
+	s.wg.Add(1)
+	time.AfterFunc(r.delay, func() {
+		defer s.wg.Done()
+		c.write(frame)
+	})
+}
+
+// subscribe applies a subscription message.  The lock must be held.
+func (s *Server) subscribe(c *client, payload []byte) {
+	var req struct {
+		Topic   string `json:"topic"`
+		Add     int    `json:"add"`
+		RouteID int    `json:"route_id"`
+	}
+
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if req.Add == 0 {
+		c.routes = slices.DeleteFunc(c.routes, func(r route) bool {
+			return r.id == req.RouteID
+		})
+		return
+	}
+
+	c.routes = append(c.routes, route{id: req.RouteID, tokens: strings.Split(req.Topic, ".")})
+	s.subs = append(s.subs, req.Topic)
+	s.notify()
+}
+
+// query answers a discovery request with the routes matching its expression:
+// the route named by it, or those under it for a partial path ending in ".".
+// The lock must be held.
+func (s *Server) query(payload []byte) []byte {
+	var req struct {
+		Expression string `json:"expression"`
+	}
+
+	var resp struct {
+		Result int      `json:"result"`
+		Count  int      `json:"count"`
+		Items  []string `json:"items"`
+	}
+	resp.Items = []string{}
+
+	if err := json.Unmarshal(bytes.TrimRight(payload, "\x00"), &req); err != nil {
+		resp.Result = 1
+	}
+
+	for c := range s.clients {
+		c.m.Lock()
+		for _, r := range c.routes {
+			topic := strings.Join(r.tokens, ".")
+			partial := strings.HasSuffix(req.Expression, ".") && strings.HasPrefix(topic, req.Expression)
+			if (topic == req.Expression || partial) && !slices.Contains(resp.Items, topic) {
+				resp.Items = append(resp.Items, topic)
+			}
+		}
+		c.m.Unlock()
+	}
+	resp.Count = len(resp.Items)
+
+	b, _ := json.Marshal(resp)
+	return b
+}
+
+// route writes the frame to every subscribed client, returning how many
+// there were.  The lock must be held.
+func (s *Server) route(topic string, frame []byte) int {
+	tokens := strings.Split(topic, ".")
+
+	n := 0
+	for c := range s.clients {
+		if c.matches(tokens) {
+			c.write(frame)
+			n++
+		}
+	}
+
+	return n
+}
+
+// notify wakes up everybody waiting for a change.  The lock must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// matches reports if a message for the topic is routed to the client.  Like
+// rtrouted, a trailing "." of the topic is ignored, a "{i}" route token
+// matches a row instance and a table registered as "Foo.{i}" is also reached
+// by its name "Foo".
+func (c *client) matches(topic []string) bool {
+	if n := len(topic); n > 0 && topic[n-1] == "" {
+		topic = topic[:n-1]
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, r := range c.routes {
+		if matchTokens(r.tokens, topic) {
+			return true
+		}
+
+		last := len(r.tokens) - 1
+		if last > 0 && r.tokens[last] == "{i}" && matchTokens(r.tokens[:last], topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchTokens(route, topic []string) bool {
+	if len(route) != len(topic) {
+		return false
+	}
+
+	for i, token := range route {
+		if token == "*" || token == topic[i] || (token == "{i}" && isInstance(topic[i])) {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
+
+// isInstance reports if the token names a table row, by its number or its
+// alias in brackets.
+func isInstance(token string) bool {
+	return token != "" && (unicode.IsDigit(rune(token[0])) || token[0] == '[' || token == "*")
+}
+
+func (c *client) write(frame []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	_, _ = c.con.Write(frame)
+}
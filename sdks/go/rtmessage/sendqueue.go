@@ -0,0 +1,321 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// defaultSendQueueSize is the number of messages that can wait to be written
+// to the router when no size is configured.
+const defaultSendQueueSize = 64
+
+var ErrSendQueueFull = errors.New("send queue full")
+
+// QueuePolicy selects what happens when a bounded queue is full.
+type QueuePolicy int
+
+const (
+	// QueueReject fails the operation right away instead of waiting for
+	// room in the queue.
+	QueueReject QueuePolicy = iota
+
+	// QueueBlock waits for room in the queue.
+	QueueBlock
+
+	// QueueDropOldest makes room by dropping the oldest item in the queue.
+	// It is only supported by Messages.
+	QueueDropOldest
+)
+
+func (p QueuePolicy) String() string {
+	switch p {
+	case QueueReject:
+		return "reject"
+	case QueueBlock:
+		return "block"
+	case QueueDropOldest:
+		return "drop-oldest"
+	}
+	return "unknown"
+}
+
+// outgoing is one or more marshaled messages waiting to be written with a
+// single write.  The done channel is nil for messages sent with SendAsync.
+type outgoing struct {
+	frame    []byte
+	parts    []framePart
+	deadline time.Time
+	done     chan error
+	batch    bool
+}
+
+// framePart locates a message within the frame of an outgoing item.
+type framePart struct {
+	topic string
+	end   int
+}
+
+// BatchError is returned by SendBatch when not every message was written.
+// The first Sent messages were written in full and need not be sent again.
+type BatchError struct {
+	Sent int
+	Err  error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch failed after %d messages: %v", e.Sent, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// sendQueue feeds the writer goroutine of a single connection.  The stopped
+// channel is closed once the writer no longer takes messages.
+type sendQueue struct {
+	items   chan outgoing
+	stopped chan struct{}
+}
+
+func newSendQueue(size int) *sendQueue {
+	return &sendQueue{
+		items:   make(chan outgoing, size),
+		stopped: make(chan struct{}),
+	}
+}
+
+// sendQueue returns the queue of the current connection.
+func (c *Connection) sendQueue() (*sendQueue, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.queue == nil {
+		return nil, ErrNotConnected
+	}
+
+	return c.queue, nil
+}
+
+// SendAsync queues the message to be written to the router and returns
+// without waiting for the write.  If the queue is full the message is rejected
+// with ErrSendQueueFull, unless WithSendQueuePolicy selected QueueBlock.  A
+// sequence number of zero is replaced with the next one.  Messages still queued
+// when the connection goes down are dropped.
+func (c *Connection) SendAsync(msg Message) error {
+	if msg.Header == nil {
+		return ErrInvalidInput
+	}
+
+	h := *msg.Header
+	if h.SequenceNumber == 0 {
+		h.SequenceNumber = uint32(c.generator.getNextSubscriptionID())
+	}
+	c.markOwn(&h)
+	msg.Header = &h
+
+	frame, err := c.marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	q, err := c.sendQueue()
+	if err != nil {
+		return err
+	}
+
+	item := outgoing{
+		frame: frame,
+		parts: []framePart{{topic: h.Topic, end: len(frame)}},
+	}
+
+	if c.sendQueuePolicy == QueueReject {
+		select {
+		case <-q.stopped:
+			return ErrClosed
+		case q.items <- item:
+			return nil
+		default:
+			return ErrSendQueueFull
+		}
+	}
+
+	select {
+	case <-q.stopped:
+		return ErrClosed
+	case q.items <- item:
+		return nil
+	}
+}
+
+// sendFrame queues a marshaled message and waits for it to be written.  Since
+// both Send and SendAsync go through the same queue, their messages reach the
+// router in the order they were sent.
+func (c *Connection) sendFrame(ctx context.Context, topic string, frame []byte) error {
+	return c.sendItem(ctx, outgoing{
+		frame: frame,
+		parts: []framePart{{topic: topic, end: len(frame)}},
+	})
+}
+
+// SendBatch writes the messages to the router with as few writes as
+// possible, bounded as a whole by the context's deadline.  The messages are
+// sent in order; a sequence number of zero is replaced with the next one.  If
+// the batch fails part way, the error is a *BatchError telling how many
+// messages were written, so the rest can be retried.
+func (c *Connection) SendBatch(ctx context.Context, msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	item := outgoing{
+		parts: make([]framePart, 0, len(msgs)),
+		batch: true,
+	}
+
+	for i, msg := range msgs {
+		if msg.Header == nil {
+			return fmt.Errorf("%w: message %d has no header", ErrInvalidInput, i)
+		}
+
+		h := *msg.Header
+		if h.SequenceNumber == 0 {
+			h.SequenceNumber = uint32(c.generator.getNextSubscriptionID())
+		}
+		c.markOwn(&h)
+		msg.Header = &h
+
+		frame, err := c.marshal(&msg)
+		if err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+
+		item.frame = append(item.frame, frame...)
+		item.parts = append(item.parts, framePart{topic: h.Topic, end: len(item.frame)})
+	}
+
+	return c.sendItem(ctx, item)
+}
+
+// sendItem queues the item and waits for it to be written.
+func (c *Connection) sendItem(ctx context.Context, item outgoing) error {
+	q, err := c.sendQueue()
+	if err != nil {
+		return err
+	}
+
+	item.done = make(chan error, 1)
+	item.deadline, _ = ctx.Deadline()
+
+	select {
+	case <-q.stopped:
+		return item.result(0, ErrClosed)
+	case <-ctx.Done():
+		return item.result(0, ctx.Err())
+	case q.items <- item:
+	}
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-q.stopped:
+		// The writer may have finished the message before stopping.
+		select {
+		case err := <-item.done:
+			return err
+		default:
+			return item.result(0, ErrClosed)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeLoop writes the queued messages to the connection until the context is
+// canceled, then fails whatever is left in the queue with ErrClosed, as it
+// does a write cut short by the connection going down.  A write failing
+// otherwise, but for the sender's deadline, fails with ErrConnectionClosed.
+func (c *Connection) writeLoop(ctx context.Context, con net.Conn, q *sendQueue) {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(q.stopped)
+			for {
+				select {
+				case item := <-q.items:
+					item.complete(0, ErrClosed)
+				default:
+					return
+				}
+			}
+		case item := <-q.items:
+			sent, err := c.write(con, item)
+			switch {
+			case err == nil:
+			case ctx.Err() != nil:
+				// The connection was taken down under the write.
+				err = ErrClosed
+			case !errors.Is(err, context.DeadlineExceeded):
+				// The router hung up, for one.
+				err = fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+			}
+			item.complete(sent, err)
+		}
+	}
+}
+
+// write writes the item, bounded by the sender's deadline so a stalled router
+// can't hold the writer forever.  It returns the number of messages written
+// in full.
+func (c *Connection) write(con net.Conn, item outgoing) (int, error) {
+	if err := con.SetWriteDeadline(item.deadline); err != nil {
+		return 0, err
+	}
+
+	n, err := con.Write(item.frame)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// The deadline is the sender's, which may see it pass before its
+		// context reports it.
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+
+	sent, start := 0, 0
+	for _, part := range item.parts {
+		if part.end > n {
+			break
+		}
+
+		c.stats.sent(part.end - start)
+		if c.metrics != nil {
+			c.metrics.MessageSent(part.topic, part.end-start)
+		}
+
+		sent++
+		start = part.end
+	}
+
+	return sent, err
+}
+
+// result converts the outcome of writing the item into the error for the
+// sender.
+func (item outgoing) result(sent int, err error) error {
+	if err == nil || !item.batch {
+		return err
+	}
+
+	return &BatchError{Sent: sent, Err: err}
+}
+
+func (item outgoing) complete(sent int, err error) {
+	if item.done != nil {
+		item.done <- item.result(sent, err)
+	}
+}
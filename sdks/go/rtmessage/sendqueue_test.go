@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// shortConn is a net.Conn whose writes stop after n bytes.
+type shortConn struct {
+	net.Conn
+	n int
+}
+
+func (c *shortConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *shortConn) Write(b []byte) (int, error) {
+	if len(b) <= c.n {
+		return len(b), nil
+	}
+	return c.n, errors.New("short write")
+}
+
+// batch returns n messages to the topic.
+func batch(n int, topic string) []Message {
+	msgs := make([]Message, n)
+	for i := range msgs {
+		msgs[i] = Message{
+			Header:  &Header{Topic: topic},
+			Payload: fmt.Appendf(nil, "message %03d", i),
+		}
+	}
+	return msgs
+}
+
+func TestSendBatch(t *testing.T) {
+	r, url := newTestRouter(t)
+	subscriber := newTestConnection(t, url, "subscriber.INBOX")
+	ch := subscribe(t, r, subscriber, "Test.Batch")
+
+	counters := new(Counters)
+	c := newTestConnection(t, url, "test.INBOX", WithMetrics(counters))
+
+	sent := counters.MessagesSent.Load()
+	msgs := batch(10, "Test.Batch")
+	if err := c.SendBatch(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	// In order, with sequence numbers filled in.
+	var seq uint32
+	for i, want := range msgs {
+		got := receive(t, ch)
+		if string(got.Payload) != string(want.Payload) {
+			t.Fatalf("message %d: got %q, want %q", i, got.Payload, want.Payload)
+		}
+		if got.Header.SequenceNumber <= seq {
+			t.Fatalf("message %d: sequence number %d after %d", i, got.Header.SequenceNumber, seq)
+		}
+		seq = got.Header.SequenceNumber
+	}
+	if msgs[0].Header.SequenceNumber != 0 {
+		t.Fatal("SendBatch changed the caller's header")
+	}
+
+	if n := counters.MessagesSent.Load() - sent; n != uint64(len(msgs)) {
+		t.Fatalf("counted %d messages, want %d", n, len(msgs))
+	}
+
+	if err := c.SendBatch(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendBatchInvalid(t *testing.T) {
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	msgs := batch(3, "Test.Batch")
+	msgs[1].Header = nil
+	if err := c.SendBatch(context.Background(), msgs); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendBatch(context.Background(), batch(3, "Test.Batch")); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("got %v, want %v", err, ErrNotConnected)
+	}
+}
+
+func TestSendBatchPartial(t *testing.T) {
+	c, err := New("mem://x", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := outgoing{batch: true}
+	var frames [][]byte
+	for _, msg := range batch(3, "Test.Batch") {
+		msg.Header.SequenceNumber = 1
+		b := frame(t, msg)
+		frames = append(frames, b)
+		item.frame = append(item.frame, b...)
+		item.parts = append(item.parts, framePart{topic: msg.Header.Topic, end: len(item.frame)})
+	}
+
+	// The second message was cut short, so only the first counts as sent.
+	con := &shortConn{n: len(frames[0]) + len(frames[1]) - 1}
+	err = item.result(c.write(con, item))
+
+	var be *BatchError
+	if !errors.As(err, &be) {
+		t.Fatalf("got %v, want a BatchError", err)
+	}
+	if be.Sent != 1 {
+		t.Fatalf("sent %d, want 1", be.Sent)
+	}
+	if be.Err == nil || be.Err.Error() != "short write" {
+		t.Fatalf("got %v", be.Err)
+	}
+}
+
+// benchmarkConnection connects to a router that drops everything it is sent,
+// over TCP so each write is a system call.
+func benchmarkConnection(b *testing.B) *Connection {
+	url, _ := rawRouter(b)
+
+	c, err := New(url, "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = c.Close() })
+
+	if err := c.Connect(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+
+	return c
+}
+
+func BenchmarkSendLoop(b *testing.B) {
+	c := benchmarkConnection(b)
+	msgs := batch(100, "Bench.Batch")
+
+	b.ReportAllocs()
+	for range b.N {
+		for _, msg := range msgs {
+			if err := c.Send(context.Background(), msg.Payload, msg.Header.Topic); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSendBatch(b *testing.B) {
+	c := benchmarkConnection(b)
+	msgs := batch(100, "Bench.Batch")
+
+	b.ReportAllocs()
+	for range b.N {
+		if err := c.SendBatch(context.Background(), msgs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// seqTrackerSenders bounds the number of senders tracked; the least
+	// recently heard from is forgotten first.
+	seqTrackerSenders = 256
+
+	// seqTrackerWindow is the number of sequence numbers below the highest
+	// seen that are remembered per sender to recognize duplicates.
+	seqTrackerWindow = 64
+)
+
+// GapListener is notified when the sequence numbers received from a sender
+// skip ahead or repeat.  The topic is the sender's reply topic; expected is
+// the sequence number that should have come next and got is the one that
+// did.
+type GapListener interface {
+	OnGap(topic string, expected, got uint32)
+}
+
+// GapListenerFunc is a function that implements the GapListener interface.
+type GapListenerFunc func(topic string, expected, got uint32)
+
+func (f GapListenerFunc) OnGap(topic string, expected, got uint32) {
+	f(topic, expected, got)
+}
+
+// AddGapListener registers a listener for sequence number gaps and
+// duplicates.  It is only called when WithSequenceTracking is used.
+func (c *Connection) AddGapListener(listener GapListener) CancelListenerFunc {
+	return CancelListenerFunc(c.gapListeners.Add(listener))
+}
+
+// seqTracker keeps the recent sequence numbers per sender.
+type seqTracker struct {
+	m       sync.Mutex
+	lru     list.List
+	senders map[string]*list.Element
+}
+
+type seqWindow struct {
+	topic   string
+	highest uint32
+	seen    uint64 // bit i set means highest-i was seen
+}
+
+func newSeqTracker() *seqTracker {
+	return &seqTracker{
+		senders: make(map[string]*list.Element),
+	}
+}
+
+// observe records the sequence number from the sender.  When it is not the
+// expected one, the expected number is returned along with true.
+func (t *seqTracker) observe(topic string, seq uint32) (uint32, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	e, found := t.senders[topic]
+	if !found {
+		if t.lru.Len() >= seqTrackerSenders {
+			oldest := t.lru.Back()
+			delete(t.senders, oldest.Value.(*seqWindow).topic)
+			t.lru.Remove(oldest)
+		}
+		t.senders[topic] = t.lru.PushFront(&seqWindow{topic: topic, highest: seq, seen: 1})
+		return 0, false
+	}
+
+	t.lru.MoveToFront(e)
+	w := e.Value.(*seqWindow)
+	expected := w.highest + 1
+
+	// Compare with wrap around in mind.
+	ahead := int32(seq - w.highest)
+	switch {
+	case ahead > 0:
+		if ahead >= seqTrackerWindow {
+			w.seen = 0
+		} else {
+			w.seen <<= uint(ahead)
+		}
+		w.seen |= 1
+		w.highest = seq
+		return expected, ahead != 1
+	case -ahead < seqTrackerWindow:
+		bit := uint64(1) << uint(-ahead)
+		if w.seen&bit != 0 {
+			return expected, true
+		}
+		// A late arrival filling an earlier gap.
+		w.seen |= bit
+		return 0, false
+	}
+
+	// Too far behind to tell; most likely the sender restarted.
+	w.highest = seq
+	w.seen = 1
+	return expected, true
+}
+
+// trackSequence reports gaps and duplicates of the message's sequence
+// number to the listeners.
+func (c *Connection) trackSequence(msg Message) {
+	if c.seqTracker == nil || msg.Header.ReplyTopic == "" {
+		return
+	}
+
+	expected, gap := c.seqTracker.observe(msg.Header.ReplyTopic, msg.Header.SequenceNumber)
+	if !gap {
+		return
+	}
+
+	c.gapListeners.Visit(func(listener GapListener) {
+		listener.OnGap(msg.Header.ReplyTopic, expected, msg.Header.SequenceNumber)
+	})
+}
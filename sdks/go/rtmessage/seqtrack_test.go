@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSeqTracker(t *testing.T) {
+	tests := []struct {
+		name string
+		seqs []uint32
+		// want has the expected and got sequence numbers of each gap or
+		// duplicate reported.
+		want string
+	}{
+		{
+			name: "in order",
+			seqs: []uint32{5, 6, 7, 8},
+			want: "[]",
+		}, {
+			name: "gap",
+			seqs: []uint32{5, 6, 9, 10},
+			want: "[7/9]",
+		}, {
+			name: "gap filled late",
+			seqs: []uint32{5, 8, 6, 7, 9},
+			want: "[6/8]",
+		}, {
+			name: "duplicate",
+			seqs: []uint32{5, 6, 6, 7, 5},
+			want: "[7/6 8/5]",
+		}, {
+			name: "duplicate of a late arrival",
+			seqs: []uint32{5, 7, 6, 6},
+			want: "[6/7 8/6]",
+		}, {
+			name: "wrap around",
+			seqs: []uint32{0xfffffffe, 0xffffffff, 0, 1, 3},
+			want: "[2/3]",
+		}, {
+			// Past the window, an earlier number is taken for a restart.
+			name: "far ahead",
+			seqs: []uint32{5, 5 + seqTrackerWindow, 5, 6},
+			want: fmt.Sprintf("[6/%d %d/5]", 5+seqTrackerWindow, 6+seqTrackerWindow),
+		}, {
+			// A sender restarting starts over, and is followed from there.
+			name: "restart",
+			seqs: []uint32{1000, 1001, 1, 2, 3},
+			want: "[1002/1]",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := newSeqTracker()
+			var got []string
+			for _, seq := range tc.seqs {
+				if expected, gap := tr.observe("A", seq); gap {
+					got = append(got, fmt.Sprintf("%d/%d", expected, seq))
+				}
+			}
+			if fmt.Sprint(got) != tc.want {
+				t.Fatalf("got %v, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSeqTrackerSenders(t *testing.T) {
+	tr := newSeqTracker()
+
+	// Each sender is followed on its own.
+	tr.observe("A", 1)
+	tr.observe("B", 10)
+	if _, gap := tr.observe("A", 2); gap {
+		t.Fatal("A taken for B")
+	}
+	if _, gap := tr.observe("B", 11); gap {
+		t.Fatal("B taken for A")
+	}
+
+	// Past the bound, the sender heard from the longest ago is forgotten,
+	// so it starts over without a gap.
+	for i := range seqTrackerSenders {
+		tr.observe(fmt.Sprintf("sender-%d", i), 1)
+	}
+	if len(tr.senders) != seqTrackerSenders || tr.lru.Len() != seqTrackerSenders {
+		t.Fatalf("tracks %d, %d senders, want %d", len(tr.senders), tr.lru.Len(), seqTrackerSenders)
+	}
+	if _, gap := tr.observe("A", 100); gap {
+		t.Fatal("forgotten sender reported")
+	}
+	if _, gap := tr.observe(fmt.Sprintf("sender-%d", seqTrackerSenders-1), 3); !gap {
+		t.Fatal("recent sender forgotten")
+	}
+}
+
+func TestSequenceTracking(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		name := "disabled"
+		if enabled {
+			name = "enabled"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			r, url := newTestRouter(t)
+
+			var opts []Option
+			if enabled {
+				opts = append(opts, WithSequenceTracking())
+			}
+			c := newTestConnection(t, url, "test.INBOX", opts...)
+
+			var (
+				m    sync.Mutex
+				gaps []string
+			)
+			c.AddGapListener(GapListenerFunc(func(topic string, expected, got uint32) {
+				m.Lock()
+				defer m.Unlock()
+				gaps = append(gaps, fmt.Sprintf("%s %d/%d", topic, expected, got))
+			}))
+			cancel := c.AddGapListener(GapListenerFunc(func(string, uint32, uint32) {
+				t.Error("called after removal")
+			}))
+			cancel()
+			ch := subscribe(t, r, c, "Test.Event")
+
+			// The messages are delivered regardless, the duplicate too.
+			// Those without a reply topic aren't tracked.
+			inject := []struct {
+				sender string
+				seq    uint32
+			}{
+				{"sender.A", 1},
+				{"sender.B", 7},
+				{"sender.A", 2},
+				{"sender.A", 4},
+				{"sender.B", 8},
+				{"sender.A", 4},
+				{"", 9},
+				{"", 9},
+			}
+			for _, in := range inject {
+				msg := Message{
+					Header:  &Header{SequenceNumber: in.seq, Topic: "Test.Event", ReplyTopic: in.sender},
+					Payload: []byte(fmt.Sprintf("%s %d", in.sender, in.seq)),
+				}
+				if err := r.Inject(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, in := range inject {
+				want := fmt.Sprintf("%s %d", in.sender, in.seq)
+				if got := receive(t, ch); string(got.Payload) != want {
+					t.Fatalf("got %q, want %q", got.Payload, want)
+				}
+			}
+
+			m.Lock()
+			defer m.Unlock()
+			want := "[]"
+			if enabled {
+				want = "[sender.A 3/4 sender.A 5/4]"
+			}
+			if fmt.Sprint(gaps) != want {
+				t.Fatalf("got %q, want %s", gaps, want)
+			}
+		})
+	}
+}
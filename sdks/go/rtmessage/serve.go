@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"fmt"
+)
+
+// NewResponse creates the response to a received request, carrying the
+// payload.  The response goes to the request's reply topic with the request's
+// sequence number and control data, so the router and the requester can match
+// it up, and with the request's timestamps.
+func (m Message) NewResponse(payload []byte) (Message, error) {
+	if m.Header == nil || m.Header.ReplyTopic == "" {
+		return Message{}, fmt.Errorf("%w: message has no reply topic", ErrInvalidInput)
+	}
+
+	h := Header{
+		Version:        m.Header.Version,
+		SequenceNumber: m.Header.SequenceNumber,
+		Flags:          (m.Header.Flags &^ FLAGS_REQUEST) | FLAGS_RESPONSE,
+		ControlData:    m.Header.ControlData,
+		Topic:          m.Header.ReplyTopic,
+		ReplyTopic:     m.Header.Topic,
+		Timestamps:     m.Header.Timestamps,
+	}
+
+	return Message{Header: &h, Payload: payload}, nil
+}
+
+// Handler answers a request, returning the payload of the response.
+type Handler func(ctx context.Context, req Message) ([]byte, error)
+
+// Serve subscribes to the expression and answers the requests matching it,
+// or sent to one of its aliases (see AddAlias), with the handler.  Each
+// request is handled on a goroutine of its own, with a context bounded by the
+// request timeout and canceled by Close, which waits for the handlers to
+// return.  When the handler fails the response is flagged undeliverable, like
+// the router does when nobody is there to answer.
+func (c *Connection) Serve(expression string, handler Handler) (CancelListenerFunc, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("%w: nil handler", ErrInvalidInput)
+	}
+
+	listener := MessageListenerFunc(func(msg Message) {
+		if msg.Type() != MsgTypeRequest {
+			return
+		}
+		if !MatchTopic(expression, msg.Header.Topic) && !c.subs.aliasOf(msg.Header.Topic, expression) {
+			return
+		}
+
+		// The listener runs on a goroutine the wait group is tracking, so
+		// adding to it can't race with Close waiting on it.
+		c.wg.Add(1)
+		go c.serve(msg, handler)
+	})
+
+	return c.Add(listener, expression)
+}
+
+func (c *Connection) serve(req Message, handler Handler) {
+	defer c.wg.Done()
+
+	ctx, cancel := c.withRequestTimeout(c.ctx)
+	defer cancel()
+
+	payload, err := handler(ctx, req)
+	if err != nil {
+		payload = nil
+	}
+
+	resp, rerr := req.NewResponse(payload)
+	if rerr != nil {
+		c.readError(rerr)
+		return
+	}
+
+	if err != nil {
+		resp.Header.Flags |= FLAGS_UNDELIVERABLE
+	}
+
+	// The response goes out even when the handler ran out of time, or the
+	// requester would wait for it in vain.  There is nobody left to
+	// respond to once closed.
+	if err := c.sendMessage(c.ctx, resp); err != nil && c.ctx.Err() == nil {
+		c.readError(fmt.Errorf("failed to respond on '%s': %w", resp.Header.Topic, err))
+	}
+}
+
+// sendMessage marshals and sends a fully formed message.
+func (c *Connection) sendMessage(ctx context.Context, msg Message) error {
+	frame, err := c.marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	return c.sendFrame(ctx, msg.Header.Topic, frame)
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewResponse(t *testing.T) {
+	req := Message{
+		Header: &Header{
+			Version:        header_VERSION,
+			SequenceNumber: 9,
+			Flags:          FLAGS_REQUEST | FLAGS_RAW_BINARY,
+			ControlData:    3,
+			Topic:          "Device.Test",
+			ReplyTopic:     "test.INBOX",
+			Timestamps:     [5]uint32{1, 2, 3},
+		},
+		Payload: []byte("request"),
+	}
+
+	resp, err := req.NewResponse([]byte("response"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Message{
+		Header: &Header{
+			SequenceNumber: 9,
+			Flags:          FLAGS_RESPONSE | FLAGS_RAW_BINARY,
+			ControlData:    3,
+			Topic:          "test.INBOX",
+			ReplyTopic:     "Device.Test",
+		},
+		Payload: []byte("response"),
+	}
+	if !resp.Equal(want) || resp.Header.Timestamps != req.Header.Timestamps {
+		t.Fatalf("got %v, want %v", resp, want)
+	}
+
+	if _, err := (Message{Header: &Header{Topic: "Device.Test"}}).NewResponse(nil); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+	if _, err := (Message{}).NewResponse(nil); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+// serve has the provider serve the expression with the handler, waiting for
+// the router to have the route.
+func serve(t *testing.T, r *MemRouter, provider *Connection, expression string, handler Handler) {
+	t.Helper()
+
+	if _, err := provider.Serve(expression, handler); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the route to "+expression, func() bool {
+		return routes(r, expression) > 0
+	})
+}
+
+func TestServe(t *testing.T) {
+	r, url := newTestRouter(t)
+	provider := newTestConnection(t, url, "provider.INBOX")
+	consumer := newTestConnection(t, url, "consumer.INBOX", WithRequestTimeout(5*time.Second))
+
+	failed := errors.New("failed")
+	serve(t, r, provider, "Device.Test.*", func(ctx context.Context, req Message) ([]byte, error) {
+		if req.Header.Topic == "Device.Test.Fail" {
+			return nil, failed
+		}
+		return bytes.ToUpper(req.Payload), nil
+	})
+
+	for _, request := range []func(context.Context, []byte, string) (Message, error){consumer.Request, consumer.RequestBinary} {
+		resp, err := request(context.Background(), []byte("ping"), "Device.Test.Echo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Payload) != "PING" {
+			t.Fatalf("got %q", resp.Payload)
+		}
+		if resp.Type() != MsgTypeResponse || resp.Header.Topic != "consumer.INBOX" {
+			t.Fatalf("got %v", resp)
+		}
+	}
+
+	if _, err := consumer.Request(context.Background(), []byte("ping"), "Device.Test.Fail"); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("got %v, want %v", err, ErrNoRoute)
+	}
+
+	// Only the requests matching the expression are served.
+	if _, err := consumer.Request(context.Background(), []byte("ping"), "Device.Other"); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("got %v, want %v", err, ErrNoRoute)
+	}
+}
+
+func TestServeNilHandler(t *testing.T) {
+	c, err := New("mem://x", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Serve("Device.Test", nil); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestServeClose(t *testing.T) {
+	r, url := newTestRouter(t)
+	provider := newTestConnection(t, url, "provider.INBOX")
+	consumer := newTestConnection(t, url, "consumer.INBOX")
+
+	// The handler only returns once its context is canceled, which without
+	// a request timeout only Close does.
+	handling := make(chan struct{})
+	canceled := make(chan error, 1)
+	serve(t, r, provider, "Device.Test", func(ctx context.Context, req Message) ([]byte, error) {
+		close(handling)
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() { _, _ = consumer.Request(ctx, []byte("ping"), "Device.Test") }()
+
+	select {
+	case <-handling:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not handled")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- provider.Close() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waits on the handler forever")
+	}
+
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestServeRequestTimeout(t *testing.T) {
+	r, url := newTestRouter(t)
+	provider := newTestConnection(t, url, "provider.INBOX", WithRequestTimeout(50*time.Millisecond))
+	consumer := newTestConnection(t, url, "consumer.INBOX")
+
+	deadline := make(chan bool, 1)
+	serve(t, r, provider, "Device.Test", func(ctx context.Context, req Message) ([]byte, error) {
+		_, ok := ctx.Deadline()
+		deadline <- ok
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := consumer.Request(ctx, []byte("ping"), "Device.Test"); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("got %v, want %v", err, ErrNoRoute)
+	}
+	if !<-deadline {
+		t.Fatal("handler without a deadline")
+	}
+}
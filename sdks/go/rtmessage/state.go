@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+// StateListener provides a way to get notified each time the state of the
+// connection changes, along with the error that caused the change, if any.
+type StateListener interface {
+	OnStateChange(State, error)
+}
+
+// StateListenerFunc is a function that implements the StateListener
+// interface.
+type StateListenerFunc func(State, error)
+
+func (f StateListenerFunc) OnStateChange(s State, err error) {
+	f(s, err)
+}
+
+// AddStateListener registers a listener called with each change of the state
+// of the connection made after it was added.  The changes are delivered in
+// the order they happened, one at a time, from a goroutine of the connection
+// that doesn't hold its lock, so the listener may call its methods.  A
+// connection that is lost and reestablished by automatic reconnecting goes
+// through StateDisconnected, carrying the cause, and StateConnecting before
+// it's StateConnected again.
+func (c *Connection) AddStateListener(listener StateListener) CancelListenerFunc {
+	return c.states.Add(listener.OnStateChange)
+}
+
+// setState changes the state of the connection, queuing the change for the
+// state listeners.  The caller must hold the lock.
+func (c *Connection) setState(s State, err error) {
+	if c.state == s {
+		return
+	}
+	c.state = s
+	c.states.Notify(s, err)
+}
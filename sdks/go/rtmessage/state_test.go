@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stateChange is a change of state a listener was called with.
+type stateChange struct {
+	state State
+	err   error
+}
+
+// recordStates returns a channel of the changes of state of the connection.
+func recordStates(c *Connection) (<-chan stateChange, CancelListenerFunc) {
+	ch := make(chan stateChange, 100)
+	cancel := c.AddStateListener(StateListenerFunc(func(s State, err error) {
+		ch <- stateChange{state: s, err: err}
+	}))
+	return ch, cancel
+}
+
+// expectStates fails the test unless the next changes are to the states, in
+// order.  It returns the changes.
+func expectStates(t *testing.T, ch <-chan stateChange, states ...State) []stateChange {
+	t.Helper()
+
+	var got []stateChange
+	for _, want := range states {
+		select {
+		case change := <-ch:
+			if change.state != want {
+				t.Fatalf("changed to %s, want %s", change.state, want)
+			}
+			got = append(got, change)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change to %s", want)
+		}
+	}
+	return got
+}
+
+func TestStateDialFailure(t *testing.T) {
+	c, err := New("mem://no-such-router", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if s := c.State(); s != StateDisconnected {
+		t.Fatalf("got %s before connecting", s)
+	}
+
+	states, cancel := recordStates(c)
+	defer cancel()
+
+	err = c.Connect(context.Background())
+	if !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidState)
+	}
+
+	// The attempt went through connecting, and back to disconnected with
+	// the dial error.
+	changes := expectStates(t, states, StateConnecting, StateDisconnected)
+	if !errors.Is(changes[1].err, ErrInvalidState) {
+		t.Fatalf("disconnected with %v, want %v", changes[1].err, ErrInvalidState)
+	}
+	if s := c.State(); s != StateDisconnected || c.Connected() {
+		t.Fatalf("got %s, connected %t after the failure", s, c.Connected())
+	}
+}
+
+func TestStateConnectDisconnectClose(t *testing.T) {
+	_, url := newTestRouter(t)
+
+	c, err := New(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, cancel := recordStates(c)
+	defer cancel()
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, states, StateConnecting, StateConnected)
+	if !c.Connected() {
+		t.Fatal("not connected")
+	}
+
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, states, StateDisconnected)
+	if c.Connected() {
+		t.Fatal("connected after Disconnect")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, states, StateClosing, StateClosed)
+
+	if err := c.Connect(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want %v", err, ErrClosed)
+	}
+	if s := c.State(); s != StateClosed {
+		t.Fatalf("got %s after Close", s)
+	}
+}
+
+func TestStateReadError(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	states, cancel := recordStates(c)
+	defer cancel()
+
+	r.DropConnections()
+
+	changes := expectStates(t, states, StateDisconnected)
+	if changes[0].err == nil {
+		t.Fatal("disconnected without a cause")
+	}
+	if s := c.State(); s != StateDisconnected || c.Connected() {
+		t.Fatalf("got %s, connected %t after the read error", s, c.Connected())
+	}
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed")
+	}
+	if c.Err() == nil {
+		t.Fatal("no error after the read error")
+	}
+}
+
+func TestStateReadErrorReconnecting(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX", WithAutoReconnect(time.Millisecond, time.Millisecond))
+
+	states, cancel := recordStates(c)
+	defer cancel()
+
+	r.DropConnections()
+
+	changes := expectStates(t, states, StateDisconnected, StateConnecting, StateConnected)
+	if changes[0].err == nil {
+		t.Fatal("disconnected without a cause")
+	}
+	if !c.Connected() {
+		t.Fatal("not connected again")
+	}
+}
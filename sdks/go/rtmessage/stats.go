@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of how a Connection has behaved so far.
+type Stats struct {
+	// Inbox is the topic the connection receives responses on.
+	Inbox string
+
+	// RemoteAddr is the resolved address of the router, or empty when not
+	// connected.
+	RemoteAddr string
+
+	// ConnectedAt is when the current connection was established, or the
+	// zero time when not connected.
+	ConnectedAt time.Time
+
+	// Reconnects is the number of times the connection was established
+	// after the first time.
+	Reconnects uint64
+
+	MessagesSent     uint64
+	BytesSent        uint64
+	MessagesReceived uint64
+	BytesReceived    uint64
+
+	// IgnoredSelf is the number of the connection's own messages dropped
+	// because of WithIgnoreSelf.
+	IgnoredSelf uint64
+
+	// LateResponses is the number of responses received for no pending
+	// request, because it timed out or was canceled already or the
+	// sequence number is unknown.  They are dropped, except that those
+	// flagged undeliverable still go to the undeliverable listeners.
+	LateResponses uint64
+
+	// LastMessageAt is when the last message was received, or the zero time
+	// if none has been.
+	LastMessageAt time.Time
+
+	// LastReadError is the last error reported by the read loop, if any.
+	LastReadError error
+
+	// Subscriptions is the number of listeners currently registered.
+	Subscriptions int
+}
+
+// connStats holds the live values behind Stats.  The counters are atomics so
+// the send and read paths never contend with a caller polling Stats; the
+// rest is guarded by its own mutex rather than the connection's so a stalled
+// write doesn't block the snapshot.
+type connStats struct {
+	connects         atomic.Uint64
+	messagesSent     atomic.Uint64
+	bytesSent        atomic.Uint64
+	messagesReceived atomic.Uint64
+	bytesReceived    atomic.Uint64
+	ignoredSelf      atomic.Uint64
+	lateResponses    atomic.Uint64
+	lastMessageAt    atomic.Int64
+	subscriptions    atomic.Int64
+
+	m             sync.Mutex
+	remoteAddr    string
+	connectedAt   time.Time
+	lastReadError error
+}
+
+func (s *connStats) connected(remoteAddr string, now time.Time) {
+	s.connects.Add(1)
+
+	s.m.Lock()
+	s.remoteAddr = remoteAddr
+	s.connectedAt = now
+	s.m.Unlock()
+}
+
+func (s *connStats) disconnected() {
+	s.m.Lock()
+	s.remoteAddr = ""
+	s.connectedAt = time.Time{}
+	s.m.Unlock()
+}
+
+func (s *connStats) sent(bytes int) {
+	s.messagesSent.Add(1)
+	s.bytesSent.Add(uint64(bytes))
+}
+
+func (s *connStats) received(bytes int, now time.Time) {
+	s.messagesReceived.Add(1)
+	s.bytesReceived.Add(uint64(bytes))
+	s.lastMessageAt.Store(now.UnixNano())
+}
+
+func (s *connStats) readError(err error) {
+	s.m.Lock()
+	s.lastReadError = err
+	s.m.Unlock()
+}
+
+// Stats returns a snapshot of the connection's statistics.  It is safe to
+// call from any goroutine.
+func (c *Connection) Stats() Stats {
+	s := &c.stats
+
+	rv := Stats{
+		Inbox:            c.inbox,
+		MessagesSent:     s.messagesSent.Load(),
+		BytesSent:        s.bytesSent.Load(),
+		MessagesReceived: s.messagesReceived.Load(),
+		BytesReceived:    s.bytesReceived.Load(),
+		IgnoredSelf:      s.ignoredSelf.Load(),
+		LateResponses:    s.lateResponses.Load(),
+		Subscriptions:    int(s.subscriptions.Load()),
+	}
+
+	if connects := s.connects.Load(); connects > 1 {
+		rv.Reconnects = connects - 1
+	}
+
+	if last := s.lastMessageAt.Load(); last != 0 {
+		rv.LastMessageAt = time.Unix(0, last)
+	}
+
+	s.m.Lock()
+	rv.RemoteAddr = s.remoteAddr
+	rv.ConnectedAt = s.connectedAt
+	rv.LastReadError = s.lastReadError
+	s.m.Unlock()
+
+	return rv
+}
@@ -0,0 +1,329 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// subscriptions remembers the expressions the connection is subscribed to, so
+// they can be restored after a reconnect and are only sent to the router once.
+type subscriptions struct {
+	m       sync.Mutex
+	exprs   map[string]*subscription
+	aliases map[string]string
+}
+
+// subscription is a single expression.  It is kept while any listener added
+// for it remains, or for good when pinned by Subscribe or WithSubscription.
+type subscription struct {
+	routeID int
+	refs    int
+	pinned  bool
+}
+
+// routes returns the route IDs keyed by expression.
+func (s *subscriptions) routes() map[string]int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	rv := make(map[string]int, len(s.exprs))
+	for expr, sub := range s.exprs {
+		rv[expr] = sub.routeID
+	}
+
+	return rv
+}
+
+// aliasRoutes returns the route IDs of the aliases keyed by alias.
+func (s *subscriptions) aliasRoutes() map[string]int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	rv := make(map[string]int, len(s.aliases))
+	for alias, expr := range s.aliases {
+		if sub, found := s.exprs[expr]; found {
+			rv[alias] = sub.routeID
+		}
+	}
+
+	return rv
+}
+
+// aliasOf reports whether the topic is routed to an alias added to the
+// expression.
+func (s *subscriptions) aliasOf(topic, expression string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tokens := strings.Split(topic, ".")
+	for alias, expr := range s.aliases {
+		if expr == expression && matchRoute(strings.Split(alias, "."), tokens) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subscriptions returns the sorted expressions the connection is subscribed
+// to, including those made by listeners and those waiting for the connection
+// to come up.
+func (c *Connection) Subscriptions() []string {
+	c.subs.m.Lock()
+	defer c.subs.m.Unlock()
+
+	rv := make([]string, 0, len(c.subs.exprs))
+	for expr := range c.subs.exprs {
+		rv = append(rv, expr)
+	}
+	slices.Sort(rv)
+
+	return rv
+}
+
+// SubscriptionID returns the ID the expression was subscribed with, which the
+// router puts in the messages delivered for it; see Message.SubscriptionID.
+// It reports false when the connection is not subscribed to the expression.
+func (c *Connection) SubscriptionID(expression string) (uint32, bool) {
+	c.subs.m.Lock()
+	defer c.subs.m.Unlock()
+
+	sub, found := c.subs.exprs[expression]
+	if !found {
+		return 0, false
+	}
+
+	return uint32(sub.routeID), true
+}
+
+// Subscribe subscribes the connection to the expression.  Subscribing to an
+// expression already subscribed to does nothing.  When the connection is down
+// the subscription is made once it is connected.
+func (c *Connection) Subscribe(expression string) error {
+	if err := validateExpression(expression); err != nil {
+		return err
+	}
+
+	return c.acquire(expression, true)
+}
+
+// acquire records a use of the expression, subscribing to it the first time.
+func (c *Connection) acquire(expression string, pin bool) error {
+	c.subs.m.Lock()
+	sub, found := c.subs.exprs[expression]
+	if !found {
+		sub = &subscription{routeID: c.generator.getNextSubscriptionID()}
+		c.subs.exprs[expression] = sub
+	}
+	if pin {
+		sub.pinned = true
+	} else {
+		sub.refs++
+	}
+	c.subs.m.Unlock()
+
+	if found {
+		return nil
+	}
+
+	err := c.subscribe(context.Background(), expression, sub.routeID, true)
+	if err == nil || errors.Is(err, ErrInvalidState) || errors.Is(err, ErrClosed) || errors.Is(err, ErrConnectionClosed) {
+		// When not connected, or disconnected before the request went out,
+		// the subscription is made when connecting.
+		return nil
+	}
+
+	c.subs.m.Lock()
+	delete(c.subs.exprs, expression)
+	c.subs.m.Unlock()
+
+	return err
+}
+
+// release drops a use of the expression, unsubscribing when it was the last.
+func (c *Connection) release(expression string) {
+	c.subs.m.Lock()
+	sub, found := c.subs.exprs[expression]
+	if !found {
+		c.subs.m.Unlock()
+		return
+	}
+	sub.refs--
+	remove := sub.refs <= 0 && !sub.pinned
+	if remove {
+		delete(c.subs.exprs, expression)
+
+		// The router drops the aliases along with the route.
+		for alias, expr := range c.subs.aliases {
+			if expr == expression {
+				delete(c.subs.aliases, alias)
+			}
+		}
+	}
+	c.subs.m.Unlock()
+
+	if remove {
+		// If this fails the connection is down and the router forgets the
+		// route anyway.
+		_ = c.subscribe(context.Background(), expression, sub.routeID, false)
+	}
+}
+
+// AddAlias routes the messages for the topic alias to the route of the
+// subscribed expression, the way rtConnection_AddAlias does, so they are
+// delivered like those matching the expression.  An rbus provider adds its
+// elements as aliases of its component name.  The alias is restored after a
+// reconnect, and is dropped when the expression is unsubscribed.
+func (c *Connection) AddAlias(expression, alias string) error {
+	if err := validateExpression(alias); err != nil {
+		return err
+	}
+
+	c.subs.m.Lock()
+	sub, found := c.subs.exprs[expression]
+	if !found {
+		c.subs.m.Unlock()
+		return fmt.Errorf("%w: not subscribed to '%s'", ErrInvalidInput, expression)
+	}
+	if existing, found := c.subs.aliases[alias]; found {
+		c.subs.m.Unlock()
+		if existing == expression {
+			return nil
+		}
+		return fmt.Errorf("%w: '%s' is already an alias of '%s'", ErrInvalidInput, alias, existing)
+	}
+	if c.subs.aliases == nil {
+		c.subs.aliases = make(map[string]string)
+	}
+	c.subs.aliases[alias] = expression
+	routeID := sub.routeID
+	c.subs.m.Unlock()
+
+	err := c.subscribe(context.Background(), alias, routeID, true)
+	if err == nil || errors.Is(err, ErrInvalidState) {
+		// When not connected the alias is added when connecting.
+		return nil
+	}
+
+	c.subs.m.Lock()
+	delete(c.subs.aliases, alias)
+	c.subs.m.Unlock()
+
+	return err
+}
+
+// RemoveAlias stops routing the messages for the topic alias to this
+// connection.  Removing an alias that wasn't added does nothing.
+func (c *Connection) RemoveAlias(alias string) error {
+	c.subs.m.Lock()
+	expression, found := c.subs.aliases[alias]
+	var routeID int
+	if found {
+		routeID = c.subs.exprs[expression].routeID
+		delete(c.subs.aliases, alias)
+	}
+	c.subs.m.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	err := c.subscribe(context.Background(), alias, routeID, false)
+	if errors.Is(err, ErrInvalidState) {
+		// The router forgets the alias along with the connection.
+		return nil
+	}
+
+	return err
+}
+
+// validateExpression checks the expression against the topic syntax rtrouted
+// accepts: dot separated, non-empty segments of printable characters without
+// spaces, with an optional "*" wildcard as the last segment, shorter than the
+// router's topic limit.
+func validateExpression(expression string) error {
+	if expression == "" {
+		return fmt.Errorf("%w: empty subscription expression", ErrInvalidInput)
+	}
+
+	if len(expression) >= header_MAX_TOPIC_LEN {
+		return fmt.Errorf("%w: subscription expression longer than %d bytes",
+			ErrInvalidInput, header_MAX_TOPIC_LEN-1)
+	}
+
+	segments := strings.Split(expression, ".")
+	for i, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("%w: empty segment %d in subscription expression %q",
+				ErrInvalidInput, i+1, expression)
+		}
+
+		if strings.Contains(segment, "*") && (segment != "*" || i != len(segments)-1) {
+			return fmt.Errorf("%w: wildcard is only allowed as the last segment in subscription expression %q",
+				ErrInvalidInput, expression)
+		}
+
+		for _, r := range segment {
+			if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+				return fmt.Errorf("%w: invalid character %q in subscription expression %q",
+					ErrInvalidInput, r, expression)
+			}
+		}
+	}
+
+	return nil
+}
+
+// MatchTopic reports if the topic matches the subscription expression, where
+// a "*" segment matches any single segment of the topic.  Listeners receive
+// every message routed to the connection, so those added for an expression
+// use it to pick theirs.
+func MatchTopic(expression, topic string) bool {
+	return matchTokens(strings.Split(expression, "."), strings.Split(topic, "."))
+}
+
+// matchTokens reports if the topic tokens match the expression tokens.  A "*"
+// token matches any token, and a "{i}" token, which rbus providers register
+// tables with, matches a row instance like rtrouted does: a number, an
+// "[alias]" or "*".
+func matchTokens(expression, topic []string) bool {
+	if len(expression) != len(topic) {
+		return false
+	}
+
+	for i, token := range expression {
+		if token == "*" || token == topic[i] || (token == "{i}" && isInstance(topic[i])) {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
+
+func isInstance(token string) bool {
+	return token != "" && (unicode.IsDigit(rune(token[0])) || token[0] == '[' || token == "*")
+}
+
+// matchRoute reports if a message for the topic is routed to the expression.
+// Like rtrouted, a trailing "." of the topic is ignored and a table registered
+// as "Foo.{i}" is also reached by its name "Foo".
+func matchRoute(expression, topic []string) bool {
+	if n := len(topic); n > 0 && topic[n-1] == "" {
+		topic = topic[:n-1]
+	}
+
+	if matchTokens(expression, topic) {
+		return true
+	}
+
+	last := len(expression) - 1
+	return last > 0 && expression[last] == "{i}" && matchTokens(expression[:last], topic)
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateExpression(t *testing.T) {
+	valid := []string{
+		"A",
+		"Device.WiFi.SSID",
+		"Device.WiFi.*",
+		"*",
+		"Device.WiFi.SSID.{i}",
+		"_RTROUTED.ADVISORY",
+		strings.Repeat("a", header_MAX_TOPIC_LEN-1),
+	}
+	for _, expr := range valid {
+		if err := validateExpression(expr); err != nil {
+			t.Errorf("%q: %v", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"Device.",
+		".Device",
+		"Device..WiFi",
+		"Device.*.SSID",
+		"Device.Wi*",
+		"Device.WiFi.**",
+		"Device.Wi Fi",
+		"Device.WiFi\t",
+		"Device.\x00",
+		strings.Repeat("a", header_MAX_TOPIC_LEN),
+	}
+	for _, expr := range invalid {
+		if err := validateExpression(expr); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%q: got %v, want %v", expr, err, ErrInvalidInput)
+		}
+	}
+}
+
+func TestSubscriptionValidated(t *testing.T) {
+	if _, err := New("mem://x", "test", WithSubscription("Device..WiFi")); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("WithSubscription: got %v, want %v", err, ErrInvalidInput)
+	}
+	if _, err := New("mem://x", "test", WithSubscriptions("A", "")); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("WithSubscriptions: got %v, want %v", err, ErrInvalidInput)
+	}
+
+	_, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+
+	if err := c.Subscribe("Device.*.SSID"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Subscribe: got %v, want %v", err, ErrInvalidInput)
+	}
+	if _, err := c.Add(MessageListenerFunc(func(Message) {}), ""); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Add: got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestSubscribeIdempotent(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX", WithSubscription("Device.Test.*"))
+
+	for range 3 {
+		if err := c.Subscribe("Device.Test.*"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Subscribe("Device.Other"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each expression reached the router once, as a single route.
+	eventually(t, "the subscription", func() bool {
+		return slices.Contains(r.Subscriptions(), "Device.Other")
+	})
+	want := []string{"Device.Other", "Device.Test.*", "test.INBOX"}
+	if got := r.Subscriptions(); !slices.Equal(got, want) {
+		t.Fatalf("router has %q, want %q", got, want)
+	}
+
+	want = want[:2]
+	if got := c.Subscriptions(); !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * golden.c writes the .bin frames of this directory with the header encoder
+ * of the C library, for the tests to check that rtmessage reads and writes
+ * the same bytes.  The default build of the library gives the frames without
+ * the timestamps, the MSG_ROUNDTRIP_TIME build the -roundtrip ones with them.
+ * From this directory:
+ *
+ *   C=../../../../src/rtmessage
+ *   gcc -I$C -o golden golden.c $C/rtMessageHeader.c $C/rtEncoder.c && ./golden
+ *   gcc -I$C -DMSG_ROUNDTRIP_TIME -o golden golden.c $C/rtMessageHeader.c $C/rtEncoder.c && ./golden
+ */
+#include "rtMessageHeader.h"
+#include "rtLog.h"
+
+#include <stdarg.h>
+#include <stdio.h>
+#include <string.h>
+
+/* The decoder of the header logs through rtLog, which isn't needed here. */
+void rtLogPrintf(rtLogLevel level, const char* pModule, const char* file, int line, const char* format, ...)
+{
+  (void) level; (void) pModule; (void) file; (void) line; (void) format;
+}
+
+#ifdef MSG_ROUNDTRIP_TIME
+#define SUFFIX "-roundtrip"
+#else
+#define SUFFIX ""
+#endif
+
+static void
+golden(char const* name, uint32_t seq, uint32_t flags, uint32_t control,
+  char const* topic, char const* reply, char const* payload, uint32_t payloadLength)
+{
+  rtMessageHeader hdr;
+  uint8_t buff[1024];
+  char path[128];
+  FILE* f;
+
+  rtMessageHeader_Init(&hdr);
+  hdr.sequence_number = seq;
+  hdr.flags = flags;
+  hdr.control_data = control;
+  hdr.payload_length = payloadLength;
+  strcpy(hdr.topic, topic);
+  hdr.topic_length = strlen(topic);
+  strcpy(hdr.reply_topic, reply);
+  hdr.reply_topic_length = strlen(reply);
+#ifdef MSG_ROUNDTRIP_TIME
+  if (flags & rtMessageFlags_Request)
+  {
+    hdr.T1 = 1700000001;
+    hdr.T2 = 1700000002;
+    hdr.T3 = 1700000003;
+  }
+  if (flags & rtMessageFlags_Response)
+  {
+    hdr.T1 = 1700000001;
+    hdr.T2 = 1700000002;
+    hdr.T3 = 1700000003;
+    hdr.T4 = 1700000004;
+    hdr.T5 = 1700000005;
+  }
+#endif
+  rtMessageHeader_Encode(&hdr, buff);
+  memcpy(buff + hdr.header_length, payload, payloadLength);
+
+  snprintf(path, sizeof(path), "%s%s.bin", name, SUFFIX);
+  f = fopen(path, "wb");
+  fwrite(buff, 1, hdr.header_length + payloadLength, f);
+  fclose(f);
+}
+
+int main()
+{
+  static char const subscribe[] = "{\"add\":1,\"topic\":\"Device.Test.*\",\"route_id\":5}";
+  static char const request[] = "\x81\xa3" "get\xa6" "Device";
+  static char const response[] = "\x92\x00\xa2" "ok";
+
+  golden("subscribe", 1, 0, 0, "_RTROUTED.INBOX.SUBSCRIBE", "",
+    subscribe, sizeof(subscribe) - 1);
+  golden("request", 2, rtMessageFlags_Request | rtMessageFlags_RawBinary, 0,
+    "Device.Test.Value", "test.INBOX.4242", request, sizeof(request) - 1);
+  golden("response", 2, rtMessageFlags_Response | rtMessageFlags_RawBinary, 5,
+    "test.INBOX.4242", "", response, sizeof(response) - 1);
+  golden("undeliverable", 2, rtMessageFlags_Response | rtMessageFlags_Undeliverable, 0,
+    "test.INBOX.4242", "", "", 0);
+  golden("event", 3, 0, 5, "Device.Test.Event", "", "", 0);
+  return 0;
+}
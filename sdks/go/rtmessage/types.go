@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MsgType is the kind of a message, as given by its header flags.
+type MsgType int
+
+const (
+	MsgTypeUnknown MsgType = iota
+
+	// MsgTypeMessage is a plain published message.
+	MsgTypeMessage
+
+	// MsgTypeRequest is a message expecting a response on its reply topic.
+	MsgTypeRequest
+
+	// MsgTypeResponse is the answer to a request.
+	MsgTypeResponse
+)
+
+func (t MsgType) String() string {
+	switch t {
+	case MsgTypeMessage:
+		return "message"
+	case MsgTypeRequest:
+		return "request"
+	case MsgTypeResponse:
+		return "response"
+	}
+	return "unknown"
+}
+
+// ParseMsgType returns the MsgType named by s, as produced by String.  The
+// comparison ignores case.
+func ParseMsgType(s string) (MsgType, error) {
+	for _, t := range []MsgType{MsgTypeUnknown, MsgTypeMessage, MsgTypeRequest, MsgTypeResponse} {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return MsgTypeUnknown, fmt.Errorf("%w: unknown message type '%s'", ErrInvalidInput, s)
+}
+
+// PayloadType is the encoding of a message payload, as given by its header
+// flags.
+type PayloadType int
+
+const (
+	PayloadTypeUnknown PayloadType = iota
+
+	// PayloadTypeMsgpack is a structured payload, as sent by rbus.
+	PayloadTypeMsgpack
+
+	// PayloadTypeBinary is an opaque payload, flagged as raw binary.
+	PayloadTypeBinary
+)
+
+func (t PayloadType) String() string {
+	switch t {
+	case PayloadTypeMsgpack:
+		return "msgpack"
+	case PayloadTypeBinary:
+		return "binary"
+	}
+	return "unknown"
+}
+
+// ParsePayloadType returns the PayloadType named by s, as produced by String.
+// The comparison ignores case.
+func ParsePayloadType(s string) (PayloadType, error) {
+	for _, t := range []PayloadType{PayloadTypeUnknown, PayloadTypeMsgpack, PayloadTypeBinary} {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return PayloadTypeUnknown, fmt.Errorf("%w: unknown payload type '%s'", ErrInvalidInput, s)
+}
+
+// Type returns the kind of the message.
+func (m Message) Type() MsgType {
+	if m.Header == nil {
+		return MsgTypeUnknown
+	}
+
+	switch {
+	case m.Header.Flags&FLAGS_REQUEST != 0 && m.Header.Flags&FLAGS_RESPONSE != 0:
+		return MsgTypeUnknown
+	case m.Header.Flags&FLAGS_REQUEST != 0:
+		return MsgTypeRequest
+	case m.Header.Flags&FLAGS_RESPONSE != 0:
+		return MsgTypeResponse
+	}
+	return MsgTypeMessage
+}
+
+// PayloadType returns the encoding of the message payload.
+func (m Message) PayloadType() PayloadType {
+	if m.Header == nil {
+		return PayloadTypeUnknown
+	}
+
+	if m.Header.Flags&FLAGS_RAW_BINARY != 0 {
+		return PayloadTypeBinary
+	}
+	return PayloadTypeMsgpack
+}
+
+// SubscriptionID returns the ID of the subscription the router delivered the
+// message for, which is the control data of a message routed by rtrouted.  It
+// reports false for raw binary messages, which carry a client ID, and for
+// messages without control data.
+func (m Message) SubscriptionID() (uint32, bool) {
+	if m.Header == nil || m.Header.ControlData == 0 || m.Header.Flags&FLAGS_RAW_BINARY != 0 {
+		return 0, false
+	}
+	return m.Header.ControlData, true
+}
+
+// ClientID returns the ID of the client that sent a raw binary message, as
+// carried in the control data by direct connections.  It reports false for
+// other messages.
+func (m Message) ClientID() (uint32, bool) {
+	if m.Header == nil || m.Header.ControlData == 0 || m.Header.Flags&FLAGS_RAW_BINARY == 0 {
+		return 0, false
+	}
+	return m.Header.ControlData, true
+}
+
+// TransitLatency returns how long the message spent in the router, from
+// receiving it to writing it out, as recorded in the timestamps.  Both come
+// from the router's clock, so the host's clock doesn't skew the result, but
+// the resolution is only a second.  It reports false when the message carries
+// no timestamps.
+func (m Message) TransitLatency() (time.Duration, bool) {
+	if m.Header == nil {
+		return 0, false
+	}
+
+	received, written := m.Header.Timestamps[1], m.Header.Timestamps[2]
+	if received == 0 || written < received {
+		return 0, false
+	}
+
+	return time.Duration(written-received) * time.Second, true
+}
+
+// String summarizes the message for logging without including the payload.
+func (m Message) String() string {
+	if m.Header == nil {
+		return fmt.Sprintf("message without header, payload %d bytes", len(m.Payload))
+	}
+
+	return fmt.Sprintf("%s topic=%s reply=%s seq=%d flags=0x%x payload=%s/%d bytes",
+		m.Type(), m.Header.Topic, m.Header.ReplyTopic, m.Header.SequenceNumber,
+		m.Header.Flags, m.PayloadType(), len(m.Payload))
+}
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package rtmessage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgTypeRoundTrip(t *testing.T) {
+	for _, typ := range []MsgType{MsgTypeUnknown, MsgTypeMessage, MsgTypeRequest, MsgTypeResponse} {
+		for _, s := range []string{typ.String(), strings.ToUpper(typ.String())} {
+			got, err := ParseMsgType(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != typ {
+				t.Fatalf("%q: got %s, want %s", s, got, typ)
+			}
+		}
+	}
+
+	if s := MsgType(42).String(); s != "unknown" {
+		t.Fatalf("got %q", s)
+	}
+	if _, err := ParseMsgType("event"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestPayloadTypeRoundTrip(t *testing.T) {
+	for _, typ := range []PayloadType{PayloadTypeUnknown, PayloadTypeMsgpack, PayloadTypeBinary} {
+		for _, s := range []string{typ.String(), strings.ToUpper(typ.String())} {
+			got, err := ParsePayloadType(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != typ {
+				t.Fatalf("%q: got %s, want %s", s, got, typ)
+			}
+		}
+	}
+
+	if s := PayloadType(42).String(); s != "unknown" {
+		t.Fatalf("got %q", s)
+	}
+	if _, err := ParsePayloadType("json"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestMessageTypes(t *testing.T) {
+	tests := []struct {
+		flags   uint32
+		typ     MsgType
+		payload PayloadType
+	}{
+		{flags: 0, typ: MsgTypeMessage, payload: PayloadTypeMsgpack},
+		{flags: FLAGS_REQUEST, typ: MsgTypeRequest, payload: PayloadTypeMsgpack},
+		{flags: FLAGS_RESPONSE | FLAGS_RAW_BINARY, typ: MsgTypeResponse, payload: PayloadTypeBinary},
+		{flags: FLAGS_RESPONSE | FLAGS_UNDELIVERABLE, typ: MsgTypeResponse, payload: PayloadTypeMsgpack},
+		{flags: FLAGS_REQUEST | FLAGS_RESPONSE, typ: MsgTypeUnknown, payload: PayloadTypeMsgpack},
+	}
+
+	for _, tc := range tests {
+		m := Message{Header: &Header{Flags: tc.flags}}
+		if got := m.Type(); got != tc.typ {
+			t.Errorf("flags 0x%x: got %s, want %s", tc.flags, got, tc.typ)
+		}
+		if got := m.PayloadType(); got != tc.payload {
+			t.Errorf("flags 0x%x: got %s, want %s", tc.flags, got, tc.payload)
+		}
+	}
+
+	var m Message
+	if m.Type() != MsgTypeUnknown || m.PayloadType() != PayloadTypeUnknown {
+		t.Fatalf("got %s, %s without a header", m.Type(), m.PayloadType())
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	m := Message{
+		Header: &Header{
+			SequenceNumber: 7,
+			Flags:          FLAGS_REQUEST | FLAGS_RAW_BINARY,
+			Topic:          "Device.Test",
+			ReplyTopic:     "test.INBOX",
+		},
+		Payload: []byte("secret"),
+	}
+
+	want := "request topic=Device.Test reply=test.INBOX seq=7 flags=0x11 payload=binary/6 bytes"
+	if got := m.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if strings.Contains(m.String(), "secret") {
+		t.Fatal("payload dumped")
+	}
+
+	if got := (Message{Payload: []byte("x")}).String(); got != "message without header, payload 1 bytes" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestMessageControlData(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       *Header
+		subscription uint32
+		client       uint32
+	}{
+		{name: "routed", header: &Header{ControlData: 5}, subscription: 5},
+		{name: "routed request", header: &Header{Flags: FLAGS_REQUEST, ControlData: 5}, subscription: 5},
+		{name: "raw binary", header: &Header{Flags: FLAGS_RAW_BINARY, ControlData: 9}, client: 9},
+		{name: "no control data", header: &Header{}},
+		{name: "raw binary without control data", header: &Header{Flags: FLAGS_RAW_BINARY}},
+		{name: "no header"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := Message{Header: tc.header}
+
+			id, ok := m.SubscriptionID()
+			if id != tc.subscription || ok != (tc.subscription != 0) {
+				t.Fatalf("SubscriptionID: got %d, %t, want %d", id, ok, tc.subscription)
+			}
+			id, ok = m.ClientID()
+			if id != tc.client || ok != (tc.client != 0) {
+				t.Fatalf("ClientID: got %d, %t, want %d", id, ok, tc.client)
+			}
+		})
+	}
+}
+
+func TestMessageTransitLatency(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     *Header
+		want       time.Duration
+		timestamps bool
+	}{
+		{
+			// T1 and T4 are the sender's and the receiver's, so they're
+			// left out.
+			name:       "routed",
+			header:     &Header{Timestamps: [5]uint32{1, 100, 103, 200, 0}},
+			want:       3 * time.Second,
+			timestamps: true,
+		}, {
+			name:       "within a second",
+			header:     &Header{Timestamps: [5]uint32{0, 100, 100, 0, 0}},
+			timestamps: true,
+		},
+		{name: "no timestamps", header: &Header{}},
+		{name: "only written", header: &Header{Timestamps: [5]uint32{0, 0, 103, 0, 0}}},
+		{name: "written before received", header: &Header{Timestamps: [5]uint32{0, 103, 100, 0, 0}}},
+		{name: "no header"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d, ok := Message{Header: tc.header}.TransitLatency()
+			if d != tc.want || ok != tc.timestamps {
+				t.Fatalf("got %s, %t, want %s, %t", d, ok, tc.want, tc.timestamps)
+			}
+		})
+	}
+}
+
+func TestLatencyListener(t *testing.T) {
+	r, url := newTestRouter(t)
+
+	latencies := make(chan string, 10)
+	c := newTestConnection(t, url, "test.INBOX", WithLatencyListener(func(topic string, d time.Duration) {
+		latencies <- fmt.Sprintf("%s %s", topic, d)
+	}))
+	ch := subscribe(t, r, c, "Test.Event")
+
+	// Only the messages with timestamps are measured.
+	for _, timestamps := range [][5]uint32{{}, {0, 100, 102, 0, 0}} {
+		msg := Message{Header: &Header{Topic: "Test.Event", Timestamps: timestamps}}
+		if err := r.Inject(msg); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, ch)
+	}
+
+	select {
+	case got := <-latencies:
+		if got != "Test.Event 2s" {
+			t.Fatalf("got %s, want Test.Event 2s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no latency")
+	}
+	select {
+	case got := <-latencies:
+		t.Fatalf("got %s, want no more", got)
+	default:
+	}
+
+	if _, err := New(url, "test", WithLatencyListener(nil)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestSubscriptionIDWildcard(t *testing.T) {
+	r, url := newTestRouter(t)
+	c := newTestConnection(t, url, "test.INBOX")
+	sender := newTestConnection(t, url, "sender.INBOX")
+
+	ch := subscribe(t, r, c, "Device.WiFi.*")
+	subscribe(t, r, c, "Device.Ethernet.*")
+
+	wifi, ok := c.SubscriptionID("Device.WiFi.*")
+	if !ok {
+		t.Fatal("no ID for Device.WiFi.*")
+	}
+	ethernet, ok := c.SubscriptionID("Device.Ethernet.*")
+	if !ok {
+		t.Fatal("no ID for Device.Ethernet.*")
+	}
+	if wifi == ethernet {
+		t.Fatalf("both subscriptions have ID %d", wifi)
+	}
+	if _, ok := c.SubscriptionID("Device.Other"); ok {
+		t.Fatal("ID for an expression not subscribed to")
+	}
+
+	// Each delivery names the subscription it was made for.
+	for topic, want := range map[string]uint32{
+		"Device.WiFi.Radio":      wifi,
+		"Device.Ethernet.Status": ethernet,
+	} {
+		if err := sender.Send(context.Background(), nil, topic); err != nil {
+			t.Fatal(err)
+		}
+		msg := receive(t, ch)
+		if msg.Header.Topic != topic {
+			t.Fatalf("got %s, want %s", msg.Header.Topic, topic)
+		}
+		if id, ok := msg.SubscriptionID(); !ok || id != want {
+			t.Fatalf("%s: got subscription %d, %t, want %d", topic, id, ok, want)
+		}
+		if _, ok := msg.ClientID(); ok {
+			t.Fatalf("%s: client ID on a routed message", topic)
+		}
+	}
+
+	// So do the deliveries to the listeners of the expression.
+	ids := make(chan uint32, 1)
+	cancel, err := c.Add(MessageListenerFunc(func(msg Message) {
+		id, _ := msg.SubscriptionID()
+		ids <- id
+	}), "Device.WiFi.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	if err := sender.Send(context.Background(), nil, "Device.WiFi.Radio"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-ids:
+		if id != wifi {
+			t.Fatalf("listener got subscription %d, want %d", id, wifi)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener not called")
+	}
+}
@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scanField is a field of the struct GetInto fills, with the name of its
+// property.
+type scanField struct {
+	name      string
+	value     reflect.Value
+	omitEmpty bool
+}
+
+// GetInto fills the exported fields of the struct dest points to with the
+// properties under the prefix, fetched with a single request.  Each field is
+// named by its rbus tag, relative to the prefix, or else by its own name:
+//
+//	type config struct {
+//		Enable   bool   `rbus:"Enable"`
+//		Host     string `rbus:"Server.Host"`
+//		Port     uint16 `rbus:"Server.Port,omitempty"`
+//		Internal int    `rbus:"-"`
+//		Retry    struct {
+//			Count *int32
+//		}
+//	}
+//	err := h.GetInto(ctx, "Device.X_Example.", &c)
+//
+// Nested structs add their name as a path segment, so Retry.Count above is
+// "Device.X_Example.Retry.Count", and pointer fields are allocated as needed.
+// The fields of an embedded struct are named like those of the struct
+// embedding it, unless the embedded struct is tagged with a name.  A struct
+// that nests itself, such as one with a pointer to its own type, fails with
+// ErrInvalidInput.
+// The values are converted like ValueAs does.  Every field whose property was
+// fetched is filled; the fields that can't be filled are left alone, and their
+// errors are returned joined, each a *PropertyError.  A field tagged omitempty
+// whose property doesn't exist, or has no provider, isn't an error.
+func (h *Handle) GetInto(ctx context.Context, prefix string, dest any) error {
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("get into '%s': %w: %T is not a pointer to a struct", prefix, ErrInvalidInput, dest)
+	}
+
+	fields, err := scanFields(v.Elem(), prefix, nil, nil)
+	if err != nil {
+		return fmt.Errorf("get into '%s': %w", prefix, err)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+
+	props, err := h.GetProperties(ctx, names...)
+
+	// The properties that failed are reported one by one.
+	failed := make(map[string]error)
+	var pe *PropertyError
+	if errors.As(err, &pe) {
+		for _, e := range unwrapJoined(err) {
+			if errors.As(e, &pe) {
+				failed[pe.Name] = e
+			}
+		}
+	} else if err != nil {
+		return fmt.Errorf("get into '%s': %w", prefix, err)
+	}
+
+	values := make(map[string]Value, len(props))
+	for _, p := range props {
+		values[p.Name] = p.Value
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if err, found := failed[f.name]; found {
+			if !f.omitEmpty || !missing(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		val, found := values[f.name]
+		if !found {
+			continue
+		}
+
+		if err := scanValue(f.value, val); err != nil {
+			errs = append(errs, &PropertyError{Name: f.name, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("get into '%s': %w", prefix, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// scanFields lists the fields of the struct to fill, descending into nested
+// structs, which are allocated when reached through a nil pointer.  The
+// outer are the types of the structs the struct is nested in, so one nesting
+// itself, which only a pointer can, is caught instead of allocated forever.
+func scanFields(v reflect.Value, prefix string, fields []scanField, outer []reflect.Type) ([]scanField, error) {
+	t := v.Type()
+	outer = append(outer, t)
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("rbus")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fv := v.Field(i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		nested := ft.Kind() == reflect.Struct && ft != reflect.TypeFor[time.Time]()
+
+		// The fields of an embedded struct are promoted, like encoding/json
+		// does, even when its type isn't exported; a nil pointer to one
+		// can't be allocated, though.
+		if !sf.IsExported() && (!sf.Anonymous || !nested || fv.Kind() == reflect.Pointer) {
+			continue
+		}
+		embedded := sf.Anonymous && nested && name == ""
+		if name == "" {
+			name = sf.Name
+		}
+
+		if nested {
+			if fv.Kind() == reflect.Pointer {
+				if slices.Contains(outer, ft) {
+					return nil, fmt.Errorf("%w: %s nests itself", ErrInvalidInput, ft)
+				}
+				if fv.IsNil() {
+					fv.Set(reflect.New(ft))
+				}
+				fv = fv.Elem()
+			}
+
+			next := prefix + name + "."
+			if embedded {
+				next = prefix
+			}
+
+			var err error
+			if fields, err = scanFields(fv, next, fields, outer); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		fields = append(fields, scanField{
+			name:      prefix + name,
+			value:     fv,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+
+	return fields, nil
+}
+
+// scanValue converts the value to the type of the field and sets it, the way
+// ValueAs does.  A nil pointer field is allocated only once the conversion
+// succeeded.
+func scanValue(field reflect.Value, val Value) error {
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := scanValue(elem.Elem(), val); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		b, err := val.AsBool()
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.String:
+		s, err := val.AsString()
+		if err != nil {
+			return err
+		}
+		field.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := val.AsInt64()
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(i) {
+			return fmt.Errorf("%w: %s value %d overflows %s", ErrTypeMismatch, val.Type(), i, field.Type())
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := val.AsUint64()
+		if err != nil {
+			return err
+		}
+		if field.OverflowUint(u) {
+			return fmt.Errorf("%w: %s value %d overflows %s", ErrTypeMismatch, val.Type(), u, field.Type())
+		}
+		field.SetUint(u)
+	case reflect.Float32:
+		f, err := asFloat32(val)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(float64(f))
+	case reflect.Float64:
+		f, err := val.AsFloat64()
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type() != reflect.TypeFor[[]byte]() {
+			return val.mismatch(field.Type().String())
+		}
+		b, err := val.AsBytes()
+		if err != nil {
+			return err
+		}
+		field.SetBytes(b)
+	case reflect.Struct:
+		if field.Type() != reflect.TypeFor[time.Time]() {
+			return val.mismatch(field.Type().String())
+		}
+		t, err := val.AsTime()
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+	default:
+		return val.mismatch(field.Type().String())
+	}
+
+	return nil
+}
+
+// unwrapJoined returns the errors joined in err, or err alone.
+func unwrapJoined(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
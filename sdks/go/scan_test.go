@@ -0,0 +1,366 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// scanProvider registers the values under Device.Scan., along with the
+// elements in gone, which it says don't exist.
+func scanProvider(t *testing.T, url string, values map[string]rbus.Value, gone ...string) *rbus.Handle {
+	t.Helper()
+
+	provider := openHandle(t, url, "provider")
+	registerValues(t, provider, values)
+	for _, name := range gone {
+		if err := provider.RegisterElement(name, rbus.ElementCallbacks{GetHandler: getter(values)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return provider
+}
+
+// failedNames returns the names of the properties that failed, each with its
+// error.
+func failedNames(t *testing.T, err error) map[string]error {
+	t.Helper()
+
+	joined, ok := errors.Unwrap(err).(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("got %v, want the property errors joined", err)
+	}
+
+	failed := make(map[string]error)
+	for _, e := range joined.Unwrap() {
+		var pe *rbus.PropertyError
+		if !errors.As(e, &pe) {
+			t.Fatalf("got %v, want a *PropertyError", e)
+		}
+		failed[pe.Name] = pe.Err
+	}
+
+	return failed
+}
+
+func TestGetInto(t *testing.T) {
+	_, url := newRouter(t)
+	scanProvider(t, url, map[string]rbus.Value{
+		"Device.Scan.Enable":       rbus.NewValue(true),
+		"Device.Scan.Server.Host":  rbus.NewValue("example.com"),
+		"Device.Scan.Server.Port":  rbus.NewValue(uint32(8080)),
+		"Device.Scan.Retry.Count":  rbus.NewValue(int32(3)),
+		"Device.Scan.Retry.Delay":  rbus.NewValue(1.5),
+		"Device.Scan.Key":          rbus.NewValue([]byte{1, 2}),
+		"Device.Scan.Since":        rbus.NewTimeValue(time.Unix(1700000000, 0).UTC()),
+		"Device.Scan.Rate":         rbus.NewValue(float32(0.5)),
+		"Device.Scan.Optional.Set": rbus.NewValue(int32(-2)),
+	})
+	consumer := openHandle(t, url, "consumer")
+
+	type retry struct {
+		Count *int32
+		Delay float64
+	}
+	var got struct {
+		Enable     bool
+		Host       string `rbus:"Server.Host"`
+		Port       uint16 `rbus:"Server.Port"`
+		Retry      *retry
+		Key        []byte
+		Since      time.Time
+		Rate       float32
+		Set        *int64 `rbus:"Optional.Set"`
+		Internal   int    `rbus:"-"`
+		unexported int
+	}
+	got.Internal = 7
+
+	if err := consumer.GetInto(context.Background(), "Device.Scan", &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Enable || got.Host != "example.com" || got.Port != 8080 || got.Rate != 0.5 || got.Internal != 7 {
+		t.Fatalf("got %+v", got)
+	}
+	if got.Retry == nil || got.Retry.Count == nil || *got.Retry.Count != 3 || got.Retry.Delay != 1.5 {
+		t.Fatalf("got retry %+v", got.Retry)
+	}
+	if string(got.Key) != "\x01\x02" || got.Since.Unix() != 1700000000 {
+		t.Fatalf("got key %v since %v", got.Key, got.Since)
+	}
+	if got.Set == nil || *got.Set != -2 {
+		t.Fatalf("got set %v, want -2", got.Set)
+	}
+}
+
+func TestGetIntoPartial(t *testing.T) {
+	_, url := newRouter(t)
+	provider := scanProvider(t, url, map[string]rbus.Value{
+		"Device.Scan.X":    rbus.NewValue(int32(5)),
+		"Device.Scan.Name": rbus.NewValue("n"),
+	}, "Device.Scan.Gone", "Device.Scan.GoneOptional")
+	err := provider.RegisterElement("Device.Scan.Secret", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.Value{}, rbus.ErrAccessNotAllowed },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := openHandle(t, url, "consumer")
+
+	var got struct {
+		X              int
+		Gone           string
+		GoneOptional   string `rbus:",omitempty"`
+		Nobody         string
+		NobodyOptional *string `rbus:",omitempty"`
+		Secret         string  `rbus:",omitempty"`
+		Name           string
+	}
+	got.GoneOptional = "kept"
+
+	err = consumer.GetInto(context.Background(), "Device.Scan.", &got)
+
+	// Every field fetched is filled, whatever failed around it.
+	if got.X != 5 || got.Name != "n" {
+		t.Fatalf("got %+v, want X and Name filled", got)
+	}
+	if got.Gone != "" || got.GoneOptional != "kept" || got.Nobody != "" || got.NobodyOptional != nil {
+		t.Fatalf("got %+v, want the missing fields left alone", got)
+	}
+
+	// Only the missing fields without omitempty are errors, besides the
+	// field that's refused.
+	failed := failedNames(t, err)
+	if len(failed) != 3 ||
+		!errors.Is(failed["Device.Scan.Gone"], rbus.ErrElementDoesNotExist) ||
+		!errors.Is(failed["Device.Scan.Nobody"], rbus.ErrDestinationNotFound) ||
+		!errors.Is(failed["Device.Scan.Secret"], rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want Gone and Nobody missing, Secret refused", failed)
+	}
+
+	// A refusal alone doesn't keep the others from being filled either.
+	var refused struct {
+		X      int
+		Secret string
+	}
+	err = consumer.GetInto(context.Background(), "Device.Scan", &refused)
+	if failed := failedNames(t, err); len(failed) != 1 || !errors.Is(failed["Device.Scan.Secret"], rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want Secret refused", failed)
+	}
+	if refused.X != 5 {
+		t.Fatalf("got %+v, want X filled", refused)
+	}
+
+	// With only omitempty fields missing there's no error at all.
+	var optional struct {
+		X            int
+		GoneOptional string  `rbus:",omitempty"`
+		Nobody       *string `rbus:",omitempty"`
+	}
+	if err := consumer.GetInto(context.Background(), "Device.Scan", &optional); err != nil || optional.X != 5 {
+		t.Fatalf("got %+v and %v, want X filled", optional, err)
+	}
+}
+
+func TestGetIntoMismatch(t *testing.T) {
+	_, url := newRouter(t)
+	scanProvider(t, url, map[string]rbus.Value{
+		"Device.Scan.Int":      rbus.NewValue(int32(300)),
+		"Device.Scan.Negative": rbus.NewValue(int32(-1)),
+		"Device.Scan.Text":     rbus.NewValue("text"),
+		"Device.Scan.Fraction": rbus.NewValue(0.1),
+		"Device.Scan.Flag":     rbus.NewValue(true),
+		"Device.Scan.Good":     rbus.NewValue(int32(1)),
+	})
+	consumer := openHandle(t, url, "consumer")
+
+	tests := []struct {
+		name  string
+		field string
+		dest  func() any
+		read  func(any) any // the field after the get
+		zero  any
+	}{
+		{name: "int overflow", field: "Int", dest: func() any { return &struct{ Int int8 }{} },
+			read: func(d any) any { return d.(*struct{ Int int8 }).Int }, zero: int8(0)},
+		{name: "negative unsigned", field: "Negative", dest: func() any { return &struct{ Negative uint }{} },
+			read: func(d any) any { return d.(*struct{ Negative uint }).Negative }, zero: uint(0)},
+		{name: "string to int", field: "Text", dest: func() any { return &struct{ Text int32 }{} },
+			read: func(d any) any { return d.(*struct{ Text int32 }).Text }, zero: int32(0)},
+		{name: "int to string", field: "Int", dest: func() any { return &struct{ Int string }{} },
+			read: func(d any) any { return d.(*struct{ Int string }).Int }, zero: ""},
+		{name: "inexact float32", field: "Fraction", dest: func() any { return &struct{ Fraction float32 }{} },
+			read: func(d any) any { return d.(*struct{ Fraction float32 }).Fraction }, zero: float32(0)},
+		{name: "bool to bytes", field: "Flag", dest: func() any { return &struct{ Flag []byte }{} },
+			read: func(d any) any { return d.(*struct{ Flag []byte }).Flag == nil }, zero: true},
+		{name: "string to time", field: "Text", dest: func() any { return &struct{ Text time.Time }{} },
+			read: func(d any) any { return d.(*struct{ Text time.Time }).Text.IsZero() }, zero: true},
+		{name: "unsupported type", field: "Int", dest: func() any { return &struct{ Int map[string]int }{} },
+			read: func(d any) any { return d.(*struct{ Int map[string]int }).Int == nil }, zero: true},
+		{name: "pointer left nil", field: "Text", dest: func() any { return &struct{ Text *bool }{} },
+			read: func(d any) any { return d.(*struct{ Text *bool }).Text == nil }, zero: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := tc.dest()
+			err := consumer.GetInto(context.Background(), "Device.Scan", dest)
+
+			failed := failedNames(t, err)
+			if len(failed) != 1 || !errors.Is(failed["Device.Scan."+tc.field], rbus.ErrTypeMismatch) {
+				t.Fatalf("got %v, want %s mismatched", failed, tc.field)
+			}
+			if got := tc.read(dest); got != tc.zero {
+				t.Fatalf("got %v, want the field left alone", got)
+			}
+		})
+	}
+
+	// A mismatch is reported even for an omitempty field, and doesn't keep
+	// the others from being filled.
+	var mixed struct {
+		Good int
+		Text *int `rbus:",omitempty"`
+	}
+	err := consumer.GetInto(context.Background(), "Device.Scan", &mixed)
+	if failed := failedNames(t, err); len(failed) != 1 || !errors.Is(failed["Device.Scan.Text"], rbus.ErrTypeMismatch) {
+		t.Fatalf("got %v, want Text mismatched", failed)
+	}
+	if mixed.Good != 1 || mixed.Text != nil {
+		t.Fatalf("got %+v, want Good filled", mixed)
+	}
+}
+
+func TestGetIntoPointers(t *testing.T) {
+	_, url := newRouter(t)
+	scanProvider(t, url, map[string]rbus.Value{
+		"Device.Scan.Inner.Value": rbus.NewValue("inner"),
+		"Device.Scan.Count":       rbus.NewValue(uint32(4)),
+	})
+	consumer := openHandle(t, url, "consumer")
+
+	type inner struct {
+		Value *string
+	}
+
+	// A pointer already set is filled in place.
+	count := uint64(9)
+	var got struct {
+		Inner *inner
+		Count *uint64
+	}
+	got.Count = &count
+
+	if err := consumer.GetInto(context.Background(), "Device.Scan", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Inner == nil || got.Inner.Value == nil || *got.Inner.Value != "inner" {
+		t.Fatalf("got %+v, want the inner value", got.Inner)
+	}
+	if got.Count == nil || *got.Count != 4 {
+		t.Fatalf("got %v, want 4", got.Count)
+	}
+
+	for _, dest := range []any{nil, got, &count, (*struct{ X int })(nil)} {
+		if err := consumer.GetInto(context.Background(), "Device.Scan", dest); !errors.Is(err, rbus.ErrInvalidInput) {
+			t.Fatalf("%T: got %v, want %v", dest, err, rbus.ErrInvalidInput)
+		}
+	}
+}
+
+func TestGetIntoEmbedded(t *testing.T) {
+	_, url := newRouter(t)
+	scanProvider(t, url, map[string]rbus.Value{
+		"Device.Scan.Enable":         rbus.NewValue(true),
+		"Device.Scan.Count":          rbus.NewValue(int32(3)),
+		"Device.Scan.Name":           rbus.NewValue("name"),
+		"Device.Scan.Tagged.Enable":  rbus.NewValue(true),
+		"Device.Scan.Primary.Host":   rbus.NewValue("a"),
+		"Device.Scan.Secondary.Host": rbus.NewValue("b"),
+	})
+	consumer := openHandle(t, url, "consumer")
+
+	type Common struct {
+		Enable bool
+	}
+	type counts struct {
+		Count int32
+	}
+	type Named struct {
+		Name string
+	}
+	type server struct {
+		Host string
+	}
+	type tagged struct {
+		Enable bool
+	}
+
+	// The fields of the embedded structs are named without theirs, but for
+	// one tagged with a name, while a struct used twice is no cycle.
+	var got struct {
+		Common
+		counts
+		*Named
+		tagged    `rbus:"Tagged"`
+		Primary   server
+		Secondary server
+	}
+	if err := consumer.GetInto(context.Background(), "Device.Scan", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Common.Enable || got.Count != 3 || got.Named == nil || got.Name != "name" {
+		t.Fatalf("got %+v, want the embedded fields filled", got)
+	}
+	if !got.tagged.Enable {
+		t.Fatalf("got %+v, want Device.Scan.Tagged.Enable", got.tagged)
+	}
+	if got.Primary.Host != "a" || got.Secondary.Host != "b" {
+		t.Fatalf("got %+v and %+v, want a and b", got.Primary, got.Secondary)
+	}
+}
+
+func TestGetIntoCycle(t *testing.T) {
+	_, url := newRouter(t)
+	scanProvider(t, url, map[string]rbus.Value{"Device.Scan.Value": rbus.NewValue(int32(1))})
+	consumer := openHandle(t, url, "consumer")
+
+	type node struct {
+		Value int32
+		Next  *node
+	}
+	type pair struct {
+		Value int32
+		Inner *struct {
+			Outer *pair
+		}
+	}
+
+	for _, dest := range []any{&node{}, &pair{}} {
+		if err := consumer.GetInto(context.Background(), "Device.Scan", dest); !errors.Is(err, rbus.ErrInvalidInput) {
+			t.Fatalf("%T: got %v, want %v", dest, err, rbus.ErrInvalidInput)
+		}
+	}
+}
+
+func TestGetIntoCanceled(t *testing.T) {
+	_, url := newRouter(t)
+	scanProvider(t, url, map[string]rbus.Value{"Device.Scan.X": rbus.NewValue(int32(5))})
+	consumer := openHandle(t, url, "consumer")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var got struct{ X int }
+	if err := consumer.GetInto(ctx, "Device.Scan", &got); !errors.Is(err, context.Canceled) || got.X != 0 {
+		t.Fatalf("got %+v and %v, want %v", got, err, context.Canceled)
+	}
+}
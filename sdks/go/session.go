@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// The session manager hands out the session ids shared by the sets of a
+// transaction spanning providers.  It's a provider of methods, called the way
+// rbus_createSession and rbus_closeSession call them.
+const (
+	sessionManager       = "_rbus_session_mgr"
+	methodRequestSession = "req_new_s"
+	methodEndSession     = "end_of_s"
+)
+
+// SessionID identifies a session.  Zero means no session.
+type SessionID uint32
+
+// CreateSession asks the session manager for a new session, whose id the
+// sets given it with WithSession carry, so their providers can tell the sets
+// of the transaction.  The session manager runs one session at a time, so
+// creating another while one is open fails with ErrSessionAlreadyExists.
+func (h *Handle) CreateSession(ctx context.Context) (SessionID, error) {
+	out, err := h.Invoke(ctx, methodRequestSession, nil)
+	if err != nil {
+		return 0, fmt.Errorf("create session: %w", err)
+	}
+
+	// The result comes first, then the id.  The session manager fails only
+	// when a session is open, with a code the C library reports as this one.
+	if sessionResult(out) != nil {
+		return 0, fmt.Errorf("create session: %w", ErrSessionAlreadyExists)
+	}
+	if len(out) < 2 {
+		return 0, fmt.Errorf("create session: %w: no session id", ErrMalformedMessage)
+	}
+
+	id, err := out[1].Value.AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("create session: %w", err)
+	}
+
+	return SessionID(id), nil
+}
+
+// CloseSession ends the session with the session manager, like
+// rbus_closeSession.  It neither commits nor rolls back the sets made in it,
+// which were committed, or not, as they were made; see WithCommit.  The
+// values a provider made with WithStagedSets holds for the session, waiting
+// for a set that commits, are dropped.  Closing session 0 does nothing, like
+// in the C library.
+//
+// When the session manager refuses, for an id other than that of the open
+// session, the error matches the ErrorCode it returned.
+func (h *Handle) CloseSession(ctx context.Context, id SessionID) error {
+	if id == 0 {
+		return nil
+	}
+
+	in := []Property{{Name: "session", Value: NewValue(int32(id))}}
+	out, err := h.Invoke(ctx, methodEndSession, in)
+	if err != nil {
+		return fmt.Errorf("close session %d: %w", id, err)
+	}
+	if err := sessionResult(out); err != nil {
+		return fmt.Errorf("close session %d: %w", id, err)
+	}
+
+	h.m.Lock()
+	if h.session == id {
+		h.session = 0
+	}
+	h.m.Unlock()
+
+	return nil
+}
+
+// BeginSession creates a session with CreateSession and makes it the session
+// of the handle: until CommitSession, the sets of the handle carry its id.
+// Only one session can be open on a handle at a time.
+func (h *Handle) BeginSession(ctx context.Context) (SessionID, error) {
+	h.m.Lock()
+	open := h.session
+	h.m.Unlock()
+
+	if open != 0 {
+		return 0, fmt.Errorf("begin session: %w: %d", ErrSessionAlreadyExists, open)
+	}
+
+	id, err := h.CreateSession(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin session: %w", err)
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.session != 0 {
+		return 0, fmt.Errorf("begin session: %w: %d", ErrSessionAlreadyExists, h.session)
+	}
+	h.session = id
+
+	return h.session, nil
+}
+
+// CommitSession closes the session of the handle begun with BeginSession,
+// once the sets made in it committed.
+func (h *Handle) CommitSession(ctx context.Context) error {
+	h.m.Lock()
+	id := h.session
+	h.m.Unlock()
+
+	if id == 0 {
+		return fmt.Errorf("commit session: %w", ErrNoSession)
+	}
+
+	if err := h.CloseSession(ctx, id); err != nil {
+		return fmt.Errorf("commit session: %w", err)
+	}
+
+	return nil
+}
+
+// sessionResult returns the ErrorCode of the result the session manager puts
+// first in its output parameters, or nil for success.
+func sessionResult(out []Property) error {
+	if len(out) == 0 {
+		return fmt.Errorf("%w: no session result", ErrMalformedMessage)
+	}
+
+	rc, err := out[0].Value.AsInt64()
+	if err != nil {
+		return err
+	}
+
+	return checkReturnCode(int32(rc))
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+func TestSessionIDRoundTrip(t *testing.T) {
+	// The id has the top bit set, which an int32 on the wire holds as a
+	// negative number.
+	const id rbus.SessionID = 0x89abcdef
+
+	_, url := newRouter(t)
+	sm := newSessionManager(t, url, id)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	var s setter
+	s.register(t, provider, "Device.Test.A")
+
+	ctx := context.Background()
+	got, err := consumer.BeginSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != id {
+		t.Fatalf("got session %#x, want %#x", got, id)
+	}
+	if _, err := consumer.BeginSession(ctx); !errors.Is(err, rbus.ErrSessionAlreadyExists) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrSessionAlreadyExists)
+	}
+
+	if err := consumer.Set(ctx, "Device.Test.A", rbus.NewValue("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.CommitSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.Set(ctx, "Device.Test.A", rbus.NewValue("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.m.Lock()
+	opts := s.opts
+	s.m.Unlock()
+	if len(opts) != 2 || opts[0].Session != id || opts[1].Session != 0 {
+		t.Fatalf("got %+v, want session %#x, then none", opts, id)
+	}
+
+	sm.m.Lock()
+	ended := sm.ended
+	sm.m.Unlock()
+	if len(ended) != 1 || uint32(ended[0]) != uint32(id) {
+		t.Fatalf("got %#x ended, want %#x", ended, id)
+	}
+
+	// The session manager refuses to end a session that isn't open.
+	if err := consumer.CloseSession(ctx, id); !errors.Is(err, rbus.ErrSessionAlreadyExists) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrSessionAlreadyExists)
+	}
+	if err := consumer.CommitSession(ctx); !errors.Is(err, rbus.ErrNoSession) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrNoSession)
+	}
+	if err := consumer.CloseSession(ctx, 0); err != nil {
+		t.Fatalf("closing session 0: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// SetOption is an option of a set.
+type SetOption interface {
+	apply(*setConfig)
+}
+
+type setOptionFunc func(*setConfig)
+
+func (f setOptionFunc) apply(cfg *setConfig) {
+	f(cfg)
+}
+
+type setConfig struct {
+	callConfig
+	session SessionID
+	commit  bool
+}
+
+// WithSession makes the set part of the session, one from CreateSession,
+// instead of the session of the handle.  Staged sets, made with
+// WithCommit(false) and followed by a set that commits, give each the same
+// session.
+func WithSession(id SessionID) SetOption {
+	return setOptionFunc(func(cfg *setConfig) {
+		cfg.session = id
+	})
+}
+
+// WithCommit sets whether the set commits, which it does by default.  The
+// provider is told of the commit with the last value, so it can apply related
+// values together; one made with WithStagedSets holds the values of the sets
+// that don't commit until a set of the same session does.  It overrides the
+// commit argument of SetMultiple.
+func WithCommit(commit bool) SetOption {
+	return setOptionFunc(func(cfg *setConfig) {
+		cfg.commit = commit
+	})
+}
+
+// SetStatus is what the provider reported for a single property of a set.
+type SetStatus struct {
+	Name string
+
+	// Code is zero when the provider accepted the value, or the code it
+	// rejected it with.
+	Code ErrorCode
+
+	// Attempted is false for the properties the provider didn't get to,
+	// as it stops at the first one it rejects.
+	Attempted bool
+}
+
+// SetResult reports how the provider handled each property of a set.
+type SetResult struct {
+	// Properties holds the status of each property, in the order given.
+	Properties []SetStatus
+
+	// Failed is the name of the property the provider rejected, as the
+	// provider reported it, or empty when it accepted them all.  A name
+	// that isn't one of the properties, such as that of the consumer for a
+	// request the provider couldn't read, means none was attempted.
+	Failed string
+}
+
+// SetMultiple sets the properties with a single request to the provider of the
+// first one, like SetProperties, committing them when commit is true; see
+// WithCommit.
+//
+// When the provider rejects one of the properties the error is a
+// *PropertyError naming the property, wrapping the ErrorCode.
+func (h *Handle) SetMultiple(ctx context.Context, params []Property, commit bool, opts ...SetOption) error {
+	_, err := h.SetProperties(ctx, params, append([]SetOption{WithCommit(commit)}, opts...)...)
+	return err
+}
+
+// SetProperties sets the properties with a single request to the provider of
+// the first one, which should own them all, or to the component given with
+// ToComponent, and commits them unless WithCommit says otherwise.  The request
+// carries the id of the session given with WithSession, or else of the one
+// begun with BeginSession, so the providers can tell the sets of a
+// transaction spanning several of them; see Batch for grouping them by
+// provider.
+//
+// The provider hands the values to their setters in order and stops at the
+// first it rejects; the result tells which were accepted, the one rejected
+// with its code, and those not attempted.  The error is then a *PropertyError
+// naming the property, wrapping the ErrorCode.  When the request fails as a
+// whole, for example because the provider can't be reached, the result is
+// empty; when no provider of the name is on the bus, the error matches
+// ErrDestinationNotFound.
+func (h *Handle) SetProperties(ctx context.Context, params []Property, opts ...SetOption) (SetResult, error) {
+	if len(params) == 0 {
+		return SetResult{}, nil
+	}
+
+	h.m.Lock()
+	cfg := setConfig{session: h.session, commit: true}
+	h.m.Unlock()
+
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+
+	req := h.newMessage()
+	req.AppendInt32(int32(cfg.session))
+	req.AppendString(h.cfg.appName)
+	req.AppendInt32(int32(len(params)))
+	for _, p := range params {
+		req.AppendString(p.Name)
+		if err := req.AppendValue(p.Value); err != nil {
+			return SetResult{}, fmt.Errorf("set '%s': %w", p.Name, err)
+		}
+	}
+	if cfg.commit {
+		req.AppendString("TRUE")
+	} else {
+		req.AppendString("FALSE")
+	}
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodSetParameterValues, parent, state)
+
+	// A committed set may have been applied before its response was lost.
+	var result SetResult
+	err := h.retry(ctx, !cfg.commit, func() (err error) {
+		result, err = h.sendSet(ctx, params, req, cfg)
+		return err
+	})
+
+	return result, err
+}
+
+// sendSet sends the set request of the properties and decodes the response.
+func (h *Handle) sendSet(ctx context.Context, params []Property, req *Message, cfg setConfig) (SetResult, error) {
+	resp, err := h.request(ctx, cfg.topic(params[0].Name), req)
+	if err != nil {
+		return SetResult{}, fmt.Errorf("set: %w", cfg.wrap(err))
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return SetResult{}, fmt.Errorf("set: %w", err)
+	}
+
+	err = checkReturnCode(rc)
+
+	// The provider names the property it rejected.
+	var failed string
+	if err != nil {
+		failed, _ = resp.PopString()
+	}
+
+	result := setResult(params, failed, rc, err == nil)
+	switch {
+	case err == nil:
+		return result, nil
+	case failed == "":
+		return result, fmt.Errorf("set: %w", err)
+	}
+
+	return result, fmt.Errorf("set: %w", &PropertyError{Name: failed, Err: err})
+}
+
+// setResult lists the status of each property: those before the one that
+// failed were accepted, and those after it not attempted.  With no failure
+// reported, all of them were accepted when ok, and none attempted otherwise.
+func setResult(params []Property, failed string, rc int32, ok bool) SetResult {
+	result := SetResult{
+		Properties: make([]SetStatus, len(params)),
+		Failed:     failed,
+	}
+
+	stop := len(params)
+	if !ok {
+		stop = slices.IndexFunc(params, func(p Property) bool {
+			return p.Name == failed
+		})
+	}
+
+	for i, p := range params {
+		result.Properties[i] = SetStatus{Name: p.Name, Attempted: stop >= 0 && i <= stop}
+		if i == stop && !ok {
+			result.Properties[i].Code = ErrorCode(rc)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+func TestSetMultipleRejectsSecond(t *testing.T) {
+	wifi := []rbus.Property{
+		{Name: "Device.WiFi.SSID", Value: rbus.NewValue("home")},
+		{Name: "Device.WiFi.Passphrase", Value: rbus.NewValue("short")},
+		{Name: "Device.WiFi.Enable", Value: rbus.NewValue(true)},
+	}
+
+	tests := []struct {
+		name string
+		opts []rbus.Option
+	}{
+		{name: "handed over"},
+		{name: "staged", opts: []rbus.Option{rbus.WithStagedSets()}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, url := newRouter(t)
+			provider := openHandle(t, url, "provider", tc.opts...)
+			consumer := openHandle(t, url, "consumer")
+
+			s := setter{reject: map[string]rbus.ErrorCode{"Device.WiFi.Passphrase": rbus.ErrInvalidParameterValue}}
+			s.register(t, provider, "Device.WiFi.SSID", "Device.WiFi.Passphrase", "Device.WiFi.Enable")
+
+			err := consumer.SetMultiple(context.Background(), wifi, true)
+			var pe *rbus.PropertyError
+			if !errors.As(err, &pe) || pe.Name != "Device.WiFi.Passphrase" || !errors.Is(err, rbus.ErrInvalidParameterValue) {
+				t.Fatalf("got %v, want the passphrase rejected", err)
+			}
+
+			// Nothing was committed, and the enable never got there.
+			if got, want := s.took(), "[Device.WiFi.SSID=home]"; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			for _, opts := range s.opts {
+				if opts.Commit {
+					t.Fatalf("got %+v, want no commit", opts)
+				}
+			}
+
+			// The result tells the properties apart.
+			result, _ := consumer.SetProperties(context.Background(), wifi)
+			want := []rbus.SetStatus{
+				{Name: "Device.WiFi.SSID", Attempted: true},
+				{Name: "Device.WiFi.Passphrase", Code: rbus.ErrInvalidParameterValue, Attempted: true},
+				{Name: "Device.WiFi.Enable"},
+			}
+			if result.Failed != "Device.WiFi.Passphrase" || len(result.Properties) != len(want) {
+				t.Fatalf("got %+v, want the passphrase failed", result)
+			}
+			for i, status := range result.Properties {
+				if status != want[i] {
+					t.Fatalf("property %d: got %+v, want %+v", i, status, want[i])
+				}
+			}
+			s.took()
+
+			// With a passphrase the provider takes, all three commit.
+			wifi := append([]rbus.Property(nil), wifi...)
+			wifi[1].Value = rbus.NewValue("long enough")
+			s.m.Lock()
+			s.reject = nil
+			s.m.Unlock()
+			if err := consumer.SetMultiple(context.Background(), wifi, true); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := s.took(), "[Device.WiFi.SSID=home Device.WiFi.Passphrase=long enough Device.WiFi.Enable=true!]"; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"time"
+)
+
+// sessionSignal is the event the session manager publishes each time a
+// session is created or ended, with the id of the open session, zero when
+// there's none, as "sessionid".
+const sessionSignal = "currentSessionIDSignal"
+
+// watchTimeout bounds the subscription to the session manager's signal.
+const watchTimeout = 5 * time.Second
+
+// stagedProperty is a property of a set, with the component that made it and
+// the inbox it answers to, which tells when that component is gone.
+type stagedProperty struct {
+	Property
+	requester string
+	inbox     string
+}
+
+// stage holds the properties of a set that doesn't commit under its session,
+// once it's checked that their elements can be set, returning the name of the
+// one that can't.  The session manager is watched first, so the properties
+// are dropped if the session ends without the set that commits.
+func (h *Handle) stage(ctx context.Context, id SessionID, props []stagedProperty) (string, int32) {
+	for _, p := range props {
+		cb, found := h.element(p.Name)
+		if !found {
+			return p.Name, int32(ErrElementDoesNotExist)
+		}
+		if cb.SetHandler == nil {
+			return p.Name, int32(ErrInvalidOperation)
+		}
+	}
+
+	if id != 0 {
+		h.watchSessions(ctx)
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.staged == nil {
+		h.staged = make(map[SessionID][]stagedProperty)
+	}
+	h.staged[id] = append(h.staged[id], props...)
+
+	return "", 0
+}
+
+// unstage removes the properties staged under the session, returning them in
+// the order they were set.
+func (h *Handle) unstage(id SessionID) []stagedProperty {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	props := h.staged[id]
+	delete(h.staged, id)
+
+	return props
+}
+
+// watchSessions subscribes to the session manager's signal, unless that's
+// done already.  Without a session manager on the bus it's tried again with
+// the next set staged in a session.
+func (h *Handle) watchSessions(ctx context.Context) {
+	h.watching.Lock()
+	defer h.watching.Unlock()
+
+	h.m.Lock()
+	watching := h.sessionWatch != nil
+	h.m.Unlock()
+	if watching {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, watchTimeout)
+	defer cancel()
+
+	sub, err := h.Subscribe(ctx, sessionSignal, h.onSessionSignal, SubOnLost(func(error) {
+		h.m.Lock()
+		h.sessionWatch = nil
+		h.m.Unlock()
+	}))
+	if err != nil {
+		h.cfg.logger.DebugContext(ctx, "watching the sessions failed", "error", err)
+		return
+	}
+
+	h.m.Lock()
+	h.sessionWatch = sub
+	h.m.Unlock()
+}
+
+// onSessionSignal drops the properties staged under the sessions other than
+// the open one, which are over.
+func (h *Handle) onSessionSignal(e Event) {
+	for _, p := range e.Data {
+		if p.Name != "sessionid" {
+			continue
+		}
+
+		open, err := p.Value.AsInt64()
+		if err != nil {
+			return
+		}
+
+		h.m.Lock()
+		for id := range h.staged {
+			if id != 0 && id != SessionID(open) {
+				delete(h.staged, id)
+			}
+		}
+		h.m.Unlock()
+		return
+	}
+}
+
+// dropStagedOf drops the properties staged by the consumer whose responses go
+// to the inbox, which is gone.
+func (h *Handle) dropStagedOf(inbox string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for id, props := range h.staged {
+		kept := props[:0]
+		for _, p := range props {
+			if p.inbox != inbox {
+				kept = append(kept, p)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(h.staged, id)
+		} else {
+			h.staged[id] = kept
+		}
+	}
+}
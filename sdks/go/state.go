@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import "github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+
+// State is the state of the connection of a Handle to the bus.
+type State int
+
+const (
+	// StateDisconnected means the handle isn't connected, either because
+	// it was closed or because the connection was lost.
+	StateDisconnected State = iota
+
+	// StateConnected means the handle is connected and registered with
+	// the bus.
+	StateConnected
+
+	// StateReconnecting means the connection was lost and is being
+	// reestablished.
+	StateReconnecting
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+// AddConnectionListener registers a function called with each change of the
+// state of the handle's connection to the bus, returning a function that
+// removes it.  The change to StateDisconnected carries the error that caused
+// it, or nil when the handle was closed.
+//
+// Open reports StateConnected once the component is registered, and Close
+// StateDisconnected.  In between, a lost connection is reported as
+// StateDisconnected then StateReconnecting, and StateConnected again once
+// reestablished and the registrations and subscriptions of the handle are
+// restored; those whose provider isn't back yet are still being retried then,
+// as for OnReconnect.  The changes are delivered in order, one at a time, from a
+// goroutine of the handle, and none is dropped however fast they come.
+func (h *Handle) AddConnectionListener(listener func(State, error)) func() {
+	if listener == nil {
+		return func() {}
+	}
+
+	return h.states.Add(listener)
+}
+
+// onStateChange reports the changes of state of the transport.  A transport
+// that has the state of the handle restored after reconnecting is reported
+// connected again once restore is done too.
+func (h *Handle) onStateChange(s rtmessage.State, err error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	switch s {
+	case rtmessage.StateConnected:
+		h.transportUp = true
+		h.reportConnectedLocked()
+	case rtmessage.StateConnecting:
+		h.transportUp = false
+		h.states.Notify(StateReconnecting, nil)
+	default:
+		h.transportUp = false
+		h.states.Notify(StateDisconnected, err)
+	}
+}
+
+// restored reports the handle connected, once the transport is, now that its
+// state is restored.
+func (h *Handle) restored() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.restoreDone = true
+	h.reportConnectedLocked()
+}
+
+// reportConnectedLocked reports StateConnected once the transport reconnected
+// and, unless it doesn't have them, the state of the handle was restored,
+// whichever comes last.  Restoring may be done before the transport's change
+// is delivered.  The caller must hold h.m.
+func (h *Handle) reportConnectedLocked() {
+	if !h.transportUp || (h.stopRestore != nil && !h.restoreDone) {
+		return
+	}
+	h.transportUp, h.restoreDone = false, false
+	h.states.Notify(StateConnected, nil)
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+func TestConnectionListenersOrder(t *testing.T) {
+	srv, url := newServer(t)
+
+	h, err := rbus.New(rbus.WithURL(url), rbus.WithApplicationName("consumer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The listeners are slow, so the changes pile up while they're called.
+	// They're called in the order they were added.
+	var (
+		m     sync.Mutex
+		calls []string
+	)
+	changes := make(chan rbus.State, 100)
+	for _, name := range []string{"first", "second"} {
+		h.AddConnectionListener(func(s rbus.State, err error) {
+			time.Sleep(5 * time.Millisecond)
+			m.Lock()
+			calls = append(calls, fmt.Sprintf("%s %s %t", name, s, err != nil))
+			m.Unlock()
+			if name == "second" {
+				changes <- s
+			}
+		})
+	}
+	removed := h.AddConnectionListener(func(rbus.State, error) { t.Error("called after removal") })
+	removed()
+
+	waitState := func(want rbus.State) {
+		t.Helper()
+		select {
+		case s := <-changes:
+			if s != want {
+				t.Fatalf("got %s, want %s", s, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change to %s", want)
+		}
+	}
+
+	if err := h.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitState(rbus.StateConnected)
+
+	// Each time the router drops the handle, it goes through every state.
+	for range 3 {
+		srv.CloseClientConn()
+		waitState(rbus.StateDisconnected)
+		waitState(rbus.StateReconnecting)
+		waitState(rbus.StateConnected)
+	}
+
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitState(rbus.StateDisconnected)
+
+	m.Lock()
+	defer m.Unlock()
+	var want []string
+	add := func(s rbus.State, failed bool) {
+		for _, name := range []string{"first", "second"} {
+			want = append(want, fmt.Sprintf("%s %s %t", name, s, failed))
+		}
+	}
+	add(rbus.StateConnected, false)
+	for range 3 {
+		add(rbus.StateDisconnected, true)
+		add(rbus.StateReconnecting, false)
+		add(rbus.StateConnected, false)
+	}
+	add(rbus.StateDisconnected, false)
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("got\n%q\nwant\n%q", calls, want)
+	}
+}
+
+func TestConnectionListenerRestored(t *testing.T) {
+	srv, url := newServer(t)
+	h := openHandle(t, url, "component")
+
+	// The handle subscribes to an element of its own, whose route is back
+	// as soon as the handle reconnects.  The element is registered again
+	// once the subscription is made, forgetting its subscriber, so that
+	// it's made again after reconnecting, which is held until released.
+	var hold atomic.Bool
+	held := make(chan struct{}, 1)
+	release := make(chan struct{}, 1)
+	t.Cleanup(func() { close(release) })
+	cb := rbus.ElementCallbacks{
+		GetHandler: getter(map[string]rbus.Value{"Device.Test.Event!": rbus.NewValue(int32(0))}),
+		SubscribeHandler: func(_ string, added bool, _ int, _ *rbus.Filter, _ time.Duration) error {
+			if added && hold.Load() {
+				held <- struct{}{}
+				<-release
+			}
+			return nil
+		},
+	}
+	if err := h.RegisterElement("Device.Test.Event!", cb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Subscribe(context.Background(), "Device.Test.Event!", func(rbus.Event) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.UnregisterElement("Device.Test.Event!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.RegisterElement("Device.Test.Event!", cb); err != nil {
+		t.Fatal(err)
+	}
+	hold.Store(true)
+
+	changes := make(chan rbus.State, 10)
+	h.AddConnectionListener(func(s rbus.State, _ error) { changes <- s })
+
+	waitState := func(want rbus.State) {
+		t.Helper()
+		select {
+		case s := <-changes:
+			if s != want {
+				t.Fatalf("got %s, want %s", s, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change to %s", want)
+		}
+	}
+
+	srv.CloseClientConn()
+	waitFor(t, held, "the subscription to be made again")
+	waitState(rbus.StateDisconnected)
+	waitState(rbus.StateReconnecting)
+
+	// The transport is connected again, but the handle isn't until the
+	// subscription is restored.
+	select {
+	case s := <-changes:
+		t.Fatalf("got %s while restoring", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	waitState(rbus.StateConnected)
+}
@@ -0,0 +1,543 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+const (
+	methodSubscribe   = "METHOD_SUBSCRIBE"
+	methodUnsubscribe = "METHOD_UNSUBSCRIBE"
+)
+
+// unsubscribeTimeout bounds the wait for a provider to acknowledge an
+// unsubscribe, so a provider that is gone doesn't hold up Close.
+const unsubscribeTimeout = 5 * time.Second
+
+// unsubscribeGrace is the least Close waits for the providers to acknowledge
+// the unsubscribes, even once its context is done.
+const unsubscribeGrace = 500 * time.Millisecond
+
+// EventHandler is called with each event delivered to a subscription.
+type EventHandler func(Event)
+
+// SubOption is an option of a subscription.
+type SubOption interface {
+	apply(*subConfig) error
+}
+
+type subOptionFunc func(*subConfig) error
+
+func (f subOptionFunc) apply(cfg *subConfig) error {
+	return f(cfg)
+}
+
+// subConfig holds the options of a subscription.  The interval and duration
+// are in seconds, as the provider expects them.
+type subConfig struct {
+	interval   int32
+	duration   int32
+	filter     *filter
+	onComplete func()
+	initial    bool
+
+	// onResubscribed and onLost are called once the subscription was made
+	// again after reconnecting, or given up on.
+	onResubscribed func()
+	onLost         func(error)
+
+	// onClose is called once the handle ended the subscription.
+	onClose func()
+}
+
+// SubWithInterval asks the provider to publish the value every interval
+// instead of on each change, which spares the subscriber a storm of events
+// for a fast changing value.  The interval must be a whole number of seconds.
+func SubWithInterval(interval time.Duration) SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		secs, err := seconds("interval", interval)
+		if err != nil {
+			return err
+		}
+		cfg.interval = secs
+		return nil
+	})
+}
+
+// SubWithDuration asks the provider to end the subscription after the
+// duration, which must be a whole number of seconds.  The provider then
+// publishes an EventDurationComplete event, after which the subscription is
+// over; see SubOnDurationComplete.
+func SubWithDuration(duration time.Duration) SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		secs, err := seconds("duration", duration)
+		if err != nil {
+			return err
+		}
+		cfg.duration = secs
+		return nil
+	})
+}
+
+// SubWithFilter asks the provider to publish only the values that stand in
+// the relation op to the value, for example only when the value goes above a
+// threshold with FilterGreaterThan.  A provider that doesn't support the
+// filter fails the subscribe.
+func SubWithFilter(op FilterOp, value Value) SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		if op < FilterGreaterThan || op > FilterNotEqual {
+			return fmt.Errorf("invalid filter operator: %d", op)
+		}
+		cfg.filter = &filter{kind: filterRelation, op: int32(op), value: value}
+		return nil
+	})
+}
+
+// SubOnDurationComplete sets a function called once the duration set with
+// SubWithDuration is over and the provider stopped publishing, after the
+// handler was called with the EventDurationComplete event.
+func SubOnDurationComplete(fn func()) SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		cfg.onComplete = fn
+		return nil
+	})
+}
+
+// SubWithInitialValue asks the provider to publish the current value of the
+// element as the subscription is made, like publishOnSubscribe does, sparing
+// a separate Get.  The handler is called with it, as an EventInitialValue
+// event carrying it as "initialValue", like the C library names it, and as
+// NewValue, before Subscribe returns, and again each time the subscription is
+// made again after reconnecting, since the value may have changed meanwhile.  When the provider ignores the option, the value is
+// got from it instead, and when that fails so does Subscribe.
+//
+// A change published while the subscription is being made may reach the
+// handler before the initial value.
+func SubWithInitialValue() SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		cfg.initial = true
+		return nil
+	})
+}
+
+// SubOnResubscribed sets a function called each time the subscription was
+// made again after the handle reconnected to the router, the provider having
+// assigned it a new id; see ID.
+func SubOnResubscribed(fn func()) SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		cfg.onResubscribed = fn
+		return nil
+	})
+}
+
+// SubOnLost sets a function called when the subscription can't be made again
+// after the handle reconnected to the router, because the provider refused it
+// or was still gone once the period set with WithResubscribePeriod was over.
+// The subscription is then over, and the function is called with the reason.
+func SubOnLost(fn func(error)) SubOption {
+	return subOptionFunc(func(cfg *subConfig) error {
+		cfg.onLost = fn
+		return nil
+	})
+}
+
+// seconds converts the duration to the whole seconds the provider expects.
+func seconds(what string, d time.Duration) (int32, error) {
+	if d < 0 || d%time.Second != 0 || d/time.Second > math.MaxInt32 {
+		return 0, fmt.Errorf("%s %s is not a whole number of seconds", what, d)
+	}
+	return int32(d / time.Second), nil
+}
+
+// Subscription is a subscription to an event.
+type Subscription struct {
+	h       *Handle
+	name    string
+	id      int32
+	handler EventHandler
+	cfg     subConfig
+}
+
+// Name returns the name of the event subscribed to.
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// ID returns the id the provider assigned to the subscription, or zero for a
+// provider that doesn't assign one.
+func (s *Subscription) ID() int32 {
+	s.h.m.Lock()
+	defer s.h.m.Unlock()
+
+	return s.id
+}
+
+// matches reports whether the subscription is to the named event with the
+// options.
+func (s *Subscription) matches(name string, interval, duration int32, f *filter) bool {
+	return s.name == name &&
+		s.cfg.interval == interval &&
+		s.cfg.duration == duration &&
+		s.cfg.filter.equal(f)
+}
+
+// Close ends the subscription: the handler is no longer called and the
+// provider is asked to stop publishing, waiting for its acknowledgement no
+// longer than a few seconds.  Closing a subscription that is already over,
+// including one whose duration completed, does nothing.
+func (s *Subscription) Close() error {
+	if !s.h.removeSubscription(s) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+	defer cancel()
+
+	if err := s.h.unsubscribe(ctx, s); err != nil {
+		return fmt.Errorf("unsubscribe '%s': %w", s.name, err)
+	}
+	s.h.cfg.logger.Debug("unsubscribed", "name", s.name)
+
+	return nil
+}
+
+// Subscribe subscribes to the named event, or to the changes of the named
+// element, calling the handler with each event the provider publishes.  The
+// handler is called from the handle's listener, so it should return quickly.
+//
+// The same event can be subscribed to more than once with different options,
+// such as two intervals; subscribing again with the same options fails with
+// ErrSubscriptionAlreadyExists, like the C library does.  When the provider
+// fails the subscribe, for example because it doesn't support the requested
+// filter, the error matches the ErrorCode it returned.
+//
+// When the connection to the router is lost, the subscription is made again
+// once the handle reconnected, with the same options; see SubOnResubscribed,
+// SubOnLost and WithResubscribePeriod.
+func (h *Handle) Subscribe(ctx context.Context, name string, handler EventHandler, opts ...SubOption) (*Subscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("subscribe '%s': nil handler", name)
+	}
+	if err := h.checkOpen(); err != nil {
+		return nil, fmt.Errorf("subscribe '%s': %w", name, err)
+	}
+
+	sub := Subscription{
+		h:       h,
+		name:    name,
+		handler: handler,
+	}
+	for _, opt := range opts {
+		if err := opt.apply(&sub.cfg); err != nil {
+			return nil, fmt.Errorf("subscribe '%s': %w", name, err)
+		}
+	}
+
+	req, err := h.subscriptionRequest(ctx, &sub, methodSubscribe)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe '%s': %w", name, err)
+	}
+
+	// The provider may publish before its response is handled, so the
+	// subscription has to be known by then.
+	h.m.Lock()
+	for _, s := range h.subs {
+		if s.matches(name, sub.cfg.interval, sub.cfg.duration, sub.cfg.filter) {
+			h.m.Unlock()
+			return nil, fmt.Errorf("subscribe '%s': %w", name, ErrSubscriptionAlreadyExists)
+		}
+	}
+	h.subs = append(h.subs, &sub)
+	h.m.Unlock()
+
+	id, initial, err := h.subscribe(ctx, &sub, req)
+	if err != nil {
+		h.removeSubscription(&sub)
+		return nil, fmt.Errorf("subscribe '%s': %w", name, err)
+	}
+
+	h.m.Lock()
+	sub.id = id
+	h.m.Unlock()
+	h.cfg.logger.DebugContext(ctx, "subscribed", "name", name, "id", id)
+
+	if err := h.initialValue(ctx, &sub, initial); err != nil {
+		_ = sub.Close()
+		return nil, fmt.Errorf("subscribe '%s': initial value: %w", name, err)
+	}
+
+	return &sub, nil
+}
+
+// subscribe sends the subscribe request of the subscription, returning the id
+// the provider assigned and the initial value event it sent along, if any.
+func (h *Handle) subscribe(ctx context.Context, s *Subscription, req *Message) (int32, *Event, error) {
+	resp, err := h.request(ctx, s.name, req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := checkReturnCode(rc); err != nil {
+		return 0, nil, err
+	}
+
+	// When it was asked for, the initial value event comes before the id,
+	// encoded like the payload of an event message and preceded by whether
+	// the provider could read the value, as rbusEvent_SubscribeWithRetries
+	// reads it.  Older providers don't send the id.
+	var initial *Event
+	if s.cfg.initial {
+		sent, err := resp.PopInt32()
+		if err != nil {
+			return 0, nil, nil
+		}
+		if sent != 0 {
+			data, err := popEventData(resp)
+			if err != nil {
+				h.cfg.logger.WarnContext(ctx, "malformed initial value", "name", s.name, "error", err)
+				return 0, nil, nil
+			}
+			initial = &data.event
+		}
+	}
+
+	id, err := resp.PopInt32()
+	if err != nil {
+		return 0, initial, nil
+	}
+
+	return id, initial, nil
+}
+
+// initialValue calls the handler of a subscription made with
+// SubWithInitialValue with the initial value event the provider sent, or else
+// with one made of the value got from the provider.
+func (h *Handle) initialValue(ctx context.Context, s *Subscription, e *Event) error {
+	if !s.cfg.initial {
+		return nil
+	}
+
+	if e == nil {
+		v, err := h.Get(ctx, s.name)
+		if err != nil {
+			return err
+		}
+		e = &Event{
+			Name: s.name,
+			Type: EventInitialValue,
+			Data: []Property{{Name: "initialValue", Value: v}},
+		}
+	}
+
+	if h.cfg.metrics != nil {
+		h.cfg.metrics.SubscriptionEventReceived(s.name)
+	}
+	e.decode()
+	s.handler(*e)
+
+	return nil
+}
+
+// unsubscribe asks the provider to stop publishing for the subscription.
+func (h *Handle) unsubscribe(ctx context.Context, s *Subscription) error {
+	req, err := h.subscriptionRequest(ctx, s, methodUnsubscribe)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.roundTrip(ctx, s.name, req)
+	if err != nil {
+		return err
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return err
+	}
+
+	return checkReturnCode(rc)
+}
+
+// closeSubscriptions ends all the subscriptions of the handle, asking their
+// providers to stop publishing in parallel until the context is done.  The
+// providers are not waited for beyond that; they drop the subscriptions of a
+// client that is gone anyway.
+func (h *Handle) closeSubscriptions(ctx context.Context) {
+	h.m.Lock()
+	subs := h.subs
+	h.subs = nil
+	h.m.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = h.unsubscribe(ctx, s)
+			if s.cfg.onClose != nil {
+				s.cfg.onClose()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// subscriptionRequest builds the subscribe or unsubscribe request of the
+// subscription the way rbus_subscribeToEventTimeout does.  The options travel
+// in a nested message, which the provider repeats in the events it publishes.
+func (h *Handle) subscriptionRequest(ctx context.Context, s *Subscription, method string) (*Message, error) {
+	payload := h.newMessage()
+	payload.AppendInt32(h.componentID)
+	payload.AppendInt32(s.cfg.interval)
+	payload.AppendInt32(s.cfg.duration)
+	if s.cfg.filter == nil {
+		payload.AppendInt32(0)
+	} else {
+		payload.AppendInt32(1)
+		if err := s.cfg.filter.append(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	req := h.newMessage()
+	req.AppendString(s.name)
+	req.AppendString(h.Inbox())
+	req.AppendInt32(1) // has payload
+	req.AppendBytes(payload.Bytes())
+	if s.cfg.initial {
+		req.AppendInt32(1) // publish on subscribe
+	} else {
+		req.AppendInt32(0)
+	}
+	req.AppendInt32(0) // raw data
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(method, parent, state)
+
+	return req, nil
+}
+
+// hasSubscription reports whether the subscription is known.
+func (h *Handle) hasSubscription(s *Subscription) bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return slices.Contains(h.subs, s)
+}
+
+// removeSubscription forgets the subscription, reporting whether it was
+// known.
+func (h *Handle) removeSubscription(s *Subscription) bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for i, sub := range h.subs {
+		if sub == s {
+			h.subs = append(h.subs[:i], h.subs[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// onEvent delivers an event sent to the inbox to the subscription it was
+// published for.  An event is matched to its subscription by the options it
+// carries, like _master_event_callback_handler does, since the same event can
+// be subscribed to with different options.
+func (h *Handle) onEvent(msg rtmessage.Message) {
+	if msg.Type() != rtmessage.MsgTypeMessage {
+		return
+	}
+
+	m := NewMessageFromBytes(msg.Payload)
+	m.SetValueWireFormat(h.cfg.wireFormat)
+
+	name, err := eventName(m)
+	if err != nil {
+		h.cfg.logger.Warn("malformed event", "topic", msg.Header.Topic, "error", err)
+		return
+	}
+
+	data, err := popEventData(m)
+	if err != nil {
+		h.cfg.logger.Warn("malformed event", "name", name, "error", err)
+		return
+	}
+	if data.componentID != h.componentID {
+		return
+	}
+
+	h.m.Lock()
+	var sub *Subscription
+	for _, s := range h.subs {
+		if s.matches(name, data.interval, data.duration, data.filter) {
+			sub = s
+			break
+		}
+	}
+	h.m.Unlock()
+
+	if sub == nil {
+		return
+	}
+
+	complete := data.event.Type == EventDurationComplete
+	if complete && !h.removeSubscription(sub) {
+		// Another copy of the event already completed it.
+		return
+	}
+	if complete {
+		h.cfg.logger.Debug("subscription complete", "name", name)
+	}
+	if h.cfg.metrics != nil {
+		h.cfg.metrics.SubscriptionEventReceived(name)
+	}
+
+	data.event.decode()
+	sub.handler(data.event)
+
+	if complete && sub.cfg.onComplete != nil {
+		sub.cfg.onComplete()
+	}
+}
+
+// eventName reads the name of the event subscribed to from the meta section
+// of an event message, as written by rbus_publishSubscriberEvent.
+func eventName(m *Message) (string, error) {
+	meta, err := m.metaSection()
+	if err != nil {
+		return "", err
+	}
+
+	name, err := meta.PopString()
+	if err != nil {
+		return "", err
+	}
+	if _, err := meta.PopString(); err != nil { // object name
+		return "", err
+	}
+
+	rbus2, err := meta.PopInt32()
+	if err != nil {
+		return "", err
+	}
+	if rbus2 == 0 {
+		return "", errors.New("not an rbus event")
+	}
+
+	return name, nil
+}
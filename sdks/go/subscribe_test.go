@@ -0,0 +1,399 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// logs is where the tests' loggers write, for them to look at.
+type logs struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *logs) Write(p []byte) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *logs) String() string {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.buf.String()
+}
+
+// logger returns a logger of the warnings and errors written to the logs.
+func (l *logs) logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(l, &slog.HandlerOptions{Level: slog.LevelWarn}))
+}
+
+// initial returns the handler of a subscription with SubWithInitialValue,
+// checking it's first called with the initial value v.
+func initial(t *testing.T, v int32) (rbus.EventHandler, func()) {
+	events := make(chan rbus.Event, 10)
+	check := func() {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != rbus.EventInitialValue || e.NewValue.String() != fmt.Sprint(v) {
+				t.Fatalf("got %+v, want the initial value %d", e, v)
+			}
+		default:
+			t.Fatal("no initial value")
+		}
+	}
+	return func(e rbus.Event) { events <- e }, check
+}
+
+func TestCloseUnacknowledgedUnsubscribe(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	// The provider takes the subscribe, but never answers the unsubscribe.
+	unsubscribing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	err := provider.RegisterElement("Device.Test.Event!", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(int32(0)), nil },
+		SubscribeHandler: func(_ string, added bool, _ int, _ *rbus.Filter, _ time.Duration) error {
+			if !added {
+				unsubscribing <- struct{}{}
+				<-release
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan rbus.Event, 1)
+	_, err = consumer.Subscribe(context.Background(), "Device.Test.Event!", func(e rbus.Event) { events <- e })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := consumer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Fatalf("took %s to close", took)
+	}
+
+	// The unsubscribe was sent, and the handler is gone.
+	select {
+	case <-unsubscribing:
+	default:
+		t.Fatal("no unsubscribe was sent")
+	}
+	if err := provider.Publish(context.Background(), rbus.Event{Name: "Device.Test.Event!", Type: rbus.EventGeneral}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("got %+v after closing", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCloseUnsubscribesPastDeadline(t *testing.T) {
+	b := newBroker(t, map[string]rbus.Value{
+		"Device.Test.X":    rbus.NewValue(int32(5)),
+		"Device.Test.Slow": rbus.NewValue(int32(6)),
+	})
+	b.SetLatency("Device.Test.Slow", 200*time.Millisecond)
+	consumer := openHandle(t, b.URL(), "consumer")
+
+	if _, err := consumer.Subscribe(context.Background(), "Device.Test.X", func(rbus.Event) {}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Subscribed("Device.Test.X"); got != 1 {
+		t.Fatalf("got %d subscriptions, want 1", got)
+	}
+
+	// The get in flight outlasts the deadline of the close.
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		_, _ = consumer.Get(context.Background(), "Device.Test.Slow")
+	}()
+	<-started
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := consumer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("closed before the deadline")
+	}
+
+	if got := b.Subscribed("Device.Test.X"); got != 0 {
+		t.Fatalf("got %d subscriptions, want 0", got)
+	}
+}
+
+func TestSubscriptionCloseTwice(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	var unsubscribes atomic.Int32
+	err := provider.RegisterElement("Device.Test.Event!", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(int32(0)), nil },
+		SubscribeHandler: func(_ string, added bool, _ int, _ *rbus.Filter, _ time.Duration) error {
+			if !added {
+				unsubscribes.Add(1)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := consumer.Subscribe(context.Background(), "Device.Test.Event!", func(rbus.Event) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := sub.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := unsubscribes.Load(); got != 1 {
+		t.Fatalf("got %d unsubscribes, want 1", got)
+	}
+}
+
+func TestSubscribeInitialValue(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	var l logs
+	consumer := openHandle(t, url, "consumer", rbus.WithLogger(l.logger()))
+
+	var gets atomic.Int32
+	err := provider.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) {
+			gets.Add(1)
+			return rbus.NewValue(int32(5)), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider sends the value along with its response, so it's got
+	// once.
+	handler, check := initial(t, 5)
+	if _, err := consumer.Subscribe(context.Background(), "Device.Test.X", handler, rbus.SubWithInitialValue()); err != nil {
+		t.Fatal(err)
+	}
+	check()
+	if n := gets.Load(); n != 1 {
+		t.Fatalf("got %d gets, want 1", n)
+	}
+
+	// Without the option there's nothing after the subscription id.
+	if _, err := consumer.Subscribe(context.Background(), "Device.Test.X", func(rbus.Event) {}, rbus.SubWithFilter(rbus.FilterGreaterThan, rbus.NewValue(int32(0)))); err != nil {
+		t.Fatal(err)
+	}
+	if n := gets.Load(); n != 1 {
+		t.Fatalf("got %d gets, want 1", n)
+	}
+	if got := l.String(); got != "" {
+		t.Fatalf("got logs %q, want none", got)
+	}
+}
+
+func TestSubscribeInitialValueIgnored(t *testing.T) {
+	r, url := newRouter(t)
+	var l logs
+	consumer := openHandle(t, url, "consumer", rbus.WithLogger(l.logger()))
+
+	// The provider can't send the value along, like a C provider of an
+	// element without a get handler, and tells so before the id.
+	con, err := rtmessage.New(url, "provider")
+	if err == nil {
+		err = con.Connect(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = con.Close() })
+
+	methods := make(chan string, 10)
+	_, err = con.Serve("Device.Test.X", func(_ context.Context, msg rtmessage.Message) ([]byte, error) {
+		method, _, _, err := rbus.NewMessageFromBytes(msg.Payload).GetMetaInfo()
+		if err != nil {
+			return nil, err
+		}
+		methods <- method
+
+		resp := rbus.NewMessage()
+		resp.AppendInt32(0)
+		switch method {
+		case "METHOD_SUBSCRIBE":
+			resp.AppendInt32(0)
+			resp.AppendInt32(1)
+		case "METHOD_GETPARAMETERVALUES":
+			resp.AppendInt32(1)
+			resp.AppendString("Device.Test.X")
+			if err := resp.AppendValue(rbus.NewValue(int32(5))); err != nil {
+				return nil, err
+			}
+		}
+		resp.SetMetaInfo("METHOD_RESPONSE", "", "")
+
+		return resp.Bytes(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(r.Subscriptions(), "Device.Test.X") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The value is got from the provider instead.
+	handler, check := initial(t, 5)
+	if _, err := consumer.Subscribe(context.Background(), "Device.Test.X", handler, rbus.SubWithInitialValue()); err != nil {
+		t.Fatal(err)
+	}
+	check()
+	for _, want := range []string{"METHOD_SUBSCRIBE", "METHOD_GETPARAMETERVALUES"} {
+		if got := <-methods; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+	if got := l.String(); got != "" {
+		t.Fatalf("got logs %q, want none", got)
+	}
+}
+
+// TestSubscribeOptions checks that the options of a subscription are sent the
+// way send_subscription_request and rbusEvent_CreateSubscribePayload send
+// them: the name, the inbox, a nested message with the component id, the
+// interval and the duration in seconds and the filter, then whether to
+// publish on subscribe and whether the data is raw.
+func TestSubscribeOptions(t *testing.T) {
+	r, url := newRouter(t)
+	consumer := openHandle(t, url, "consumer")
+
+	con, err := rtmessage.New(url, "provider")
+	if err == nil {
+		err = con.Connect(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = con.Close() })
+
+	reqs := make(chan []byte, 10)
+	_, err = con.Serve("Device.Test.X", func(_ context.Context, msg rtmessage.Message) ([]byte, error) {
+		reqs <- msg.Payload
+		resp := rbus.NewMessage()
+		resp.AppendInt32(0)
+		resp.AppendInt32(1)
+		resp.SetMetaInfo("METHOD_RESPONSE", "", "")
+		return resp.Bytes(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(r.Subscriptions(), "Device.Test.X") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	sub, err := consumer.Subscribe(context.Background(), "Device.Test.X", func(rbus.Event) {},
+		rbus.SubWithInterval(30*time.Second),
+		rbus.SubWithDuration(10*time.Second),
+		rbus.SubWithFilter(rbus.FilterGreaterThan, rbus.NewValue(int32(5))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// fields reads the strings, 32-bit integers and values of the message,
+	// an s, an i or a v each.
+	fields := func(m *rbus.Message, kinds string) string {
+		t.Helper()
+		var got []string
+		for _, kind := range kinds {
+			var (
+				v   any
+				err error
+			)
+			switch kind {
+			case 's':
+				v, err = m.PopString()
+			case 'i':
+				v, err = m.PopInt32()
+			case 'v':
+				var val rbus.Value
+				if val, err = m.PopValue(); err == nil {
+					v = fmt.Sprintf("%s(%s)", val.Type(), val)
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprint(v))
+		}
+		return fmt.Sprint(got)
+	}
+
+	// The unsubscribe repeats the options, for the provider to tell the
+	// subscription from others to the same event.
+	for _, method := range []string{"METHOD_SUBSCRIBE", "METHOD_UNSUBSCRIBE"} {
+		req := rbus.NewMessageFromBytes(<-reqs)
+		if got, _, _, err := req.GetMetaInfo(); err != nil || got != method {
+			t.Fatalf("got %s and %v, want %s", got, err, method)
+		}
+
+		want := fmt.Sprint([]string{"Device.Test.X", consumer.Inbox(), "1"})
+		if got := fields(req, "ssi"); got != want {
+			t.Fatalf("%s: got %s, want %s", method, got, want)
+		}
+		payload, err := req.PopBytes()
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if got, want := fields(req, "ii"), "[0 0]"; got != want {
+			t.Fatalf("%s: got %s, want %s", method, got, want)
+		}
+
+		// The component id is the handle's own, so it's skipped.
+		m := rbus.NewMessageFromBytes(payload)
+		if _, err := m.PopInt32(); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		want = fmt.Sprint([]string{"30", "10", "1", "0", "0", "filter", "int32(5)"})
+		if got := fields(m, "iiiiisv"); got != want {
+			t.Fatalf("%s: got %s, want %s", method, got, want)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	methodAddTableRow    = "METHOD_ADDTBLROW"
+	methodDeleteTableRow = "METHOD_DELETETBLROW"
+)
+
+// RowInfo describes a row of a table.
+type RowInfo struct {
+	// Name is the full name of the row, such as "Device.NAT.PortMapping.3.".
+	Name string
+
+	// Instance is the instance number of the row, 3 in the example above.
+	Instance uint32
+
+	// Alias is the alias of the row, or empty when it has none.
+	Alias string
+}
+
+// TableCallbacks are the handlers of a table registered by a provider.  Either
+// can be nil, in which case consumers can't add or remove rows.  They are
+// called on a goroutine of their own for each request, so they must be safe
+// for concurrent use.  An error wrapping an ErrorCode is reported to the
+// consumer as that code, any other error as ErrBus.
+type TableCallbacks struct {
+	// AddRow creates a row.  The handle assigns the instance number; when
+	// AddRow fails the row isn't added.
+	AddRow func(row RowInfo) error
+
+	// RemoveRow deletes a row.  When it fails the row is kept.
+	RemoveRow func(row RowInfo) error
+}
+
+// table is the bookkeeping of a registered table.
+type table struct {
+	maxRows   int
+	callbacks TableCallbacks
+	last      uint32
+	pending   int
+	rows      []RowInfo
+}
+
+// row returns the index of the row with the instance, which is either the
+// instance number or the alias in brackets, as in "[wan]".
+func (t *table) row(instance string) int {
+	if alias, ok := strings.CutPrefix(instance, "["); ok {
+		alias = strings.TrimSuffix(alias, "]")
+		return slices.IndexFunc(t.rows, func(r RowInfo) bool {
+			return r.Alias != "" && r.Alias == alias
+		})
+	}
+
+	n, err := strconv.ParseUint(instance, 10, 32)
+	if err != nil {
+		return -1
+	}
+
+	return slices.IndexFunc(t.rows, func(r RowInfo) bool {
+		return r.Instance == uint32(n)
+	})
+}
+
+// RegisterTable registers the named table, such as "Device.NAT.PortMapping.",
+// so consumers can add and remove its rows.  Up to maxRows rows can exist at
+// once, or any number when maxRows is zero.  The handle numbers the rows, never
+// reusing the number of a removed row.
+//
+// The elements of the rows are registered with RegisterElement using "{i}" for
+// the instance, as in "Device.NAT.PortMapping.{i}.Enable"; their callbacks
+// are called with the name of the row's element, such as
+// "Device.NAT.PortMapping.3.Enable".  Tables within rows are not supported.
+func (h *Handle) RegisterTable(name string, maxRows int, callbacks TableCallbacks) error {
+	if !strings.HasSuffix(name, ".") || strings.Count(name, ".") < 2 || strings.Contains(name, "{") {
+		return fmt.Errorf("register table '%s': %w: not the name of a table", name, ErrInvalidInput)
+	}
+	if maxRows < 0 {
+		return fmt.Errorf("register table '%s': %w: negative row limit", name, ErrInvalidInput)
+	}
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("register table '%s': %w", name, err)
+	}
+
+	h.reg.Lock()
+	defer h.reg.Unlock()
+
+	h.m.Lock()
+	_, found := h.tables[name]
+	h.m.Unlock()
+	if found {
+		return fmt.Errorf("register table '%s': %w", name, ErrElementNameDuplicate)
+	}
+
+	if err := h.serveComponent(); err != nil {
+		return fmt.Errorf("register table '%s': %w", name, err)
+	}
+
+	h.m.Lock()
+	if h.tables == nil {
+		h.tables = make(map[string]*table)
+	}
+	h.tables[name] = &table{maxRows: maxRows, callbacks: callbacks}
+	h.m.Unlock()
+
+	// Like the C library, the table is routed by its row pattern.
+	if err := h.addAlias(name + "{i}"); err != nil {
+		h.m.Lock()
+		delete(h.tables, name)
+		h.m.Unlock()
+		return fmt.Errorf("register table '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// TableRows returns the rows of the named table registered with
+// RegisterTable, ordered by instance number.
+func (h *Handle) TableRows(name string) ([]RowInfo, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	t, found := h.tables[name]
+	if !found {
+		return nil, fmt.Errorf("table '%s': %w", name, ErrElementDoesNotExist)
+	}
+
+	return slices.Clone(t.rows), nil
+}
+
+// rowOf finds the table row the name is under, returning the table name and
+// the row, along with the rest of the name.  It's called with h.m held.
+func (h *Handle) rowOf(name string) (string, *table, RowInfo, string, bool) {
+	for tableName, t := range h.tables {
+		rest, ok := strings.CutPrefix(name, tableName)
+		if !ok {
+			continue
+		}
+
+		instance, after, _ := strings.Cut(rest, ".")
+		if i := t.row(instance); i >= 0 {
+			return tableName, t, t.rows[i], after, true
+		}
+	}
+
+	return "", nil, RowInfo{}, "", false
+}
+
+// rowTemplate returns the name under which the element of a table row is
+// registered, with "{i}" for the instance, or "" for a name not in a row.
+// It's called with h.m held.
+func (h *Handle) rowTemplate(name string) string {
+	tableName, _, _, rest, found := h.rowOf(name)
+	if !found || rest == "" {
+		return ""
+	}
+
+	return tableName + "{i}." + rest
+}
+
+// serveAddRow answers a request to add a row, the way
+// _table_add_row_callback_handler does: the return code is followed by the
+// instance number of the new row.
+func (h *Handle) serveAddRow(req *Message) *Message {
+	row, rc := h.addRow(req)
+
+	resp := h.newMessage()
+	resp.AppendInt32(rc)
+	resp.AppendInt32(int32(row.Instance))
+
+	return resp
+}
+
+func (h *Handle) addRow(req *Message) (RowInfo, int32) {
+	if _, err := req.PopInt32(); err != nil { // session id
+		return RowInfo{}, int32(ErrInvalidInput)
+	}
+
+	name, err := req.PopString()
+	if err != nil {
+		return RowInfo{}, int32(ErrInvalidInput)
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	// Consumers other than rbus don't send an alias.
+	alias, _ := req.PopString()
+
+	h.m.Lock()
+	t, found := h.tables[name]
+	switch {
+	case !found:
+		h.m.Unlock()
+		return RowInfo{}, int32(ErrElementDoesNotExist)
+	case t.callbacks.AddRow == nil:
+		h.m.Unlock()
+		return RowInfo{}, int32(ErrInvalidOperation)
+	case t.maxRows > 0 && len(t.rows)+t.pending >= t.maxRows:
+		h.m.Unlock()
+		return RowInfo{}, int32(ErrOutOfResources)
+	case alias != "" && t.row("["+alias+"]") >= 0:
+		h.m.Unlock()
+		return RowInfo{}, int32(ErrElementNameDuplicate)
+	}
+	t.last++
+	t.pending++
+	row := RowInfo{
+		Name:     name + strconv.FormatUint(uint64(t.last), 10) + ".",
+		Instance: t.last,
+		Alias:    alias,
+	}
+	h.m.Unlock()
+
+	err = t.callbacks.AddRow(row)
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	t.pending--
+	if err != nil {
+		// Unless another row was added meanwhile, the number is free again.
+		if t.last == row.Instance {
+			t.last--
+		}
+		return RowInfo{}, returnCode(err)
+	}
+	t.rows = append(t.rows, row)
+
+	return row, 0
+}
+
+// serveRemoveRow answers a request to remove a row, the way
+// _table_remove_row_callback_handler does.
+func (h *Handle) serveRemoveRow(req *Message) *Message {
+	resp := h.newMessage()
+	resp.AppendInt32(h.removeRow(req))
+
+	return resp
+}
+
+func (h *Handle) removeRow(req *Message) int32 {
+	if _, err := req.PopInt32(); err != nil { // session id
+		return int32(ErrInvalidInput)
+	}
+
+	name, err := req.PopString()
+	if err != nil {
+		return int32(ErrInvalidInput)
+	}
+
+	h.m.Lock()
+	_, t, row, rest, found := h.rowOf(name)
+	h.m.Unlock()
+
+	switch {
+	case !found || rest != "":
+		return int32(ErrElementDoesNotExist)
+	case t.callbacks.RemoveRow == nil:
+		return int32(ErrInvalidOperation)
+	}
+
+	if err := t.callbacks.RemoveRow(row); err != nil {
+		return returnCode(err)
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	t.rows = slices.DeleteFunc(t.rows, func(r RowInfo) bool {
+		return r.Instance == row.Instance
+	})
+
+	return 0
+}
+
+// AddTableRow asks the provider of the named table, such as
+// "Device.NAT.PortMapping.", to add a row, returning the instance number it
+// assigned.  The alias names the row, as in "Device.NAT.PortMapping.[wan].";
+// it can be empty.  The response carries only the instance number, so an
+// alias the provider assigns itself has to be read from the row.
+func (h *Handle) AddTableRow(ctx context.Context, tableName, alias string) (uint32, error) {
+	if !strings.HasSuffix(tableName, ".") {
+		return 0, fmt.Errorf("add row to '%s': %w: not the name of a table", tableName, ErrInvalidInput)
+	}
+
+	h.m.Lock()
+	session := h.session
+	h.m.Unlock()
+
+	req := h.newMessage()
+	req.AppendInt32(int32(session))
+	req.AppendString(tableName)
+	req.AppendString(alias)
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodAddTableRow, parent, state)
+
+	var instance int32
+	err := h.retry(ctx, false, func() error {
+		resp, err := h.request(ctx, tableName, req)
+		if err != nil {
+			return err
+		}
+
+		rc, err := resp.PopInt32()
+		if err != nil {
+			return err
+		}
+		if err := checkReturnCode(rc); err != nil {
+			return err
+		}
+
+		instance, err = resp.PopInt32()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("add row to '%s': %w", tableName, err)
+	}
+
+	return uint32(instance), nil
+}
+
+// RemoveTableRow asks the provider of the named row, such as
+// "Device.NAT.PortMapping.3." or "Device.NAT.PortMapping.[wan].", to remove
+// it.
+func (h *Handle) RemoveTableRow(ctx context.Context, rowName string) error {
+	h.m.Lock()
+	session := h.session
+	h.m.Unlock()
+
+	req := h.newMessage()
+	req.AppendInt32(int32(session))
+	req.AppendString(rowName)
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodDeleteTableRow, parent, state)
+
+	resp, err := h.request(ctx, rowName, req)
+	if err != nil {
+		return fmt.Errorf("remove row '%s': %w", rowName, err)
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return fmt.Errorf("remove row '%s': %w", rowName, err)
+	}
+	if err := checkReturnCode(rc); err != nil {
+		return fmt.Errorf("remove row '%s': %w", rowName, err)
+	}
+
+	return nil
+}
+
+// RowsOption is an option of GetRowNames.
+type RowsOption interface {
+	apply(*rowsConfig)
+}
+
+type rowsOptionFunc func(*rowsConfig)
+
+func (f rowsOptionFunc) apply(cfg *rowsConfig) {
+	f(cfg)
+}
+
+type rowsConfig struct {
+	recursive bool
+}
+
+// RowsRecursive makes GetRowNames return the rows of the tables within the
+// rows as well, each row followed by those under it.
+func RowsRecursive() RowsOption {
+	return rowsOptionFunc(func(cfg *rowsConfig) {
+		cfg.recursive = true
+	})
+}
+
+// GetRowNames returns the rows of the named table, such as
+// "Device.NAT.PortMapping.", in the order the provider lists them.  Only the
+// rows of the table itself are returned unless RowsRecursive is given.
+func (h *Handle) GetRowNames(ctx context.Context, tableName string, opts ...RowsOption) ([]RowInfo, error) {
+	if !strings.HasSuffix(tableName, ".") {
+		return nil, fmt.Errorf("rows of '%s': %w: not the name of a table", tableName, ErrInvalidInput)
+	}
+
+	var cfg rowsConfig
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+
+	rows, err := h.getRowNames(ctx, tableName, cfg.recursive)
+	if err != nil {
+		return nil, fmt.Errorf("rows of '%s': %w", tableName, err)
+	}
+
+	return rows, nil
+}
+
+func (h *Handle) getRowNames(ctx context.Context, tableName string, recursive bool) ([]RowInfo, error) {
+	req := h.newMessage()
+	req.AppendString(tableName)
+	req.AppendInt32(-1) // the next level
+	req.AppendInt32(1)  // row names only
+	parent, state := h.traceInfo(ctx)
+	req.SetMetaInfo(methodGetParameterNames, parent, state)
+
+	resp, err := h.request(ctx, tableName, req)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := resp.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReturnCode(rc); err != nil {
+		return nil, err
+	}
+
+	count, err := resp.PopInt32()
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("%w: negative row count %d", ErrMalformedMessage, count)
+	}
+
+	rows := make([]RowInfo, 0, min(int(count), resp.remaining()/2))
+	for range count {
+		instance, err := resp.PopInt32()
+		if err != nil {
+			return nil, err
+		}
+		alias, err := resp.PopString()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, RowInfo{
+			Name:     tableName + strconv.FormatUint(uint64(uint32(instance)), 10) + ".",
+			Instance: uint32(instance),
+			Alias:    alias,
+		})
+	}
+
+	if !recursive {
+		return rows, nil
+	}
+
+	var all []RowInfo
+	for _, row := range rows {
+		all = append(all, row)
+
+		names, err := h.getNames(ctx, row.Name, row.Name, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			if n.Type != ElementTypeTable {
+				continue
+			}
+
+			sub, err := h.getRowNames(ctx, n.Name, true)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, sub...)
+		}
+	}
+
+	return all, nil
+}
@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// rows records the rows handed to the TableCallbacks it's used for, refusing
+// to add those with the aliases in reject and to remove those in keep.
+type rows struct {
+	m       sync.Mutex
+	added   []rbus.RowInfo
+	removed []rbus.RowInfo
+	reject  map[string]rbus.ErrorCode
+	keep    map[string]rbus.ErrorCode
+}
+
+func (r *rows) add(row rbus.RowInfo) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if code, found := r.reject[row.Alias]; found {
+		return code
+	}
+	r.added = append(r.added, row)
+	return nil
+}
+
+func (r *rows) remove(row rbus.RowInfo) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if code, found := r.keep[row.Alias]; found {
+		return code
+	}
+	r.removed = append(r.removed, row)
+	return nil
+}
+
+func (r *rows) callbacks() rbus.TableCallbacks {
+	return rbus.TableCallbacks{AddRow: r.add, RemoveRow: r.remove}
+}
+
+// instances returns the instance numbers of the rows of the table.
+func instances(t *testing.T, h *rbus.Handle, name string) string {
+	t.Helper()
+
+	rows, err := h.TableRows(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []uint32
+	for _, row := range rows {
+		got = append(got, row.Instance)
+	}
+	return fmt.Sprint(got)
+}
+
+func TestRegisterTableInvalid(t *testing.T) {
+	_, url := newRouter(t)
+	h := openHandle(t, url, "provider")
+
+	for _, name := range []string{"Device.Test.Table", "Device.", "Device.Test.{i}."} {
+		if err := h.RegisterTable(name, 0, rbus.TableCallbacks{}); !errors.Is(err, rbus.ErrInvalidInput) {
+			t.Fatalf("%s: got %v, want %v", name, err, rbus.ErrInvalidInput)
+		}
+	}
+	if err := h.RegisterTable("Device.Test.Table.", -1, rbus.TableCallbacks{}); !errors.Is(err, rbus.ErrInvalidInput) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrInvalidInput)
+	}
+
+	if err := h.RegisterTable("Device.Test.Table.", 0, rbus.TableCallbacks{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.RegisterTable("Device.Test.Table.", 0, rbus.TableCallbacks{}); !errors.Is(err, rbus.ErrElementNameDuplicate) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrElementNameDuplicate)
+	}
+
+	if _, err := h.TableRows("Device.Nope."); !errors.Is(err, rbus.ErrElementDoesNotExist) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrElementDoesNotExist)
+	}
+}
+
+func TestTableRowLifecycle(t *testing.T) {
+	// The rows are routed by the "{i}" of the table over a real socket.
+	_, url := newServer(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	var r rows
+	if err := provider.RegisterTable("Device.Test.Table.", 2, r.callbacks()); err != nil {
+		t.Fatal(err)
+	}
+	err := provider.RegisterElement("Device.Test.Table.{i}.Name", rbus.ElementCallbacks{
+		GetHandler: func(_ context.Context, name string) (rbus.Value, error) { return rbus.NewValue(name), nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i, alias := range []string{"wan", ""} {
+		instance, err := consumer.AddTableRow(ctx, "Device.Test.Table.", alias)
+		if err != nil || instance != uint32(i+1) {
+			t.Fatalf("got row %d and %v, want row %d", instance, err, i+1)
+		}
+	}
+	if got := instances(t, provider, "Device.Test.Table."); got != "[1 2]" {
+		t.Fatalf("got rows %s, want [1 2]", got)
+	}
+
+	// The table is full.
+	if _, err := consumer.AddTableRow(ctx, "Device.Test.Table.", ""); !errors.Is(err, rbus.ErrOutOfResources) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrOutOfResources)
+	}
+
+	// The elements of a row are had by its number or its alias.
+	for _, name := range []string{"Device.Test.Table.1.Name", "Device.Test.Table.[wan].Name"} {
+		if v, err := consumer.Get(ctx, name); err != nil || v.String() != name {
+			t.Fatalf("got %v and %v, want %s", v, err, name)
+		}
+	}
+
+	if err := consumer.RemoveTableRow(ctx, "Device.Test.Table.[wan]."); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.RemoveTableRow(ctx, "Device.Test.Table.1."); !errors.Is(err, rbus.ErrElementDoesNotExist) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrElementDoesNotExist)
+	}
+
+	// The number of the removed row isn't handed out again.
+	instance, err := consumer.AddTableRow(ctx, "Device.Test.Table.", "")
+	if err != nil || instance != 3 {
+		t.Fatalf("got row %d and %v, want row 3", instance, err)
+	}
+	if got := instances(t, provider, "Device.Test.Table."); got != "[2 3]" {
+		t.Fatalf("got rows %s, want [2 3]", got)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.added) != 3 || len(r.removed) != 1 || r.removed[0] != (rbus.RowInfo{Name: "Device.Test.Table.1.", Instance: 1, Alias: "wan"}) {
+		t.Fatalf("got %+v added and %+v removed", r.added, r.removed)
+	}
+}
+
+func TestAddTableRowRejected(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+
+	r := rows{
+		reject: map[string]rbus.ErrorCode{"bad": rbus.ErrInvalidParameterValue},
+		keep:   map[string]rbus.ErrorCode{"kept": rbus.ErrAccessNotAllowed},
+	}
+	if err := provider.RegisterTable("Device.Test.Table.", 0, r.callbacks()); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.RegisterTable("Device.Test.Fixed.", 0, rbus.TableCallbacks{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		table string
+		alias string
+		want  error
+	}{
+		{name: "callback", table: "Device.Test.Table.", alias: "bad", want: rbus.ErrInvalidParameterValue},
+		{name: "no callback", table: "Device.Test.Fixed.", want: rbus.ErrInvalidOperation},
+		{name: "no provider", table: "Device.Nobody.Table.", want: rtmessage.ErrNoRoute},
+		{name: "not a table", table: "Device.Test.Table", want: rbus.ErrInvalidInput},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := consumer.AddTableRow(ctx, tc.table, tc.alias); !errors.Is(err, tc.want) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	// The number of a row that wasn't added is handed out again.
+	instance, err := consumer.AddTableRow(ctx, "Device.Test.Table.", "kept")
+	if err != nil || instance != 1 {
+		t.Fatalf("got row %d and %v, want row 1", instance, err)
+	}
+	if _, err := consumer.AddTableRow(ctx, "Device.Test.Table.", "kept"); !errors.Is(err, rbus.ErrElementNameDuplicate) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrElementNameDuplicate)
+	}
+
+	// A row the callback refuses to remove is kept.
+	if err := consumer.RemoveTableRow(ctx, "Device.Test.Table.1."); !errors.Is(err, rbus.ErrAccessNotAllowed) {
+		t.Fatalf("got %v, want %v", err, rbus.ErrAccessNotAllowed)
+	}
+	rows, err := provider.TableRows("Device.Test.Table.")
+	if err != nil || len(rows) != 1 || rows[0] != (rbus.RowInfo{Name: "Device.Test.Table.1.", Instance: 1, Alias: "kept"}) {
+		t.Fatalf("got %+v and %v, want row 1 kept", rows, err)
+	}
+}
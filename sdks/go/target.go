@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// CallOption is an option of a get, a set or a method call.  Being a
+// SetOption too, it can be given to Set, SetMultiple and SetProperties.
+type CallOption interface {
+	SetOption
+	applyCall(*callConfig)
+}
+
+// callConfig holds the options shared by gets, sets and method calls.
+type callConfig struct {
+	component string
+}
+
+// componentOption is the CallOption of ToComponent.
+type componentOption string
+
+func (o componentOption) applyCall(cfg *callConfig) {
+	cfg.component = string(o)
+}
+
+func (o componentOption) apply(cfg *setConfig) {
+	o.applyCall(&cfg.callConfig)
+}
+
+// ToComponent sends the request to the named component, such as one of the
+// values DiscoverComponents returns, instead of to the provider the router
+// picks for the element or method.  It helps when two providers register
+// overlapping names, for example while migrating.  When no component of the
+// name is on the bus, the error matches ErrDestinationNotFound.
+//
+// A partial path, ending in ".", or a name with a "*" wildcard can't be sent
+// to a component; Get fails with ErrInvalidInput for them, and GetWildcard
+// takes no options.
+func ToComponent(name string) CallOption {
+	return componentOption(name)
+}
+
+// newCallConfig applies the options.
+func newCallConfig(opts []CallOption) callConfig {
+	var cfg callConfig
+	for _, opt := range opts {
+		opt.applyCall(&cfg)
+	}
+	return cfg
+}
+
+// topic returns the topic to send the request for the named element or
+// method to: the component given with ToComponent, or else the name.
+func (cfg callConfig) topic(name string) string {
+	if cfg.component != "" {
+		return cfg.component
+	}
+	return name
+}
+
+// check fails a request for the named element that can't be sent to a
+// component.
+func (cfg callConfig) check(name string) error {
+	if cfg.component != "" && (strings.HasSuffix(name, ".") || strings.Contains(name, "*")) {
+		return fmt.Errorf("%w: a wildcard can't be sent to component '%s'", ErrInvalidInput, cfg.component)
+	}
+	return nil
+}
+
+// wrap reports a request the router found no provider for, or no component
+// given with ToComponent, as ErrDestinationNotFound.
+func (cfg callConfig) wrap(err error) error {
+	switch {
+	case !errors.Is(err, rtmessage.ErrNoRoute):
+		return err
+	case cfg.component != "":
+		return fmt.Errorf("%w: component '%s': %w", ErrDestinationNotFound, cfg.component, err)
+	}
+	return fmt.Errorf("%w: %w", ErrDestinationNotFound, err)
+}
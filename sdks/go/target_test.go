@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+func TestToComponent(t *testing.T) {
+	_, url := newRouter(t)
+	consumer := openHandle(t, url, "consumer")
+
+	// Both providers serve Device.Test.X and Device.Test.Who(), answering
+	// with their own names.
+	setters := make(map[string]*setter)
+	for _, name := range []string{"old", "new"} {
+		h := openHandle(t, url, name)
+		s := &setter{}
+		setters[name] = s
+
+		err := h.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+			GetHandler: func(context.Context, string) (rbus.Value, error) { return rbus.NewValue(name), nil },
+			SetHandler: s.set,
+		})
+		if err == nil {
+			err = h.RegisterMethod("Device.Test.Who()", func(context.Context, []rbus.Property) ([]rbus.Property, error) {
+				return []rbus.Property{{Name: "name", Value: rbus.NewValue(name)}}, nil
+			})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{"old", "new"} {
+		v, err := consumer.Get(ctx, "Device.Test.X", rbus.ToComponent(name))
+		if err != nil || v.String() != name {
+			t.Fatalf("got %s and %v, want %s", v, err, name)
+		}
+
+		out, err := consumer.Invoke(ctx, "Device.Test.Who()", nil, rbus.ToComponent(name))
+		if err != nil || list(out) != "[name="+name+"]" {
+			t.Fatalf("got %s and %v, want %s", list(out), err, name)
+		}
+	}
+
+	if err := consumer.Set(ctx, "Device.Test.X", rbus.NewValue("y"), rbus.ToComponent("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := setters["new"].took(); got != "[Device.Test.X=y!]" {
+		t.Fatalf("got %s set on new", got)
+	}
+	if got := setters["old"].took(); got != "[]" {
+		t.Fatalf("got %s set on old", got)
+	}
+
+	// The components DiscoverComponents names are those to send to.
+	comps, err := consumer.DiscoverComponents(ctx, "Device.Test.X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comp := comps["Device.Test.X"]; comp != "old" && comp != "new" {
+		t.Fatalf("got %q, want old or new", comp)
+	} else if v, err := consumer.Get(ctx, "Device.Test.X", rbus.ToComponent(comp)); err != nil || v.String() != comp {
+		t.Fatalf("got %s and %v, want %s", v, err, comp)
+	}
+}
+
+func TestToComponentErrors(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer")
+	registerValues(t, provider, map[string]rbus.Value{"Device.Test.X": rbus.NewValue("x")})
+
+	ctx := context.Background()
+	to := rbus.ToComponent("nobody")
+	if _, err := consumer.Get(ctx, "Device.Test.X", to); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("get: got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+	if err := consumer.Set(ctx, "Device.Test.X", rbus.NewValue("y"), to); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("set: got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+	if _, err := consumer.Invoke(ctx, "Device.Test.Who()", nil, to); !errors.Is(err, rbus.ErrDestinationNotFound) {
+		t.Fatalf("invoke: got %v, want %v", err, rbus.ErrDestinationNotFound)
+	}
+
+	// Wildcards aren't sent to a component, even one that's there.
+	to = rbus.ToComponent("provider")
+	for _, name := range []string{"Device.Test.", "Device.*.X"} {
+		if _, err := consumer.Get(ctx, name, to); !errors.Is(err, rbus.ErrInvalidInput) {
+			t.Fatalf("%s: got %v, want %v", name, err, rbus.ErrInvalidInput)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * datetime.c writes the datetime-*.bin payloads of this directory with the
+ * value encoder of the C library, for the tests to check that the times its
+ * providers send are decoded as they mean them.  Each is a property the way
+ * rbusValue_appendToMessage adds it to a get response: the name, the type and
+ * the rbusDateTime_t.  From this directory, with msgpack-c installed; the
+ * functions of the library that aren't called are left unresolved:
+ *
+ *   S=../../../src
+ *   gcc -no-pie -I$S/../include -I$S/rbus -I$S/core -I$S/rtmessage -I$S/session_manager -o datetime datetime.c \
+ *     $S/rbus/rbus.c $S/rbus/rbus_value.c $S/rbus/rbus_object.c $S/rbus/rbus_property.c \
+ *     $S/rbus/rbus_filter.c $S/rbus/rbus_buffer.c $S/core/rbuscore_message.c \
+ *     $S/rtmessage/rtRetainable.c $S/rtmessage/rtMemory.c \
+ *     -lmsgpackc -lpthread -Wl,--unresolved-symbols=ignore-all && ./datetime
+ */
+#define _GNU_SOURCE
+#include <rbus.h>
+#include <rbuscore_message.h>
+#include <rtLog.h>
+
+#include <stdarg.h>
+#include <stdio.h>
+#include <string.h>
+#include <time.h>
+
+void rbusValue_appendToMessage(char const* name, rbusValue_t value, rbusMessage msg);
+void rbusValue_MarshallTMtoRBUS(rbusDateTime_t* outvalue, const struct tm* invalue);
+
+/* The values log through rtLog, which isn't needed here. */
+void rtLogPrintf(rtLogLevel level, const char* pModule, const char* file, int line, const char* format, ...)
+{
+  (void) level; (void) pModule; (void) file; (void) line; (void) format;
+}
+
+/*
+ * golden writes the property of the local time, given as seconds since the
+ * epoch in UTC, and its offset.  The time is broken down like a provider
+ * would with gmtime_r, which fills in the day of the week and of the year.
+ */
+static void
+golden(char const* name, time_t local, int tzhour, int tzmin, bool west)
+{
+  rbusDateTime_t tv;
+  rbusValue_t value;
+  rbusMessage msg;
+  struct tm tm;
+  uint8_t* buff;
+  uint32_t n;
+  char path[128];
+  FILE* f;
+
+  memset(&tv, 0, sizeof(tv));
+  if (local)
+  {
+    gmtime_r(&local, &tm);
+    rbusValue_MarshallTMtoRBUS(&tv, &tm);
+    tv.m_tz.m_tzhour = tzhour;
+    tv.m_tz.m_tzmin = tzmin;
+    tv.m_tz.m_isWest = west;
+  }
+
+  rbusValue_Init(&value);
+  rbusValue_SetTime(value, &tv);
+
+  rbusMessage_Init(&msg);
+  rbusValue_appendToMessage("Device.Time.CurrentLocalTime", value, msg);
+
+  rbusMessage_ToBytes(msg, &buff, &n);
+  snprintf(path, sizeof(path), "datetime-%s.bin", name);
+  f = fopen(path, "wb");
+  fwrite(buff, 1, n, f);
+  fclose(f);
+
+  rbusMessage_Release(msg);
+  rbusValue_Release(value);
+}
+
+int main()
+{
+  /* The unknown time, all zeros. */
+  golden("unknown", 0, 0, 0, false);
+
+  /* 2024-03-10T12:34:56Z. */
+  golden("utc", 1710074096, 0, 0, false);
+
+  /* The same instant at 2024-03-10T18:04:56+05:30. */
+  golden("east", 1710074096 + 5*3600 + 30*60, 5, 30, false);
+
+  /* And at 2024-03-10T07:34:56-05:00. */
+  golden("west", 1710074096 - 5*3600, 5, 0, true);
+
+  return 0;
+}
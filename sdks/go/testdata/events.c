@@ -0,0 +1,125 @@
+/*
+ * events.c writes the event-*.bin payloads of this directory with the event
+ * encoder of the C library, for the tests to check that the events its
+ * providers publish are decoded as they mean them.  Each is the payload of an
+ * event message as rbus_publishSubscriberEvent sends it: the data appended by
+ * rbusEventData_appendToMessage, then the meta section.  From this directory,
+ * with msgpack-c installed; the functions of the library that aren't called
+ * are left unresolved:
+ *
+ *   S=../../../src
+ *   gcc -no-pie -I$S/../include -I$S/rbus -I$S/core -I$S/rtmessage -I$S/session_manager -o events events.c \
+ *     $S/rbus/rbus.c $S/rbus/rbus_value.c $S/rbus/rbus_object.c $S/rbus/rbus_property.c \
+ *     $S/rbus/rbus_filter.c $S/rbus/rbus_buffer.c $S/core/rbuscore_message.c \
+ *     $S/rtmessage/rtRetainable.c $S/rtmessage/rtMemory.c \
+ *     -lmsgpackc -lpthread -Wl,--unresolved-symbols=ignore-all && ./events
+ */
+#include <rbus.h>
+#include <rbuscore_message.h>
+#include <rtLog.h>
+
+#include <stdarg.h>
+#include <stdio.h>
+
+void rbusEventData_appendToMessage(rbusEvent_t* event, rbusFilter_t filter,
+  uint32_t interval, uint32_t duration, int32_t componentId, rbusMessage msg);
+
+/* The values log through rtLog, which isn't needed here. */
+void rtLogPrintf(rtLogLevel level, const char* pModule, const char* file, int line, const char* format, ...)
+{
+  (void) level; (void) pModule; (void) file; (void) line; (void) format;
+}
+
+static void
+golden(char const* name, char const* eventName, rbusEventType_t type, rbusObject_t data,
+  rbusFilter_t filter, uint32_t interval, uint32_t duration)
+{
+  rbusEvent_t event = {0};
+  rbusMessage msg;
+  uint8_t* buff;
+  uint32_t n;
+  char path[128];
+  FILE* f;
+
+  event.name = eventName;
+  event.type = type;
+  event.data = data;
+
+  rbusMessage_Init(&msg);
+  rbusEventData_appendToMessage(&event, filter, interval, duration, 7, msg);
+  rbusMessage_BeginMetaSectionWrite(msg);
+  rbusMessage_SetString(msg, eventName);
+  rbusMessage_SetString(msg, "provider");
+  rbusMessage_SetInt32(msg, 1);
+  rbusMessage_EndMetaSectionWrite(msg);
+
+  rbusMessage_ToBytes(msg, &buff, &n);
+  snprintf(path, sizeof(path), "event-%s.bin", name);
+  f = fopen(path, "wb");
+  fwrite(buff, 1, n, f);
+  fclose(f);
+
+  rbusMessage_Release(msg);
+  rbusObject_Release(data);
+}
+
+int main()
+{
+  rbusObject_t data;
+  rbusFilter_t filter;
+  rbusValue_t threshold;
+
+  /* As rbus_valuechange.c publishes them. */
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyInt32(data, "value", 6);
+  rbusObject_SetPropertyInt32(data, "oldValue", 5);
+  rbusObject_SetPropertyString(data, "by", "setter");
+  golden("value-changed", "Device.Test.X", RBUS_EVENT_VALUE_CHANGED, data, NULL, 0, 0);
+
+  /* To a subscription with a filter, which says whether it started matching. */
+  rbusValue_Init(&threshold);
+  rbusValue_SetInt32(threshold, 5);
+  rbusFilter_InitRelation(&filter, RBUS_FILTER_OPERATOR_GREATER_THAN, threshold);
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyInt32(data, "value", 6);
+  rbusObject_SetPropertyInt32(data, "oldValue", 5);
+  rbusObject_SetPropertyString(data, "by", "setter");
+  rbusObject_SetPropertyBoolean(data, "filter", true);
+  golden("value-changed-filter", "Device.Test.X", RBUS_EVENT_VALUE_CHANGED, data, filter, 0, 0);
+  rbusFilter_Release(filter);
+  rbusValue_Release(threshold);
+
+  /* As rbusTable_addRow and rbusTable_removeRow publish them. */
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyString(data, "rowName", "Device.Test.Table.1.");
+  rbusObject_SetPropertyUInt32(data, "instNum", 1);
+  rbusObject_SetPropertyString(data, "alias", "first");
+  golden("object-created", "Device.Test.Table.", RBUS_EVENT_OBJECT_CREATED, data, NULL, 0, 0);
+
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyString(data, "rowName", "Device.Test.Table.1.");
+  golden("object-deleted", "Device.Test.Table.", RBUS_EVENT_OBJECT_DELETED, data, NULL, 0, 0);
+
+  /* As a provider might publish one with rbusEvent_Publish. */
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyString(data, "message", "hello");
+  rbusObject_SetPropertyInt32(data, "count", 3);
+  golden("general", "Device.Test.Event!", RBUS_EVENT_GENERAL, data, NULL, 0, 0);
+
+  /* As _subscribe_callback_handler sends it with the subscribe response. */
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyInt32(data, "initialValue", 5);
+  golden("initial-value", "Device.Test.X", RBUS_EVENT_INITIAL_VALUE, data, NULL, 0, 0);
+
+  /* As rbus_intervalsubscription.c publishes them, the value named after the
+   * element. */
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyInt32(data, "Device.Test.X", 5);
+  golden("interval", "Device.Test.X", RBUS_EVENT_INTERVAL, data, NULL, 2, 10);
+
+  rbusObject_Init(&data, NULL);
+  rbusObject_SetPropertyInt32(data, "Device.Test.X", 5);
+  golden("duration-complete", "Device.Test.X", RBUS_EVENT_DURATION_COMPLETE, data, NULL, 2, 10);
+
+  return 0;
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// TracePropagator carries trace contexts across the bus in the W3C Trace
+// Context format, which rbus places in the meta section of its requests.  It
+// keeps the handle free of a tracing dependency; with OpenTelemetry it's a
+// thin wrapper around propagation.TraceContext and a propagation.MapCarrier
+// holding the "traceparent" and "tracestate" keys.
+type TracePropagator interface {
+	// Inject returns the traceparent and tracestate of the span active in
+	// the context, or empty strings when there is none.
+	Inject(ctx context.Context) (traceParent, traceState string)
+
+	// Extract returns the context carrying the remote span described by
+	// the traceparent and tracestate of a request.
+	Extract(ctx context.Context, traceParent, traceState string) context.Context
+}
+
+// traceKey is the context key of the trace context of a request served.
+type traceKey struct{}
+
+type traceInfo struct {
+	parent string
+	state  string
+}
+
+// TraceContext returns the traceparent and tracestate a consumer sent with
+// the request an element's handler or a MethodHandler is called for, or empty
+// strings for a context other than a handler's or a consumer that sent none.
+func TraceContext(ctx context.Context) (traceParent, traceState string) {
+	info, _ := ctx.Value(traceKey{}).(traceInfo)
+	return info.parent, info.state
+}
+
+// traceInfo returns the traceparent and tracestate to send with a request
+// made with the context.  Without an active span a random traceparent is made
+// up, so the providers still get an id to correlate the request with.
+func (h *Handle) traceInfo(ctx context.Context) (string, string) {
+	if h.cfg.tracer != nil {
+		if parent, state := h.cfg.tracer.Inject(ctx); parent != "" {
+			return parent, state
+		}
+	}
+
+	return newTraceParent(), ""
+}
+
+// withTraceInfo returns the context of a request served, carrying the trace
+// context the consumer sent.
+func (h *Handle) withTraceInfo(ctx context.Context, parent, state string) context.Context {
+	if parent == "" {
+		return ctx
+	}
+
+	ctx = context.WithValue(ctx, traceKey{}, traceInfo{parent: parent, state: state})
+	if h.cfg.tracer != nil {
+		ctx = h.cfg.tracer.Extract(ctx, parent, state)
+	}
+
+	return ctx
+}
+
+// newTraceParent returns a version 00 traceparent with random trace and
+// parent ids, not sampled.
+func newTraceParent() string {
+	var ids [24]byte
+	_, _ = rand.Read(ids[:])
+
+	return "00-" + hex.EncodeToString(ids[:16]) + "-" + hex.EncodeToString(ids[16:]) + "-00"
+}
@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+// spanKey is the context key of the span of the propagator.
+type spanKey struct{}
+
+// propagator is a TracePropagator keeping the traceparent and tracestate of
+// its span in the context under spanKey.
+type propagator struct {
+	m         sync.Mutex
+	extracted []string
+}
+
+func (p *propagator) Inject(ctx context.Context) (string, string) {
+	span, _ := ctx.Value(spanKey{}).([2]string)
+	return span[0], span[1]
+}
+
+func (p *propagator) Extract(ctx context.Context, parent, state string) context.Context {
+	p.m.Lock()
+	p.extracted = append(p.extracted, parent)
+	p.m.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, [2]string{parent, state})
+}
+
+// traced records the trace contexts the handlers of an element and a method
+// are called with.
+type traced struct {
+	m     sync.Mutex
+	trace [][2]string
+	spans [][2]string
+}
+
+func (tr *traced) record(ctx context.Context) {
+	parent, state := rbus.TraceContext(ctx)
+	span, _ := ctx.Value(spanKey{}).([2]string)
+
+	tr.m.Lock()
+	defer tr.m.Unlock()
+	tr.trace = append(tr.trace, [2]string{parent, state})
+	tr.spans = append(tr.spans, span)
+}
+
+// register registers Device.Test.X and Device.Test.Echo() on the provider,
+// recording their trace contexts.
+func (tr *traced) register(t *testing.T, provider *rbus.Handle) {
+	t.Helper()
+
+	err := provider.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+		GetHandler: func(ctx context.Context, _ string) (rbus.Value, error) {
+			tr.record(ctx)
+			return rbus.NewValue(int32(5)), nil
+		},
+		SetHandler: func(ctx context.Context, _ string, _ rbus.Value, _ rbus.SetHandlerOptions) error {
+			tr.record(ctx)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = provider.RegisterMethod("Device.Test.Echo()", func(ctx context.Context, in []rbus.Property) ([]rbus.Property, error) {
+		tr.record(ctx)
+		return in, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requests makes a get, a set and a call in the span, or in none when it's
+// empty.
+func requests(t *testing.T, consumer *rbus.Handle, span [2]string) {
+	t.Helper()
+
+	ctx := context.Background()
+	if span[0] != "" {
+		ctx = context.WithValue(ctx, spanKey{}, span)
+	}
+
+	if _, err := consumer.Get(ctx, "Device.Test.X"); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.Set(ctx, "Device.Test.X", rbus.NewValue(int32(6))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.Invoke(ctx, "Device.Test.Echo()", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTraceInjected(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	consumer := openHandle(t, url, "consumer", rbus.WithTracePropagator(&propagator{}))
+
+	var tr traced
+	tr.register(t, provider)
+
+	span := [2]string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=value"}
+	requests(t, consumer, span)
+
+	if got := len(tr.trace); got != 3 {
+		t.Fatalf("got %d requests, want 3", got)
+	}
+	for i, got := range tr.trace {
+		if got != span {
+			t.Fatalf("request %d: got %q, want %q", i, got, span)
+		}
+	}
+}
+
+func TestTraceGenerated(t *testing.T) {
+	traceParent := regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-00$`)
+
+	tests := []struct {
+		name string
+		opts []rbus.Option
+	}{
+		{name: "without a propagator"},
+		{name: "without an active span", opts: []rbus.Option{rbus.WithTracePropagator(&propagator{})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, url := newRouter(t)
+			provider := openHandle(t, url, "provider")
+			consumer := openHandle(t, url, "consumer", tt.opts...)
+
+			var tr traced
+			tr.register(t, provider)
+			requests(t, consumer, [2]string{})
+
+			if got := len(tr.trace); got != 3 {
+				t.Fatalf("got %d requests, want 3", got)
+			}
+			seen := make(map[string]bool)
+			for i, got := range tr.trace {
+				if !traceParent.MatchString(got[0]) || got[1] != "" {
+					t.Fatalf("request %d: got %q, want a random traceparent alone", i, got)
+				}
+				if seen[got[0]] {
+					t.Fatalf("request %d: got %q again", i, got[0])
+				}
+				seen[got[0]] = true
+			}
+		})
+	}
+}
+
+func TestTraceExtracted(t *testing.T) {
+	_, url := newRouter(t)
+	var p propagator
+	provider := openHandle(t, url, "provider", rbus.WithTracePropagator(&p))
+	consumer := openHandle(t, url, "consumer", rbus.WithTracePropagator(&propagator{}))
+
+	var tr traced
+	tr.register(t, provider)
+
+	span := [2]string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=value"}
+	requests(t, consumer, span)
+
+	// The handlers run in the span the provider's propagator extracted.
+	if got := len(tr.spans); got != 3 {
+		t.Fatalf("got %d requests, want 3", got)
+	}
+	for i, got := range tr.spans {
+		if got != span {
+			t.Fatalf("request %d: got span %q, want %q", i, got, span)
+		}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if got := len(p.extracted); got != 3 {
+		t.Fatalf("got %d extracted, want 3", got)
+	}
+	for _, got := range p.extracted {
+		if got != span[0] {
+			t.Fatalf("got %q extracted, want %q", got, span[0])
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// Transport carries the messages of a Handle to and from the bus.  It's
+// satisfied by *rtmessage.Connection, which the Handle uses unless another
+// one is given with WithTransport, for example a fake in the tests of an
+// application.
+//
+// A Transport covers the consumer side: gets, sets, method calls and
+// subscriptions.  One that also has the Serve, AddAlias and RemoveAlias
+// methods of *rtmessage.Connection can register elements, one with its
+// DiscoverWildcardDestinations, DiscoverObjectElements and
+// DiscoverElementObjects methods can get partial paths and discover, one
+// with its AddReconnectListener method has the state of the handle restored
+// after reconnecting, one with its AddStateListener method reports the
+// changes of its state to the connection listeners, and one with its Add
+// method can subscribe to raw data.  Without them those operations fail with
+// ErrInvalidOperation.
+type Transport interface {
+	// Connect connects to the bus.
+	Connect(ctx context.Context) error
+
+	// Disconnect disconnects from the bus.
+	Disconnect() error
+
+	// RequestBinary sends the request to the topic and waits for the
+	// response.
+	RequestBinary(ctx context.Context, payload []byte, topic string) (rtmessage.Message, error)
+
+	// SendBinary sends the message to the topic.
+	SendBinary(ctx context.Context, payload []byte, topic string) error
+
+	// Inbox returns the topic the messages for the Handle are sent to.
+	Inbox() string
+
+	// AddInboxListener registers a listener for the messages sent to the
+	// inbox other than responses.
+	AddInboxListener(listener rtmessage.MessageListener) rtmessage.CancelListenerFunc
+}
+
+var _ Transport = (*rtmessage.Connection)(nil)
+
+// server is a Transport that can serve the elements of a provider.
+type server interface {
+	Serve(expression string, handler rtmessage.Handler) (rtmessage.CancelListenerFunc, error)
+	AddAlias(expression, alias string) error
+	RemoveAlias(alias string) error
+}
+
+// discoverer is a Transport that can ask the router about the routes.
+type discoverer interface {
+	DiscoverWildcardDestinations(ctx context.Context, expression string) ([]string, error)
+	DiscoverObjectElements(ctx context.Context, expression string) ([]string, error)
+	DiscoverElementObjects(ctx context.Context, topics ...string) ([][]string, error)
+}
+
+// reconnecter is a Transport that reports reconnecting.
+type reconnecter interface {
+	AddReconnectListener(listener rtmessage.ReconnectListener) rtmessage.CancelListenerFunc
+}
+
+// stateWatcher is a Transport that reports the changes of its state.
+type stateWatcher interface {
+	AddStateListener(listener rtmessage.StateListener) rtmessage.CancelListenerFunc
+}
+
+// topicListener is a Transport that can receive the messages of any topic.
+type topicListener interface {
+	Add(listener rtmessage.MessageListener, expression string) (rtmessage.CancelListenerFunc, error)
+}
+
+var (
+	_ server        = (*rtmessage.Connection)(nil)
+	_ discoverer    = (*rtmessage.Connection)(nil)
+	_ reconnecter   = (*rtmessage.Connection)(nil)
+	_ stateWatcher  = (*rtmessage.Connection)(nil)
+	_ topicListener = (*rtmessage.Connection)(nil)
+)
+
+// transport returns the transport of the handle, also while it's closing.
+func (h *Handle) transport() (Transport, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.conn == nil {
+		return nil, ErrNotOpen
+	}
+	return h.conn, nil
+}
+
+// server returns the transport of the handle as a server.
+func (h *Handle) server() (server, error) {
+	con, err := h.transport()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := con.(server)
+	if !ok {
+		return nil, fmt.Errorf("%w: the transport can't serve elements", ErrInvalidOperation)
+	}
+	return s, nil
+}
+
+// addAlias routes the requests sent to the alias to the component of the
+// handle.
+func (h *Handle) addAlias(alias string) error {
+	s, err := h.server()
+	if err != nil {
+		return err
+	}
+	return s.AddAlias(h.cfg.appName, alias)
+}
+
+// removeAlias stops routing the requests sent to the alias.
+func (h *Handle) removeAlias(alias string) error {
+	s, err := h.server()
+	if err != nil {
+		return err
+	}
+	return s.RemoveAlias(alias)
+}
+
+// discoverer returns the transport of the handle as a discoverer.
+func (h *Handle) discoverer() (discoverer, error) {
+	con, err := h.transport()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := con.(discoverer)
+	if !ok {
+		return nil, fmt.Errorf("%w: the transport can't discover", ErrInvalidOperation)
+	}
+	return d, nil
+}
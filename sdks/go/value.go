@@ -1,13 +1,76 @@
 package rbus
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType identifies the rbus type of a Value.  The numeric values match
+// rbusValueType_t in the C library and are what is carried on the wire.
+type ValueType int32
+
+const (
+	ValueTypeBoolean ValueType = 0x500 + iota
+	ValueTypeChar
+	ValueTypeByte
+	ValueTypeInt8
+	ValueTypeUInt8
+	ValueTypeInt16
+	ValueTypeUInt16
+	ValueTypeInt32
+	ValueTypeUInt32
+	ValueTypeInt64
+	ValueTypeUInt64
+	ValueTypeSingle
+	ValueTypeDouble
+	ValueTypeDateTime
+	ValueTypeString
+	ValueTypeBytes
+	ValueTypeProperty
+	ValueTypeObject
+	ValueTypeNone
+)
+
+var valueTypeNames = map[ValueType]string{
+	ValueTypeBoolean:  "boolean",
+	ValueTypeChar:     "char",
+	ValueTypeByte:     "byte",
+	ValueTypeInt8:     "int8",
+	ValueTypeUInt8:    "uint8",
+	ValueTypeInt16:    "int16",
+	ValueTypeUInt16:   "uint16",
+	ValueTypeInt32:    "int32",
+	ValueTypeUInt32:   "uint32",
+	ValueTypeInt64:    "int64",
+	ValueTypeUInt64:   "uint64",
+	ValueTypeSingle:   "single",
+	ValueTypeDouble:   "double",
+	ValueTypeDateTime: "datetime",
+	ValueTypeString:   "string",
+	ValueTypeBytes:    "bytes",
+	ValueTypeProperty: "property",
+	ValueTypeObject:   "object",
+	ValueTypeNone:     "none",
+}
+
+func (t ValueType) String() string {
+	if name, found := valueTypeNames[t]; found {
+		return name
+	}
+	return fmt.Sprintf("unknown(0x%x)", int32(t))
+}
 
 type ValueConstraint interface {
-	int | bool | string | int8 | int16 | int32 | int64 | uint8 | uint16 | uint32 | uint64
+	int | bool | string | int8 | int16 | int32 | int64 | uint8 | uint16 | uint32 | uint64 | float32 | float64 | []byte
 }
 
 type ValueVariant interface {
 	isVariant()
+	get() any
 }
 
 type Value struct {
@@ -20,21 +83,252 @@ type Variant[T ValueConstraint] struct {
 
 func (v Variant[T]) isVariant() {}
 
+func (v Variant[T]) get() any {
+	return v.unwrap
+}
+
 func NewValue[T ValueConstraint](v T) Value {
+	// Bytes are copied, so the caller can reuse its slice.
+	if b, ok := any(v).([]byte); ok {
+		return Value{Variant[[]byte]{bytes.Clone(b)}}
+	}
 	return Value{Variant[T]{v}}
 }
 
+// object is the variant of an object value.
+type object struct {
+	props []Property
+}
+
+func (o object) isVariant() {}
+
+func (o object) get() any {
+	return o.props
+}
+
+// String lists the properties as name=value pairs between braces, the
+// objects among them nested the same way.
+func (o object) String() string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, p := range o.props {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(p.Name)
+		b.WriteByte('=')
+		b.WriteString(p.Value.String())
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// NewObjectValue returns an object value holding the properties, such as the
+// output of a method.  Objects nest by holding properties of object values.
+func NewObjectValue(props ...Property) Value {
+	return Value{object{props: props}}
+}
+
+// Type returns the rbus type of the value.  An empty Value has the type
+// ValueTypeNone.
+func (val Value) Type() ValueType {
+	switch val.Value.(type) {
+	case Variant[bool]:
+		return ValueTypeBoolean
+	case Variant[int8]:
+		return ValueTypeInt8
+	case Variant[uint8]:
+		return ValueTypeUInt8
+	case Variant[int16]:
+		return ValueTypeInt16
+	case Variant[uint16]:
+		return ValueTypeUInt16
+	case Variant[int32]:
+		return ValueTypeInt32
+	case Variant[uint32]:
+		return ValueTypeUInt32
+	case Variant[int], Variant[int64]:
+		return ValueTypeInt64
+	case Variant[uint64]:
+		return ValueTypeUInt64
+	case Variant[float32]:
+		return ValueTypeSingle
+	case Variant[float64]:
+		return ValueTypeDouble
+	case Variant[string]:
+		return ValueTypeString
+	case Variant[[]byte]:
+		return ValueTypeBytes
+	case dateTime:
+		return ValueTypeDateTime
+	case object:
+		return ValueTypeObject
+	}
+	return ValueTypeNone
+}
+
+// String formats the value for printing.  Bytes are written as their length
+// and their base64, such as 3:AQID, and datetimes as RFC 3339.  A value of a
+// type it doesn't know is written as a placeholder naming it.
 func (val Value) String() string {
 	switch v := val.Value.(type) {
-	case Variant[int]:
-		return fmt.Sprintf("%d", v.unwrap)
-	case Variant[int64]:
-		return fmt.Sprintf("%d", v.unwrap)
+	case nil:
+		return ""
 	case Variant[bool]:
 		return fmt.Sprintf("%t", v.unwrap)
 	case Variant[string]:
 		return v.unwrap
+	case Variant[float32]:
+		return strconv.FormatFloat(float64(v.unwrap), 'g', -1, 32)
+	case Variant[float64]:
+		return strconv.FormatFloat(v.unwrap, 'g', -1, 64)
+	case Variant[int], Variant[int8], Variant[int16], Variant[int32], Variant[int64],
+		Variant[uint8], Variant[uint16], Variant[uint32], Variant[uint64]:
+		return fmt.Sprintf("%d", v.get())
+	case Variant[[]byte]:
+		return fmt.Sprintf("%d:%s", len(v.unwrap), base64.StdEncoding.EncodeToString(v.unwrap))
+	case dateTime:
+		return v.String()
+	case object:
+		return v.String()
 	default:
-		panic(fmt.Errorf("unsupported type: %T", v))
+		return fmt.Sprintf("<invalid value type %T>", v)
+	}
+}
+
+// mismatch returns the error for a value that can't be converted to the Go
+// type.
+func (val Value) mismatch(to string) error {
+	return fmt.Errorf("%w: %s value is not %s", ErrTypeMismatch, val.Type(), to)
+}
+
+// Equal reports whether the values are of the same rbus type and equal.
+func (val Value) Equal(o Value) bool {
+	return val.Type() == o.Type() && val.String() == o.String()
+}
+
+// AsString returns the value of a string.  No other type converts to a
+// string.
+func (val Value) AsString() (string, error) {
+	if v, ok := val.Value.(Variant[string]); ok {
+		return v.unwrap, nil
+	}
+	return "", val.mismatch("a string")
+}
+
+// AsBytes returns a copy of the data of a bytes value, so it can be kept and
+// changed.  No other type converts to bytes.
+func (val Value) AsBytes() ([]byte, error) {
+	if v, ok := val.Value.(Variant[[]byte]); ok {
+		return bytes.Clone(v.unwrap), nil
+	}
+	return nil, val.mismatch("bytes")
+}
+
+// AsObject returns the properties of an object.  No other type converts to
+// an object.
+func (val Value) AsObject() ([]Property, error) {
+	if v, ok := val.Value.(object); ok {
+		return v.props, nil
+	}
+	return nil, val.mismatch("an object")
+}
+
+// AsBool returns the value of a boolean.  No other type converts to a bool.
+func (val Value) AsBool() (bool, error) {
+	if v, ok := val.Value.(Variant[bool]); ok {
+		return v.unwrap, nil
+	}
+	return false, val.mismatch("a bool")
+}
+
+// AsInt64 returns the value of any of the integer types.  A uint64 only
+// converts when it fits.  Floats and strings don't convert.
+func (val Value) AsInt64() (int64, error) {
+	switch v := val.Value.(type) {
+	case Variant[int8]:
+		return int64(v.unwrap), nil
+	case Variant[uint8]:
+		return int64(v.unwrap), nil
+	case Variant[int16]:
+		return int64(v.unwrap), nil
+	case Variant[uint16]:
+		return int64(v.unwrap), nil
+	case Variant[int32]:
+		return int64(v.unwrap), nil
+	case Variant[uint32]:
+		return int64(v.unwrap), nil
+	case Variant[int]:
+		return int64(v.unwrap), nil
+	case Variant[int64]:
+		return v.unwrap, nil
+	case Variant[uint64]:
+		if v.unwrap > math.MaxInt64 {
+			return 0, fmt.Errorf("%w: uint64 value %d overflows an int64", ErrTypeMismatch, v.unwrap)
+		}
+		return int64(v.unwrap), nil
+	}
+	return 0, val.mismatch("an integer")
+}
+
+// AsUint64 returns the value of any of the integer types.  A signed integer
+// only converts when it isn't negative.  Floats and strings don't convert.
+func (val Value) AsUint64() (uint64, error) {
+	switch v := val.Value.(type) {
+	case Variant[uint8]:
+		return uint64(v.unwrap), nil
+	case Variant[uint16]:
+		return uint64(v.unwrap), nil
+	case Variant[uint32]:
+		return uint64(v.unwrap), nil
+	case Variant[uint64]:
+		return v.unwrap, nil
+	}
+
+	i, err := val.AsInt64()
+	if err != nil {
+		return 0, val.mismatch("an integer")
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("%w: %s value %d is negative", ErrTypeMismatch, val.Type(), i)
+	}
+	return uint64(i), nil
+}
+
+// AsFloat64 returns the value of a single or a double.  Integers convert as
+// well when a float64 holds them exactly, which those of up to 32 bits always
+// are, as are wider ones of a magnitude of at most 2^53.  Strings don't
+// convert.
+func (val Value) AsFloat64() (float64, error) {
+	switch v := val.Value.(type) {
+	case Variant[float32]:
+		return float64(v.unwrap), nil
+	case Variant[float64]:
+		return v.unwrap, nil
+	case Variant[int8]:
+		return float64(v.unwrap), nil
+	case Variant[uint8]:
+		return float64(v.unwrap), nil
+	case Variant[int16]:
+		return float64(v.unwrap), nil
+	case Variant[uint16]:
+		return float64(v.unwrap), nil
+	case Variant[int32]:
+		return float64(v.unwrap), nil
+	case Variant[uint32]:
+		return float64(v.unwrap), nil
+	case Variant[int], Variant[int64]:
+		i, _ := val.AsInt64()
+		// A float64 of 2^63 or more is out of the range of an int64.
+		if f := float64(i); f < math.MaxInt64 && int64(f) == i {
+			return f, nil
+		}
+		return 0, fmt.Errorf("%w: %s value %d isn't exact as a float64", ErrTypeMismatch, val.Type(), i)
+	case Variant[uint64]:
+		if f := float64(v.unwrap); f < math.MaxUint64 && uint64(f) == v.unwrap {
+			return f, nil
+		}
+		return 0, fmt.Errorf("%w: %s value %d isn't exact as a float64", ErrTypeMismatch, val.Type(), v.unwrap)
 	}
+	return 0, val.mismatch("a float")
 }
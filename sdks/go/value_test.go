@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"testing"
+)
+
+// bogus is a variant no Value is made of.
+type bogus struct{}
+
+func (bogus) isVariant() {}
+
+func (bogus) get() any {
+	return nil
+}
+
+func TestValueStringInvalid(t *testing.T) {
+	v := Value{bogus{}}
+	if got, want := v.String(), "<invalid value type rbus.bogus>"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if v.Type() != ValueTypeNone {
+		t.Fatalf("got %s, want %s", v.Type(), ValueTypeNone)
+	}
+}
+
+func TestObjectNested(t *testing.T) {
+	in := NewObjectValue(
+		Property{Name: "a", Value: NewValue(int32(1))},
+		Property{Name: "b", Value: NewObjectValue(
+			Property{Name: "c", Value: NewValue("d")},
+			Property{Name: "e", Value: NewObjectValue(Property{Name: "f", Value: NewValue(true)})},
+		)},
+		Property{Name: "g", Value: NewObjectValue()},
+	)
+	const want = "{a=1, b={c=d, e={f=true}}, g={}}"
+	if got := in.String(); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	m := NewMessage()
+	if err := m.AppendValue(in); err != nil {
+		t.Fatal(err)
+	}
+	m.AppendString("after")
+
+	r := NewMessageFromBytes(m.Bytes())
+	got, err := r.PopValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type() != ValueTypeObject || got.String() != want {
+		t.Fatalf("got %s %s, want %s", got.Type(), got, want)
+	}
+	if s, err := r.PopString(); err != nil || s != "after" {
+		t.Fatalf("got %q, %v after the object", s, err)
+	}
+
+	// The nested objects are objects of their own, not their strings.
+	props, err := got.AsObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := props[1].Value.AsObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	innermost, err := inner[1].Value.AsObject()
+	if err != nil || len(innermost) != 1 || innermost[0].Name != "f" || innermost[0].Value.Type() != ValueTypeBoolean {
+		t.Fatalf("got %v and %v, want f=true", innermost, err)
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// valueChange is the detection of the changes of an element, which polls it
+// while it has subscribers.
+type valueChange struct {
+	name     string
+	interval time.Duration
+	get      func(ctx context.Context, name string) (Value, error)
+
+	// stop ends the polling, and is nil while not polling.
+	stop context.CancelFunc
+}
+
+// EnableValueChangeDetection publishes an EventValueChanged event to the
+// subscribers of the named element, registered with RegisterElement, each
+// time its value changes.  Like the C library does, the value is read with
+// the element's GetHandler at the interval, and only while the element has
+// subscribers; a value that differs from the one read before, as told by
+// Value.Equal, is published with it as "value" and the one before as
+// "oldValue".  Enabling the detection again changes the interval.
+func (h *Handle) EnableValueChangeDetection(name string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("detect '%s': %w: interval %s", name, ErrInvalidInput, interval)
+	}
+	if err := h.checkOpen(); err != nil {
+		return fmt.Errorf("detect '%s': %w", name, err)
+	}
+
+	cb, found := h.element(name)
+	if !found {
+		return fmt.Errorf("detect '%s': %w", name, ErrElementDoesNotExist)
+	}
+	if cb.GetHandler == nil {
+		return fmt.Errorf("detect '%s': %w: not readable", name, ErrInvalidOperation)
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.stopDetectionLocked(name)
+	if h.detectors == nil {
+		h.detectors = make(map[string]*valueChange)
+	}
+	h.detectors[name] = &valueChange{
+		name:     name,
+		interval: interval,
+		get:      cb.GetHandler,
+	}
+	if len(h.subscribers[name]) > 0 {
+		h.startDetectionLocked(name)
+	}
+
+	return nil
+}
+
+// startDetectionLocked starts polling the named element if its changes are
+// to be detected.  It's called with h.m held.
+func (h *Handle) startDetectionLocked(name string) {
+	vc, found := h.detectors[name]
+	if !found || vc.stop != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	vc.stop = cancel
+	go h.detect(ctx, vc)
+}
+
+// stopDetectionLocked stops polling the named element.  It's called with h.m
+// held.
+func (h *Handle) stopDetectionLocked(name string) {
+	if vc, found := h.detectors[name]; found && vc.stop != nil {
+		vc.stop()
+		vc.stop = nil
+	}
+}
+
+// detect polls the element until the context is done, publishing its changes.
+// The value read first is the one the changes are told from.
+func (h *Handle) detect(ctx context.Context, vc *valueChange) {
+	last, err := vc.get(ctx, vc.name)
+	known := err == nil
+
+	t := time.NewTicker(vc.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		val, err := vc.get(ctx, vc.name)
+		if err != nil {
+			continue
+		}
+		if known && val.Equal(last) {
+			continue
+		}
+
+		if known {
+			_ = h.publish(ctx, Event{
+				Name: vc.name,
+				Type: EventValueChanged,
+				Data: []Property{
+					{Name: "value", Value: val},
+					{Name: "oldValue", Value: last},
+				},
+			})
+		}
+		last, known = val, true
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus"
+)
+
+func TestValueChangeDetection(t *testing.T) {
+	_, url := newRouter(t)
+	provider := openHandle(t, url, "provider")
+	first := openHandle(t, url, "first")
+	second := openHandle(t, url, "second")
+
+	// Each read of the value is a poll.
+	var value atomic.Int32
+	polls := make(chan struct{}, 1000)
+	err := provider.RegisterElement("Device.Test.X", rbus.ElementCallbacks{
+		GetHandler: func(context.Context, string) (rbus.Value, error) {
+			polls <- struct{}{}
+			return rbus.NewValue(value.Load()), nil
+		},
+	})
+	if err == nil {
+		err = provider.EnableValueChangeDetection("Device.Test.X", 5*time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// polling tells whether the value is read within a few intervals, after
+	// the reads under way are done with.
+	polling := func() bool {
+		time.Sleep(20 * time.Millisecond)
+		for len(polls) > 0 {
+			<-polls
+		}
+		select {
+		case <-polls:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	// change changes the value, and checks the subscription tells it.
+	change := func(events <-chan rbus.Event, v int32) {
+		t.Helper()
+		value.Store(v)
+		select {
+		case e := <-events:
+			if got, want := e.NewValue.String(), rbus.NewValue(v).String(); e.Type != rbus.EventValueChanged || got != want {
+				t.Fatalf("got %+v, want the value changed to %s", e, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event for the change to %d", v)
+		}
+	}
+
+	if polling() {
+		t.Fatal("polling without subscribers")
+	}
+
+	ctx := context.Background()
+	firstEvents := make(chan rbus.Event, 10)
+	firstSub, err := first.Subscribe(ctx, "Device.Test.X", func(e rbus.Event) { firstEvents <- e })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !polling() {
+		t.Fatal("not polling with a subscriber")
+	}
+	change(firstEvents, 1)
+
+	// The first subscriber leaving mid-stream leaves the polling to the
+	// second.
+	secondEvents := make(chan rbus.Event, 10)
+	secondSub, err := second.Subscribe(ctx, "Device.Test.X", func(e rbus.Event) { secondEvents <- e })
+	if err == nil {
+		err = firstSub.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(secondEvents, 2)
+
+	if err := secondSub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if polling() {
+		t.Fatal("still polling after the last subscriber left")
+	}
+}
@@ -0,0 +1,286 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultWatchBuffer is the number of updates a watch holds for a receiver
+// that falls behind, unless set with WatchWithBuffer.
+const defaultWatchBuffer = 16
+
+// Update is a change of the value of a watched element.
+type Update struct {
+	// Name is the name of the element.
+	Name string
+
+	// Old is the value before the change, and empty for the first update,
+	// which holds the value the element had when the watch began.
+	Old Value
+
+	// New is the value after the change.
+	New Value
+
+	// Time is when the change was received.
+	Time time.Time
+}
+
+// OverflowPolicy is what a watch does with an update when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest update held to make room, so
+	// the receiver always gets to the latest value.
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDropNewest discards the update, so the receiver gets the
+	// changes that came first.
+	OverflowDropNewest
+)
+
+// WatchOption is an option of a watch.
+type WatchOption interface {
+	apply(*watchConfig) error
+}
+
+type watchOptionFunc func(*watchConfig) error
+
+func (f watchOptionFunc) apply(cfg *watchConfig) error {
+	return f(cfg)
+}
+
+type watchConfig struct {
+	buffer   int
+	overflow OverflowPolicy
+	subOpts  []SubOption
+}
+
+// WatchWithBuffer sets the number of updates the watch holds for a receiver
+// that falls behind, which must be at least one.
+func WatchWithBuffer(n int) WatchOption {
+	return watchOptionFunc(func(cfg *watchConfig) error {
+		if n < 1 {
+			return fmt.Errorf("invalid watch buffer: %d", n)
+		}
+		cfg.buffer = n
+		return nil
+	})
+}
+
+// WatchWithOverflow sets what the watch does with an update when its buffer
+// is full.  The default is OverflowDropOldest.
+func WatchWithOverflow(policy OverflowPolicy) WatchOption {
+	return watchOptionFunc(func(cfg *watchConfig) error {
+		if policy != OverflowDropOldest && policy != OverflowDropNewest {
+			return fmt.Errorf("invalid overflow policy: %d", policy)
+		}
+		cfg.overflow = policy
+		return nil
+	})
+}
+
+// WatchWithSubOptions sets options of the subscription the watch makes, such
+// as SubWithInterval for a value that changes too often.
+func WatchWithSubOptions(opts ...SubOption) WatchOption {
+	return watchOptionFunc(func(cfg *watchConfig) error {
+		cfg.subOpts = append(cfg.subOpts, opts...)
+		return nil
+	})
+}
+
+// Watch subscribes to the changes of the named element and returns a channel
+// of its updates.  The first update holds the current value of the element,
+// and each following one a change of it.
+//
+// The element is subscribed to before its value is fetched, so no change is
+// missed in between; a change received before the value was fetched is
+// delivered only if the value doesn't already reflect it.  Updates that
+// leave the value as it was are not delivered.
+//
+// Calling stop, the context being done or the handle being closed ends the
+// watch: the element is unsubscribed from and the channel is closed.  stop
+// can be called more than once.
+func (h *Handle) Watch(ctx context.Context, name string, opts ...WatchOption) (<-chan Update, func(), error) {
+	cfg := watchConfig{
+		buffer:   defaultWatchBuffer,
+		overflow: OverflowDropOldest,
+	}
+	for _, opt := range opts {
+		if err := opt.apply(&cfg); err != nil {
+			return nil, nil, fmt.Errorf("watch '%s': %w", name, err)
+		}
+	}
+
+	w := watcher{
+		name:     name,
+		overflow: cfg.overflow,
+		updates:  make(chan Update, cfg.buffer),
+		done:     make(chan struct{}),
+	}
+
+	subOpts := append(cfg.subOpts, subOptionFunc(func(cfg *subConfig) error {
+		cfg.onClose = w.close
+		return nil
+	}))
+	sub, err := h.Subscribe(ctx, name, w.onEvent, subOpts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("watch '%s': %w", name, err)
+	}
+
+	val, err := h.Get(ctx, name)
+	if err != nil {
+		_ = sub.Close()
+		return nil, nil, fmt.Errorf("watch '%s': %w", name, err)
+	}
+	w.prime(val)
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			_ = sub.Close()
+			w.close()
+		})
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-w.done:
+		}
+	}()
+
+	return w.updates, stop, nil
+}
+
+// watcher turns the events of a subscription into the updates of a watch.
+type watcher struct {
+	name     string
+	overflow OverflowPolicy
+	updates  chan Update
+	done     chan struct{}
+
+	// m guards the fields below and the sends on updates, so none happens
+	// once it is closed.
+	m       sync.Mutex
+	primed  bool
+	closed  bool
+	last    Value
+	pending []Update
+}
+
+// onEvent handles an event of the subscription, holding the change back until
+// the watch is primed with the current value.
+func (w *watcher) onEvent(e Event) {
+	val, found := eventValue(e)
+	if !found {
+		return
+	}
+
+	name := e.Name
+	if name == "" {
+		name = w.name
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	u := Update{Name: name, New: val, Time: time.Now()}
+	if !w.primed {
+		w.pending = append(w.pending, u)
+		return
+	}
+	w.deliver(u)
+}
+
+// prime delivers the current value of the element, followed by the changes
+// received since subscribing that came after it.  A change that brought the
+// element to the current value, and all those before it, are already
+// reflected in the value.
+func (w *watcher) prime(val Value) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.primed = true
+	w.last = val
+	w.send(Update{Name: w.name, New: val, Time: time.Now()})
+
+	pending := w.pending
+	w.pending = nil
+	for i := len(pending) - 1; i >= 0; i-- {
+		if pending[i].New.Equal(val) {
+			pending = pending[i+1:]
+			break
+		}
+	}
+	for _, u := range pending {
+		w.deliver(u)
+	}
+}
+
+// deliver sends the change from the last value delivered, unless it leaves
+// the value as it was.
+func (w *watcher) deliver(u Update) {
+	if u.New.Equal(w.last) {
+		return
+	}
+	u.Old = w.last
+	w.last = u.New
+	w.send(u)
+}
+
+// send queues the update for the receiver without waiting, making room by the
+// overflow policy when the buffer is full.
+func (w *watcher) send(u Update) {
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.updates <- u:
+		return
+	default:
+	}
+
+	if w.overflow == OverflowDropNewest {
+		return
+	}
+
+	select {
+	case <-w.updates:
+	default:
+	}
+	select {
+	case w.updates <- u:
+	default:
+	}
+}
+
+// close closes the channel of updates, once.
+func (w *watcher) close() {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.updates)
+	close(w.done)
+}
+
+// eventValue returns the new value an event carries, found for the value
+// change and interval events.
+func eventValue(e Event) (Value, bool) {
+	for _, p := range e.Data {
+		if p.Name == "value" {
+			return p.Value, true
+		}
+	}
+	return Value{}, false
+}
@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package rbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/rbus-rdk/sdks/go/rbus/rtmessage"
+)
+
+// newWatcher creates a watcher of Device.Test.X with room for n updates.
+func newWatcher(n int, overflow OverflowPolicy) *watcher {
+	return &watcher{
+		name:     "Device.Test.X",
+		overflow: overflow,
+		updates:  make(chan Update, n),
+		done:     make(chan struct{}),
+	}
+}
+
+// change is the value change event of Device.Test.X to v.
+func change(v int32) Event {
+	return Event{
+		Name: "Device.Test.X",
+		Type: EventValueChanged,
+		Data: []Property{{Name: "value", Value: NewValue(v)}},
+	}
+}
+
+// received returns the updates held by the watcher as old->new pairs.
+func received(w *watcher) string {
+	var got []string
+	for {
+		select {
+		case u := <-w.updates:
+			got = append(got, fmt.Sprintf("%s->%s", u.Old, u.New))
+		default:
+			return fmt.Sprint(got)
+		}
+	}
+}
+
+func TestWatcherPrime(t *testing.T) {
+	tests := []struct {
+		desc    string
+		pending []int32
+		current int32
+		after   []int32
+		want    string
+	}{
+		{
+			desc:    "no change pending",
+			current: 1,
+			after:   []int32{2},
+			want:    "[->1 1->2]",
+		}, {
+			desc:    "change reflected by the value",
+			pending: []int32{2},
+			current: 2,
+			want:    "[->2]",
+		}, {
+			desc:    "change after the value",
+			pending: []int32{2},
+			current: 1,
+			want:    "[->1 1->2]",
+		}, {
+			desc:    "changes on both sides of the value",
+			pending: []int32{2, 3, 4},
+			current: 3,
+			after:   []int32{5},
+			want:    "[->3 3->4 4->5]",
+		}, {
+			desc:    "change back to the value",
+			pending: []int32{1, 2},
+			current: 1,
+			want:    "[->1 1->2]",
+		}, {
+			desc:    "change leaving the value",
+			current: 1,
+			after:   []int32{1},
+			want:    "[->1]",
+		},
+	}
+
+	for _, tc := range tests {
+		w := newWatcher(10, OverflowDropOldest)
+		for _, v := range tc.pending {
+			w.onEvent(change(v))
+		}
+		w.prime(NewValue(tc.current))
+		for _, v := range tc.after {
+			w.onEvent(change(v))
+		}
+
+		if got := received(w); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestWatcherOverflow(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   string
+	}{
+		{policy: OverflowDropOldest, want: "[3->4 4->5]"},
+		{policy: OverflowDropNewest, want: "[->1 1->2]"},
+	}
+
+	for _, tc := range tests {
+		w := newWatcher(2, tc.policy)
+		w.prime(NewValue(int32(1)))
+		for v := range int32(4) {
+			w.onEvent(change(v + 2))
+		}
+
+		if got := received(w); got != tc.want {
+			t.Errorf("policy %d: got %s, want %s", tc.policy, got, tc.want)
+		}
+	}
+}
+
+func TestWatchCloseOnce(t *testing.T) {
+	router, err := rtmessage.NewMemRouter("rbus-watch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+
+	open := func(component string) *Handle {
+		h, err := New(WithURL("mem://rbus-watch-test"), WithApplicationName(component))
+		if err == nil {
+			err = h.Open(context.Background())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = h.Close(context.Background()) })
+		return h
+	}
+	provider := open("provider")
+	consumer := open("consumer")
+
+	subscribers := make(chan int, 100)
+	err = provider.RegisterElement("Device.Test.X", ElementCallbacks{
+		GetHandler: func(context.Context, string) (Value, error) { return NewValue(int32(1)), nil },
+		SubscribeHandler: func(_ string, _ bool, count int, _ *Filter, _ time.Duration) error {
+			subscribers <- count
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 20 {
+		ctx, cancel := context.WithCancel(context.Background())
+		updates, stop, err := consumer.Watch(ctx, "Device.Test.X")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := <-subscribers; n != 1 {
+			t.Fatalf("got %d subscribers, want 1", n)
+		}
+
+		// Both end the watch at once, and stop again after.
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cancel()
+		}()
+		go func() {
+			defer wg.Done()
+			stop()
+		}()
+		wg.Wait()
+		stop()
+
+		var got int
+		for range updates {
+			got++
+		}
+		if got != 1 {
+			t.Fatalf("got %d updates, want the current value", got)
+		}
+		if n := <-subscribers; n != 0 {
+			t.Fatalf("got %d subscribers, want 0", n)
+		}
+	}
+}